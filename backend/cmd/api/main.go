@@ -5,12 +5,19 @@ package main
 import (
 	"context"
 	"log"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/cache"
 	"github.com/sharithg/civet/internal/config"
 	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/mail"
+	"github.com/sharithg/civet/internal/ratelimit"
+	"github.com/sharithg/civet/internal/receipt"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/internal/token"
 	"github.com/sharithg/civet/pkg/api"
 	"github.com/sharithg/civet/pkg/database"
 	"go.uber.org/zap"
@@ -22,12 +29,42 @@ func main() {
 
 	db := database.NewDatabase(config)
 	repo := repository.New(db)
-	storage := storage.NewStorage(config)
 	openai := genai.NewOpenAiClient(config)
 
 	ctx := context.Background()
 	logger, _ := zap.NewProduction()
 
+	storage, err := storage.Open(ctx, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	tokens, err := token.Open(ctx, config, repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	tokens.Start(ctx, 10*time.Minute)
+
+	mailer, err := mail.Open(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cache, err := cache.Open(config, repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cache.StartPurge(ctx, time.Hour)
+
+	limiter, err := ratelimit.Open(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	restoreWindow := time.Duration(config.RestoreWindowHours) * time.Hour
+	retention := time.Duration(config.ImageRetentionDays) * 24 * time.Hour
+	receipt.NewPurger(repo, storage, cache, restoreWindow, retention).Start(ctx, time.Hour)
+
 	gin.SetMode(gin.DebugMode)
 
 	appCtx := api.AppContext{
@@ -35,7 +72,11 @@ func main() {
 		Repo:    repo,
 		DB:      db,
 		Storage: storage,
+		Tokens:  tokens,
+		Mailer:  mailer,
 		OpenAI:  openai,
+		Cache:   cache,
+		Limiter: limiter,
 		Context: &ctx,
 		Config:  config,
 	}
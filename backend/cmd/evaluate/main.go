@@ -0,0 +1,153 @@
+package main
+
+// Scores receipt extraction against a labelled dataset: a directory of receipt
+// images, each with a <name>.json file holding the expected Receipt.
+//
+//	go run ./cmd/evaluate -dataset data/eval -out runs/baseline.json
+//	go run ./cmd/evaluate -dataset data/eval -model gpt-4.1-mini -compare runs/baseline.json
+//	go run ./cmd/evaluate -compare runs/baseline.json,runs/gpt-4.1-mini.json
+//
+// With -fixtures, API calls are replayed from (or, with -record, saved to) a
+// fixture directory, so a dataset can be re-scored offline.
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	vision "cloud.google.com/go/vision/v2/apiv1"
+	"github.com/joho/godotenv"
+	"github.com/openai/openai-go/option"
+	"github.com/sharithg/civet/internal/cloudvision"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/evaluate"
+	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/recorder"
+	googleoption "google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+func main() {
+	dataset := flag.String("dataset", "", "directory of receipt images and <name>.json labels")
+	model := flag.String("model", genai.DefaultModel, "OpenAI model to evaluate")
+	label := flag.String("label", "", "name for this run in the comparison table (default: the model)")
+	out := flag.String("out", "", "save the run as JSON to this path")
+	compare := flag.String("compare", "", "comma-separated saved runs to compare against")
+	fixtures := flag.String("fixtures", "", "replay API calls from this fixture directory")
+	record := flag.Bool("record", false, "with -fixtures, call the live APIs and save fixtures")
+	failures := flag.Bool("failures", false, "list examples that failed or got the total wrong")
+	flag.Parse()
+
+	if *dataset == "" && *compare == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var runs []evaluate.Run
+	for _, path := range splitPaths(*compare) {
+		run, err := evaluate.LoadRun(path)
+		if err != nil {
+			log.Fatalf("load run %s: %v", path, err)
+		}
+		runs = append(runs, run)
+	}
+
+	if *dataset != "" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("WARNING: Error loading .env file")
+		}
+
+		examples, err := evaluate.LoadDataset(*dataset)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		ctx := context.Background()
+		visionClient, openaiClient, err := clients(ctx, *fixtures, *record)
+		if err != nil {
+			log.Fatal(err)
+		}
+		openaiClient.Model = *model
+
+		if *label == "" {
+			*label = *model
+		}
+
+		log.Printf("evaluating %d receipts with %s", len(examples), *model)
+		run := evaluate.Evaluate(ctx, *label, examples, visionClient, openaiClient)
+
+		if *out != "" {
+			if err := evaluate.SaveRun(*out, run); err != nil {
+				log.Fatalf("save run: %v", err)
+			}
+		}
+		if *failures {
+			evaluate.WriteFailures(os.Stdout, run)
+			fmt.Println()
+		}
+		runs = append(runs, run)
+	}
+
+	if err := evaluate.WriteTable(os.Stdout, runs); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func clients(ctx context.Context, fixtures string, record bool) (*cloudvision.CloudVision, genai.OpenAi, error) {
+	credentials := os.Getenv("GOOGLE_CLOUD_VISION_CREDENTIALS")
+	apiKey := os.Getenv("OPENAI_API_KEY")
+
+	if fixtures == "" {
+		if apiKey == "" {
+			return nil, genai.OpenAi{}, fmt.Errorf("OPENAI_API_KEY is not set")
+		}
+		visionClient, err := cloudvision.NewCloudVision(ctx, credentials)
+		if err != nil {
+			return nil, genai.OpenAi{}, err
+		}
+		return visionClient, genai.NewOpenAiClient(&config.Config{OpenAIAPIKey: apiKey}), nil
+	}
+
+	mode := recorder.Replay
+	var visionBase http.RoundTripper
+	if record {
+		mode = recorder.Record
+
+		opts := []googleoption.ClientOption{googleoption.WithScopes(vision.DefaultAuthScopes()...)}
+		if credentials != "" {
+			opts = append(opts, googleoption.WithCredentialsFile(credentials))
+		}
+		base, err := htransport.NewTransport(ctx, http.DefaultTransport, opts...)
+		if err != nil {
+			return nil, genai.OpenAi{}, err
+		}
+		visionBase = base
+	} else if apiKey == "" {
+		apiKey = "replay"
+	}
+
+	visionClient, err := cloudvision.NewCloudVisionHTTP(ctx, recorder.New(fixtures, mode, visionBase).Client())
+	if err != nil {
+		return nil, genai.OpenAi{}, err
+	}
+	openaiClient := genai.NewOpenAiClient(
+		&config.Config{OpenAIAPIKey: apiKey},
+		option.WithHTTPClient(recorder.New(fixtures, mode, nil).Client()),
+		option.WithMaxRetries(0),
+	)
+	return visionClient, openaiClient, nil
+}
+
+func splitPaths(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
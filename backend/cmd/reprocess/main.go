@@ -0,0 +1,87 @@
+package main
+
+// Re-runs receipt extraction for receipts produced by an older prompt or
+// schema version. Prints the diff for each receipt and only saves with -apply.
+//
+//	go run ./cmd/reprocess -limit 20
+//	go run ./cmd/reprocess -receipt <id> -apply
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/cache"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/receipt"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/database"
+)
+
+func main() {
+	limit := flag.Int("limit", 10, "maximum number of outdated receipts to process")
+	receiptFlag := flag.String("receipt", "", "re-process a single receipt by id")
+	apply := flag.Bool("apply", false, "save the new extraction instead of only printing the diff")
+	flag.Parse()
+
+	config := config.LoadConfig()
+
+	db := database.NewDatabase(config)
+	repo := repository.New(db)
+	openai := genai.NewOpenAiClient(config)
+
+	cache, err := cache.Open(config, repo)
+	if err != nil {
+		log.Fatal(err)
+	}
+	reprocessor := receipt.NewReprocessor(db, repo, openai, cache)
+
+	ctx := context.Background()
+
+	var ids []uuid.UUID
+	if *receiptFlag != "" {
+		id, err := uuid.Parse(*receiptFlag)
+		if err != nil {
+			log.Fatalf("invalid receipt id: %v", err)
+		}
+		ids = append(ids, id)
+	} else {
+		outdated, err := reprocessor.Outdated(ctx, int32(*limit))
+		if err != nil {
+			log.Fatalf("list outdated receipts: %v", err)
+		}
+		for _, row := range outdated {
+			ids = append(ids, row.ID)
+		}
+	}
+
+	fmt.Printf("current prompt %s, schema %s\n", receipt.PromptVersion, receipt.SchemaVersion())
+
+	for _, id := range ids {
+		plan, err := reprocessor.Plan(ctx, id)
+		if err != nil {
+			fmt.Printf("\n%s: %v\n", id, err)
+			continue
+		}
+
+		fmt.Printf("\n%s (prompt %s, schema %s): %d changes\n", id, plan.FromPromptVersion, plan.FromSchemaVersion, len(plan.Changes))
+		for _, change := range plan.Changes {
+			fmt.Printf("  %s: %v -> %v\n", change.Field, change.Old, change.New)
+		}
+
+		if !*apply {
+			continue
+		}
+		if plan.SplitsRemoved > 0 {
+			fmt.Printf("  removing %d splits\n", plan.SplitsRemoved)
+		}
+		if err := reprocessor.Apply(ctx, plan); err != nil {
+			fmt.Printf("  apply failed: %v\n", err)
+			continue
+		}
+		fmt.Println("  applied")
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+// Reseals stored objects after the storage encryption key is rotated. Set
+// STORAGE_ENCRYPTION_KEY to the new key and STORAGE_ENCRYPTION_OLD_KEYS to the
+// previous ones, run this, then drop the old keys.
+//
+//	go run ./cmd/reseal
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/storage"
+)
+
+func main() {
+	config := config.LoadConfig()
+	ctx := context.Background()
+
+	store, err := storage.Open(ctx, config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encrypted, ok := store.(*storage.Encrypted)
+	if !ok {
+		log.Fatal("STORAGE_ENCRYPTION_KEY is not set, nothing to reseal")
+	}
+
+	n, err := encrypted.Reseal(ctx, config.ReceiptsBucket)
+	if err != nil {
+		log.Fatalf("reseal %s: %v", config.ReceiptsBucket, err)
+	}
+	fmt.Printf("resealed %d objects in %s\n", n, config.ReceiptsBucket)
+}
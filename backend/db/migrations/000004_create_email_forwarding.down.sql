@@ -0,0 +1 @@
+drop table email_forwarding_addresses;
\ No newline at end of file
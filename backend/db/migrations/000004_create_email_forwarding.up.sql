@@ -0,0 +1,8 @@
+create table email_forwarding_addresses (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null unique references users(id),
+    token varchar(64) not null unique,
+    outing_id uuid references outings(id),
+    created_at timestamp with time zone not null default now(),
+    updated_at timestamp with time zone not null default now()
+);
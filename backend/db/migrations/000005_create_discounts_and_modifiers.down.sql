@@ -0,0 +1,7 @@
+drop table discounts;
+
+alter table other_fees drop column kind,
+    drop column taxable;
+
+alter table order_items drop column taxable,
+    drop column parent_item_id;
@@ -0,0 +1,16 @@
+alter table order_items
+add column taxable boolean not null default true,
+    add column parent_item_id uuid references order_items(id) on delete cascade;
+
+alter table other_fees
+add column kind varchar(50) not null default 'fee',
+    add column taxable boolean not null default false;
+
+create table discounts (
+    id uuid primary key default gen_random_uuid(),
+    receipt_id uuid not null references receipts(id) on delete cascade,
+    order_item_id uuid references order_items(id) on delete cascade,
+    name varchar(255) not null,
+    amount numeric(10, 2) not null,
+    created_at timestamp with time zone not null default now()
+);
@@ -0,0 +1,2 @@
+alter table receipts drop column payment_card_last_four,
+    drop column tip_percentage_override;
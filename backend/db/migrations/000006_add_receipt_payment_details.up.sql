@@ -0,0 +1,3 @@
+alter table receipts
+add column payment_card_last_four varchar(4),
+    add column tip_percentage_override numeric(5, 2);
@@ -0,0 +1,6 @@
+alter table users drop column timezone;
+
+alter table outings drop column timezone;
+
+alter table receipts drop column opened_raw,
+    alter column opened type timestamp using opened at time zone 'UTC';
@@ -0,0 +1,9 @@
+alter table receipts
+alter column opened type timestamp with time zone using opened at time zone 'UTC',
+    add column opened_raw text;
+
+alter table outings
+add column timezone varchar(64);
+
+alter table users
+add column timezone varchar(64);
@@ -0,0 +1,5 @@
+alter table receipts drop column prompt_version,
+    drop column schema_version;
+
+alter table genai_cache drop column prompt_version,
+    drop column schema_version;
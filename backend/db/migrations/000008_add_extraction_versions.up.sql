@@ -0,0 +1,7 @@
+alter table genai_cache
+add column prompt_version varchar(32) not null default '1',
+    add column schema_version varchar(64) not null default '';
+
+alter table receipts
+add column prompt_version varchar(32) not null default '1',
+    add column schema_version varchar(64) not null default '';
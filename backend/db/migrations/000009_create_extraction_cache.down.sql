@@ -0,0 +1,37 @@
+create table cloud_vision_cache (
+    id uuid primary key default gen_random_uuid(),
+    image_hash varchar(255) not null,
+    response text[] not null,
+    created_at timestamp with time zone default now(),
+    updated_at timestamp with time zone default now()
+);
+
+create table genai_cache (
+    id uuid primary key default gen_random_uuid(),
+    image_hash varchar(255) not null,
+    response jsonb not null,
+    created_at timestamp with time zone default now(),
+    updated_at timestamp with time zone default now(),
+    prompt_version varchar(32) not null default '1',
+    schema_version varchar(64) not null default ''
+);
+
+insert into cloud_vision_cache (image_hash, response, created_at, updated_at)
+select input_hash,
+    array(select jsonb_array_elements_text(convert_from(response, 'UTF8')::jsonb)),
+    created_at,
+    updated_at
+from extraction_cache
+where stage = 'ocr';
+
+insert into genai_cache (image_hash, response, created_at, updated_at, prompt_version, schema_version)
+select input_hash,
+    convert_from(response, 'UTF8')::jsonb,
+    created_at,
+    updated_at,
+    split_part(prompt_version, '/', 1),
+    split_part(prompt_version, '/', 2)
+from extraction_cache
+where stage = 'structured';
+
+drop table extraction_cache;
@@ -0,0 +1,43 @@
+create table extraction_cache (
+    id uuid primary key default gen_random_uuid(),
+    stage varchar(32) not null,
+    provider varchar(64) not null,
+    model varchar(128) not null,
+    prompt_version varchar(128) not null default '',
+    input_hash varchar(255) not null,
+    response bytea not null,
+    expires_at timestamp with time zone,
+    created_at timestamp with time zone default now(),
+    updated_at timestamp with time zone default now(),
+    unique (stage, provider, model, prompt_version, input_hash)
+);
+
+create index extraction_cache_expires_at_idx on extraction_cache (expires_at)
+where expires_at is not null;
+
+insert into extraction_cache (stage, provider, model, prompt_version, input_hash, response, created_at, updated_at)
+select distinct on (image_hash) 'ocr',
+    'google',
+    'text_detection',
+    '',
+    image_hash,
+    convert_to(to_jsonb(response)::text, 'UTF8'),
+    created_at,
+    updated_at
+from cloud_vision_cache
+order by image_hash, created_at desc;
+
+insert into extraction_cache (stage, provider, model, prompt_version, input_hash, response, created_at, updated_at)
+select distinct on (image_hash, prompt_version, schema_version) 'structured',
+    'openai',
+    'gpt-4o-mini',
+    prompt_version || '/' || schema_version,
+    image_hash,
+    convert_to(response::text, 'UTF8'),
+    created_at,
+    updated_at
+from genai_cache
+order by image_hash, prompt_version, schema_version, created_at desc;
+
+drop table cloud_vision_cache;
+drop table genai_cache;
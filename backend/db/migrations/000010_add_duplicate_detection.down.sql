@@ -0,0 +1,5 @@
+drop table receipt_duplicates;
+
+drop index receipt_images_outing_hash_idx;
+
+alter table receipt_images drop column phash;
@@ -0,0 +1,15 @@
+alter table receipt_images
+add column phash bigint;
+
+create index receipt_images_outing_hash_idx on receipt_images (outing_id, hash);
+
+create table receipt_duplicates (
+    id uuid primary key default gen_random_uuid(),
+    receipt_id uuid not null references receipts(id) on delete cascade,
+    candidate_id uuid not null references receipts(id) on delete cascade,
+    reasons text [] not null,
+    status varchar(16) not null default 'pending',
+    created_at timestamp with time zone not null default now(),
+    updated_at timestamp with time zone not null default now(),
+    unique (receipt_id, candidate_id)
+);
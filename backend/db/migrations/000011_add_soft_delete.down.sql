@@ -0,0 +1,25 @@
+alter table email_forwarding_addresses drop constraint email_forwarding_addresses_outing_id_fkey,
+    add constraint email_forwarding_addresses_outing_id_fkey foreign key (outing_id) references outings(id);
+
+alter table receipt_images drop constraint receipt_images_outing_id_fkey,
+    add constraint receipt_images_outing_id_fkey foreign key (outing_id) references outings(id);
+
+alter table friends drop constraint friends_outing_id_fkey,
+    add constraint friends_outing_id_fkey foreign key (outing_id) references outings(id);
+
+alter table splits drop constraint splits_friend_id_fkey,
+    add constraint splits_friend_id_fkey foreign key (friend_id) references friends(id),
+    drop constraint splits_order_item_id_fkey,
+    add constraint splits_order_item_id_fkey foreign key (order_item_id) references order_items(id),
+    drop constraint splits_receipt_id_fkey,
+    add constraint splits_receipt_id_fkey foreign key (receipt_id) references receipts(id);
+
+drop index receipt_images_hash_idx;
+
+drop index receipts_deleted_at_idx;
+
+drop index outings_deleted_at_idx;
+
+alter table receipts drop column deleted_at;
+
+alter table outings drop column deleted_at;
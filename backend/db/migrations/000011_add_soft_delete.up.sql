@@ -0,0 +1,30 @@
+alter table outings
+add column deleted_at timestamp with time zone;
+
+alter table receipts
+add column deleted_at timestamp with time zone;
+
+create index outings_deleted_at_idx on outings (deleted_at)
+where deleted_at is not null;
+
+create index receipts_deleted_at_idx on receipts (deleted_at)
+where deleted_at is not null;
+
+create index receipt_images_hash_idx on receipt_images (hash);
+
+-- purging a receipt or outing removes everything that hangs off it
+alter table splits drop constraint splits_friend_id_fkey,
+    add constraint splits_friend_id_fkey foreign key (friend_id) references friends(id) on delete cascade,
+    drop constraint splits_order_item_id_fkey,
+    add constraint splits_order_item_id_fkey foreign key (order_item_id) references order_items(id) on delete cascade,
+    drop constraint splits_receipt_id_fkey,
+    add constraint splits_receipt_id_fkey foreign key (receipt_id) references receipts(id) on delete cascade;
+
+alter table friends drop constraint friends_outing_id_fkey,
+    add constraint friends_outing_id_fkey foreign key (outing_id) references outings(id) on delete cascade;
+
+alter table receipt_images drop constraint receipt_images_outing_id_fkey,
+    add constraint receipt_images_outing_id_fkey foreign key (outing_id) references outings(id) on delete cascade;
+
+alter table email_forwarding_addresses drop constraint email_forwarding_addresses_outing_id_fkey,
+    add constraint email_forwarding_addresses_outing_id_fkey foreign key (outing_id) references outings(id) on delete set null;
@@ -0,0 +1,6 @@
+drop index outings_status_idx;
+
+alter table outings drop constraint outings_status_check;
+
+alter table outings drop column location,
+    drop column date;
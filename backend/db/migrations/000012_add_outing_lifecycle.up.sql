@@ -0,0 +1,15 @@
+alter table outings
+add column date date,
+    add column location varchar(255) not null default '';
+
+update outings
+set status = 'active'
+where status not in ('draft', 'active', 'locked', 'settled', 'archived');
+
+alter table outings
+add constraint outings_status_check check (
+        status in ('draft', 'active', 'locked', 'settled', 'archived')
+    );
+
+create index outings_status_idx on outings (status)
+where deleted_at is null;
@@ -0,0 +1,9 @@
+drop index outings_created_at_id_idx;
+
+drop index receipts_created_at_id_idx;
+
+drop index receipts_restaurant_search_idx;
+
+drop index order_items_name_search_idx;
+
+drop index receipt_images_raw_text_search_idx;
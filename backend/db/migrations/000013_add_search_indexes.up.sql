@@ -0,0 +1,9 @@
+create index receipt_images_raw_text_search_idx on receipt_images using gin (to_tsvector('english', raw_text));
+
+create index order_items_name_search_idx on order_items using gin (to_tsvector('english', name));
+
+create index receipts_restaurant_search_idx on receipts using gin (to_tsvector('english', restaurant));
+
+create index receipts_created_at_id_idx on receipts (created_at desc, id desc);
+
+create index outings_created_at_id_idx on outings (created_at desc, id desc);
@@ -0,0 +1,2 @@
+alter table receipt_images drop column thumbnail_key,
+    drop column medium_key;
@@ -0,0 +1,5 @@
+-- resized copies generated on upload, null when the original is already
+-- small enough or could not be decoded
+alter table receipt_images
+add column thumbnail_key varchar(255),
+    add column medium_key varchar(255);
@@ -0,0 +1,4 @@
+drop index receipt_images_unredacted_idx;
+
+alter table receipt_images drop column original_deleted_at,
+    drop column raw_text_redacted;
@@ -0,0 +1,14 @@
+-- set once the original photo (and its medium copy) has been removed by the
+-- retention policy; the extracted receipt and the thumbnail are kept
+alter table receipt_images
+add column original_deleted_at timestamp with time zone,
+    add column raw_text_redacted boolean not null default false;
+
+-- text saved from now on is redacted before insert, older rows and their
+-- cached ocr output are redacted in the background
+alter table receipt_images
+alter column raw_text_redacted
+set default true;
+
+create index receipt_images_unredacted_idx on receipt_images (id)
+where not raw_text_redacted;
@@ -0,0 +1,19 @@
+-- one row per signed in device. refresh_token_id is the jti of the only
+-- refresh token that may be used next; it changes on every refresh, so
+-- presenting an older token from the same session means it was replayed.
+create table sessions (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    refresh_token_id uuid not null,
+    platform varchar(16) not null default '',
+    user_agent text not null default '',
+    ip_address varchar(64) not null default '',
+    created_at timestamp with time zone not null default now(),
+    last_used_at timestamp with time zone not null default now(),
+    expires_at timestamp with time zone not null,
+    revoked_at timestamp with time zone,
+    revoked_reason varchar(16)
+);
+
+create index sessions_user_id_idx on sessions (user_id)
+where revoked_at is null;
@@ -0,0 +1 @@
+drop table signing_keys;
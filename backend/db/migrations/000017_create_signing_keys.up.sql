@@ -0,0 +1,14 @@
+-- keys used to sign access and refresh tokens. A key is published in the
+-- JWKS from creation, used for signing from activates_at until the next key
+-- activates, and kept for verification until retires_at.
+create table signing_keys (
+    kid varchar(64) primary key,
+    algorithm varchar(16) not null,
+    -- PKCS #8, sealed with a key derived from JWT_SECRET
+    private_key bytea not null,
+    -- PKIX
+    public_key bytea not null,
+    created_at timestamp with time zone not null default now(),
+    activates_at timestamp with time zone not null,
+    retires_at timestamp with time zone not null
+);
@@ -0,0 +1,10 @@
+drop index users_verified_email_idx;
+
+alter table users
+add constraint users_email_key unique (email);
+
+drop table auth_challenges;
+
+drop table webauthn_credentials;
+
+drop table user_identities;
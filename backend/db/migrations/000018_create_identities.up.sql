@@ -0,0 +1,59 @@
+-- a user can sign in with several providers. subject is the provider's id
+-- for the account: Google and Apple's sub, or the lowercased address for
+-- email. users.sub stays the stable subject of Civet's own tokens; it is the
+-- Google sub for accounts created before identities existed.
+create table user_identities (
+    id uuid primary key default gen_random_uuid(),
+    user_id uuid not null references users(id) on delete cascade,
+    provider varchar(16) not null,
+    subject varchar(255) not null,
+    email varchar(255) not null default '',
+    created_at timestamp with time zone not null default now(),
+    last_used_at timestamp with time zone not null default now(),
+    unique (provider, subject)
+);
+
+create index user_identities_user_id_idx on user_identities (user_id);
+
+insert into user_identities (user_id, provider, subject, email)
+select id,
+    'google',
+    sub,
+    email
+from users;
+
+-- passkeys, keyed by the authenticator's credential id
+create table webauthn_credentials (
+    id bytea primary key,
+    user_id uuid not null references users(id) on delete cascade,
+    public_key bytea not null,
+    sign_count bigint not null default 0,
+    transports text [] not null default '{}',
+    name varchar(255) not null default '',
+    created_at timestamp with time zone not null default now(),
+    last_used_at timestamp with time zone
+);
+
+create index webauthn_credentials_user_id_idx on webauthn_credentials (user_id);
+
+-- single use secrets for magic links and passkey ceremonies. only a hash of
+-- the secret is stored.
+create table auth_challenges (
+    token_hash varchar(64) primary key,
+    kind varchar(32) not null,
+    email varchar(255) not null default '',
+    user_id uuid references users(id) on delete cascade,
+    created_at timestamp with time zone not null default now(),
+    expires_at timestamp with time zone not null
+);
+
+create index auth_challenges_expires_at_idx on auth_challenges (expires_at);
+
+-- only a verified address identifies a user. passkey and Apple accounts can
+-- have no email at all, and an unverified one may be someone else's, so
+-- neither can be held to a unique email
+alter table users drop constraint users_email_key;
+
+create unique index users_verified_email_idx on users (lower(email))
+where email_verified
+    and email <> '';
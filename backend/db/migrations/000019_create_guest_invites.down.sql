@@ -0,0 +1 @@
+drop table guest_invites;
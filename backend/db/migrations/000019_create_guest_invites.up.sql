@@ -0,0 +1,13 @@
+-- share links that let someone act as one friend of an outing without an
+-- account. only a hash of the link's secret is stored.
+create table guest_invites (
+    id uuid primary key default gen_random_uuid(),
+    friend_id uuid not null references friends(id) on delete cascade,
+    token_hash varchar(64) not null unique,
+    created_by uuid not null references users(id) on delete cascade,
+    created_at timestamp with time zone not null default now(),
+    expires_at timestamp with time zone not null,
+    revoked_at timestamp with time zone
+);
+
+create index guest_invites_friend_id_idx on guest_invites (friend_id);
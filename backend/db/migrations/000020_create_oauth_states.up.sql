@@ -0,0 +1,13 @@
+create table oauth_states (
+    state_hash varchar(64) primary key,
+    code_hash varchar(64) unique,
+    redirect_uri text not null,
+    client_state text not null,
+    code_challenge varchar(128) not null default '',
+    code_challenge_method varchar(8) not null default '',
+    provider_verifier varchar(128) not null,
+    created_at timestamp with time zone not null default now(),
+    expires_at timestamp with time zone not null
+);
+
+create index oauth_states_expires_at_idx on oauth_states (expires_at);
@@ -0,0 +1,9 @@
+alter table users
+    drop column name,
+    drop column avatar_key,
+    drop column default_currency,
+    drop column default_tip_percentage,
+    drop column venmo_handle,
+    drop column paypal_handle,
+    drop column iban,
+    drop column deleted_at;
@@ -0,0 +1,9 @@
+alter table users
+    add column name varchar(255) not null default '',
+    add column avatar_key text not null default '',
+    add column default_currency varchar(3) not null default 'USD',
+    add column default_tip_percentage double precision,
+    add column venmo_handle varchar(64) not null default '',
+    add column paypal_handle varchar(64) not null default '',
+    add column iban varchar(34) not null default '',
+    add column deleted_at timestamp with time zone;
@@ -0,0 +1 @@
+drop table extraction_usage;
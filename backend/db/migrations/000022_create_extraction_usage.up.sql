@@ -0,0 +1,7 @@
+create table extraction_usage (
+    user_id uuid not null references users(id) on delete cascade,
+    month date not null,
+    extractions integer not null default 0,
+    updated_at timestamp with time zone not null default now(),
+    primary key (user_id, month)
+);
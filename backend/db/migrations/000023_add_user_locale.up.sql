@@ -0,0 +1,4 @@
+-- the BCP 47 locale the user reads dates in, for receipts from places that
+-- print them either way
+alter table users
+    add column locale varchar(35) not null default '';
@@ -0,0 +1,210 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// Stages of the extraction pipeline that are cached.
+const (
+	StageOCR        = "ocr"
+	StageStructured = "structured"
+)
+
+// Key identifies a cached result. The same input run through a different
+// provider, model or prompt version is a separate entry.
+type Key struct {
+	Stage         string
+	Provider      string
+	Model         string
+	PromptVersion string
+	InputHash     string
+}
+
+func (k Key) String() string {
+	return fmt.Sprintf("%s:%s:%s:%s:%s", k.Stage, k.Provider, k.Model, k.PromptVersion, k.InputHash)
+}
+
+// Backend stores cache entries. Set must overwrite an existing entry for the
+// same key so concurrent writers of the same result never conflict.
+type Backend interface {
+	Get(ctx context.Context, key Key) ([]byte, bool, error)
+	Set(ctx context.Context, key Key, value []byte, ttl time.Duration) error
+	// Purge removes expired entries, for backends that do not expire them on their own.
+	Purge(ctx context.Context) (int64, error)
+	// Forget removes every entry computed from inputHash, across stages and versions.
+	Forget(ctx context.Context, inputHash string) (int64, error)
+}
+
+// Stats counts lookups for a single stage.
+type Stats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Errors uint64 `json:"errors"`
+}
+
+type counters struct {
+	hits   atomic.Uint64
+	misses atomic.Uint64
+	errors atomic.Uint64
+}
+
+type Cache struct {
+	backend Backend
+	ttls    map[string]time.Duration
+	stats   sync.Map // stage -> *counters
+}
+
+// New wraps a backend. ttls maps a stage to how long its entries live; stages
+// without a ttl never expire.
+func New(backend Backend, ttls map[string]time.Duration) *Cache {
+	return &Cache{backend: backend, ttls: ttls}
+}
+
+// Open builds the cache configured by CACHE_BACKEND.
+func Open(config *config.Config, repo *repository.Queries) (*Cache, error) {
+	var backend Backend
+	switch config.CacheBackend {
+	case "postgres", "":
+		backend = NewPostgres(repo)
+	case "filesystem":
+		fs, err := NewFilesystem(config.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		backend = fs
+	case "redis":
+		redis, err := NewRedis(config.RedisURL)
+		if err != nil {
+			return nil, err
+		}
+		backend = redis
+	default:
+		return nil, fmt.Errorf("unknown cache backend %q", config.CacheBackend)
+	}
+
+	return New(backend, map[string]time.Duration{
+		StageOCR:        time.Duration(config.CacheOCRTTLSeconds) * time.Second,
+		StageStructured: time.Duration(config.CacheStructuredTTLSeconds) * time.Second,
+	}), nil
+}
+
+func (c *Cache) counters(stage string) *counters {
+	v, _ := c.stats.LoadOrStore(stage, &counters{})
+	return v.(*counters)
+}
+
+// Get returns the cached value for key. Backend errors are logged and treated
+// as a miss so a cache outage never fails an extraction.
+func (c *Cache) Get(ctx context.Context, key Key) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	counters := c.counters(key.Stage)
+	value, ok, err := c.backend.Get(ctx, key)
+	if err != nil {
+		counters.errors.Add(1)
+		log.Printf("[WARN] cache get %s: %v", key, err)
+		return nil, false
+	}
+	if !ok {
+		counters.misses.Add(1)
+		return nil, false
+	}
+	counters.hits.Add(1)
+	return value, true
+}
+
+func (c *Cache) Set(ctx context.Context, key Key, value []byte) error {
+	if c == nil {
+		return nil
+	}
+
+	if err := c.backend.Set(ctx, key, value, c.ttls[key.Stage]); err != nil {
+		c.counters(key.Stage).errors.Add(1)
+		return fmt.Errorf("cache set %s: %w", key, err)
+	}
+	return nil
+}
+
+// Forget drops everything cached for an input, used once nothing references
+// the content any more.
+func (c *Cache) Forget(ctx context.Context, inputHash string) (int64, error) {
+	if c == nil {
+		return 0, nil
+	}
+	return c.backend.Forget(ctx, inputHash)
+}
+
+// Stats returns hit/miss counts per stage since startup.
+func (c *Cache) Stats() map[string]Stats {
+	out := map[string]Stats{}
+	if c == nil {
+		return out
+	}
+	c.stats.Range(func(k, v any) bool {
+		counters := v.(*counters)
+		out[k.(string)] = Stats{
+			Hits:   counters.hits.Load(),
+			Misses: counters.misses.Load(),
+			Errors: counters.errors.Load(),
+		}
+		return true
+	})
+	return out
+}
+
+// StartPurge removes expired entries every interval until ctx is done.
+func (c *Cache) StartPurge(ctx context.Context, interval time.Duration) {
+	if c == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if n, err := c.backend.Purge(ctx); err != nil {
+					log.Printf("[WARN] cache purge: %v", err)
+				} else if n > 0 {
+					log.Printf("cache purge removed %d entries", n)
+				}
+			}
+		}
+	}()
+}
+
+// GetJSON is Get followed by unmarshaling into T. A value that no longer
+// unmarshals is treated as a miss.
+func GetJSON[T any](ctx context.Context, c *Cache, key Key) (T, bool) {
+	var out T
+	raw, ok := c.Get(ctx, key)
+	if !ok {
+		return out, false
+	}
+	if err := json.Unmarshal(raw, &out); err != nil {
+		log.Printf("[WARN] cache decode %s: %v", key, err)
+		return out, false
+	}
+	return out, true
+}
+
+func SetJSON(ctx context.Context, c *Cache, key Key, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, raw)
+}
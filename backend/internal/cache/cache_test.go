@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// memoryBackend records what the Cache asks of its backend.
+type memoryBackend struct {
+	entries map[Key][]byte
+	ttls    map[Key]time.Duration
+	err     error
+}
+
+func newMemoryBackend() *memoryBackend {
+	return &memoryBackend{entries: map[Key][]byte{}, ttls: map[Key]time.Duration{}}
+}
+
+func (m *memoryBackend) Get(ctx context.Context, key Key) ([]byte, bool, error) {
+	if m.err != nil {
+		return nil, false, m.err
+	}
+	value, ok := m.entries[key]
+	return value, ok, nil
+}
+
+func (m *memoryBackend) Set(ctx context.Context, key Key, value []byte, ttl time.Duration) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.entries[key] = value
+	m.ttls[key] = ttl
+	return nil
+}
+
+func (m *memoryBackend) Purge(ctx context.Context) (int64, error) { return 0, m.err }
+
+func (m *memoryBackend) Forget(ctx context.Context, inputHash string) (int64, error) {
+	var n int64
+	for key := range m.entries {
+		if key.InputHash == inputHash {
+			delete(m.entries, key)
+			n++
+		}
+	}
+	return n, m.err
+}
+
+func testKey(stage, input string) Key {
+	return Key{Stage: stage, Provider: "openai", Model: "gpt-4o", PromptVersion: "v1", InputHash: input}
+}
+
+func TestKeyString(t *testing.T) {
+	if got := testKey(StageOCR, "abc").String(); got != "ocr:openai:gpt-4o:v1:abc" {
+		t.Errorf("Key.String() = %q", got)
+	}
+}
+
+func TestCacheStats(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	c := New(backend, map[string]time.Duration{StageOCR: time.Hour})
+
+	ocr, structured := testKey(StageOCR, "a"), testKey(StageStructured, "a")
+	if _, ok := c.Get(ctx, ocr); ok {
+		t.Fatal("hit on an empty cache")
+	}
+	if err := c.Set(ctx, ocr, []byte("lines")); err != nil {
+		t.Fatal(err)
+	}
+	if value, ok := c.Get(ctx, ocr); !ok || string(value) != "lines" {
+		t.Fatalf("Get = %q, %v", value, ok)
+	}
+	c.Get(ctx, ocr)
+	c.Get(ctx, structured)
+
+	backend.err = errors.New("connection refused")
+	if _, ok := c.Get(ctx, structured); ok {
+		t.Error("a backend error was a hit")
+	}
+	if err := c.Set(ctx, structured, []byte("{}")); err == nil {
+		t.Error("Set hid a backend error")
+	}
+
+	want := map[string]Stats{
+		StageOCR:        {Hits: 2, Misses: 1},
+		StageStructured: {Misses: 1, Errors: 2},
+	}
+	got := c.Stats()
+	if len(got) != len(want) {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	for stage, w := range want {
+		if got[stage] != w {
+			t.Errorf("Stats[%s] = %+v, want %+v", stage, got[stage], w)
+		}
+	}
+}
+
+func TestCacheStageTTL(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	c := New(backend, map[string]time.Duration{StageOCR: time.Hour})
+
+	for _, key := range []Key{testKey(StageOCR, "a"), testKey(StageStructured, "a")} {
+		if err := c.Set(ctx, key, []byte("v")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := backend.ttls[testKey(StageOCR, "a")]; got != time.Hour {
+		t.Errorf("ocr ttl = %s, want 1h", got)
+	}
+	if got := backend.ttls[testKey(StageStructured, "a")]; got != 0 {
+		t.Errorf("structured ttl = %s, want none", got)
+	}
+}
+
+func TestNilCache(t *testing.T) {
+	ctx := context.Background()
+	var c *Cache
+	if _, ok := c.Get(ctx, testKey(StageOCR, "a")); ok {
+		t.Error("nil cache hit")
+	}
+	if err := c.Set(ctx, testKey(StageOCR, "a"), []byte("v")); err != nil {
+		t.Error(err)
+	}
+	if n, err := c.Forget(ctx, "a"); n != 0 || err != nil {
+		t.Errorf("Forget = %d, %v", n, err)
+	}
+	if len(c.Stats()) != 0 {
+		t.Error("nil cache has stats")
+	}
+	c.StartPurge(ctx, time.Hour)
+}
+
+func TestJSON(t *testing.T) {
+	ctx := context.Background()
+	backend := newMemoryBackend()
+	c := New(backend, nil)
+
+	type lines struct {
+		Lines []string `json:"lines"`
+	}
+	key := testKey(StageOCR, "a")
+	if err := SetJSON(ctx, c, key, lines{Lines: []string{"TOTAL 12.00"}}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := GetJSON[lines](ctx, c, key)
+	if !ok || len(got.Lines) != 1 || got.Lines[0] != "TOTAL 12.00" {
+		t.Errorf("GetJSON = %+v, %v", got, ok)
+	}
+
+	backend.entries[key] = []byte(`{"lines": "not a list"}`)
+	if got, ok := GetJSON[lines](ctx, c, key); ok {
+		t.Errorf("GetJSON of a stale shape = %+v, want a miss", got)
+	}
+	if _, ok := GetJSON[lines](ctx, c, testKey(StageOCR, "b")); ok {
+		t.Error("GetJSON hit a missing key")
+	}
+}
@@ -0,0 +1,152 @@
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Filesystem stores each entry as a file under dir/<stage>/<input>/, where
+// <input> is derived from the input hash so all entries for one input can be
+// removed together. The first line of the file holds the expiry as a unix
+// timestamp, 0 meaning never.
+type Filesystem struct {
+	dir string
+}
+
+func NewFilesystem(dir string) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Filesystem{dir: dir}, nil
+}
+
+func (f *Filesystem) path(key Key) string {
+	sum := sha256.Sum256([]byte(key.String()))
+	return filepath.Join(f.dir, key.Stage, inputDir(key.InputHash), hex.EncodeToString(sum[:]))
+}
+
+func inputDir(inputHash string) string {
+	sum := sha256.Sum256([]byte(inputHash))
+	return hex.EncodeToString(sum[:16])
+}
+
+func (f *Filesystem) Get(ctx context.Context, key Key) ([]byte, bool, error) {
+	raw, err := os.ReadFile(f.path(key))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	expired, value, err := decodeEntry(raw)
+	if err != nil {
+		return nil, false, err
+	}
+	if expired {
+		return nil, false, nil
+	}
+	return value, true, nil
+}
+
+// Set writes to a temporary file and renames it into place, so readers never
+// see a partial entry and concurrent writers of the same key do not interleave.
+func (f *Filesystem) Set(ctx context.Context, key Key, value []byte, ttl time.Duration) error {
+	path := f.path(key)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+
+	var expiresAt int64
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).Unix()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	fmt.Fprintf(w, "%d\n", expiresAt)
+	w.Write(value)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *Filesystem) Purge(ctx context.Context) (int64, error) {
+	var removed int64
+	err := filepath.WalkDir(f.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if expired, _, err := decodeEntry(raw); err == nil && expired {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			removed++
+		}
+		return ctx.Err()
+	})
+	return removed, err
+}
+
+func (f *Filesystem) Forget(ctx context.Context, inputHash string) (int64, error) {
+	stages, err := os.ReadDir(f.dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int64
+	for _, stage := range stages {
+		if !stage.IsDir() {
+			continue
+		}
+		dir := filepath.Join(f.dir, stage.Name(), inputDir(inputHash))
+		entries, err := os.ReadDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return removed, err
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, err
+		}
+		removed += int64(len(entries))
+	}
+	return removed, nil
+}
+
+func decodeEntry(raw []byte) (expired bool, value []byte, err error) {
+	header, value, ok := bytes.Cut(raw, []byte("\n"))
+	if !ok {
+		return false, nil, errors.New("malformed cache entry")
+	}
+	expiresAt, err := strconv.ParseInt(string(header), 10, 64)
+	if err != nil {
+		return false, nil, fmt.Errorf("malformed cache entry: %w", err)
+	}
+	return expiresAt != 0 && time.Now().Unix() >= expiresAt, value, nil
+}
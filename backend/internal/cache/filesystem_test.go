@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestFilesystem(t *testing.T) *Filesystem {
+	t.Helper()
+	f, err := NewFilesystem(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return f
+}
+
+func TestFilesystemGetSet(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFilesystem(t)
+	key := testKey(StageOCR, "a")
+
+	if _, ok, err := f.Get(ctx, key); ok || err != nil {
+		t.Fatalf("Get on an empty cache = %v, %v", ok, err)
+	}
+	for _, value := range []string{"first\nwith a newline", "second", ""} {
+		if err := f.Set(ctx, key, []byte(value), time.Hour); err != nil {
+			t.Fatal(err)
+		}
+		got, ok, err := f.Get(ctx, key)
+		if err != nil || !ok || string(got) != value {
+			t.Errorf("Get = %q, %v, %v, want %q", got, ok, err, value)
+		}
+	}
+
+	other := key
+	other.PromptVersion = "v2"
+	if _, ok, _ := f.Get(ctx, other); ok {
+		t.Error("another prompt version shares the entry")
+	}
+}
+
+func TestFilesystemExpiry(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFilesystem(t)
+
+	tests := []struct {
+		name string
+		ttl  time.Duration
+		want bool
+	}{
+		{"no ttl", 0, true},
+		{"future", time.Hour, true},
+		{"expired", time.Nanosecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key := testKey(StageOCR, tt.name)
+			if err := f.Set(ctx, key, []byte("v"), tt.ttl); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok, err := f.Get(ctx, key); ok != tt.want || err != nil {
+				t.Errorf("Get = %v, %v, want %v", ok, err, tt.want)
+			}
+		})
+	}
+
+	n, err := f.Purge(ctx)
+	if err != nil || n != 1 {
+		t.Errorf("Purge = %d, %v, want 1", n, err)
+	}
+	if n, err := f.Purge(ctx); err != nil || n != 0 {
+		t.Errorf("second Purge = %d, %v, want 0", n, err)
+	}
+	for _, name := range []string{"no ttl", "future"} {
+		if _, ok, _ := f.Get(ctx, testKey(StageOCR, name)); !ok {
+			t.Errorf("Purge removed the %s entry", name)
+		}
+	}
+}
+
+func TestFilesystemForget(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFilesystem(t)
+
+	keys := []Key{
+		testKey(StageOCR, "a"),
+		testKey(StageStructured, "a"),
+		{Stage: StageStructured, Provider: "gemini", Model: "flash", PromptVersion: "v3", InputHash: "a"},
+		testKey(StageOCR, "b"),
+	}
+	for _, key := range keys {
+		if err := f.Set(ctx, key, []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := f.Forget(ctx, "a")
+	if err != nil || n != 3 {
+		t.Errorf("Forget = %d, %v, want 3", n, err)
+	}
+	for _, key := range keys[:3] {
+		if _, ok, _ := f.Get(ctx, key); ok {
+			t.Errorf("%s survived Forget", key)
+		}
+	}
+	if _, ok, _ := f.Get(ctx, keys[3]); !ok {
+		t.Error("Forget removed another input's entry")
+	}
+	if n, err := f.Forget(ctx, "missing"); err != nil || n != 0 {
+		t.Errorf("Forget of an unknown input = %d, %v", n, err)
+	}
+}
+
+func TestFilesystemMalformedEntry(t *testing.T) {
+	ctx := context.Background()
+	f := newTestFilesystem(t)
+	key := testKey(StageOCR, "a")
+	if err := f.Set(ctx, key, []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, raw := range []string{"no header", "soon\nv"} {
+		if err := os.WriteFile(f.path(key), []byte(raw), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok, err := f.Get(ctx, key); ok || err == nil {
+			t.Errorf("Get of %q = %v, %v, want an error", raw, ok, err)
+		}
+		if n, err := f.Purge(ctx); n != 0 || err != nil {
+			t.Errorf("Purge with %q = %d, %v, want it skipped", raw, n, err)
+		}
+	}
+}
+
+func TestDecodeEntry(t *testing.T) {
+	now := time.Now().Unix()
+	tests := []struct {
+		raw         string
+		wantExpired bool
+		wantValue   string
+		wantErr     bool
+	}{
+		{"0\nvalue", false, "value", false},
+		{"0\n", false, "", false},
+		{strconv.FormatInt(now+60, 10) + "\nvalue", false, "value", false},
+		{strconv.FormatInt(now-60, 10) + "\nvalue", true, "value", false},
+		{"0", false, "", true},
+		{"x\nvalue", false, "", true},
+		{"", false, "", true},
+	}
+	for _, tt := range tests {
+		expired, value, err := decodeEntry([]byte(tt.raw))
+		if (err != nil) != tt.wantErr {
+			t.Errorf("decodeEntry(%q) err = %v", tt.raw, err)
+			continue
+		}
+		if expired != tt.wantExpired || string(value) != tt.wantValue {
+			t.Errorf("decodeEntry(%q) = %v, %q", tt.raw, expired, value)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// Postgres stores entries in the extraction_cache table. The table has a unique
+// constraint on the key, and writes are upserts.
+type Postgres struct {
+	repo *repository.Queries
+}
+
+func NewPostgres(repo *repository.Queries) *Postgres {
+	return &Postgres{repo: repo}
+}
+
+func (p *Postgres) Get(ctx context.Context, key Key) ([]byte, bool, error) {
+	value, err := p.repo.GetCacheEntry(ctx, repository.GetCacheEntryParams{
+		Stage:         key.Stage,
+		Provider:      key.Provider,
+		Model:         key.Model,
+		PromptVersion: key.PromptVersion,
+		InputHash:     key.InputHash,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (p *Postgres) Set(ctx context.Context, key Key, value []byte, ttl time.Duration) error {
+	var expiresAt pgtype.Timestamptz
+	if ttl > 0 {
+		expiresAt = pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true}
+	}
+
+	return p.repo.UpsertCacheEntry(ctx, repository.UpsertCacheEntryParams{
+		Stage:         key.Stage,
+		Provider:      key.Provider,
+		Model:         key.Model,
+		PromptVersion: key.PromptVersion,
+		InputHash:     key.InputHash,
+		Response:      value,
+		ExpiresAt:     expiresAt,
+	})
+}
+
+func (p *Postgres) Purge(ctx context.Context) (int64, error) {
+	return p.repo.DeleteExpiredCacheEntries(ctx)
+}
+
+func (p *Postgres) Forget(ctx context.Context, inputHash string) (int64, error) {
+	return p.repo.DeleteCacheEntriesForInput(ctx, inputHash)
+}
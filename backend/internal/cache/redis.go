@@ -0,0 +1,230 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const redisKeyPrefix = "civet:cache:"
+
+// Redis stores entries with SET ... PX so Redis expires them itself. It speaks
+// just enough of the RESP protocol for GET/SET over a single connection.
+type Redis struct {
+	addr     string
+	password string
+	db       int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// NewRedis connects to a redis://[:password@]host:port[/db] URL.
+func NewRedis(rawURL string) (*Redis, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse redis url: %w", err)
+	}
+	if u.Scheme != "redis" {
+		return nil, fmt.Errorf("unsupported redis url scheme %q", u.Scheme)
+	}
+
+	r := &Redis{addr: u.Host}
+	if password, ok := u.User.Password(); ok {
+		r.password = password
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if r.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.connect(context.Background()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Redis) connect(ctx context.Context) error {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", r.addr)
+	if err != nil {
+		return fmt.Errorf("connect to redis: %w", err)
+	}
+	r.conn = conn
+	r.reader = bufio.NewReader(conn)
+
+	if r.password != "" {
+		if _, err := r.roundTrip(ctx, "AUTH", r.password); err != nil {
+			r.close()
+			return fmt.Errorf("redis auth: %w", err)
+		}
+	}
+	if r.db != 0 {
+		if _, err := r.roundTrip(ctx, "SELECT", strconv.Itoa(r.db)); err != nil {
+			r.close()
+			return fmt.Errorf("redis select: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Redis) close() {
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn = nil
+	r.reader = nil
+}
+
+// Do runs a command that returns a simple, integer or bulk reply, for other
+// users of Redis like the rate limiter.
+func (r *Redis) Do(ctx context.Context, args ...string) ([]byte, error) {
+	return r.do(ctx, args...)
+}
+
+// do runs a command, reconnecting once if the connection was dropped.
+func (r *Redis) do(ctx context.Context, args ...string) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.conn == nil {
+		if err := r.connect(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := r.roundTrip(ctx, args...)
+	var netErr net.Error
+	if errors.Is(err, io.EOF) || errors.As(err, &netErr) {
+		r.close()
+		if err := r.connect(ctx); err != nil {
+			return nil, err
+		}
+		reply, err = r.roundTrip(ctx, args...)
+	}
+
+	// Anything other than a reply from the server leaves the connection in an
+	// unknown state, so drop it and reconnect on the next command.
+	var replyErr redisError
+	if err != nil && !errors.Is(err, errRedisNil) && !errors.As(err, &replyErr) {
+		r.close()
+	}
+	return reply, err
+}
+
+func (r *Redis) roundTrip(ctx context.Context, args ...string) ([]byte, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		r.conn.SetDeadline(deadline)
+	} else {
+		r.conn.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(r.conn, b.String()); err != nil {
+		return nil, err
+	}
+
+	return r.readReply()
+}
+
+var errRedisNil = errors.New("redis: nil")
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+func (r *Redis) readReply() ([]byte, error) {
+	line, err := r.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+', ':':
+		return []byte(line[1:]), nil
+	case '-':
+		return nil, redisError(line[1:])
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: bad bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, errRedisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r.reader, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key Key) ([]byte, bool, error) {
+	value, err := r.do(ctx, "GET", redisKeyPrefix+key.String())
+	if errors.Is(err, errRedisNil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+func (r *Redis) Set(ctx context.Context, key Key, value []byte, ttl time.Duration) error {
+	args := []string{"SET", redisKeyPrefix + key.String(), string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.do(ctx, args...)
+	return err
+}
+
+// Purge is a no-op; Redis expires entries itself.
+func (r *Redis) Purge(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+// forgetScript deletes keys matching a pattern server-side, so Forget does not
+// need array replies from SCAN.
+const forgetScript = `local n = 0
+local cursor = "0"
+repeat
+	local res = redis.call("SCAN", cursor, "MATCH", ARGV[1], "COUNT", 500)
+	cursor = res[1]
+	for _, k in ipairs(res[2]) do
+		n = n + redis.call("DEL", k)
+	end
+until cursor == "0"
+return n`
+
+func (r *Redis) Forget(ctx context.Context, inputHash string) (int64, error) {
+	reply, err := r.do(ctx, "EVAL", forgetScript, "0", redisKeyPrefix+"*:"+inputHash)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(string(reply), 10, 64)
+}
@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis answers the handful of commands the Redis backend sends.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	data     map[string]string
+	commands [][]string
+	// dropNext closes the connection instead of answering the next command.
+	dropNext bool
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on loopback: %v", err)
+	}
+	f := &fakeRedis{ln: ln, password: password, data: map[string]string{}}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) url(password string, db int) string {
+	u := "redis://"
+	if password != "" {
+		u += ":" + password + "@"
+	}
+	return fmt.Sprintf("%s%s/%d", u, f.ln.Addr(), db)
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("bad command header %q", line)
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(line[1:], "\r\n"))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+
+		f.mu.Lock()
+		f.commands = append(f.commands, args)
+		drop := f.dropNext
+		f.dropNext = false
+		reply := f.handle(args)
+		f.mu.Unlock()
+
+		if drop {
+			return
+		}
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) handle(args []string) string {
+	switch strings.ToUpper(args[0]) {
+	case "AUTH":
+		if args[1] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		return "+OK\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := f.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		f.data[args[1]] = args[2]
+		return "+OK\r\n"
+	case "EVAL":
+		n := 0
+		for k := range f.data {
+			if ok, _ := path.Match(args[3], k); ok {
+				delete(f.data, k)
+				n++
+			}
+		}
+		return fmt.Sprintf(":%d\r\n", n)
+	}
+	return fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+}
+
+func (f *fakeRedis) sent() [][]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.commands)
+}
+
+func TestRedisGetSet(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "")
+	r, err := NewRedis(server.url("", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := testKey(StageOCR, "a")
+
+	if _, ok, err := r.Get(ctx, key); ok || err != nil {
+		t.Fatalf("Get on an empty cache = %v, %v", ok, err)
+	}
+	value := "line one\r\nline two"
+	if err := r.Set(ctx, key, []byte(value), 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok, err := r.Get(ctx, key); err != nil || !ok || string(got) != value {
+		t.Errorf("Get = %q, %v, %v, want %q", got, ok, err, value)
+	}
+	if err := r.Set(ctx, testKey(StageStructured, "a"), []byte("{}"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"GET", "civet:cache:ocr:openai:gpt-4o:v1:a"},
+		{"SET", "civet:cache:ocr:openai:gpt-4o:v1:a", value, "PX", "90000"},
+		{"GET", "civet:cache:ocr:openai:gpt-4o:v1:a"},
+		{"SET", "civet:cache:structured:openai:gpt-4o:v1:a", "{}"},
+	}
+	got := server.sent()
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+}
+
+func TestRedisForget(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "")
+	r, err := NewRedis(server.url("", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []Key{testKey(StageOCR, "a"), testKey(StageStructured, "a"), testKey(StageOCR, "b")} {
+		if err := r.Set(ctx, key, []byte("v"), 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n, err := r.Forget(ctx, "a"); err != nil || n != 2 {
+		t.Errorf("Forget = %d, %v, want 2", n, err)
+	}
+	if _, ok, _ := r.Get(ctx, testKey(StageOCR, "b")); !ok {
+		t.Error("Forget removed another input's entry")
+	}
+	if n, err := r.Purge(ctx); n != 0 || err != nil {
+		t.Errorf("Purge = %d, %v", n, err)
+	}
+}
+
+func TestRedisConnect(t *testing.T) {
+	server := newFakeRedis(t, "hunter2")
+
+	if _, err := NewRedis(server.url("hunter2", 3)); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{{"AUTH", "hunter2"}, {"SELECT", "3"}}
+	if got := server.sent(); !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("sent %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"wrong password", server.url("wrong", 0)},
+		{"other scheme", "rediss://" + server.ln.Addr().String()},
+		{"bad database", "redis://" + server.ln.Addr().String() + "/cache"},
+		{"bad url", "redis://%zz"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRedis(tt.url); err == nil {
+				t.Error("NewRedis succeeded")
+			}
+		})
+	}
+}
+
+func TestRedisReconnects(t *testing.T) {
+	ctx := context.Background()
+	server := newFakeRedis(t, "")
+	r, err := NewRedis(server.url("", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := testKey(StageOCR, "a")
+	if err := r.Set(ctx, key, []byte("v"), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	server.dropNext = true
+	server.mu.Unlock()
+	if got, ok, err := r.Get(ctx, key); err != nil || !ok || string(got) != "v" {
+		t.Errorf("Get after a dropped connection = %q, %v, %v", got, ok, err)
+	}
+
+	// an error reply leaves the connection usable
+	if _, err := r.do(ctx, "PING"); err == nil {
+		t.Fatal("unknown command succeeded")
+	} else if errors.Is(err, errRedisNil) {
+		t.Fatalf("err = %v, want an error reply", err)
+	}
+	r.mu.Lock()
+	connected := r.conn != nil
+	r.mu.Unlock()
+	if !connected {
+		t.Error("an error reply dropped the connection")
+	}
+}
+
+func TestRedisReadReply(t *testing.T) {
+	tests := []struct {
+		reply   string
+		want    string
+		wantErr error
+	}{
+		{"+OK\r\n", "OK", nil},
+		{":42\r\n", "42", nil},
+		{"$5\r\nhello\r\n", "hello", nil},
+		{"$0\r\n\r\n", "", nil},
+		{"$-1\r\n", "", errRedisNil},
+		{"-ERR wrong type\r\n", "", redisError("ERR wrong type")},
+	}
+	for _, tt := range tests {
+		r := &Redis{reader: bufio.NewReader(strings.NewReader(tt.reply))}
+		got, err := r.readReply()
+		if !errors.Is(err, tt.wantErr) || string(got) != tt.want {
+			t.Errorf("readReply(%q) = %q, %v, want %q, %v", tt.reply, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	for _, reply := range []string{"", "\r\n", "$x\r\n", "$5\r\nhel", "*1\r\n:1\r\n"} {
+		r := &Redis{reader: bufio.NewReader(strings.NewReader(reply))}
+		if got, err := r.readReply(); err == nil {
+			t.Errorf("readReply(%q) = %q, want an error", reply, got)
+		}
+	}
+}
@@ -1,22 +1,26 @@
 package cloudvision
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"os"
+	"net/http"
 
-	vision "cloud.google.com/go/vision/apiv1"
+	vision "cloud.google.com/go/vision/v2/apiv1"
 	visionpb "cloud.google.com/go/vision/v2/apiv1/visionpb"
 	"google.golang.org/api/option"
 )
 
+// Provider and Model identify Cloud Vision text detection in cache keys.
+const (
+	Provider = "google"
+	Model    = "text_detection"
+)
+
 type CloudVision struct {
-	client   *vision.ImageAnnotatorClient
-	cacheDir string
+	client *vision.ImageAnnotatorClient
 }
 
-func NewCloudVision(ctx context.Context, cacheDir string, credentials string) (*CloudVision, error) {
+func NewCloudVision(ctx context.Context, credentials string) (*CloudVision, error) {
 	var client *vision.ImageAnnotatorClient
 	var err error
 	if credentials == "" {
@@ -28,27 +32,45 @@ func NewCloudVision(ctx context.Context, cacheDir string, credentials string) (*
 		return nil, err
 	}
 
-	if err := os.MkdirAll(cacheDir, os.ModePerm); err != nil {
+	return &CloudVision{
+		client: client,
+	}, nil
+}
+
+// NewCloudVisionHTTP talks to the REST API through httpClient instead of gRPC,
+// so calls can be recorded and replayed. httpClient must add credentials itself.
+func NewCloudVisionHTTP(ctx context.Context, httpClient *http.Client) (*CloudVision, error) {
+	client, err := vision.NewImageAnnotatorRESTClient(ctx, option.WithHTTPClient(httpClient))
+	if err != nil {
 		return nil, err
 	}
 
 	return &CloudVision{
-		client:   client,
-		cacheDir: cacheDir,
+		client: client,
 	}, nil
 }
 
 func (cv *CloudVision) DetectText(ctx context.Context, content []byte) ([]*visionpb.EntityAnnotation, error) {
-
-	img, err := vision.NewImageFromReader(bytes.NewReader(content))
+	res, err := cv.client.BatchAnnotateImages(ctx, &visionpb.BatchAnnotateImagesRequest{
+		Requests: []*visionpb.AnnotateImageRequest{{
+			Image: &visionpb.Image{Content: content},
+			Features: []*visionpb.Feature{{
+				Type:       visionpb.Feature_TEXT_DETECTION,
+				MaxResults: 10,
+			}},
+		}},
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create image: %w", err)
+		return nil, fmt.Errorf("failed to detect texts: %w", err)
+	}
+	if len(res.Responses) == 0 {
+		return nil, fmt.Errorf("failed to detect texts: empty response")
 	}
 
-	annotations, err := cv.client.DetectTexts(ctx, img, nil, 10)
-	if err != nil {
-		return nil, fmt.Errorf("failed to detect texts: %w", err)
+	annotation := res.Responses[0]
+	if annotation.Error != nil {
+		return nil, fmt.Errorf("failed to detect texts: %s", annotation.Error.GetMessage())
 	}
 
-	return annotations, nil
+	return annotation.TextAnnotations, nil
 }
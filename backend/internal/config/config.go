@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -10,24 +11,59 @@ import (
 )
 
 type Config struct {
-	// server
+	// server; Env is development unless set to production
 	Port string
+	Env  string
+	// origins browsers may send credentialed and state changing requests from
+	AllowedOrigins []string
 
 	// database
 	DbURL string
 
 	// storage
-	MinioHost      string
-	MinioAccessKey string
-	MinioSecretKey string
+	StorageBackend   string
+	StorageDir       string
+	MinioHost        string
+	MinioAccessKey   string
+	MinioSecretKey   string
+	StorageRegion    string
+	StorageUseSSL    bool
+	StoragePathStyle bool
+	ReceiptsBucket   string
+	// base64 encoded 32 byte master key, images are stored in plaintext when empty
+	StorageEncryptionKey string
+	// comma separated base64 keys used before the current one, still accepted
+	// when reading until `go run ./cmd/reseal` has moved objects over
+	StorageEncryptionOldKeys string
+	// days after upload that original photos are kept, 0 keeps them forever
+	ImageRetentionDays int
 
-	// auth
+	// presigned image urls; MinIO and S3 cap these at 7 days
+	ImageURLTTLSeconds        int
+	ImageVariantURLTTLSeconds int
+
+	// auth, new signing keys use JWTAlgorithm (RS256 or EdDSA)
 	JWTAlgorithm         string
 	JWTExpirationSeconds int
 	RefreshExpiration    int
+	JWTIssuer            string
+	JWTAudience          string
+	JWTKeyRotationDays   int
+	// accept HS256 tokens signed with JWT_SECRET from before signing keys,
+	// off unless turned on for a migration; they must still carry the issuer
+	// and audience
+	JWTAcceptLegacy bool
+	// how long a guest share link works
+	GuestInviteTTLHours int
 
 	CookieName        string
 	RefreshCookieName string
+	CSRFCookieName    string
+	// whether cookie sessions must echo the CSRF cookie; off until every web
+	// client sends the header
+	CSRFEnabled bool
+	// always on outside development
+	CookieSecure bool
 
 	ServerURL    string
 	WebRedirect  string
@@ -36,12 +72,69 @@ type Config struct {
 	ClientSecret string
 	RedirectURI  string
 	JWTSecret    string
+	// where the google sign in flow may send the client back to, matched exactly
+	OAuthRedirectURIs []string
 
 	// openai
 	OpenAIAPIKey string
 
 	// cloud vision
 	CloudVisionCredentials string
+
+	// sign in with apple: the app's bundle id and the web services id
+	AppleClientIDs []string
+
+	// passkeys; the relying party id defaults to SERVER_URL's host
+	WebAuthnRPID    string
+	WebAuthnRPName  string
+	WebAuthnOrigins []string
+
+	// outgoing mail, MailBackend is smtp or log, which writes messages to MailDir
+	MailBackend  string
+	MailDir      string
+	MailFrom     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
+
+	// email ingestion
+	InboundEmailDomain string
+	InboundEmailSecret string
+	MaxEmailBytes      int64
+
+	// admin
+	AdminEmails []string
+
+	// cache
+	CacheBackend              string
+	CacheDir                  string
+	RedisURL                  string
+	CacheOCRTTLSeconds        int
+	CacheStructuredTTLSeconds int
+
+	// deletion
+	RestoreWindowHours int
+
+	// extraction limits; the rate limits are per user and per IP, a quota of
+	// 0 is unlimited
+	RateLimitBackend        string
+	ExtractionRateBurst     int
+	ExtractionRatePerHour   int
+	ExtractionIPRatePerHour int
+	ExtractionQuotaMonthly  int
+
+	// sign in link limits, per address and per IP
+	EmailRateBurst     int
+	EmailRatePerHour   int
+	EmailIPRatePerHour int
+
+	// request size limits, in bytes; uploads and emails are allowed more
+	// than other requests, and images are also limited in pixels since a
+	// small file can decode to a huge bitmap
+	MaxRequestBytes int64
+	MaxUploadBytes  int64
+	MaxImagePixels  int
 }
 
 func LoadConfig() *Config {
@@ -52,26 +145,71 @@ func LoadConfig() *Config {
 
 	jwtExpiration, _ := strconv.Atoi(getenv("JWT_EXPIRATION_SECONDS", "900")) // 15 * 60
 	refreshExpiration, _ := strconv.Atoi(getenv("REFRESH_EXPIRATION_SECONDS", "604800"))
+	maxEmail, _ := strconv.ParseInt(getenv("MAX_EMAIL_BYTES", "26214400"), 10, 64) // 25 MB
+	cacheOCRTTL, _ := strconv.Atoi(getenv("CACHE_OCR_TTL_SECONDS", "0"))
+	cacheStructuredTTL, _ := strconv.Atoi(getenv("CACHE_STRUCTURED_TTL_SECONDS", "0"))
+	imageURLTTL, _ := strconv.Atoi(getenv("IMAGE_URL_TTL_SECONDS", "86400"))                 // 24 hours
+	imageVariantURLTTL, _ := strconv.Atoi(getenv("IMAGE_VARIANT_URL_TTL_SECONDS", "604800")) // 7 days
+	storageUseSSL, _ := strconv.ParseBool(getenv("STORAGE_USE_SSL", "false"))
+	storagePathStyle, _ := strconv.ParseBool(getenv("STORAGE_PATH_STYLE", "true"))
+	imageRetention, _ := strconv.Atoi(getenv("IMAGE_RETENTION_DAYS", "0"))
+	jwtKeyRotation, _ := strconv.Atoi(getenv("JWT_KEY_ROTATION_DAYS", "30"))
+	jwtAcceptLegacy, _ := strconv.ParseBool(getenv("JWT_ACCEPT_LEGACY_HS256", "false"))
+	guestInviteTTL, _ := strconv.Atoi(getenv("GUEST_INVITE_TTL_HOURS", "72"))
+	restoreWindow, _ := strconv.Atoi(getenv("RESTORE_WINDOW_HOURS", "720")) // 30 days
+	cookieSecure, _ := strconv.ParseBool(getenv("COOKIE_SECURE", "false"))
+	csrfEnabled, _ := strconv.ParseBool(getenv("CSRF_ENABLED", "false"))
+	extractionBurst, _ := strconv.Atoi(getenv("RATE_LIMIT_EXTRACTION_BURST", "5"))
+	extractionRate, _ := strconv.Atoi(getenv("RATE_LIMIT_EXTRACTION_PER_HOUR", "30"))
+	extractionIPRate, _ := strconv.Atoi(getenv("RATE_LIMIT_EXTRACTION_IP_PER_HOUR", "60"))
+	extractionQuota, _ := strconv.Atoi(getenv("EXTRACTION_QUOTA_MONTHLY", "200"))
+	emailBurst, _ := strconv.Atoi(getenv("RATE_LIMIT_EMAIL_BURST", "3"))
+	emailRate, _ := strconv.Atoi(getenv("RATE_LIMIT_EMAIL_PER_HOUR", "5"))
+	emailIPRate, _ := strconv.Atoi(getenv("RATE_LIMIT_EMAIL_IP_PER_HOUR", "20"))
+	maxRequest, _ := strconv.ParseInt(getenv("MAX_REQUEST_BYTES", "1048576"), 10, 64) // 1 MB
+	maxUpload, _ := strconv.ParseInt(getenv("MAX_UPLOAD_BYTES", "20971520"), 10, 64)  // 20 MB
+	maxImagePixels, _ := strconv.Atoi(getenv("MAX_IMAGE_PIXELS", "50000000"))
 
 	cfg := &Config{
 		// server
 		Port: ":8001",
+		Env:  getenv("APP_ENV", "development"),
 
 		// database
 		DbURL: envOrPanic("DATABASE_URL"),
 
-		// storage
-		MinioHost:      envOrPanic("MINIIO_HOST"),
-		MinioAccessKey: envOrPanic("MINIIO_ACCESS_KEY_ID"),
-		MinioSecretKey: envOrPanic("MINIIO_SECRET_ACCESS_KEY"),
+		// storage, the MinIO variables are only needed by the s3 backend
+		StorageBackend:   getenv("STORAGE_BACKEND", "s3"),
+		StorageDir:       getenv("STORAGE_DIR", "storage"),
+		MinioHost:        getenv("MINIIO_HOST", ""),
+		MinioAccessKey:   getenvOrFile("MINIIO_ACCESS_KEY_ID", ""),
+		MinioSecretKey:   getenvOrFile("MINIIO_SECRET_ACCESS_KEY", ""),
+		StorageRegion:    getenv("STORAGE_REGION", "us-east-1"),
+		StorageUseSSL:    storageUseSSL,
+		StoragePathStyle: storagePathStyle,
+		ReceiptsBucket:   getenv("STORAGE_RECEIPTS_BUCKET", "receipts"),
+
+		StorageEncryptionKey:     getenvOrFile("STORAGE_ENCRYPTION_KEY", ""),
+		StorageEncryptionOldKeys: getenvOrFile("STORAGE_ENCRYPTION_OLD_KEYS", ""),
+		ImageRetentionDays:       imageRetention,
+
+		ImageURLTTLSeconds:        imageURLTTL,
+		ImageVariantURLTTLSeconds: imageVariantURLTTL,
 
 		// auth
-		JWTAlgorithm:         "HS256",
+		JWTAlgorithm:         getenv("JWT_ALGORITHM", "EdDSA"),
 		JWTExpirationSeconds: jwtExpiration,
 		RefreshExpiration:    refreshExpiration,
+		JWTAudience:          getenv("JWT_AUDIENCE", "civet"),
+		JWTKeyRotationDays:   jwtKeyRotation,
+		JWTAcceptLegacy:      jwtAcceptLegacy,
+		GuestInviteTTLHours:  guestInviteTTL,
 
 		CookieName:        envOrPanic("COOKIE_NAME"),
 		RefreshCookieName: "refresh_token",
+		CSRFCookieName:    getenv("CSRF_COOKIE_NAME", "csrf_token"),
+		CSRFEnabled:       csrfEnabled,
+		CookieSecure:      cookieSecure,
 
 		ServerURL:    envOrPanic("SERVER_URL"),
 		WebRedirect:  envOrPanic("EXPO_WEB_URL"),
@@ -86,11 +224,107 @@ func LoadConfig() *Config {
 
 		// cloud vision
 		CloudVisionCredentials: getenv("GOOGLE_CLOUD_VISION_CREDENTIALS", ""),
+
+		AppleClientIDs: splitList(getenv("APPLE_CLIENT_IDS", "")),
+
+		WebAuthnRPName: getenv("WEBAUTHN_RP_NAME", "Civet"),
+
+		// mail
+		MailBackend:  getenv("MAIL_BACKEND", "log"),
+		MailDir:      getenv("MAIL_DIR", "mail"),
+		MailFrom:     getenv("MAIL_FROM", "Civet <no-reply@civetmobile.xyz>"),
+		SMTPHost:     getenv("SMTP_HOST", ""),
+		SMTPPort:     getenv("SMTP_PORT", "587"),
+		SMTPUsername: getenv("SMTP_USERNAME", ""),
+		SMTPPassword: getenvOrFile("SMTP_PASSWORD", ""),
+
+		// email ingestion
+		InboundEmailDomain: getenv("INBOUND_EMAIL_DOMAIN", "receipts.civetmobile.xyz"),
+		InboundEmailSecret: getenv("INBOUND_EMAIL_SECRET", ""),
+		MaxEmailBytes:      maxEmail,
+
+		// admin
+		AdminEmails: splitList(getenv("ADMIN_EMAILS", "")),
+
+		// cache
+		CacheBackend:              getenv("CACHE_BACKEND", "postgres"),
+		CacheDir:                  getenv("CACHE_DIR", "cache"),
+		RedisURL:                  getenv("REDIS_URL", "redis://localhost:6379/0"),
+		CacheOCRTTLSeconds:        cacheOCRTTL,
+		CacheStructuredTTLSeconds: cacheStructuredTTL,
+
+		// deletion
+		RestoreWindowHours: restoreWindow,
+
+		// extraction limits
+		RateLimitBackend:        getenv("RATE_LIMIT_BACKEND", "memory"),
+		ExtractionRateBurst:     extractionBurst,
+		ExtractionRatePerHour:   extractionRate,
+		ExtractionIPRatePerHour: extractionIPRate,
+		ExtractionQuotaMonthly:  extractionQuota,
+
+		// sign in link limits
+		EmailRateBurst:     emailBurst,
+		EmailRatePerHour:   emailRate,
+		EmailIPRatePerHour: emailIPRate,
+
+		// request size limits
+		MaxRequestBytes: maxRequest,
+		MaxUploadBytes:  maxUpload,
+		MaxImagePixels:  maxImagePixels,
 	}
 
+	if cfg.Env != "development" && cfg.Env != "production" {
+		log.Printf("WARNING: unknown APP_ENV %q, running as development", cfg.Env)
+		cfg.Env = "development"
+	}
+
+	if !cfg.Development() {
+		if !cfg.CookieSecure && os.Getenv("COOKIE_SECURE") != "" {
+			log.Println("WARNING: COOKIE_SECURE is ignored outside development")
+		}
+		cfg.CookieSecure = true
+	}
+
+	defaultOrigins := []string{originOf(cfg.WebRedirect), originOf(cfg.ServerURL)}
+	if cfg.Development() {
+		defaultOrigins = append(defaultOrigins, localOrigins...)
+	}
+	cfg.AllowedOrigins = splitList(getenv("ALLOWED_ORIGINS", strings.Join(defaultOrigins, ",")))
+
+	cfg.OAuthRedirectURIs = splitList(getenv("OAUTH_REDIRECT_URIS", cfg.WebRedirect+","+cfg.AppScheme))
+
+	cfg.JWTIssuer = getenv("JWT_ISSUER", cfg.ServerURL)
+	cfg.WebAuthnRPID = getenv("WEBAUTHN_RP_ID", hostOf(cfg.ServerURL))
+	cfg.WebAuthnOrigins = splitList(getenv("WEBAUTHN_ORIGINS", originOf(cfg.ServerURL)+","+originOf(cfg.WebRedirect)))
+
 	return cfg
 }
 
+// localOrigins are where the web app runs during development.
+var localOrigins = []string{
+	"http://127.0.0.1",
+	"http://127.0.0.1:8001",
+	"http://localhost",
+	"http://localhost:8001",
+	"http://localhost:8081",
+}
+
+func (c *Config) Development() bool {
+	return c.Env == "development"
+}
+
+// OriginAllowed reports whether origin, as sent in an Origin header, is one
+// of AllowedOrigins.
+func (c *Config) OriginAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
 func envOrPanic(key string) string {
 	fileKey := key + "_FILE"
 	if filePath := os.Getenv(fileKey); filePath != "" {
@@ -113,9 +347,45 @@ func readFromFile(path string) string {
 	return strings.TrimSpace(string(content))
 }
 
+// getenvOrFile is getenv for optional secrets, which like envOrPanic may be
+// read from the file named by KEY_FILE.
+func getenvOrFile(key string, fallback string) string {
+	if filePath := os.Getenv(key + "_FILE"); filePath != "" {
+		return readFromFile(filePath)
+	}
+	return getenv(key, fallback)
+}
+
 func getenv(key string, fallback string) string {
 	if val := os.Getenv(key); val != "" {
 		return val
 	}
 	return fallback
 }
+
+func splitList(s string) []string {
+	var out []string
+	for _, part := range strings.Split(s, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// originOf is the scheme://host[:port] part of a URL, as browsers report it.
+func originOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,70 @@
+// Package evaluate scores receipt extraction against a labelled dataset so
+// prompt, schema and model changes can be compared run to run.
+package evaluate
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sharithg/civet/internal/receipt"
+)
+
+var imageExts = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+	".heic": true,
+}
+
+// Example is one labelled receipt: an image and the Receipt it should produce.
+type Example struct {
+	Name      string
+	ImagePath string
+	Expected  receipt.Receipt
+}
+
+// LoadDataset reads every image in dir that has a matching <name>.json label.
+// Images without a label are reported as an error rather than skipped, so a
+// half-labelled dataset is noticed.
+func LoadDataset(dir string) ([]Example, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var examples []Example
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !imageExts[ext] {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		raw, err := os.ReadFile(filepath.Join(dir, name+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("label for %s: %w", entry.Name(), err)
+		}
+
+		var expected receipt.Receipt
+		if err := json.Unmarshal(raw, &expected); err != nil {
+			return nil, fmt.Errorf("label for %s: %w", entry.Name(), err)
+		}
+
+		examples = append(examples, Example{
+			Name:      name,
+			ImagePath: filepath.Join(dir, entry.Name()),
+			Expected:  expected,
+		})
+	}
+
+	sort.Slice(examples, func(i, j int) bool { return examples[i].Name < examples[j].Name })
+	if len(examples) == 0 {
+		return nil, fmt.Errorf("no labelled images in %s", dir)
+	}
+	return examples, nil
+}
@@ -0,0 +1,160 @@
+package evaluate
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/sharithg/civet/internal/receipt"
+)
+
+// amountTolerance is how far apart two amounts can be and still match.
+const amountTolerance = 0.005
+
+// Fields scored for field-level accuracy, in report order.
+var Fields = []string{
+	"restaurant",
+	"address",
+	"opened",
+	"order_number",
+	"order_type",
+	"table",
+	"server",
+	"subtotal",
+	"sales_tax",
+	"total",
+	"payment.method",
+	"payment.amount_paid",
+	"payment.tip",
+	"payment.card_last_four",
+	"copy",
+}
+
+// CompareFields reports, for each of Fields, whether got matches want.
+// Strings are compared case-, whitespace- and punctuation-insensitively.
+func CompareFields(want, got receipt.Receipt) map[string]bool {
+	return map[string]bool{
+		"restaurant":             sameText(want.Restaurant, got.Restaurant),
+		"address":                sameText(want.Address, got.Address),
+		"opened":                 sameText(want.Opened, got.Opened),
+		"order_number":           sameText(want.OrderNumber, got.OrderNumber),
+		"order_type":             sameText(want.OrderType, got.OrderType),
+		"table":                  sameText(want.Table, got.Table),
+		"server":                 sameText(want.Server, got.Server),
+		"subtotal":               sameAmount(want.Subtotal, got.Subtotal),
+		"sales_tax":              sameAmount(want.SalesTax, got.SalesTax),
+		"total":                  sameAmount(want.Total, got.Total),
+		"payment.method":         sameText(want.Payment.Method, got.Payment.Method),
+		"payment.amount_paid":    sameAmount(want.Payment.AmountPaid, got.Payment.AmountPaid),
+		"payment.tip":            sameAmount(want.Payment.Tip, got.Payment.Tip),
+		"payment.card_last_four": sameText(want.Payment.CardLastFour, got.Payment.CardLastFour),
+		"copy":                   sameText(want.Copy, got.Copy),
+	}
+}
+
+// MatchItems pairs expected and extracted items one to one and returns how
+// many matched. Items match when their prices agree and their names are
+// similar enough; the most similar pair is taken first.
+func MatchItems(want, got []receipt.OrderItem) int {
+	type pair struct {
+		i, j  int
+		score float64
+	}
+
+	var pairs []pair
+	for i, w := range want {
+		for j, g := range got {
+			if !sameAmount(w.Price, g.Price) {
+				continue
+			}
+			if score := nameSimilarity(w.Name, g.Name); score >= 0.5 {
+				pairs = append(pairs, pair{i, j, score})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool { return pairs[a].score > pairs[b].score })
+
+	usedWant, usedGot := map[int]bool{}, map[int]bool{}
+	matched := 0
+	for _, p := range pairs {
+		if usedWant[p.i] || usedGot[p.j] {
+			continue
+		}
+		usedWant[p.i], usedGot[p.j] = true, true
+		matched++
+	}
+	return matched
+}
+
+func sameAmount(a, b float64) bool {
+	return math.Abs(a-b) < amountTolerance
+}
+
+func sameText(a, b string) bool {
+	return normalize(a) == normalize(b)
+}
+
+func normalize(s string) string {
+	return strings.Join(tokens(s), " ")
+}
+
+func tokens(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// nameSimilarity is the Jaccard similarity of the word sets of a and b.
+func nameSimilarity(a, b string) float64 {
+	setA, setB := map[string]bool{}, map[string]bool{}
+	for _, t := range tokens(a) {
+		setA[t] = true
+	}
+	for _, t := range tokens(b) {
+		setB[t] = true
+	}
+	if len(setA) == 0 && len(setB) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for t := range setA {
+		if setB[t] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(setA)+len(setB)-shared)
+}
+
+// percentile returns the p-th percentile (0-100) of values by nearest rank.
+func percentile(values []float64, p float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
@@ -0,0 +1,93 @@
+package evaluate
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteTable prints one column per run so runs can be compared side by side.
+// With two or more runs a final column shows the last run minus the first.
+func WriteTable(w io.Writer, runs []Run) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	header := []string{"metric"}
+	for _, run := range runs {
+		header = append(header, run.Label)
+	}
+	compare := len(runs) > 1
+	if compare {
+		header = append(header, "delta")
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t")+"\t")
+
+	text := func(name string, value func(Run) string) {
+		row := []string{name}
+		for _, run := range runs {
+			row = append(row, value(run))
+		}
+		if compare {
+			row = append(row, "")
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	number := func(name, format string, value func(Run) float64) {
+		row := []string{name}
+		for _, run := range runs {
+			row = append(row, fmt.Sprintf(format, value(run)))
+		}
+		if compare {
+			delta := value(runs[len(runs)-1]) - value(runs[0])
+			row = append(row, fmt.Sprintf("%+"+strings.TrimPrefix(format, "%"), delta))
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t")+"\t")
+	}
+	percent := func(name string, value func(Run) float64) {
+		number(name, "%.1f%%", func(r Run) float64 { return 100 * value(r) })
+	}
+
+	text("model", func(r Run) string { return r.Provider + "/" + r.Model })
+	text("prompt/schema", func(r Run) string { return r.PromptVersion + "/" + r.SchemaVersion })
+	number("examples", "%.0f", func(r Run) float64 { return float64(r.Summary.Examples) })
+	number("failed", "%.0f", func(r Run) float64 { return float64(r.Summary.Failed) })
+
+	percent("field accuracy", func(r Run) float64 { return r.Summary.OverallAccuracy })
+	for _, field := range Fields {
+		percent("  "+field, func(r Run) float64 { return r.Summary.FieldAccuracy[field] })
+	}
+
+	percent("item precision", func(r Run) float64 { return r.Summary.ItemPrecision })
+	percent("item recall", func(r Run) float64 { return r.Summary.ItemRecall })
+	percent("item f1", func(r Run) float64 { return r.Summary.ItemF1 })
+
+	percent("total exact", func(r Run) float64 { return r.Summary.TotalExact })
+	number("total error mean", "%.2f", func(r Run) float64 { return r.Summary.TotalErrorMean })
+	number("total error p50", "%.2f", func(r Run) float64 { return r.Summary.TotalErrorMedian })
+	number("total error p90", "%.2f", func(r Run) float64 { return r.Summary.TotalErrorP90 })
+	number("total error max", "%.2f", func(r Run) float64 { return r.Summary.TotalErrorMax })
+
+	number("ocr latency p50 ms", "%.0f", func(r Run) float64 { return r.Summary.OCRLatencyP50Ms })
+	number("llm latency p50 ms", "%.0f", func(r Run) float64 { return r.Summary.LLMLatencyP50Ms })
+	number("latency p50 ms", "%.0f", func(r Run) float64 { return r.Summary.LatencyP50Ms })
+	number("latency p90 ms", "%.0f", func(r Run) float64 { return r.Summary.LatencyP90Ms })
+
+	number("prompt tokens", "%.0f", func(r Run) float64 { return float64(r.Summary.PromptTokens) })
+	number("completion tokens", "%.0f", func(r Run) float64 { return float64(r.Summary.CompletionTokens) })
+	number("cost usd", "%.4f", func(r Run) float64 { return r.Summary.CostUSD })
+	number("cost per receipt usd", "%.5f", func(r Run) float64 { return r.Summary.CostPerReceipt })
+
+	return tw.Flush()
+}
+
+// WriteFailures lists examples that errored or got the total wrong.
+func WriteFailures(w io.Writer, run Run) {
+	for _, r := range run.Examples {
+		switch {
+		case r.Error != "":
+			fmt.Fprintf(w, "%s: error: %s\n", r.Name, r.Error)
+		case r.TotalError >= amountTolerance:
+			fmt.Fprintf(w, "%s: total off by %.2f\n", r.Name, r.TotalError)
+		}
+	}
+}
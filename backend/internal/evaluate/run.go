@@ -0,0 +1,243 @@
+package evaluate
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"os"
+	"time"
+
+	"github.com/sharithg/civet/internal/cloudvision"
+	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/receipt"
+)
+
+// Pricing is the USD cost per million tokens for a model.
+type Pricing struct {
+	Input  float64
+	Output float64
+}
+
+// ModelPricing lists known OpenAI chat models. Runs on other models report
+// tokens but no cost.
+var ModelPricing = map[string]Pricing{
+	"gpt-4o-mini":  {Input: 0.15, Output: 0.60},
+	"gpt-4o":       {Input: 2.50, Output: 10.00},
+	"gpt-4.1":      {Input: 2.00, Output: 8.00},
+	"gpt-4.1-mini": {Input: 0.40, Output: 1.60},
+	"gpt-4.1-nano": {Input: 0.10, Output: 0.40},
+}
+
+// visionCostPerImage is Cloud Vision text detection past the free tier.
+const visionCostPerImage = 1.50 / 1000
+
+type ExampleResult struct {
+	Name           string          `json:"name"`
+	Error          string          `json:"error,omitempty"`
+	Fields         map[string]bool `json:"fields,omitempty"`
+	ItemsExpected  int             `json:"items_expected"`
+	ItemsExtracted int             `json:"items_extracted"`
+	ItemsMatched   int             `json:"items_matched"`
+	TotalError     float64         `json:"total_error"`
+	OCRLatencyMs   float64         `json:"ocr_latency_ms"`
+	LLMLatencyMs   float64         `json:"llm_latency_ms"`
+	Usage          genai.Usage     `json:"usage"`
+}
+
+type Summary struct {
+	Examples         int                `json:"examples"`
+	Failed           int                `json:"failed"`
+	FieldAccuracy    map[string]float64 `json:"field_accuracy"`
+	OverallAccuracy  float64            `json:"overall_accuracy"`
+	ItemPrecision    float64            `json:"item_precision"`
+	ItemRecall       float64            `json:"item_recall"`
+	ItemF1           float64            `json:"item_f1"`
+	TotalExact       float64            `json:"total_exact"`
+	TotalErrorMean   float64            `json:"total_error_mean"`
+	TotalErrorMedian float64            `json:"total_error_median"`
+	TotalErrorP90    float64            `json:"total_error_p90"`
+	TotalErrorMax    float64            `json:"total_error_max"`
+	OCRLatencyP50Ms  float64            `json:"ocr_latency_p50_ms"`
+	LLMLatencyP50Ms  float64            `json:"llm_latency_p50_ms"`
+	LatencyP50Ms     float64            `json:"latency_p50_ms"`
+	LatencyP90Ms     float64            `json:"latency_p90_ms"`
+	PromptTokens     int64              `json:"prompt_tokens"`
+	CompletionTokens int64              `json:"completion_tokens"`
+	CostUSD          float64            `json:"cost_usd"`
+	CostPerReceipt   float64            `json:"cost_per_receipt_usd"`
+}
+
+// Run is the saved result of evaluating one configuration over a dataset.
+type Run struct {
+	Label         string          `json:"label"`
+	OCRProvider   string          `json:"ocr_provider"`
+	OCRModel      string          `json:"ocr_model"`
+	Provider      string          `json:"provider"`
+	Model         string          `json:"model"`
+	PromptVersion string          `json:"prompt_version"`
+	SchemaVersion string          `json:"schema_version"`
+	StartedAt     time.Time       `json:"started_at"`
+	Examples      []ExampleResult `json:"examples"`
+	Summary       Summary         `json:"summary"`
+}
+
+// Evaluate runs every example through OCR, structured output and ToModel
+// without a cache, so latency and token counts reflect real calls.
+func Evaluate(ctx context.Context, label string, examples []Example, vision *cloudvision.CloudVision, openai genai.OpenAi) Run {
+	run := Run{
+		Label:         label,
+		OCRProvider:   cloudvision.Provider,
+		OCRModel:      cloudvision.Model,
+		Provider:      genai.Provider,
+		Model:         openai.Model,
+		PromptVersion: receipt.PromptVersion,
+		SchemaVersion: receipt.SchemaVersion(),
+		StartedAt:     time.Now(),
+	}
+
+	for _, example := range examples {
+		run.Examples = append(run.Examples, evaluateOne(ctx, example, vision, openai))
+	}
+	run.Summary = Summarize(run)
+	return run
+}
+
+func evaluateOne(ctx context.Context, example Example, vision *cloudvision.CloudVision, openai genai.OpenAi) ExampleResult {
+	result := ExampleResult{
+		Name:          example.Name,
+		ItemsExpected: len(example.Expected.Items),
+	}
+
+	data, err := os.ReadFile(example.ImagePath)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	e := receipt.NewExtractWithVision(nil, openai, nil, nil, vision, data, example.ImagePath)
+	e.Location = time.UTC
+
+	start := time.Now()
+	text, err := e.ExtractText(ctx)
+	result.OCRLatencyMs = milliseconds(time.Since(start))
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start = time.Now()
+	output, err := e.StructuredOutput(ctx, text)
+	result.LLMLatencyMs = milliseconds(time.Since(start))
+	result.Usage = e.Usage
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	parsed, err := e.ToModel(output)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	result.Fields = CompareFields(example.Expected, parsed.Receipt)
+	result.ItemsExtracted = len(parsed.Items)
+	result.ItemsMatched = MatchItems(example.Expected.Items, parsed.Items)
+	result.TotalError = math.Abs(parsed.Total - example.Expected.Total)
+	return result
+}
+
+// Summarize aggregates per-example results. Failed examples count against
+// field accuracy and item recall but are left out of error and latency figures.
+func Summarize(run Run) Summary {
+	summary := Summary{
+		Examples:      len(run.Examples),
+		FieldAccuracy: map[string]float64{},
+	}
+
+	var totalErrors, ocrLatency, llmLatency, latency []float64
+	var expected, extracted, matched, fieldsCorrect, totalsExact int
+	correct := map[string]int{}
+
+	for _, r := range run.Examples {
+		expected += r.ItemsExpected
+		summary.PromptTokens += r.Usage.PromptTokens
+		summary.CompletionTokens += r.Usage.CompletionTokens
+
+		if r.Error != "" {
+			summary.Failed++
+			continue
+		}
+
+		extracted += r.ItemsExtracted
+		matched += r.ItemsMatched
+		for field, ok := range r.Fields {
+			if ok {
+				correct[field]++
+				fieldsCorrect++
+			}
+		}
+		if r.TotalError < amountTolerance {
+			totalsExact++
+		}
+		totalErrors = append(totalErrors, r.TotalError)
+		ocrLatency = append(ocrLatency, r.OCRLatencyMs)
+		llmLatency = append(llmLatency, r.LLMLatencyMs)
+		latency = append(latency, r.OCRLatencyMs+r.LLMLatencyMs)
+	}
+
+	for _, field := range Fields {
+		summary.FieldAccuracy[field] = ratio(correct[field], summary.Examples)
+	}
+	summary.OverallAccuracy = ratio(fieldsCorrect, summary.Examples*len(Fields))
+
+	summary.ItemPrecision = ratio(matched, extracted)
+	summary.ItemRecall = ratio(matched, expected)
+	if p, r := summary.ItemPrecision, summary.ItemRecall; p+r > 0 {
+		summary.ItemF1 = 2 * p * r / (p + r)
+	}
+
+	summary.TotalExact = ratio(totalsExact, summary.Examples)
+	summary.TotalErrorMean = mean(totalErrors)
+	summary.TotalErrorMedian = percentile(totalErrors, 50)
+	summary.TotalErrorP90 = percentile(totalErrors, 90)
+	summary.TotalErrorMax = percentile(totalErrors, 100)
+
+	summary.OCRLatencyP50Ms = percentile(ocrLatency, 50)
+	summary.LLMLatencyP50Ms = percentile(llmLatency, 50)
+	summary.LatencyP50Ms = percentile(latency, 50)
+	summary.LatencyP90Ms = percentile(latency, 90)
+
+	if pricing, ok := ModelPricing[run.Model]; ok {
+		summary.CostUSD = float64(summary.PromptTokens)/1e6*pricing.Input +
+			float64(summary.CompletionTokens)/1e6*pricing.Output
+	}
+	summary.CostUSD += visionCostPerImage * float64(summary.Examples)
+	summary.CostPerReceipt = summary.CostUSD / math.Max(1, float64(summary.Examples))
+
+	return summary
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+func SaveRun(path string, run Run) error {
+	raw, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+func LoadRun(path string) (Run, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return Run{}, err
+	}
+	var run Run
+	if err := json.Unmarshal(raw, &run); err != nil {
+		return Run{}, err
+	}
+	return run, nil
+}
@@ -3,33 +3,49 @@ package genai
 import (
 	"context"
 	"encoding/json"
-	"os"
 
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
 	"github.com/sharithg/civet/internal/config"
 )
 
+// Provider identifies OpenAI in cache keys and evaluation runs.
+const (
+	Provider     = "openai"
+	DefaultModel = openai.ChatModelGPT4oMini
+)
+
 type OpenAi struct {
-	client   openai.Client
-	cacheDir string
-	Config   *config.Config
+	client openai.Client
+	Config *config.Config
+	// Model is the chat model used for completions.
+	Model string
 }
 
-func NewOpenAiClient(config *config.Config) OpenAi {
+// Usage is the token count reported for a completion.
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+}
+
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+}
+
+// NewOpenAiClient builds a client from config. opts are applied after the API
+// key, e.g. option.WithHTTPClient to record or replay requests.
+func NewOpenAiClient(config *config.Config, opts ...option.RequestOption) OpenAi {
 	client := openai.NewClient(
-		option.WithAPIKey(config.OpenAIAPIKey),
+		append([]option.RequestOption{option.WithAPIKey(config.OpenAIAPIKey)}, opts...)...,
 	)
-	cacheDir := "cache/openai"
-	_ = os.MkdirAll(cacheDir, os.ModePerm)
-
 	return OpenAi{
-		client:   client,
-		cacheDir: cacheDir,
+		client: client,
+		Model:  DefaultModel,
 	}
 }
 
-func JsonChat[T any](ctx context.Context, o *OpenAi, prompt string, input string, schemaName string, schema interface{}) (T, error) {
+func JsonChat[T any](ctx context.Context, o *OpenAi, prompt string, input string, schemaName string, schema interface{}) (T, Usage, error) {
 	var zero T
 
 	schemaParam := openai.ResponseFormatJSONSchemaJSONSchemaParam{
@@ -48,17 +64,22 @@ func JsonChat[T any](ctx context.Context, o *OpenAi, prompt string, input string
 				JSONSchema: schemaParam,
 			},
 		},
-		Model: openai.ChatModelGPT4oMini,
+		Model: o.Model,
 	})
 	if err != nil {
-		return zero, err
+		return zero, Usage{}, err
+	}
+
+	usage := Usage{
+		PromptTokens:     chat.Usage.PromptTokens,
+		CompletionTokens: chat.Usage.CompletionTokens,
 	}
 
 	var result T
 	err = json.Unmarshal([]byte(chat.Choices[0].Message.Content), &result)
 	if err != nil {
-		return zero, err
+		return zero, usage, err
 	}
 
-	return result, nil
+	return result, usage, nil
 }
@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Log stands in for a mail server during development: messages are written
+// to dir as .eml files and echoed to the log instead of being delivered.
+type Log struct {
+	dir  string
+	from string
+}
+
+func NewLog(dir, from string) (*Log, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Log{dir: dir, from: from}, nil
+}
+
+func (l *Log) Send(ctx context.Context, msg Message) error {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), hex.EncodeToString(suffix))
+	path := filepath.Join(l.dir, name)
+
+	if err := os.WriteFile(path, render(l.from, msg), 0o600); err != nil {
+		return err
+	}
+	log.Printf("[MAIL] to %s: %s (%s)\n%s", msg.To, msg.Subject, path, msg.Text)
+	return nil
+}
@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"time"
+
+	"github.com/sharithg/civet/internal/config"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+}
+
+// Sender delivers outgoing mail.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// Open builds the sender configured by MAIL_BACKEND.
+func Open(config *config.Config) (Sender, error) {
+	switch config.MailBackend {
+	case "smtp":
+		if config.SMTPHost == "" {
+			return nil, fmt.Errorf("SMTP_HOST is required for the smtp mail backend")
+		}
+		return NewSMTP(config.SMTPHost, config.SMTPPort, config.SMTPUsername, config.SMTPPassword, config.MailFrom)
+	case "log", "":
+		return NewLog(config.MailDir, config.MailFrom)
+	default:
+		return nil, fmt.Errorf("unknown mail backend %q", config.MailBackend)
+	}
+}
+
+// render formats msg as a plain text RFC 5322 message.
+func render(from string, msg Message) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(msg.Text)
+	return b.Bytes()
+}
+
+// address extracts the bare address from a "Name <address>" string.
+func address(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
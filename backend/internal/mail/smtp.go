@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+)
+
+// SMTP sends through a relay, upgrading to TLS when the server offers STARTTLS.
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+func NewSMTP(host, port, username, password, from string) (*SMTP, error) {
+	if _, err := address(from); err != nil {
+		return nil, fmt.Errorf("invalid MAIL_FROM: %w", err)
+	}
+
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTP{addr: net.JoinHostPort(host, port), auth: auth, from: from}, nil
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	from, _ := address(s.from)
+	to, err := address(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %w", err)
+	}
+	return smtp.SendMail(s.addr, s.auth, from, []string{to}, render(s.from, msg))
+}
@@ -0,0 +1,45 @@
+// Package outingstatus is the lifecycle of an outing, shared by the API and
+// the receipt pipeline.
+package outingstatus
+
+// Outing statuses. Drafts are still being set up, active outings take new
+// receipts and splits, locked outings keep their splits fixed while people
+// pay, settled outings are paid up and archived outings are put away.
+const (
+	Draft    = "draft"
+	Active   = "active"
+	Locked   = "locked"
+	Settled  = "settled"
+	Archived = "archived"
+)
+
+// transitions lists the statuses each status can move to. Locking can be
+// undone to reopen an outing for edits, and an archived outing is reopened as
+// active.
+var transitions = map[string][]string{
+	Draft:    {Active, Archived},
+	Active:   {Locked, Archived},
+	Locked:   {Active, Settled},
+	Settled:  {Locked, Archived},
+	Archived: {Active},
+}
+
+func Valid(status string) bool {
+	_, ok := transitions[status]
+	return ok
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SplitsEditable reports whether splits and tips on an outing's receipts may
+// still change.
+func SplitsEditable(status string) bool {
+	return status == Draft || status == Active
+}
@@ -0,0 +1,114 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/sharithg/civet/internal/config"
+)
+
+// Rate is a token bucket: up to Burst requests at once, with one more allowed
+// every Interval.
+type Rate struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// PerHour allows n requests an hour, burst of them at once.
+func PerHour(n, burst int) Rate {
+	return Rate{Burst: burst, Interval: time.Hour / time.Duration(max(n, 1))}
+}
+
+// refill is how long an empty bucket takes to fill up again.
+func (r Rate) refill() time.Duration {
+	return r.Interval * time.Duration(r.Burst)
+}
+
+type Result struct {
+	Allowed   bool
+	Remaining int
+	// RetryAfter is how long until the next request would be allowed
+	RetryAfter time.Duration
+}
+
+// Limiter takes one token from the bucket for key.
+type Limiter interface {
+	Allow(ctx context.Context, key string, rate Rate) (Result, error)
+}
+
+// Open builds the limiter configured by RATE_LIMIT_BACKEND. The in memory
+// limiter is per process, so deployments with several replicas should use
+// redis.
+func Open(config *config.Config) (Limiter, error) {
+	switch config.RateLimitBackend {
+	case "memory", "":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(config.RedisURL)
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", config.RateLimitBackend)
+	}
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	refill time.Duration
+}
+
+// take refills the bucket up to now and takes a token if there is one.
+func (b *bucket) take(now time.Time, rate Rate) Result {
+	b.tokens = math.Min(float64(rate.Burst), b.tokens+float64(now.Sub(b.at))/float64(rate.Interval))
+	b.at = now
+	b.refill = rate.refill()
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true, Remaining: int(b.tokens)}
+	}
+	return Result{RetryAfter: time.Duration((1 - b.tokens) * float64(rate.Interval))}
+}
+
+// Memory keeps buckets in process. Buckets that have refilled completely are
+// dropped on the next sweep, since a new bucket starts out full anyway.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemory() *Memory {
+	return &Memory{buckets: map[string]*bucket{}, lastSweep: time.Now()}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rate.Burst), at: now}
+		m.buckets[key] = b
+	}
+	return b.take(now, rate), nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		if now.Sub(b.at) > b.refill {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
@@ -0,0 +1,112 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestPerHour(t *testing.T) {
+	tests := []struct {
+		n, burst int
+		want     Rate
+	}{
+		{60, 5, Rate{Burst: 5, Interval: time.Minute}},
+		{1, 1, Rate{Burst: 1, Interval: time.Hour}},
+		{0, 3, Rate{Burst: 3, Interval: time.Hour}},
+	}
+	for _, tt := range tests {
+		if got := PerHour(tt.n, tt.burst); got != tt.want {
+			t.Errorf("PerHour(%d, %d) = %+v, want %+v", tt.n, tt.burst, got, tt.want)
+		}
+	}
+}
+
+func TestBucketTake(t *testing.T) {
+	rate := Rate{Burst: 3, Interval: time.Minute}
+
+	type step struct {
+		at         time.Duration
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"burst then empty", []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{0, false, 0, time.Minute},
+		}},
+		{"partial refill", []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{30 * time.Second, false, 0, 30 * time.Second},
+			{time.Minute, true, 0, 0},
+		}},
+		{"refill is capped at burst", []step{
+			{0, true, 2, 0},
+			{time.Hour, true, 2, 0},
+			{time.Hour, true, 1, 0},
+		}},
+		{"denied requests cost nothing", []step{
+			{0, true, 2, 0},
+			{0, true, 1, 0},
+			{0, true, 0, 0},
+			{20 * time.Second, false, 0, 40 * time.Second},
+			{40 * time.Second, false, 0, 20 * time.Second},
+			{time.Minute, true, 0, 0},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+			b := &bucket{tokens: float64(rate.Burst), at: start}
+			for i, s := range tt.steps {
+				got := b.take(start.Add(s.at), rate)
+				want := Result{Allowed: s.allowed, Remaining: s.remaining, RetryAfter: s.retryAfter}
+				if got != want {
+					t.Fatalf("step %d at %s: got %+v, want %+v", i, s.at, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMemoryKeysAreSeparate(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	rate := Rate{Burst: 1, Interval: time.Hour}
+
+	if r, _ := m.Allow(ctx, "a", rate); !r.Allowed {
+		t.Fatal("first request for a was denied")
+	}
+	if r, _ := m.Allow(ctx, "a", rate); r.Allowed {
+		t.Fatal("second request for a was allowed")
+	}
+	if r, _ := m.Allow(ctx, "b", rate); !r.Allowed {
+		t.Fatal("first request for b was denied")
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	rate := Rate{Burst: 2, Interval: time.Minute}
+
+	m.buckets["full"] = &bucket{tokens: 2, at: now.Add(-3 * time.Minute), refill: rate.refill()}
+	m.buckets["draining"] = &bucket{tokens: 0, at: now.Add(-time.Minute), refill: rate.refill()}
+
+	m.sweep(now)
+
+	if _, ok := m.buckets["full"]; ok {
+		t.Error("a bucket that has refilled was kept")
+	}
+	if _, ok := m.buckets["draining"]; !ok {
+		t.Error("a bucket that is still refilling was dropped")
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sharithg/civet/internal/cache"
+)
+
+const redisKeyPrefix = "civet:ratelimit:"
+
+// bucketScript is the token bucket of Memory, run atomically in Redis. The
+// reply is "allowed remaining retry_after_ms" since the client only reads
+// simple replies.
+const bucketScript = `local burst = tonumber(ARGV[1])
+local per_token = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local state = redis.call("HMGET", KEYS[1], "tokens", "at")
+local tokens = tonumber(state[1]) or burst
+local at = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - at) / per_token)
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+else
+	retry = math.ceil((1 - tokens) * per_token)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "at", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst * per_token))
+return allowed .. " " .. math.floor(tokens) .. " " .. retry`
+
+// Redis shares buckets between every replica of the API.
+type Redis struct {
+	client *cache.Redis
+}
+
+func NewRedis(rawURL string) (*Redis, error) {
+	client, err := cache.NewRedis(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &Redis{client: client}, nil
+}
+
+func (r *Redis) Allow(ctx context.Context, key string, rate Rate) (Result, error) {
+	reply, err := r.client.Do(ctx, "EVAL", bucketScript, "1", redisKeyPrefix+key,
+		strconv.Itoa(rate.Burst),
+		strconv.FormatInt(rate.Interval.Milliseconds(), 10),
+		strconv.FormatInt(time.Now().UnixMilli(), 10),
+	)
+	if err != nil {
+		return Result{}, err
+	}
+
+	fields := strings.Fields(string(reply))
+	if len(fields) != 3 {
+		return Result{}, fmt.Errorf("unexpected rate limit reply %q", reply)
+	}
+	remaining, _ := strconv.Atoi(fields[1])
+	retry, _ := strconv.ParseInt(fields[2], 10, 64)
+	return Result{
+		Allowed:    fields[0] == "1",
+		Remaining:  remaining,
+		RetryAfter: time.Duration(retry) * time.Millisecond,
+	}, nil
+}
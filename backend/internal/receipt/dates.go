@@ -0,0 +1,252 @@
+package receipt
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	meridiemDots   = regexp.MustCompile(`(\d|\b)([AP])\.M\.?`)
+	meridiemSpace  = regexp.MustCompile(`(\d)([AP]M)\b`)
+	whitespaceRuns = regexp.MustCompile(`\s+`)
+)
+
+var isoLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+}
+
+// Numeric date layouts. Go accepts one or two digits for "1" and "2", so these
+// also cover zero-padded values.
+var (
+	monthFirstDates  = []string{"1/2/2006", "1/2/06", "1-2-2006", "1-2-06"}
+	dayFirstDates    = []string{"2/1/2006", "2/1/06", "2-1-2006", "2-1-06", "2.1.2006", "2.1.06"}
+	unambiguousDates = []string{
+		"2006-1-2",
+		"2006/1/2",
+		"Jan 2 2006",
+		"January 2 2006",
+		"2 Jan 2006",
+		"2 January 2006",
+		"Mon Jan 2 2006",
+		"Mon 2 Jan 2006",
+		"Jan 2 06",
+		"2 Jan 06",
+	}
+	clockLayouts = []string{
+		"15:04:05",
+		"15:04",
+		"3:04:05 PM",
+		"3:04 PM",
+	}
+)
+
+// DateOrder is whether numeric dates such as 03/04/25 put the month or the
+// day first.
+type DateOrder int
+
+const (
+	// UnknownOrder leaves the order to the date itself where it can: a part
+	// over 12 can only be the day.
+	UnknownOrder DateOrder = iota
+	MonthFirst
+	DayFirst
+)
+
+// monthFirstZones are locations whose receipts print dates as month/day.
+var monthFirstZones = []string{
+	"US/",
+	"America/New_York",
+	"America/Chicago",
+	"America/Denver",
+	"America/Phoenix",
+	"America/Los_Angeles",
+	"America/Anchorage",
+	"America/Detroit",
+	"America/Boise",
+	"America/Indiana/",
+	"America/Kentucky/",
+	"America/North_Dakota/",
+	"Pacific/Honolulu",
+	"Asia/Manila",
+}
+
+// ambiguousZones are Canadian locations, where receipts print dates either
+// way depending on the province, the language and the point of sale.
+var ambiguousZones = []string{
+	"Canada/",
+	"America/Atikokan",
+	"America/Blanc-Sablon",
+	"America/Cambridge_Bay",
+	"America/Creston",
+	"America/Dawson",
+	"America/Dawson_Creek",
+	"America/Edmonton",
+	"America/Fort_Nelson",
+	"America/Glace_Bay",
+	"America/Goose_Bay",
+	"America/Halifax",
+	"America/Inuvik",
+	"America/Iqaluit",
+	"America/Moncton",
+	"America/Montreal",
+	"America/Nipigon",
+	"America/Pangnirtung",
+	"America/Rainy_River",
+	"America/Rankin_Inlet",
+	"America/Regina",
+	"America/Resolute",
+	"America/St_Johns",
+	"America/Swift_Current",
+	"America/Thunder_Bay",
+	"America/Toronto",
+	"America/Vancouver",
+	"America/Whitehorse",
+	"America/Winnipeg",
+	"America/Yellowknife",
+}
+
+func hasZonePrefix(name string, zones []string) bool {
+	for _, zone := range zones {
+		if strings.HasPrefix(name, zone) {
+			return true
+		}
+	}
+	return false
+}
+
+// ZoneDateOrder is the order receipts in loc print numeric dates in. Only the
+// US-style zones above print month first. Canadian zones, UTC and unknown
+// locations don't say.
+func ZoneDateOrder(loc *time.Location) DateOrder {
+	if loc == nil || loc == time.UTC {
+		return UnknownOrder
+	}
+	name := loc.String()
+	switch {
+	case hasZonePrefix(name, monthFirstZones):
+		return MonthFirst
+	case hasZonePrefix(name, ambiguousZones):
+		return UnknownOrder
+	}
+	return DayFirst
+}
+
+// monthFirstRegions are the regions whose locales write month/day.
+var monthFirstRegions = []string{"US", "PH", "FM", "MH", "PW"}
+
+// LocaleDateOrder is the order a user with the given locale reads numeric
+// dates in. It takes a BCP 47 tag such as en-GB, or an Accept-Language header,
+// whose first language is used. English Canada is taken to follow the US and
+// French Canada Europe; a bare language says nothing.
+func LocaleDateOrder(locale string) DateOrder {
+	tag, _, _ := strings.Cut(locale, ",")
+	tag, _, _ = strings.Cut(tag, ";")
+	parts := strings.FieldsFunc(strings.TrimSpace(tag), func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) < 2 {
+		return UnknownOrder
+	}
+
+	lang := strings.ToLower(parts[0])
+	var region string
+	for _, part := range parts[1:] {
+		// the region follows the language and an optional four letter script
+		if len(part) == 2 || (len(part) == 3 && part[0] >= '0' && part[0] <= '9') {
+			region = strings.ToUpper(part)
+			break
+		}
+	}
+
+	switch {
+	case region == "":
+		return UnknownOrder
+	case region == "CA" && lang == "en":
+		return MonthFirst
+	case slices.Contains(monthFirstRegions, region):
+		return MonthFirst
+	}
+	return DayFirst
+}
+
+// LoadLocation resolves an IANA timezone name, falling back to UTC when the
+// name is empty or unknown.
+func LoadLocation(name string) *time.Location {
+	if name == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// ParseOpened normalizes the free-form date/time printed on a receipt. Values
+// without an explicit offset are interpreted in loc. Ambiguous numeric dates
+// follow the order for loc, else the user's order, else month/day; a date
+// with a part over 12 is read the only way it can be.
+func ParseOpened(s string, loc *time.Location, userOrder DateOrder) (time.Time, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	raw := strings.TrimSpace(s)
+	if raw == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	for _, layout := range isoLayouts[1:] {
+		if t, err := time.ParseInLocation(layout, raw, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	value := normalizeDate(raw)
+	order := ZoneDateOrder(loc)
+	if order == UnknownOrder {
+		order = userOrder
+	}
+	for _, layout := range dateTimeLayouts(order == DayFirst) {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("unrecognized date format: %q", s)
+}
+
+func normalizeDate(s string) string {
+	s = strings.ToUpper(s)
+	s = meridiemDots.ReplaceAllString(s, "${1}${2}M")
+	s = meridiemSpace.ReplaceAllString(s, "$1 $2")
+	s = strings.NewReplacer(",", " ", "'", " ", " AT ", " ", "@", " ").Replace(s)
+	return strings.TrimSpace(whitespaceRuns.ReplaceAllString(s, " "))
+}
+
+func dateTimeLayouts(dayFirst bool) []string {
+	var dates []string
+	if dayFirst {
+		dates = append(dates, dayFirstDates...)
+		dates = append(dates, monthFirstDates...)
+	} else {
+		dates = append(dates, monthFirstDates...)
+		dates = append(dates, dayFirstDates...)
+	}
+	dates = append(dates, unambiguousDates...)
+
+	var layouts []string
+	for _, date := range dates {
+		for _, clock := range clockLayouts {
+			layouts = append(layouts, date+" "+clock, clock+" "+date)
+		}
+		layouts = append(layouts, date)
+	}
+	return layouts
+}
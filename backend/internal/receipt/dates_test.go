@@ -0,0 +1,178 @@
+package receipt
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("timezone data for %s unavailable: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseOpened(t *testing.T) {
+	newYork := mustLocation(t, "America/New_York")
+	london := mustLocation(t, "Europe/London")
+	berlin := mustLocation(t, "Europe/Berlin")
+
+	tests := []struct {
+		name string
+		in   string
+		loc  *time.Location
+		want time.Time
+	}{
+		{"us month first", "03/04/25 7:30 PM", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+		{"uk day first", "03/04/25 7:30 PM", london, time.Date(2025, 4, 3, 19, 30, 0, 0, london)},
+		{"utc defaults to month first", "03/04/2025", time.UTC, time.Date(2025, 3, 4, 0, 0, 0, 0, time.UTC)},
+		{"nil location is utc", "03/04/2025 19:30", nil, time.Date(2025, 3, 4, 19, 30, 0, 0, time.UTC)},
+		{"day over 12 falls back to day first", "13/04/2025 12:05", newYork, time.Date(2025, 4, 13, 12, 5, 0, 0, newYork)},
+		{"month over 12 falls back to month first", "04/13/2025", london, time.Date(2025, 4, 13, 0, 0, 0, 0, london)},
+		{"dotted day first", "04.03.2025 19:30", berlin, time.Date(2025, 3, 4, 19, 30, 0, 0, berlin)},
+		{"dashes", "3-4-25 07:30:15", newYork, time.Date(2025, 3, 4, 7, 30, 15, 0, newYork)},
+		{"time before date", "7:30 PM 03/04/2025", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+		{"iso date", "2025-03-04 19:30", london, time.Date(2025, 3, 4, 19, 30, 0, 0, london)},
+		{"iso without offset", "2025-03-04T19:30:00", berlin, time.Date(2025, 3, 4, 19, 30, 0, 0, berlin)},
+		{"rfc3339 keeps its offset", "2025-03-04T19:30:00-08:00", berlin, time.Date(2025, 3, 4, 19, 30, 0, 0, time.FixedZone("", -8*3600))},
+		{"month name", "Mar 4, 2025 @ 7:30p.m.", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+		{"day before month name", "4 March 2025 at 19:30", london, time.Date(2025, 3, 4, 19, 30, 0, 0, london)},
+		{"weekday", "Tue Mar 4 2025", newYork, time.Date(2025, 3, 4, 0, 0, 0, 0, newYork)},
+		{"apostrophe year", "Mar 4 '25 19:30", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+		{"dotted meridiem with space", "03/04/2025 7:30 P.M.", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+		{"lowercase meridiem without space", "3/4/2025 7:30pm", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+		{"surrounding whitespace", "  03/04/2025   19:30 ", newYork, time.Date(2025, 3, 4, 19, 30, 0, 0, newYork)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOpened(tt.in, tt.loc, UnknownOrder)
+			if err != nil {
+				t.Fatalf("ParseOpened(%q): %v", tt.in, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseOpened(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseOpenedErrors(t *testing.T) {
+	for _, in := range []string{"", "   ", "TABLE 12", "13/13/2025", "32/01/2025", "25:00 03/04/2025"} {
+		t.Run(in, func(t *testing.T) {
+			if got, err := ParseOpened(in, time.UTC, UnknownOrder); err == nil {
+				t.Errorf("ParseOpened(%q) = %v, want an error", in, got)
+			}
+		})
+	}
+}
+
+func TestParseOpenedUserOrder(t *testing.T) {
+	toronto := mustLocation(t, "America/Toronto")
+	newYork := mustLocation(t, "America/New_York")
+	london := mustLocation(t, "Europe/London")
+
+	tests := []struct {
+		name  string
+		in    string
+		loc   *time.Location
+		order DateOrder
+		want  time.Time
+	}{
+		{"canada without a locale", "03/04/25", toronto, UnknownOrder, time.Date(2025, 3, 4, 0, 0, 0, 0, toronto)},
+		{"canada with a day first locale", "03/04/25", toronto, DayFirst, time.Date(2025, 4, 3, 0, 0, 0, 0, toronto)},
+		{"canada with a month first locale", "03/04/25", toronto, MonthFirst, time.Date(2025, 3, 4, 0, 0, 0, 0, toronto)},
+		{"canada day over 12 beats the locale", "13/04/2025", toronto, MonthFirst, time.Date(2025, 4, 13, 0, 0, 0, 0, toronto)},
+		{"canada month over 12 beats the locale", "04/13/2025", toronto, DayFirst, time.Date(2025, 4, 13, 0, 0, 0, 0, toronto)},
+		{"utc with a day first locale", "03/04/2025", time.UTC, DayFirst, time.Date(2025, 4, 3, 0, 0, 0, 0, time.UTC)},
+		{"us zone beats the locale", "03/04/25", newYork, DayFirst, time.Date(2025, 3, 4, 0, 0, 0, 0, newYork)},
+		{"uk zone beats the locale", "03/04/25", london, MonthFirst, time.Date(2025, 4, 3, 0, 0, 0, 0, london)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseOpened(tt.in, tt.loc, tt.order)
+			if err != nil {
+				t.Fatalf("ParseOpened(%q): %v", tt.in, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("ParseOpened(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestZoneDateOrder(t *testing.T) {
+	tests := []struct {
+		loc  *time.Location
+		want DateOrder
+	}{
+		{nil, UnknownOrder},
+		{time.UTC, UnknownOrder},
+		{mustLocation(t, "America/Los_Angeles"), MonthFirst},
+		{mustLocation(t, "America/Indiana/Indianapolis"), MonthFirst},
+		{mustLocation(t, "Pacific/Honolulu"), MonthFirst},
+		{mustLocation(t, "America/Toronto"), UnknownOrder},
+		{mustLocation(t, "America/Vancouver"), UnknownOrder},
+		{mustLocation(t, "America/St_Johns"), UnknownOrder},
+		{mustLocation(t, "America/Mexico_City"), DayFirst},
+		{mustLocation(t, "Europe/Paris"), DayFirst},
+		{mustLocation(t, "Australia/Sydney"), DayFirst},
+	}
+	for _, tt := range tests {
+		name := "nil"
+		if tt.loc != nil {
+			name = tt.loc.String()
+		}
+		t.Run(name, func(t *testing.T) {
+			if got := ZoneDateOrder(tt.loc); got != tt.want {
+				t.Errorf("ZoneDateOrder(%s) = %v, want %v", name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocaleDateOrder(t *testing.T) {
+	tests := []struct {
+		locale string
+		want   DateOrder
+	}{
+		{"", UnknownOrder},
+		{"en", UnknownOrder},
+		{"en-US", MonthFirst},
+		{"en_US", MonthFirst},
+		{"en-CA", MonthFirst},
+		{"fr-CA", DayFirst},
+		{"en-GB", DayFirst},
+		{"zh-Hant-TW", DayFirst},
+		{"es-419", DayFirst},
+		{"fil-PH", MonthFirst},
+		{"fr-CA,fr;q=0.9,en-US;q=0.8", DayFirst},
+		{"en-US;q=0.9", MonthFirst},
+	}
+	for _, tt := range tests {
+		t.Run(tt.locale, func(t *testing.T) {
+			if got := LocaleDateOrder(tt.locale); got != tt.want {
+				t.Errorf("LocaleDateOrder(%q) = %v, want %v", tt.locale, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"", "UTC"},
+		{"Not/A_Zone", "UTC"},
+		{"Europe/Berlin", "Europe/Berlin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LoadLocation(tt.name).String(); got != tt.want {
+				t.Errorf("LoadLocation(%q) = %s, want %s", tt.name, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package receipt
+
+import (
+	"bytes"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"math/bits"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// PerceptualHashThreshold is the largest Hamming distance between two
+// perceptual hashes that still counts as the same photo.
+const PerceptualHashThreshold = 10
+
+// PerceptualHash returns a 64-bit difference hash of an image: the image is
+// shrunk to 9x8 grayscale and each bit records whether a pixel is brighter
+// than its right-hand neighbour. Re-encoded, resized or slightly re-cropped
+// photos of the same receipt land within a few bits of each other. ok is false
+// for formats the standard library cannot decode (HEIC, WebP).
+func PerceptualHash(data []byte) (hash uint64, ok bool) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, false
+	}
+
+	const w, h = 9, 8
+	var sums [h][w]float64
+	var counts [h][w]int
+
+	bounds := img.Bounds()
+	if bounds.Dx() < w || bounds.Dy() < h {
+		return 0, false
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		cy := (y - bounds.Min.Y) * h / bounds.Dy()
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			cx := (x - bounds.Min.X) * w / bounds.Dx()
+			r, g, b, _ := img.At(x, y).RGBA()
+			sums[cy][cx] += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			counts[cy][cx]++
+		}
+	}
+
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if sums[y][x]/float64(counts[y][x]) > sums[y][x+1]/float64(counts[y][x+1]) {
+				hash |= 1
+			}
+		}
+	}
+	return hash, true
+}
+
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Fingerprint is the part of a receipt that identifies the transaction,
+// independent of how it was photographed.
+type Fingerprint struct {
+	Restaurant  string
+	OrderNumber string
+	Total       float64
+	Opened      time.Time
+}
+
+// Reasons a stored receipt is flagged as a possible duplicate.
+const (
+	DuplicateImage       = "image"
+	DuplicateRestaurant  = "restaurant"
+	DuplicateOrderNumber = "order_number"
+	DuplicateTotal       = "total"
+	DuplicateOpened      = "opened"
+)
+
+// openedTolerance allows for receipts printed a little apart, such as a
+// merchant and customer copy of the same order.
+const openedTolerance = 2 * time.Minute
+
+// DuplicateReasons returns which parts of two fingerprints match, or nil if
+// they do not look like the same transaction. A matching total alone is not
+// enough; it needs the order number or the time to agree as well.
+func (f Fingerprint) DuplicateReasons(other Fingerprint) []string {
+	sameRestaurant := f.Restaurant != "" && normalizeName(f.Restaurant) == normalizeName(other.Restaurant)
+	sameOrder := f.OrderNumber != "" && normalizeName(f.OrderNumber) == normalizeName(other.OrderNumber)
+	sameTotal := f.Total > 0 && math.Abs(f.Total-other.Total) < 0.005
+	sameOpened := !f.Opened.IsZero() && !other.Opened.IsZero() &&
+		f.Opened.Sub(other.Opened).Abs() <= openedTolerance
+
+	if !(sameTotal && (sameOrder || sameOpened)) && !(sameOrder && sameRestaurant) {
+		return nil
+	}
+
+	var reasons []string
+	if sameRestaurant {
+		reasons = append(reasons, DuplicateRestaurant)
+	}
+	if sameOrder {
+		reasons = append(reasons, DuplicateOrderNumber)
+	}
+	if sameTotal {
+		reasons = append(reasons, DuplicateTotal)
+	}
+	if sameOpened {
+		reasons = append(reasons, DuplicateOpened)
+	}
+	return reasons
+}
+
+func (p ParsedReceipt) Fingerprint() Fingerprint {
+	return Fingerprint{
+		Restaurant:  p.Restaurant,
+		OrderNumber: p.OrderNumber,
+		Total:       p.Total,
+		Opened:      p.Opened,
+	}
+}
+
+func normalizeName(s string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
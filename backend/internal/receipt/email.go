@@ -0,0 +1,230 @@
+package receipt
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// EmailAttachment is a decoded MIME part that was sent as a file.
+type EmailAttachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+// Email holds the parts of an RFC 822 message that are useful for receipt extraction.
+type Email struct {
+	From        string
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []EmailAttachment
+}
+
+// Body returns the best plain text representation of the message, preferring the
+// text/plain part and falling back to the HTML part with markup stripped.
+func (e *Email) Body() string {
+	if strings.TrimSpace(e.Text) != "" {
+		return e.Text
+	}
+	return HTMLToText(e.HTML)
+}
+
+// ImageAttachments returns the attachments that can be run through OCR.
+func (e *Email) ImageAttachments() []EmailAttachment {
+	var images []EmailAttachment
+	for _, a := range e.Attachments {
+		if strings.HasPrefix(a.ContentType, "image/") {
+			images = append(images, a)
+		}
+	}
+	return images
+}
+
+// ParseEmail parses a raw RFC 822 message, walking nested multipart bodies.
+func ParseEmail(raw []byte) (*Email, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+
+	dec := new(mime.WordDecoder)
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		subject = msg.Header.Get("Subject")
+	}
+
+	email := &Email{
+		From:    msg.Header.Get("From"),
+		Subject: subject,
+	}
+
+	for _, header := range []string{"To", "Cc", "Delivered-To", "X-Original-To"} {
+		addrs, err := msg.Header.AddressList(header)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			email.To = append(email.To, addr.Address)
+		}
+	}
+
+	err = email.walk(msg.Header, msg.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return email, nil
+}
+
+// partHeader is satisfied by both mail.Header and textproto.MIMEHeader.
+type partHeader interface {
+	Get(key string) string
+}
+
+func (e *Email) walk(header partHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("read multipart: %w", err)
+			}
+			if err := e.walk(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(decodeTransfer(header.Get("Content-Transfer-Encoding"), body))
+	if err != nil {
+		return fmt.Errorf("decode part: %w", err)
+	}
+
+	fileName := attachmentName(header, params)
+	switch {
+	case fileName != "":
+		e.Attachments = append(e.Attachments, EmailAttachment{
+			FileName:    fileName,
+			ContentType: mediaType,
+			Data:        data,
+		})
+	case mediaType == "text/plain" && e.Text == "":
+		e.Text = string(data)
+	case mediaType == "text/html" && e.HTML == "":
+		e.HTML = string(data)
+	}
+
+	return nil
+}
+
+func attachmentName(header partHeader, params map[string]string) string {
+	if _, dispParams, err := mime.ParseMediaType(header.Get("Content-Disposition")); err == nil {
+		if name := dispParams["filename"]; name != "" {
+			return filepath.Base(name)
+		}
+	}
+	if name := params["name"]; name != "" {
+		return filepath.Base(name)
+	}
+	return ""
+}
+
+func decodeTransfer(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: r})
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// newlineStripper drops CR/LF so line-wrapped base64 bodies decode cleanly.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	count, err := n.r.Read(p)
+	out := p[:0]
+	for _, b := range p[:count] {
+		if b != '\r' && b != '\n' {
+			out = append(out, b)
+		}
+	}
+	return len(out), err
+}
+
+// HTMLToText renders an HTML email body as plain text, one block per line.
+func HTMLToText(s string) string {
+	if s == "" {
+		return ""
+	}
+
+	tokenizer := html.NewTokenizer(strings.NewReader(s))
+	var sb strings.Builder
+	skip := 0
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return collapseLines(sb.String())
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				skip++
+			case "br", "p", "div", "tr", "li", "table", "h1", "h2", "h3", "h4":
+				sb.WriteString("\n")
+			case "td", "th":
+				sb.WriteString(" ")
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style", "head":
+				if skip > 0 {
+					skip--
+				}
+			case "p", "div", "tr", "li", "table":
+				sb.WriteString("\n")
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.Write(tokenizer.Text())
+			}
+		}
+	}
+}
+
+func collapseLines(s string) string {
+	var lines []string
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.Join(strings.Fields(line), " ")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,231 @@
+package receipt
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/cache"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/storage"
+)
+
+const purgeBatchSize = 100
+
+// Purger permanently removes receipts and outings once they have been soft
+// deleted for longer than the restore window. Stored images and cache entries
+// are content addressed, so they are only removed when no remaining receipt
+// image has the same hash.
+//
+// It also applies the image retention policy and redacts card numbers from
+// text saved before redaction existed.
+type Purger struct {
+	repo      *repository.Queries
+	storage   storage.Storage
+	cache     *cache.Cache
+	window    time.Duration
+	retention time.Duration
+}
+
+// NewPurger builds a Purger. A zero retention keeps original photos forever.
+func NewPurger(repo *repository.Queries, storage storage.Storage, cache *cache.Cache, window, retention time.Duration) *Purger {
+	return &Purger{repo: repo, storage: storage, cache: cache, window: window, retention: retention}
+}
+
+// Purge removes everything deleted before the restore window and returns the
+// number of receipt images and outings removed.
+func (p *Purger) Purge(ctx context.Context) (int, error) {
+	cutoff := pgtype.Timestamptz{Time: time.Now().Add(-p.window), Valid: true}
+	removed := 0
+
+	for {
+		images, err := p.repo.ListPurgeableReceiptImages(ctx, repository.ListPurgeableReceiptImagesParams{
+			DeletedAt: cutoff,
+			Limit:     purgeBatchSize,
+		})
+		if err != nil {
+			return removed, fmt.Errorf("list receipt images: %w", err)
+		}
+
+		for _, image := range images {
+			if err := p.repo.DeleteReceiptImage(ctx, image.ID); err != nil {
+				return removed, fmt.Errorf("delete receipt image %s: %w", image.ID, err)
+			}
+			removed++
+			p.release(ctx, image)
+		}
+
+		if len(images) < purgeBatchSize {
+			break
+		}
+	}
+
+	outings, err := p.repo.ListPurgeableOutings(ctx, cutoff)
+	if err != nil {
+		return removed, fmt.Errorf("list outings: %w", err)
+	}
+	for _, id := range outings {
+		if err := p.repo.DeleteOuting(ctx, id); err != nil {
+			return removed, fmt.Errorf("delete outing %s: %w", id, err)
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// release removes the stored object and cache entries for an image's content
+// once the last row referencing its hash is gone. Failures only leave an
+// orphaned object behind, so they are logged rather than returned.
+func (p *Purger) release(ctx context.Context, image repository.ListPurgeableReceiptImagesRow) {
+	refs, err := p.repo.CountReceiptImagesByHash(ctx, image.Hash)
+	if err != nil {
+		log.Printf("[WARN] purge: count references to %s: %v", image.Hash, err)
+		return
+	}
+	if refs > 0 {
+		return
+	}
+
+	for _, key := range []pgtype.Text{{String: image.Key, Valid: true}, image.ThumbnailKey, image.MediumKey} {
+		if !key.Valid {
+			continue
+		}
+		if err := p.storage.Delete(ctx, image.Bucket, key.String); err != nil {
+			log.Printf("[WARN] purge: delete object %s/%s: %v", image.Bucket, key.String, err)
+		}
+	}
+	if _, err := p.cache.Forget(ctx, image.Hash); err != nil {
+		log.Printf("[WARN] purge: forget cache entries for %s: %v", image.Hash, err)
+	}
+}
+
+// ExpireOriginals deletes the original photo and medium copy of every image
+// uploaded longer than the retention period ago, and returns how many were
+// removed. The extracted receipt, its text and the thumbnail are kept. A photo
+// shared by several receipts is kept until the newest of them expires.
+func (p *Purger) ExpireOriginals(ctx context.Context) (int, error) {
+	if p.retention <= 0 {
+		return 0, nil
+	}
+
+	cutoff := pgtype.Timestamp{Time: time.Now().Add(-p.retention), Valid: true}
+	removed := 0
+
+	for {
+		originals, err := p.repo.ListExpiredOriginals(ctx, repository.ListExpiredOriginalsParams{
+			CreatedAt: cutoff,
+			Limit:     purgeBatchSize,
+		})
+		if err != nil {
+			return removed, fmt.Errorf("list expired originals: %w", err)
+		}
+
+		for _, original := range originals {
+			for _, key := range []string{original.Key, original.MediumKey} {
+				if key == "" {
+					continue
+				}
+				if err := p.storage.Delete(ctx, original.Bucket, key); err != nil {
+					return removed, fmt.Errorf("delete object %s/%s: %w", original.Bucket, key, err)
+				}
+			}
+			if err := p.repo.MarkOriginalDeleted(ctx, original.Hash); err != nil {
+				return removed, fmt.Errorf("mark original %s deleted: %w", original.Hash, err)
+			}
+			removed++
+		}
+
+		if len(originals) < purgeBatchSize {
+			return removed, nil
+		}
+	}
+}
+
+// RedactText masks card numbers in text saved before it was redacted on the
+// way in, along with the OCR output cached for the same image, and returns how
+// many rows were updated.
+func (p *Purger) RedactText(ctx context.Context) (int, error) {
+	updated := 0
+
+	for {
+		rows, err := p.repo.ListUnredactedReceiptImages(ctx, purgeBatchSize)
+		if err != nil {
+			return updated, fmt.Errorf("list unredacted text: %w", err)
+		}
+
+		for _, row := range rows {
+			err := p.repo.SetRedactedRawText(ctx, repository.SetRedactedRawTextParams{
+				ID:      row.ID,
+				RawText: RedactCardNumbers(row.RawText),
+			})
+			if err != nil {
+				return updated, fmt.Errorf("redact text of %s: %w", row.ID, err)
+			}
+			p.redactCache(ctx, row.Hash)
+			updated++
+		}
+
+		if len(rows) < purgeBatchSize {
+			return updated, nil
+		}
+	}
+}
+
+// redactCache rewrites the cached OCR lines for an image if they still hold
+// card numbers. A failure leaves the entry to expire on its own, so it is only
+// logged.
+func (p *Purger) redactCache(ctx context.Context, hash string) {
+	key := ocrKey(hash)
+	lines, ok := cache.GetJSON[[]string](ctx, p.cache, key)
+	if !ok {
+		return
+	}
+	redacted := redactLines(lines)
+	if slices.Equal(lines, redacted) {
+		return
+	}
+	if err := cache.SetJSON(ctx, p.cache, key, redacted); err != nil {
+		log.Printf("[WARN] text redaction: %v", err)
+	}
+}
+
+func (p *Purger) run(ctx context.Context) {
+	if n, err := p.Purge(ctx); err != nil {
+		log.Printf("[WARN] receipt purge: %v", err)
+	} else if n > 0 {
+		log.Printf("receipt purge removed %d rows", n)
+	}
+
+	if n, err := p.ExpireOriginals(ctx); err != nil {
+		log.Printf("[WARN] image retention: %v", err)
+	} else if n > 0 {
+		log.Printf("image retention removed %d originals", n)
+	}
+
+	if n, err := p.RedactText(ctx); err != nil {
+		log.Printf("[WARN] text redaction: %v", err)
+	} else if n > 0 {
+		log.Printf("text redaction updated %d rows", n)
+	}
+}
+
+// Start runs the purge, retention and redaction jobs every interval until
+// ctx is done.
+func (p *Purger) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.run(ctx)
+			}
+		}
+	}()
+}
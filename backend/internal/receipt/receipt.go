@@ -4,123 +4,216 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log"
 	"path/filepath"
 	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/cache"
 	"github.com/sharithg/civet/internal/cloudvision"
 	"github.com/sharithg/civet/internal/genai"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/internal/storage"
 )
 
-const prompt = "Convert the given text of a receipt into a structured output format"
+const prompt = "Convert the given text of a receipt into a structured output format. " +
+	"Attach modifiers and item discounts to the item they belong to, and keep service charges separate from the tip"
+
+// DefaultBucket is the bucket receipts are uploaded to unless the caller
+// sets Extract.Bucket.
+const DefaultBucket = "receipts"
 
 type Extract struct {
-	ImageBytes   []byte
-	FileName     string
-	ImageHash    string
-	FileExt      string
+	ImageBytes  []byte
+	FileName    string
+	ImageHash   string
+	FileExt     string
+	ContentType string
+	Location    *time.Location
+	// DateOrder is how the user reads numeric dates, for when Location
+	// doesn't settle it.
+	DateOrder DateOrder
+	// Bucket is where Upload stores the original and its variants.
+	Bucket string
+	// Usage totals the model tokens spent by this extraction; cache hits cost nothing.
+	Usage genai.Usage
+	// ModelCalled is set once StructuredOutput has sent the text to the model
+	// rather than answering from the cache.
+	ModelCalled bool
+	// Variants is filled in by Upload with the keys of the resized copies.
+	Variants ImageVariants
+	// original, when set, is streamed to storage instead of ImageBytes.
+	original     *Upload
+	text         string
 	visionClient *cloudvision.CloudVision
 	openaiClient genai.OpenAi
 	storage      storage.Storage
+	cache        *cache.Cache
 	Repo         *repository.Queries
 }
 
-func NewExtract(ctx context.Context, storage storage.Storage, openai genai.OpenAi, repo *repository.Queries, imageBytes []byte, fname string, credentials string) (*Extract, error) {
+func NewExtract(ctx context.Context, storage storage.Storage, openai genai.OpenAi, repo *repository.Queries, cache *cache.Cache, imageBytes []byte, fname string, credentials string) (*Extract, error) {
+	visionClient, err := cloudvision.NewCloudVision(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewExtractWithVision(storage, openai, repo, cache, visionClient, imageBytes, fname), nil
+}
+
+// NewExtractWithVision is NewExtract with an existing Vision client, for callers
+// that run many images through one client.
+func NewExtractWithVision(storage storage.Storage, openai genai.OpenAi, repo *repository.Queries, cache *cache.Cache, visionClient *cloudvision.CloudVision, imageBytes []byte, fname string) *Extract {
 	hash := sha256.Sum256(imageBytes)
-	imageHash := hex.EncodeToString(hash[:])
-	ext := strings.TrimPrefix(filepath.Ext(fname), ".")
+	return newImageExtract(storage, openai, repo, cache, visionClient, imageBytes, hex.EncodeToString(hash[:]), fname, DetectImageType(imageBytes))
+}
+
+// NewUploadExtract is NewExtract for an upload that was hashed as it was read.
+// The original is streamed from the upload when it is stored.
+func NewUploadExtract(ctx context.Context, storage storage.Storage, openai genai.OpenAi, repo *repository.Queries, cache *cache.Cache, upload *Upload, credentials string) (*Extract, error) {
+	visionClient, err := cloudvision.NewCloudVision(ctx, credentials)
+	if err != nil {
+		return nil, err
+	}
 
-	visionClient, err := cloudvision.NewCloudVision(ctx, "cache/cloud_vision", credentials)
+	// OCR, the perceptual hash and the variants all need the image itself
+	data, err := upload.Bytes()
 	if err != nil {
 		return nil, err
 	}
 
+	e := newImageExtract(storage, openai, repo, cache, visionClient, data, upload.Hash, upload.FileName, upload.ContentType)
+	e.original = upload
+	return e, nil
+}
+
+// newImageExtract stores the image under the extension of its detected
+// content type, falling back to the file name's when it could not be told.
+func newImageExtract(storage storage.Storage, openai genai.OpenAi, repo *repository.Queries, cache *cache.Cache, visionClient *cloudvision.CloudVision, imageBytes []byte, imageHash, fname, contentType string) *Extract {
+	ext, ok := imageExts[contentType]
+	if !ok {
+		ext = strings.TrimPrefix(filepath.Ext(fname), ".")
+	}
+	if contentType == "" {
+		contentType = "image/" + ext
+	}
+
 	return &Extract{
 		ImageBytes:   imageBytes,
 		FileName:     fname,
 		ImageHash:    imageHash,
 		FileExt:      ext,
+		ContentType:  contentType,
+		Bucket:       DefaultBucket,
 		visionClient: visionClient,
 		openaiClient: openai,
 		storage:      storage,
+		cache:        cache,
 		Repo:         repo,
-	}, nil
+	}
+}
+
+// NewTextExtract builds an extraction for content that already has a text form,
+// such as a forwarded e-receipt. The raw bytes are stored as-is and OCR is skipped.
+func NewTextExtract(storage storage.Storage, openai genai.OpenAi, repo *repository.Queries, cache *cache.Cache, raw []byte, fname, contentType, text string) *Extract {
+	hash := sha256.Sum256(raw)
+	ext := strings.TrimPrefix(filepath.Ext(fname), ".")
+
+	return &Extract{
+		ImageBytes:   raw,
+		FileName:     fname,
+		ImageHash:    hex.EncodeToString(hash[:]),
+		FileExt:      ext,
+		ContentType:  contentType,
+		Bucket:       DefaultBucket,
+		text:         text,
+		openaiClient: openai,
+		storage:      storage,
+		cache:        cache,
+		Repo:         repo,
+	}
 }
 
 func (e *Extract) Upload(ctx context.Context) (bucket, key string, err error) {
 	objectName := fmt.Sprintf("%s.%s", e.ImageHash, e.FileExt)
-	bucket = "receipts"
-	_, err = e.storage.UploadImageBytes(ctx, bucket, objectName, e.ImageBytes, "image/"+e.FileExt)
-	return bucket, objectName, err
+	if e.original != nil {
+		err = e.storage.Put(ctx, e.Bucket, objectName, e.original.Open(), e.original.Size, e.ContentType)
+	} else {
+		err = storage.PutBytes(ctx, e.storage, e.Bucket, objectName, e.ImageBytes, e.ContentType)
+	}
+	if err != nil {
+		return e.Bucket, objectName, err
+	}
+
+	e.uploadVariants(ctx, e.Bucket)
+	return e.Bucket, objectName, nil
 }
 
+// ExtractText returns the receipt's text with card numbers redacted, so they
+// never reach the model or the database.
 func (e *Extract) ExtractText(ctx context.Context) (string, error) {
-	existing, err := e.Repo.GetCachedCloudVisionResponse(ctx, e.ImageHash)
-
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		return "", err
+	if e.visionClient == nil {
+		return RedactCardNumbers(e.text), nil
 	}
 
-	if !errors.Is(err, pgx.ErrNoRows) {
-		return strings.Join(existing, "\n"), nil
+	key := ocrKey(e.ImageHash)
+
+	if lines, ok := cache.GetJSON[[]string](ctx, e.cache, key); ok {
+		return RedactCardNumbers(strings.Join(lines, "\n")), nil
 	}
 
 	annotations, err := e.visionClient.DetectText(ctx, e.ImageBytes)
 	if err != nil {
 		return "", err
 	}
-	lines := GroupTextByLines(annotations, 10)
-	_, err = e.Repo.InsertCachedCloudVisionResponse(ctx, repository.InsertCachedCloudVisionResponseParams{
-		ImageHash: e.ImageHash,
-		Response:  lines,
-	})
-	if err != nil {
-		return "", err
+	lines := redactLines(GroupTextByLines(annotations, 10))
+
+	if err := cache.SetJSON(ctx, e.cache, key, lines); err != nil {
+		log.Printf("[WARN] %v", err)
 	}
 
 	return strings.Join(lines, "\n"), nil
 }
 
-func (e *Extract) StructuredOutput(ctx context.Context, input string) (Receipt, error) {
-	var Schema = GenerateSchema[Receipt]()
-
-	existing, err := e.Repo.GetCachedGenAiResponse(ctx, e.ImageHash)
-	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
-		return Receipt{}, err
+func ocrKey(imageHash string) cache.Key {
+	return cache.Key{
+		Stage:     cache.StageOCR,
+		Provider:  cloudvision.Provider,
+		Model:     cloudvision.Model,
+		InputHash: imageHash,
 	}
+}
 
-	if !errors.Is(err, pgx.ErrNoRows) {
-		var output Receipt
-		err = json.Unmarshal(existing, &output)
-		if err != nil {
-			return Receipt{}, err
-		}
-		return output, nil
+// structuredKey keys the LLM output on the image hash rather than the OCR text,
+// so a receipt is only sent to the model once per prompt and schema version.
+func (e *Extract) structuredKey() cache.Key {
+	return cache.Key{
+		Stage:         cache.StageStructured,
+		Provider:      genai.Provider,
+		Model:         e.openaiClient.Model,
+		PromptVersion: PromptVersion + "/" + SchemaVersion(),
+		InputHash:     e.ImageHash,
 	}
+}
 
-	output, err := genai.JsonChat[Receipt](ctx, &e.openaiClient, prompt, input, "receipt_info", Schema)
-	if err != nil {
-		return Receipt{}, err
+func (e *Extract) StructuredOutput(ctx context.Context, input string) (Receipt, error) {
+	var Schema = GenerateSchema[Receipt]()
+
+	key := e.structuredKey()
+	if output, ok := cache.GetJSON[Receipt](ctx, e.cache, key); ok {
+		return output, nil
 	}
 
-	jsonOutput, err := json.Marshal(output)
+	output, usage, err := genai.JsonChat[Receipt](ctx, &e.openaiClient, prompt, input, "receipt_info", Schema)
+	e.ModelCalled = true
+	e.Usage.Add(usage)
 	if err != nil {
 		return Receipt{}, err
 	}
 
-	_, err = e.Repo.InsertCachedGenAiResponse(ctx, repository.InsertCachedGenAiResponseParams{
-		ImageHash: e.ImageHash,
-		Response:  jsonOutput,
-	})
-	if err != nil {
-		return Receipt{}, err
+	if err := cache.SetJSON(ctx, e.cache, key, output); err != nil {
+		log.Printf("[WARN] %v", err)
 	}
 
 	return output, nil
@@ -152,21 +245,20 @@ func (e *Extract) Run(ctx context.Context) (ParsedReceipt, string, string, strin
 }
 
 func (e *Extract) ToModel(output Receipt) (ParsedReceipt, error) {
-	dateStr := output.Opened
 	var parsed time.Time
 
-	if dateStr != "" {
-		t, err := time.Parse(time.RFC3339, dateStr)
+	if output.Opened != "" {
+		t, err := ParseOpened(output.Opened, e.Location, e.DateOrder)
 		if err != nil {
-			t, err = time.Parse("2006-01-02 15:04:05", dateStr)
-		}
-		if err != nil {
-			log.Printf("[WARN] Unable to parse date string: %s, err: %v", dateStr, err)
+			log.Printf("[WARN] Unable to parse date string: %s, err: %v", output.Opened, err)
 		} else {
 			parsed = t
 		}
 	}
 
+	payment := output.Payment
+	payment.CardLastFour = CardLastFour(payment.CardLastFour)
+
 	return ParsedReceipt{
 		Receipt: Receipt{
 			Restaurant:  output.Restaurant,
@@ -180,9 +272,10 @@ func (e *Extract) ToModel(output Receipt) (ParsedReceipt, error) {
 			Subtotal:    output.Subtotal,
 			SalesTax:    output.SalesTax,
 			Total:       output.Total,
-			Payment:     output.Payment,
+			Payment:     payment,
 			Copy:        output.Copy,
 			OtherFees:   output.OtherFees,
+			Discounts:   output.Discounts,
 		},
 		Opened: parsed,
 	}, nil
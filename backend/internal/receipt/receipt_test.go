@@ -0,0 +1,164 @@
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	vision "cloud.google.com/go/vision/v2/apiv1"
+	"github.com/openai/openai-go/option"
+	"github.com/sharithg/civet/internal/cloudvision"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/recorder"
+	googleoption "google.golang.org/api/option"
+	htransport "google.golang.org/api/transport/http"
+)
+
+// Run with -record (and GOOGLE_CLOUD_VISION_CREDENTIALS / OPENAI_API_KEY set)
+// after adding images or changing the prompt or schema, then -update to accept
+// the new output.
+var (
+	record = flag.Bool("record", false, "call the live Vision and OpenAI APIs and save fixtures")
+	update = flag.Bool("update", false, "rewrite golden files from the current output")
+)
+
+const (
+	receiptsDir = "testdata/receipts"
+	fixturesDir = "testdata/fixtures"
+	goldenDir   = "testdata/golden"
+)
+
+// golden is the end-to-end output for one receipt image.
+type golden struct {
+	Text    string    `json:"text"`
+	Receipt Receipt   `json:"receipt"`
+	Opened  time.Time `json:"opened"`
+}
+
+func TestExtractGolden(t *testing.T) {
+	images, err := filepath.Glob(filepath.Join(receiptsDir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) == 0 {
+		t.Skip("no receipt images in " + receiptsDir)
+	}
+
+	visionClient, openaiClient := newRecordedClients(t)
+
+	for _, path := range images {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash := sha256.Sum256(data)
+
+			e := &Extract{
+				ImageBytes:   data,
+				FileName:     filepath.Base(path),
+				ImageHash:    hex.EncodeToString(hash[:]),
+				Location:     time.UTC,
+				visionClient: visionClient,
+				openaiClient: openaiClient,
+			}
+
+			text, err := e.ExtractText(ctx)
+			if err != nil {
+				t.Fatalf("ExtractText: %v", err)
+			}
+			output, err := e.StructuredOutput(ctx, text)
+			if err != nil {
+				t.Fatalf("StructuredOutput: %v", err)
+			}
+			parsed, err := e.ToModel(output)
+			if err != nil {
+				t.Fatalf("ToModel: %v", err)
+			}
+
+			got, err := json.MarshalIndent(golden{Text: text, Receipt: parsed.Receipt, Opened: parsed.Opened}, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			goldenPath := filepath.Join(goldenDir, name+".json")
+			if *update {
+				if err := os.MkdirAll(goldenDir, os.ModePerm); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(goldenPath, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("read golden file (run with -update to create it): %v", err)
+			}
+			if !bytes.Equal(want, got) {
+				t.Errorf("output differs from %s; run with -update if the change is expected\ngot:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// newRecordedClients returns Vision and OpenAI clients that replay fixtures,
+// or call the live APIs and save fixtures when -record is set.
+func newRecordedClients(t *testing.T) (*cloudvision.CloudVision, genai.OpenAi) {
+	t.Helper()
+	ctx := context.Background()
+
+	mode := recorder.Replay
+	var visionBase http.RoundTripper
+	apiKey := "replay"
+
+	if *record {
+		mode = recorder.Record
+
+		opts := []googleoption.ClientOption{googleoption.WithScopes(vision.DefaultAuthScopes()...)}
+		if credentials := os.Getenv("GOOGLE_CLOUD_VISION_CREDENTIALS"); credentials != "" {
+			opts = append(opts, googleoption.WithCredentialsFile(credentials))
+		}
+		// The recorder sits in front of the authenticating transport, so
+		// credentials never reach the fixtures.
+		base, err := htransport.NewTransport(ctx, http.DefaultTransport, opts...)
+		if err != nil {
+			t.Fatalf("vision credentials: %v", err)
+		}
+		visionBase = base
+
+		apiKey = os.Getenv("OPENAI_API_KEY")
+		if apiKey == "" {
+			t.Fatal("OPENAI_API_KEY must be set with -record")
+		}
+	}
+
+	visionClient, err := cloudvision.NewCloudVisionHTTP(ctx, recorder.New(fixturesDir, mode, visionBase).Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	openaiClient := genai.NewOpenAiClient(
+		&config.Config{OpenAIAPIKey: apiKey},
+		option.WithHTTPClient(recorder.New(fixturesDir, mode, nil).Client()),
+		option.WithMaxRetries(0),
+	)
+
+	return visionClient, openaiClient
+}
@@ -0,0 +1,70 @@
+package receipt
+
+import (
+	"regexp"
+	"strings"
+)
+
+// cardNumber matches the ways card numbers are printed: 13 to 19 digits in a
+// row, in groups of four, or grouped 4-6-5 like American Express.
+var cardNumber = regexp.MustCompile(`\b(?:\d{13,19}|\d{4}(?:[ -]\d{4}){2}[ -]\d{1,7}|\d{4}[ -]\d{6}[ -]\d{5})\b`)
+
+// RedactCardNumbers masks every full card number in OCR text, leaving the
+// last four digits so the model can still fill in the card on the receipt.
+// Only numbers with a card network prefix (2 to 6) that pass the Luhn check
+// are touched, which keeps most order, survey and transaction numbers of the
+// same length intact.
+func RedactCardNumbers(text string) string {
+	return cardNumber.ReplaceAllStringFunc(text, func(match string) string {
+		digits := strings.Map(func(r rune) rune {
+			if r >= '0' && r <= '9' {
+				return r
+			}
+			return -1
+		}, match)
+		if digits[0] < '2' || digits[0] > '6' || !luhn(digits) {
+			return match
+		}
+
+		masked := []byte(match)
+		keep := 4
+		for i := len(masked) - 1; i >= 0; i-- {
+			if masked[i] < '0' || masked[i] > '9' {
+				continue
+			}
+			if keep > 0 {
+				keep--
+				continue
+			}
+			masked[i] = '*'
+		}
+		return string(masked)
+	})
+}
+
+// redactLines redacts each OCR line. Card numbers never span lines, so this
+// matches redacting the joined text.
+func redactLines(lines []string) []string {
+	redacted := make([]string, len(lines))
+	for i, line := range lines {
+		redacted[i] = RedactCardNumbers(line)
+	}
+	return redacted
+}
+
+func luhn(digits string) bool {
+	sum := 0
+	double := false
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,77 @@
+package receipt
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRedactCardNumbers(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"visa", "CARD 4111111111111111", "CARD ************1111"},
+		{"visa spaced", "4111 1111 1111 1111", "**** **** **** 1111"},
+		{"visa dashed", "4111-1111-1111-1111", "****-****-****-1111"},
+		{"mastercard", "5555555555554444 APPROVED", "************4444 APPROVED"},
+		{"mastercard 2 series", "2223003122003222", "************3222"},
+		{"amex 4-6-5", "AMEX 3782 822463 10005", "AMEX **** ****** *0005"},
+		{"amex run together", "378282246310005", "***********0005"},
+		{"discover", "6011111111111117", "************1117"},
+		{"thirteen digits", "4222222222222", "*********2222"},
+		{"nineteen digits", "4000000000000000006", "***************0006"},
+		{"several on one receipt", "4111111111111111 / 5555555555554444", "************1111 / ************4444"},
+		{"multiline", "VISA\n4111111111111111\nTOTAL 12.00", "VISA\n************1111\nTOTAL 12.00"},
+		{"already masked", "XXXXXXXXXXXX1111", "XXXXXXXXXXXX1111"},
+		{"last four only", "VISA ****1111", "VISA ****1111"},
+		{"fails luhn", "4111111111111112", "4111111111111112"},
+		{"non card prefix", "1234567812345670", "1234567812345670"},
+		{"order number", "ORDER 9000000000000001", "ORDER 9000000000000001"},
+		{"too short", "411111111111", "411111111111"},
+		{"too long", "41111111111111111111", "41111111111111111111"},
+		{"part of a longer token", "REF4111111111111111", "REF4111111111111111"},
+		{"phone number", "(555) 123-4567", "(555) 123-4567"},
+		{"prices", "2 x 4.50 = 9.00", "2 x 4.50 = 9.00"},
+		{"empty", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RedactCardNumbers(tt.in); got != tt.want {
+				t.Errorf("RedactCardNumbers(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactLines(t *testing.T) {
+	lines := []string{"VISA", "4111 1111 1111 1111", "THANK YOU"}
+	want := []string{"VISA", "**** **** **** 1111", "THANK YOU"}
+
+	got := redactLines(lines)
+	if !slices.Equal(got, want) {
+		t.Errorf("redactLines = %q, want %q", got, want)
+	}
+	if lines[1] != "4111 1111 1111 1111" {
+		t.Error("redactLines modified its input")
+	}
+}
+
+func TestLuhn(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   bool
+	}{
+		{"4111111111111111", true},
+		{"4111111111111112", false},
+		{"378282246310005", true},
+		{"79927398713", true},
+		{"79927398710", false},
+		{"0", true},
+	}
+	for _, tt := range tests {
+		if got := luhn(tt.digits); got != tt.want {
+			t.Errorf("luhn(%s) = %v, want %v", tt.digits, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+package receipt
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sharithg/civet/internal/cache"
+	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/outingstatus"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+var (
+	ErrReceiptLocked  = errors.New("receipt belongs to a locked or settled outing")
+	ErrReceiptDeleted = errors.New("receipt has been deleted")
+)
+
+// FieldDiff is a single value that differs between the stored receipt and a
+// fresh extraction. Item fields are keyed by item name, e.g. items[Burger].price.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   any    `json:"old"`
+	New   any    `json:"new"`
+}
+
+// ReprocessPlan describes what re-running extraction would change for one receipt.
+type ReprocessPlan struct {
+	ReceiptID         uuid.UUID   `json:"receipt_id"`
+	FromPromptVersion string      `json:"from_prompt_version"`
+	FromSchemaVersion string      `json:"from_schema_version"`
+	ToPromptVersion   string      `json:"to_prompt_version"`
+	ToSchemaVersion   string      `json:"to_schema_version"`
+	SplitsRemoved     int64       `json:"splits_removed"`
+	Changes           []FieldDiff `json:"changes"`
+
+	parsed ParsedReceipt
+}
+
+// Reprocessor re-runs structured extraction over the OCR text stored with each
+// receipt, so prompt or schema changes can be applied to existing data.
+type Reprocessor struct {
+	db     *pgxpool.Pool
+	repo   *repository.Queries
+	openai genai.OpenAi
+	cache  *cache.Cache
+}
+
+func NewReprocessor(db *pgxpool.Pool, repo *repository.Queries, openai genai.OpenAi, cache *cache.Cache) *Reprocessor {
+	return &Reprocessor{db: db, repo: repo, openai: openai, cache: cache}
+}
+
+// Outdated lists receipts extracted with a prompt or schema other than the
+// current one. Deleted receipts and receipts on outings whose splits are fixed
+// are left out.
+func (p *Reprocessor) Outdated(ctx context.Context, limit int32) ([]repository.ListOutdatedReceiptsRow, error) {
+	return p.repo.ListOutdatedReceipts(ctx, repository.ListOutdatedReceiptsParams{
+		PromptVersion: PromptVersion,
+		SchemaVersion: SchemaVersion(),
+		Limit:         limit,
+	})
+}
+
+// Plan runs the current extraction for a receipt without saving it and returns
+// the differences from what is stored.
+func (p *Reprocessor) Plan(ctx context.Context, receiptId uuid.UUID) (*ReprocessPlan, error) {
+	if err := checkReprocessable(ctx, p.repo, receiptId); err != nil {
+		return nil, err
+	}
+
+	row, err := p.repo.GetReceiptForReprocess(ctx, receiptId)
+	if err != nil {
+		return nil, fmt.Errorf("get receipt: %w", err)
+	}
+
+	stored, err := storedReceipt(row)
+	if err != nil {
+		return nil, err
+	}
+
+	timezone, err := p.repo.GetOutingTimezone(ctx, row.OutingID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("get timezone: %w", err)
+	}
+
+	locale, err := p.repo.GetOutingOwnerLocale(ctx, row.OutingID)
+	if err != nil && err != pgx.ErrNoRows {
+		return nil, fmt.Errorf("get locale: %w", err)
+	}
+
+	e := &Extract{
+		ImageHash:    row.Hash,
+		Location:     LoadLocation(timezone),
+		DateOrder:    LocaleDateOrder(locale),
+		text:         row.RawText,
+		openaiClient: p.openai,
+		cache:        p.cache,
+		Repo:         p.repo,
+	}
+
+	output, err := e.StructuredOutput(ctx, row.RawText)
+	if err != nil {
+		return nil, fmt.Errorf("structured output: %w", err)
+	}
+
+	parsed, err := e.ToModel(output)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ReprocessPlan{
+		ReceiptID:         row.ID,
+		FromPromptVersion: row.PromptVersion,
+		FromSchemaVersion: row.SchemaVersion,
+		ToPromptVersion:   PromptVersion,
+		ToSchemaVersion:   SchemaVersion(),
+		SplitsRemoved:     row.SplitCount,
+		Changes:           DiffReceipts(stored, parsed.Receipt),
+		parsed:            parsed,
+	}, nil
+}
+
+// Apply replaces the stored receipt with the plan's extraction. Line items are
+// recreated, so any splits on the receipt are removed. The receipt is checked
+// again under a row lock, since the outing may have been locked or the receipt
+// deleted since the plan was made.
+func (p *Reprocessor) Apply(ctx context.Context, plan *ReprocessPlan) error {
+	tx, err := p.db.BeginTx(ctx, pgx.TxOptions{})
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	q := p.repo.WithTx(tx)
+	parsed := plan.parsed
+
+	if err := checkReprocessable(ctx, q, plan.ReceiptID); err != nil {
+		return err
+	}
+
+	if err := q.DeleteSplit(ctx, plan.ReceiptID); err != nil {
+		return fmt.Errorf("delete splits: %w", err)
+	}
+	if err := q.DeleteDiscounts(ctx, plan.ReceiptID); err != nil {
+		return fmt.Errorf("delete discounts: %w", err)
+	}
+	if err := q.DeleteOtherFees(ctx, plan.ReceiptID); err != nil {
+		return fmt.Errorf("delete other_fees: %w", err)
+	}
+	if err := q.DeleteOrderItems(ctx, plan.ReceiptID); err != nil {
+		return fmt.Errorf("delete order_items: %w", err)
+	}
+
+	err = q.UpdateReceiptExtraction(ctx, repository.UpdateReceiptExtractionParams{
+		ID:         plan.ReceiptID,
+		Restaurant: parsed.Restaurant,
+		Address:    parsed.Address,
+		Opened: pgtype.Timestamptz{
+			Time:  parsed.Opened,
+			Valid: !parsed.Opened.IsZero(),
+		},
+		OpenedRaw:     parsed.Receipt.Opened,
+		OrderNumber:   parsed.OrderNumber,
+		OrderType:     parsed.OrderType,
+		TableNumber:   parsed.Table,
+		Server:        parsed.Server,
+		Subtotal:      sql.NullFloat64{Float64: parsed.Subtotal, Valid: true},
+		SalesTax:      sql.NullFloat64{Float64: parsed.SalesTax, Valid: true},
+		Total:         sql.NullFloat64{Float64: parsed.Total, Valid: true},
+		Copy:          parsed.Copy,
+		PaymentMethod: parsed.Payment.Method,
+		PaymentAmountPaid: sql.NullFloat64{
+			Float64: parsed.Payment.AmountPaid,
+			Valid:   parsed.Payment.AmountPaid != 0,
+		},
+		PaymentTip:          sql.NullFloat64{Float64: parsed.Payment.Tip, Valid: true},
+		PaymentCardLastFour: parsed.Payment.CardLastFour,
+		PromptVersion:       plan.ToPromptVersion,
+		SchemaVersion:       plan.ToSchemaVersion,
+	})
+	if err != nil {
+		return fmt.Errorf("update receipt: %w", err)
+	}
+
+	if err := SaveLineItems(ctx, q, plan.ReceiptID, parsed); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// checkReprocessable rejects receipts that are deleted or whose outing is
+// past the point where splits may change.
+func checkReprocessable(ctx context.Context, q *repository.Queries, receiptId uuid.UUID) error {
+	state, err := q.GetReceiptReprocessState(ctx, receiptId)
+	if err != nil {
+		return fmt.Errorf("get receipt: %w", err)
+	}
+	if state.Deleted {
+		return ErrReceiptDeleted
+	}
+	if !outingstatus.SplitsEditable(state.Status) {
+		return ErrReceiptLocked
+	}
+	return nil
+}
+
+type storedItem struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	Price        float64 `json:"price"`
+	Quantity     int     `json:"quantity"`
+	Taxable      bool    `json:"taxable"`
+	ParentItemID *string `json:"parent_item_id"`
+}
+
+type storedDiscount struct {
+	OrderItemID *string `json:"order_item_id"`
+	Name        string  `json:"name"`
+	Amount      float64 `json:"amount"`
+}
+
+// storedReceipt rebuilds the extraction output from the saved rows so it can be
+// compared with a fresh extraction.
+func storedReceipt(row repository.GetReceiptForReprocessRow) (Receipt, error) {
+	var items []storedItem
+	if err := json.Unmarshal(row.Items, &items); err != nil {
+		return Receipt{}, fmt.Errorf("unmarshal items: %w", err)
+	}
+	var fees []OtherFee
+	if err := json.Unmarshal(row.Fees, &fees); err != nil {
+		return Receipt{}, fmt.Errorf("unmarshal fees: %w", err)
+	}
+	var discounts []storedDiscount
+	if err := json.Unmarshal(row.Discounts, &discounts); err != nil {
+		return Receipt{}, fmt.Errorf("unmarshal discounts: %w", err)
+	}
+
+	out := Receipt{
+		Restaurant:  row.Restaurant,
+		Address:     row.Address,
+		Opened:      row.OpenedRaw,
+		OrderNumber: row.OrderNumber,
+		OrderType:   row.OrderType,
+		Table:       row.TableNumber,
+		Server:      row.Server,
+		Subtotal:    row.Subtotal.Float64,
+		SalesTax:    row.SalesTax.Float64,
+		Total:       row.Total.Float64,
+		Payment: PaymentDetails{
+			Method:       row.PaymentMethod,
+			AmountPaid:   row.PaymentAmountPaid.Float64,
+			Tip:          row.PaymentTip.Float64,
+			CardLastFour: row.PaymentCardLastFour,
+		},
+		Copy:      row.Copy,
+		OtherFees: fees,
+	}
+
+	index := map[string]int{}
+	for _, item := range items {
+		if item.ParentItemID == nil {
+			index[item.ID] = len(out.Items)
+			out.Items = append(out.Items, OrderItem{
+				Name:     item.Name,
+				Price:    item.Price,
+				Quantity: item.Quantity,
+				Taxable:  item.Taxable,
+			})
+		}
+	}
+	for _, item := range items {
+		if item.ParentItemID != nil {
+			if i, ok := index[*item.ParentItemID]; ok {
+				out.Items[i].Modifiers = append(out.Items[i].Modifiers, ItemModifier{Name: item.Name, Price: item.Price})
+			}
+		}
+	}
+	for _, d := range discounts {
+		discount := Discount{Name: d.Name, Amount: d.Amount}
+		if i, ok := index[deref(d.OrderItemID)]; ok {
+			out.Items[i].Discounts = append(out.Items[i].Discounts, discount)
+		} else {
+			out.Discounts = append(out.Discounts, discount)
+		}
+	}
+
+	return out, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// DiffReceipts lists the leaf values that differ between two receipts.
+func DiffReceipts(old, new Receipt) []FieldDiff {
+	before, after := map[string]any{}, map[string]any{}
+	flattenJSON(old, before)
+	flattenJSON(new, after)
+
+	keys := map[string]struct{}{}
+	for k := range before {
+		keys[k] = struct{}{}
+	}
+	for k := range after {
+		keys[k] = struct{}{}
+	}
+
+	var diffs []FieldDiff
+	for k := range keys {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			diffs = append(diffs, FieldDiff{Field: k, Old: before[k], New: after[k]})
+		}
+	}
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+	return diffs
+}
+
+func flattenJSON(v any, out map[string]any) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	var generic any
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return
+	}
+	flatten("", generic, out)
+}
+
+func flatten(prefix string, v any, out map[string]any) {
+	switch val := v.(type) {
+	case map[string]any:
+		for k, child := range val {
+			key := k
+			if prefix != "" {
+				key = prefix + "." + k
+			}
+			flatten(key, child, out)
+		}
+	case []any:
+		seen := map[string]int{}
+		for i, child := range val {
+			label := fmt.Sprint(i)
+			if m, ok := child.(map[string]any); ok {
+				if name, ok := m["name"].(string); ok && name != "" {
+					seen[name]++
+					label = name
+					if seen[name] > 1 {
+						label = fmt.Sprintf("%s#%d", name, seen[name])
+					}
+				}
+			}
+			flatten(fmt.Sprintf("%s[%s]", prefix, label), child, out)
+		}
+	default:
+		out[prefix] = val
+	}
+}
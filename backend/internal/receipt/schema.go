@@ -16,24 +16,41 @@ type Receipt struct {
 	Total       float64        `json:"total" jsonschema_description:"Total amount of the order"`
 	Payment     PaymentDetails `json:"payment" jsonschema_description:"Payment information"`
 	Copy        string         `json:"copy" jsonschema_description:"Receipt copy type (e.g., customer, merchant)"`
-	OtherFees   []OtherFee     `json:"other_fees" jsonschema_description:"List of additional fees applied to the order"`
+	OtherFees   []OtherFee     `json:"other_fees" jsonschema_description:"List of additional fees applied to the order, excluding tax and tip"`
+	Discounts   []Discount     `json:"discounts" jsonschema_description:"Discounts or coupons applied to the whole order rather than a single item"`
 }
 
 type OrderItem struct {
-	Name     string  `json:"name" jsonschema_description:"Name of the ordered item"`
-	Price    float64 `json:"price" jsonschema_description:"Price of the ordered item"`
-	Quantity int     `json:"quantity" jsonschema_description:"Quantity of the ordered item"`
+	Name      string         `json:"name" jsonschema_description:"Name of the ordered item"`
+	Price     float64        `json:"price" jsonschema_description:"Unit price of the ordered item, excluding modifiers"`
+	Quantity  int            `json:"quantity" jsonschema_description:"Quantity of the ordered item"`
+	Taxable   bool           `json:"taxable" jsonschema_description:"Whether sales tax applies to this item (false for items marked non-taxable or tax-exempt)"`
+	Modifiers []ItemModifier `json:"modifiers" jsonschema_description:"Add-ons or changes listed under this item (e.g., add bacon +$2), not separate items"`
+	Discounts []Discount     `json:"discounts" jsonschema_description:"Discounts or coupons that apply to this item only"`
+}
+
+type ItemModifier struct {
+	Name  string  `json:"name" jsonschema_description:"Name of the modifier"`
+	Price float64 `json:"price" jsonschema_description:"Total price added by the modifier, 0 if free"`
+}
+
+type Discount struct {
+	Name   string  `json:"name" jsonschema_description:"Name of the discount or coupon"`
+	Amount float64 `json:"amount" jsonschema_description:"Amount taken off, as a positive number"`
 }
 
 type PaymentDetails struct {
-	Method     string  `json:"method" jsonschema_description:"Payment method (e.g., cash, credit card)"`
-	AmountPaid float64 `json:"amount_paid" jsonschema_description:"Total amount paid"`
-	Tip        float64 `json:"tip" jsonschema_description:"Tip amount given"`
+	Method       string  `json:"method" jsonschema_description:"Payment method (e.g., cash, credit card)"`
+	AmountPaid   float64 `json:"amount_paid" jsonschema_description:"Total amount paid"`
+	Tip          float64 `json:"tip" jsonschema_description:"Tip amount given"`
+	CardLastFour string  `json:"card_last_four" jsonschema_description:"Last four digits of the card used, empty if not shown or paid in cash"`
 }
 
 type OtherFee struct {
-	Name  string  `json:"name" jsonschema_description:"Name of the additional fee"`
-	Price float64 `json:"price" jsonschema_description:"Price of the additional fee"`
+	Name    string  `json:"name" jsonschema_description:"Name of the additional fee"`
+	Price   float64 `json:"price" jsonschema_description:"Price of the additional fee"`
+	Kind    string  `json:"kind" jsonschema:"enum=service_charge,enum=delivery,enum=fee" jsonschema_description:"service_charge for automatic gratuity or service charges, delivery for delivery fees, fee for anything else"`
+	Taxable bool    `json:"taxable" jsonschema_description:"Whether sales tax applies to this fee"`
 }
 
 type ParsedReceipt struct {
@@ -0,0 +1,58 @@
+package receipt
+
+// Bill is the part of a receipt that is shared between the friends who
+// claimed its items, rather than claimed itself.
+type Bill struct {
+	// Subtotal is the claimed items, after item discounts, and
+	// TaxableSubtotal the taxable part of it.
+	Subtotal        float64
+	TaxableSubtotal float64
+	// Discount is the bill level discounts.
+	Discount float64
+	// Fees is every fee and service charge, TaxableFees the ones tax was
+	// charged on.
+	Fees        float64
+	TaxableFees float64
+	Tax         float64
+	Tip         float64
+}
+
+// Claim is what one friend claimed on a receipt.
+type Claim struct {
+	Subtotal        float64
+	TaxableSubtotal float64
+}
+
+// Share is what a friend owes for a receipt.
+type Share struct {
+	Subtotal float64
+	Tax      float64
+	Fees     float64
+	Tip      float64
+	Total    float64
+}
+
+// Share works out what claim owes. Discounts, fees and the tip are shared in
+// proportion to the subtotal claimed. Tax is shared in proportion to the
+// taxable amount, which includes the friend's part of any taxable fees.
+func (b Bill) Share(claim Claim) Share {
+	ratio := fraction(claim.Subtotal, b.Subtotal)
+
+	taxable := claim.TaxableSubtotal + b.TaxableFees*ratio
+	share := Share{
+		Subtotal: claim.Subtotal - b.Discount*ratio,
+		Tax:      b.Tax * fraction(taxable, b.TaxableSubtotal+b.TaxableFees),
+		Fees:     b.Fees * ratio,
+		Tip:      b.Tip * ratio,
+	}
+	share.Total = share.Subtotal + share.Tax + share.Fees + share.Tip
+	return share
+}
+
+// fraction is part/whole, or 0 when there is nothing to divide.
+func fraction(part, whole float64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return part / whole
+}
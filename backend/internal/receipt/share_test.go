@@ -0,0 +1,112 @@
+package receipt
+
+import (
+	"math"
+	"testing"
+)
+
+func TestBillShare(t *testing.T) {
+	tests := []struct {
+		name  string
+		bill  Bill
+		claim Claim
+		want  Share
+	}{
+		{
+			name:  "sole claimant pays everything",
+			bill:  Bill{Subtotal: 40, TaxableSubtotal: 40, Tax: 3.2, Fees: 2, Tip: 8},
+			claim: Claim{Subtotal: 40, TaxableSubtotal: 40},
+			want:  Share{Subtotal: 40, Tax: 3.2, Fees: 2, Tip: 8, Total: 53.2},
+		},
+		{
+			name:  "fees, tip and discount follow the subtotal",
+			bill:  Bill{Subtotal: 100, TaxableSubtotal: 100, Discount: 10, Fees: 5, Tip: 20},
+			claim: Claim{Subtotal: 25, TaxableSubtotal: 25},
+			want:  Share{Subtotal: 22.5, Fees: 1.25, Tip: 5, Total: 28.75},
+		},
+		{
+			name:  "tax follows the taxable subtotal",
+			bill:  Bill{Subtotal: 100, TaxableSubtotal: 60, Tax: 6},
+			claim: Claim{Subtotal: 40, TaxableSubtotal: 0},
+			want:  Share{Subtotal: 40, Total: 40},
+		},
+		{
+			name:  "taxable fees add to the taxable amount",
+			bill:  Bill{Subtotal: 100, TaxableSubtotal: 50, Fees: 20, TaxableFees: 20, Tax: 7},
+			claim: Claim{Subtotal: 50, TaxableSubtotal: 0},
+			// 10 of the 70 taxed
+			want: Share{Subtotal: 50, Tax: 1, Fees: 10, Total: 61},
+		},
+		{
+			name:  "untaxable fees do not",
+			bill:  Bill{Subtotal: 100, TaxableSubtotal: 50, Fees: 20, Tax: 5},
+			claim: Claim{Subtotal: 50, TaxableSubtotal: 0},
+			want:  Share{Subtotal: 50, Fees: 10, Total: 60},
+		},
+		{
+			name:  "tax on fees alone is shared by subtotal",
+			bill:  Bill{Subtotal: 80, Fees: 10, TaxableFees: 10, Tax: 1},
+			claim: Claim{Subtotal: 20},
+			want:  Share{Subtotal: 20, Tax: 0.25, Fees: 2.5, Total: 22.75},
+		},
+		{
+			name:  "nothing claimed owes nothing",
+			bill:  Bill{Fees: 5, Tax: 1, Tip: 3},
+			claim: Claim{},
+			want:  Share{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.bill.Share(tt.claim)
+			for _, f := range []struct {
+				field     string
+				got, want float64
+			}{
+				{"subtotal", got.Subtotal, tt.want.Subtotal},
+				{"tax", got.Tax, tt.want.Tax},
+				{"fees", got.Fees, tt.want.Fees},
+				{"tip", got.Tip, tt.want.Tip},
+				{"total", got.Total, tt.want.Total},
+			} {
+				if math.Abs(f.got-f.want) > 1e-9 {
+					t.Errorf("%s = %v, want %v", f.field, f.got, f.want)
+				}
+			}
+		})
+	}
+}
+
+// Every friend's share together must come to the whole bill, or someone pays
+// for what nobody claimed.
+func TestBillSharesAddUp(t *testing.T) {
+	claims := []Claim{
+		{Subtotal: 31.5, TaxableSubtotal: 31.5},
+		{Subtotal: 12.25, TaxableSubtotal: 0},
+		{Subtotal: 56.25, TaxableSubtotal: 40},
+	}
+	bill := Bill{Discount: 7.5, Fees: 12, TaxableFees: 4, Tax: 6.63, Tip: 18}
+	for _, claim := range claims {
+		bill.Subtotal += claim.Subtotal
+		bill.TaxableSubtotal += claim.TaxableSubtotal
+	}
+
+	var sum Share
+	for _, claim := range claims {
+		share := bill.Share(claim)
+		sum.Subtotal += share.Subtotal
+		sum.Tax += share.Tax
+		sum.Fees += share.Fees
+		sum.Tip += share.Tip
+		sum.Total += share.Total
+	}
+
+	want := bill.Subtotal - bill.Discount + bill.Tax + bill.Fees + bill.Tip
+	if math.Abs(sum.Total-want) > 1e-9 {
+		t.Errorf("shares total %v, want %v", sum.Total, want)
+	}
+	if math.Abs(sum.Tax-bill.Tax) > 1e-9 {
+		t.Errorf("shares tax %v, want %v", sum.Tax, bill.Tax)
+	}
+}
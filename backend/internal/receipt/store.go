@@ -0,0 +1,101 @@
+package receipt
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// SaveLineItems inserts the items, fees and discounts of a parsed receipt.
+// q is expected to be bound to the transaction that created the receipt row.
+func SaveLineItems(ctx context.Context, q *repository.Queries, receiptId uuid.UUID, parsed ParsedReceipt) error {
+	// Items, with modifiers as child items
+	for _, item := range parsed.Items {
+		itemId, err := q.InsertOrderItem(ctx, repository.InsertOrderItemParams{
+			ReceiptID: receiptId,
+			Name:      item.Name,
+			Price: sql.NullFloat64{
+				Float64: item.Price,
+				Valid:   true,
+			},
+			Quantity: int32(item.Quantity),
+			Taxable:  item.Taxable,
+		})
+		if err != nil {
+			return fmt.Errorf("insert into order_items: %w", err)
+		}
+
+		for _, modifier := range item.Modifiers {
+			_, err = q.InsertOrderItem(ctx, repository.InsertOrderItemParams{
+				ReceiptID: receiptId,
+				Name:      modifier.Name,
+				Price: sql.NullFloat64{
+					Float64: modifier.Price,
+					Valid:   true,
+				},
+				Quantity:     1,
+				Taxable:      item.Taxable,
+				ParentItemID: &itemId,
+			})
+			if err != nil {
+				return fmt.Errorf("insert modifier into order_items: %w", err)
+			}
+		}
+
+		for _, discount := range item.Discounts {
+			err = q.InsertDiscount(ctx, repository.InsertDiscountParams{
+				ReceiptID:   receiptId,
+				OrderItemID: &itemId,
+				Name:        discount.Name,
+				Amount: sql.NullFloat64{
+					Float64: discount.Amount,
+					Valid:   true,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("insert item discount: %w", err)
+			}
+		}
+	}
+
+	// Fees
+	for _, fee := range parsed.OtherFees {
+		kind := fee.Kind
+		if kind == "" {
+			kind = "fee"
+		}
+		err := q.InsertOtherFee(ctx, repository.InsertOtherFeeParams{
+			ReceiptID: receiptId,
+			Name:      fee.Name,
+			Price: sql.NullFloat64{
+				Float64: fee.Price,
+				Valid:   true,
+			},
+			Kind:    kind,
+			Taxable: fee.Taxable,
+		})
+		if err != nil {
+			return fmt.Errorf("insert into other_fees: %w", err)
+		}
+	}
+
+	// Order-level discounts
+	for _, discount := range parsed.Discounts {
+		err := q.InsertDiscount(ctx, repository.InsertDiscountParams{
+			ReceiptID: receiptId,
+			Name:      discount.Name,
+			Amount: sql.NullFloat64{
+				Float64: discount.Amount,
+				Valid:   true,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("insert into discounts: %w", err)
+		}
+	}
+
+	return nil
+}
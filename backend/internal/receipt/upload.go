@@ -0,0 +1,181 @@
+package receipt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrImageTooLarge is returned for images with more pixels than allowed,
+	// which are rejected before decoding since a small file can decode to
+	// gigabytes.
+	ErrImageTooLarge = errors.New("image dimensions are too large")
+	ErrNotImage      = errors.New("upload is not an image")
+)
+
+// maxDecodePixels bounds images decoded for variants and avatars, whatever
+// limit uploads are checked against.
+const maxDecodePixels = 100_000_000
+
+// Upload is an uploaded file. It is spooled to a temporary file and hashed as
+// it is read, so slow or large uploads are not held in memory. Close removes
+// the temporary file.
+type Upload struct {
+	Hash        string
+	ContentType string
+	FileName    string
+	Size        int64
+	file        *os.File
+}
+
+// Open returns a reader over the whole upload.
+func (u *Upload) Open() io.Reader {
+	return io.NewSectionReader(u.file, 0, u.Size)
+}
+
+// Bytes reads the upload into memory, for steps that decode or send the image.
+func (u *Upload) Bytes() ([]byte, error) {
+	data := make([]byte, u.Size)
+	if _, err := io.ReadFull(u.Open(), data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (u *Upload) Close() error {
+	u.file.Close()
+	return os.Remove(u.file.Name())
+}
+
+// ReadLimited reads all of r, failing with an *http.MaxBytesError rather than
+// truncating once more than limit bytes arrive, the same error a request body
+// over its limit gives. size, when known, presizes the buffer.
+func ReadLimited(r io.Reader, limit, size int64) ([]byte, error) {
+	if size > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, max(size, 0)+bytes.MinRead))
+	if _, err := buf.ReadFrom(io.LimitReader(r, limit+1)); err != nil {
+		return nil, err
+	}
+	if int64(buf.Len()) > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+	return buf.Bytes(), nil
+}
+
+// ReadImageUpload streams an uploaded image through the hasher into a
+// temporary file. The content type comes from the bytes rather than what the
+// client claimed, and images over maxPixels are refused without being decoded.
+func ReadImageUpload(r io.Reader, fileName string, size, limit int64, maxPixels int) (*Upload, error) {
+	if size > limit {
+		return nil, &http.MaxBytesError{Limit: limit}
+	}
+
+	file, err := os.CreateTemp("", "civet-upload-*")
+	if err != nil {
+		return nil, err
+	}
+	upload := &Upload{FileName: fileName, file: file}
+
+	hash := sha256.New()
+	upload.Size, err = io.Copy(file, io.TeeReader(io.LimitReader(r, limit+1), hash))
+	if err == nil && upload.Size > limit {
+		err = &http.MaxBytesError{Limit: limit}
+	}
+	if err == nil {
+		err = upload.check(maxPixels)
+	}
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+
+	upload.Hash = hex.EncodeToString(hash.Sum(nil))
+	return upload, nil
+}
+
+// check sniffs the content type and dimensions from the start of the file.
+func (u *Upload) check(maxPixels int) error {
+	header := make([]byte, 512)
+	n, err := u.file.ReadAt(header, 0)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	u.ContentType = DetectImageType(header[:n])
+	if u.ContentType == "" {
+		return ErrNotImage
+	}
+	return checkDimensions(u.Open(), maxPixels)
+}
+
+// heifBrands maps the major brands of HEIF files to their content type.
+// iPhones save photos as HEIC, which http.DetectContentType does not know.
+var heifBrands = map[string]string{
+	"heic": "image/heic",
+	"heix": "image/heic",
+	"hevc": "image/heic-sequence",
+	"hevx": "image/heic-sequence",
+	"heim": "image/heic",
+	"heis": "image/heic",
+	"mif1": "image/heif",
+	"msf1": "image/heif-sequence",
+}
+
+// DetectImageType returns the content type of an image from its first bytes,
+// or "" when they are not an image.
+func DetectImageType(header []byte) string {
+	if len(header) >= 12 && string(header[4:8]) == "ftyp" {
+		if contentType, ok := heifBrands[string(header[8:12])]; ok {
+			return contentType
+		}
+	}
+	contentType := http.DetectContentType(header)
+	if !strings.HasPrefix(contentType, "image/") {
+		return ""
+	}
+	return contentType
+}
+
+// imageExts are the file extensions images are stored under, by content type.
+var imageExts = map[string]string{
+	"image/jpeg":          "jpg",
+	"image/png":           "png",
+	"image/gif":           "gif",
+	"image/webp":          "webp",
+	"image/bmp":           "bmp",
+	"image/heic":          "heic",
+	"image/heic-sequence": "heic",
+	"image/heif":          "heif",
+	"image/heif-sequence": "heif",
+}
+
+// CheckDimensions reads just the header of an image and refuses ones with
+// more than maxPixels. Formats the standard library cannot read, like HEIC,
+// pass as they are never decoded here.
+func CheckDimensions(data []byte, maxPixels int) error {
+	return checkDimensions(bytes.NewReader(data), maxPixels)
+}
+
+func checkDimensions(r io.Reader, maxPixels int) error {
+	cfg, _, err := image.DecodeConfig(r)
+	if errors.Is(err, image.ErrFormat) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrNotImage, err)
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixels {
+		return ErrImageTooLarge
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package receipt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/png"
+	"net/http"
+	"testing"
+
+	"github.com/sharithg/civet/internal/genai"
+)
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, w, h))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// heifHeader is the start of an ftyp box with the given major brand.
+func heifHeader(brand string) []byte {
+	return append([]byte{0, 0, 0, 24, 'f', 't', 'y', 'p'}, []byte(brand+"\x00\x00\x00\x00mif1heic")...)
+}
+
+func TestDetectImageType(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"png", pngBytes(t, 1, 1), "image/png"},
+		{"jpeg", []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), "image/jpeg"},
+		{"heic", heifHeader("heic"), "image/heic"},
+		{"heif", heifHeader("mif1"), "image/heif"},
+		{"mp4", heifHeader("isom"), ""},
+		{"text", []byte("Total 12.00"), ""},
+		{"empty", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectImageType(tt.header); got != tt.want {
+				t.Errorf("DetectImageType = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadImageUpload(t *testing.T) {
+	small := pngBytes(t, 10, 10)
+
+	tests := []struct {
+		name      string
+		data      []byte
+		size      int64
+		limit     int64
+		maxPixels int
+		wantType  string
+		wantErr   error
+	}{
+		{name: "png", data: small, limit: 1 << 20, maxPixels: 1000, wantType: "image/png"},
+		{name: "heic is not decoded", data: heifHeader("heic"), limit: 1 << 20, maxPixels: 1, wantType: "image/heic"},
+		{name: "too many pixels", data: small, limit: 1 << 20, maxPixels: 99, wantErr: ErrImageTooLarge},
+		{name: "not an image", data: []byte("hello"), limit: 1 << 20, maxPixels: 1000, wantErr: ErrNotImage},
+		{name: "over limit", data: small, limit: int64(len(small) - 1), maxPixels: 1000},
+		{name: "declared over limit", data: small, size: 1 << 21, limit: 1 << 20, maxPixels: 1000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upload, err := ReadImageUpload(bytes.NewReader(tt.data), "photo", tt.size, tt.limit, tt.maxPixels)
+			if tt.wantType == "" {
+				if err == nil {
+					upload.Close()
+					t.Fatal("ReadImageUpload succeeded")
+				}
+				var maxBytes *http.MaxBytesError
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Errorf("err = %v, want %v", err, tt.wantErr)
+				} else if tt.wantErr == nil && !errors.As(err, &maxBytes) {
+					t.Errorf("err = %v, want *http.MaxBytesError", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer upload.Close()
+
+			sum := sha256.Sum256(tt.data)
+			if upload.Hash != hex.EncodeToString(sum[:]) {
+				t.Errorf("Hash = %s, want the sha256 of the data", upload.Hash)
+			}
+			if upload.ContentType != tt.wantType {
+				t.Errorf("ContentType = %q, want %q", upload.ContentType, tt.wantType)
+			}
+			got, err := upload.Bytes()
+			if err != nil || !bytes.Equal(got, tt.data) {
+				t.Errorf("Bytes = %d bytes, %v; want the upload back", len(got), err)
+			}
+		})
+	}
+}
+
+func TestNewImageExtractContentType(t *testing.T) {
+	tests := []struct {
+		fname, contentType string
+		wantExt, wantType  string
+	}{
+		{"IMG_0001.HEIC", "image/heic", "heic", "image/heic"},
+		{"photo", "image/jpeg", "jpg", "image/jpeg"},
+		{"scan.png", "", "png", "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fname, func(t *testing.T) {
+			e := newImageExtract(nil, genai.OpenAi{}, nil, nil, nil, nil, "hash", tt.fname, tt.contentType)
+			if e.FileExt != tt.wantExt || e.ContentType != tt.wantType {
+				t.Errorf("got %s, %s; want %s, %s", e.FileExt, e.ContentType, tt.wantExt, tt.wantType)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package receipt
 import (
 	"math"
 	"sort"
+	"strings"
+	"unicode"
 
 	visionpb "cloud.google.com/go/vision/v2/apiv1/visionpb"
 	"github.com/invopop/jsonschema"
@@ -91,3 +93,18 @@ func GenerateSchema[T any]() interface{} {
 	schema := reflector.Reflect(v)
 	return schema
 }
+
+// CardLastFour keeps only the trailing four digits of a masked card number
+// such as "XXXX XXXX XXXX 1234", returning "" when fewer than four are present.
+func CardLastFour(s string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, s)
+	if len(digits) < 4 {
+		return ""
+	}
+	return digits[len(digits)-4:]
+}
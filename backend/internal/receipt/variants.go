@@ -0,0 +1,152 @@
+package receipt
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"log"
+
+	"github.com/sharithg/civet/internal/storage"
+)
+
+// Stored sizes of a receipt image. Lists should use the thumbnail and detail
+// screens the medium size; the original is kept for reprocessing and zooming.
+const (
+	VariantThumbnail = "thumbnail"
+	VariantMedium    = "medium"
+	VariantOriginal  = "original"
+)
+
+// Longest side, in pixels, of each generated variant.
+const (
+	ThumbnailSize = 320
+	MediumSize    = 1280
+)
+
+const variantQuality = 80
+
+// ImageVariants holds the object keys of the resized copies of an upload. A
+// key is empty when the original was already small enough to serve as is or
+// could not be decoded (HEIC, PDF, e-mail).
+type ImageVariants struct {
+	ThumbnailKey string
+	MediumKey    string
+}
+
+// VariantKey is the object key of a resized copy. Like the original it is
+// addressed by the content hash, so identical uploads share their variants.
+func VariantKey(hash, variant string) string {
+	return fmt.Sprintf("%s_%s.jpg", hash, variant)
+}
+
+// uploadVariants stores the medium and thumbnail copies of the image next to
+// the original. Variants are a convenience, so failures are logged and leave
+// the key empty for callers to fall back to the original.
+func (e *Extract) uploadVariants(ctx context.Context, bucket string) {
+	if err := CheckDimensions(e.ImageBytes, maxDecodePixels); err != nil {
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(e.ImageBytes))
+	if err != nil {
+		return
+	}
+
+	src := toRGBA(img)
+	medium := downscale(src, MediumSize)
+	if medium != src {
+		e.Variants.MediumKey = e.uploadVariant(ctx, bucket, VariantMedium, medium)
+	}
+
+	// the medium copy is already close to thumbnail size and much cheaper to shrink
+	thumbnail := downscale(medium, ThumbnailSize)
+	if thumbnail != medium {
+		e.Variants.ThumbnailKey = e.uploadVariant(ctx, bucket, VariantThumbnail, thumbnail)
+	}
+}
+
+func (e *Extract) uploadVariant(ctx context.Context, bucket, variant string, img image.Image) string {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: variantQuality}); err != nil {
+		log.Printf("[WARN] encoding %s variant of %s: %v", variant, e.ImageHash, err)
+		return ""
+	}
+
+	key := VariantKey(e.ImageHash, variant)
+	if err := storage.PutBytes(ctx, e.storage, bucket, key, buf.Bytes(), "image/jpeg"); err != nil {
+		log.Printf("[WARN] uploading %s variant of %s: %v", variant, e.ImageHash, err)
+		return ""
+	}
+	return key
+}
+
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba
+	}
+	b := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, b.Min, draw.Src)
+	return rgba
+}
+
+// downscale shrinks src so its longest side is at most maxSize, averaging
+// every source pixel that falls into a destination pixel. src is returned
+// unchanged when it already fits.
+func downscale(src *image.RGBA, maxSize int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	if sw <= maxSize && sh <= maxSize {
+		return src
+	}
+
+	dw, dh := maxSize, sh*maxSize/sw
+	if sh > sw {
+		dw, dh = sw*maxSize/sh, maxSize
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for dy := 0; dy < dh; dy++ {
+		y0, y1 := dy*sh/dh, max((dy+1)*sh/dh, dy*sh/dh+1)
+		for dx := 0; dx < dw; dx++ {
+			x0, x1 := dx*sw/dw, max((dx+1)*sw/dw, dx*sw/dw+1)
+
+			var r, g, b, a, n int
+			for y := y0; y < y1; y++ {
+				row := src.Pix[y*src.Stride:]
+				for x := x0; x < x1; x++ {
+					p := row[x*4:]
+					r += int(p[0])
+					g += int(p[1])
+					b += int(p[2])
+					a += int(p[3])
+					n++
+				}
+			}
+
+			d := dst.Pix[dy*dst.Stride+dx*4:]
+			d[0], d[1], d[2], d[3] = uint8(r/n), uint8(g/n), uint8(b/n), uint8(a/n)
+		}
+	}
+	return dst
+}
+
+// Shrink re-encodes an image as a JPEG no larger than maxSize on its longest
+// side. Any metadata the original carried, like its location, is dropped.
+func Shrink(data []byte, maxSize int) ([]byte, error) {
+	if err := CheckDimensions(data, maxDecodePixels); err != nil {
+		return nil, err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, downscale(toRGBA(img), maxSize), &jpeg.Options{Quality: variantQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
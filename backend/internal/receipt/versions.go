@@ -0,0 +1,28 @@
+package receipt
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// PromptVersion identifies the extraction prompt. Bump it whenever prompt changes
+// so cached responses and stored receipts from the old prompt can be re-processed.
+// Version "1" is the original prompt, before modifiers and discounts were extracted.
+const PromptVersion = "2"
+
+var schemaVersion = sync.OnceValue(func() string {
+	out, err := json.Marshal(GenerateSchema[Receipt]())
+	if err != nil {
+		panic(err)
+	}
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:])[:12]
+})
+
+// SchemaVersion is a short hash of the JSON schema sent to the model, so any
+// change to the Receipt struct or its descriptions produces a new version.
+func SchemaVersion() string {
+	return schemaVersion()
+}
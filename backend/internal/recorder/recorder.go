@@ -0,0 +1,216 @@
+// Package recorder is an http.RoundTripper that saves request/response pairs
+// to disk and replays them later, so code calling Vision or OpenAI can be
+// tested offline.
+package recorder
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type Mode string
+
+const (
+	// Replay serves responses from fixtures and fails on any request without one.
+	Replay Mode = "replay"
+	// Record sends requests through the base transport and saves the responses.
+	Record Mode = "record"
+)
+
+// Request bodies larger than this (e.g. base64 images) are not written to the
+// fixture; they still take part in matching through the fixture key.
+const maxStoredRequestBody = 16 << 10
+
+type Transport struct {
+	Dir  string
+	Mode Mode
+	Base http.RoundTripper
+}
+
+// New returns a transport storing fixtures under dir. base is only used in
+// Record mode and defaults to http.DefaultTransport.
+func New(dir string, mode Mode, base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Dir: dir, Mode: mode, Base: base}
+}
+
+// Client returns an http.Client using the transport.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+type Fixture struct {
+	Request  FixtureRequest  `json:"request"`
+	Response FixtureResponse `json:"response"`
+}
+
+type FixtureRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type FixtureResponse struct {
+	StatusCode int               `json:"status_code"`
+	Header     map[string]string `json:"header,omitempty"`
+	// Body holds JSON responses as-is so fixtures stay readable and diffable;
+	// anything else is stored in BodyBase64.
+	Body       json.RawMessage `json:"body,omitempty"`
+	BodyBase64 string          `json:"body_base64,omitempty"`
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	path := t.path(req, body)
+
+	switch t.Mode {
+	case Record:
+		return t.record(req, body, path)
+	case Replay:
+		return t.replay(req, path)
+	default:
+		return nil, fmt.Errorf("recorder: unknown mode %q", t.Mode)
+	}
+}
+
+// path names the fixture after a hash of the method, URL and body. JSON bodies
+// are re-encoded first so key order and whitespace do not change the match.
+// Headers are ignored, which keeps credentials out of the key and the fixture.
+func (t *Transport) path(req *http.Request, body []byte) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s?%s\n", req.Method, req.URL.Path, req.URL.RawQuery)
+	h.Write(canonicalJSON(body))
+	return filepath.Join(t.Dir, req.URL.Host, hex.EncodeToString(h.Sum(nil))[:32]+".json")
+}
+
+func (t *Transport) replay(req *http.Request, path string) (*http.Response, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("recorder: no fixture for %s %s (%s); re-run in record mode", req.Method, req.URL, path)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return nil, fmt.Errorf("recorder: read %s: %w", path, err)
+	}
+
+	body := []byte(fixture.Response.Body)
+	if fixture.Response.BodyBase64 != "" {
+		body, err = base64.StdEncoding.DecodeString(fixture.Response.BodyBase64)
+		if err != nil {
+			return nil, fmt.Errorf("recorder: read %s: %w", path, err)
+		}
+	}
+
+	header := http.Header{}
+	for k, v := range fixture.Response.Header {
+		header.Set(k, v)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Response.StatusCode, http.StatusText(fixture.Response.StatusCode)),
+		StatusCode:    fixture.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func (t *Transport) record(req *http.Request, body []byte, path string) (*http.Response, error) {
+	out := req.Clone(req.Context())
+	out.Body = io.NopCloser(bytes.NewReader(body))
+	out.ContentLength = int64(len(body))
+
+	res, err := t.Base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	fixture := Fixture{
+		Request: FixtureRequest{
+			Method: req.Method,
+			URL:    req.URL.String(),
+		},
+		Response: FixtureResponse{
+			StatusCode: res.StatusCode,
+			Header:     map[string]string{},
+		},
+	}
+	if len(body) <= maxStoredRequestBody && json.Valid(body) {
+		fixture.Request.Body = body
+	}
+	if ct := res.Header.Get("Content-Type"); ct != "" {
+		fixture.Response.Header["Content-Type"] = ct
+	}
+	if json.Valid(resBody) {
+		fixture.Response.Body = resBody
+	} else {
+		fixture.Response.BodyBase64 = base64.StdEncoding.EncodeToString(resBody)
+	}
+
+	raw, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, append(raw, '\n'), 0o644); err != nil {
+		return nil, err
+	}
+
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	res.ContentLength = int64(len(resBody))
+	res.Header.Del("Content-Encoding")
+	return res, nil
+}
+
+func canonicalJSON(body []byte) []byte {
+	if len(strings.TrimSpace(string(body))) == 0 {
+		return nil
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return body
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return out
+}
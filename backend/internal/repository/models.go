@@ -12,14 +12,53 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
-type CloudVisionCache struct {
+type AuthChallenge struct {
+	TokenHash string             `json:"token_hash"`
+	Kind      string             `json:"kind"`
+	Email     string             `json:"email"`
+	UserID    *uuid.UUID         `json:"user_id"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+type Discount struct {
+	ID          uuid.UUID          `json:"id"`
+	ReceiptID   uuid.UUID          `json:"receipt_id"`
+	OrderItemID *uuid.UUID         `json:"order_item_id"`
+	Name        string             `json:"name"`
+	Amount      sql.NullFloat64    `json:"amount"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+}
+
+type EmailForwardingAddress struct {
 	ID        uuid.UUID          `json:"id"`
-	ImageHash string             `json:"image_hash"`
-	Response  []string           `json:"response"`
+	UserID    uuid.UUID          `json:"user_id"`
+	Token     string             `json:"token"`
+	OutingID  *uuid.UUID         `json:"outing_id"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
 }
 
+type ExtractionCache struct {
+	ID            uuid.UUID          `json:"id"`
+	Stage         string             `json:"stage"`
+	Provider      string             `json:"provider"`
+	Model         string             `json:"model"`
+	PromptVersion string             `json:"prompt_version"`
+	InputHash     string             `json:"input_hash"`
+	Response      []byte             `json:"response"`
+	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+}
+
+type ExtractionUsage struct {
+	UserID      uuid.UUID          `json:"user_id"`
+	Month       pgtype.Date        `json:"month"`
+	Extractions int32              `json:"extractions"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
 type Friend struct {
 	ID        uuid.UUID          `json:"id"`
 	Name      string             `json:"name"`
@@ -29,20 +68,36 @@ type Friend struct {
 	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
 }
 
-type GenaiCache struct {
+type GuestInvite struct {
 	ID        uuid.UUID          `json:"id"`
-	ImageHash string             `json:"image_hash"`
-	Response  []byte             `json:"response"`
+	FriendID  uuid.UUID          `json:"friend_id"`
+	TokenHash string             `json:"token_hash"`
+	CreatedBy uuid.UUID          `json:"created_by"`
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt pgtype.Timestamptz `json:"revoked_at"`
+}
+
+type OauthState struct {
+	StateHash           string             `json:"state_hash"`
+	CodeHash            string             `json:"code_hash"`
+	RedirectUri         string             `json:"redirect_uri"`
+	ClientState         string             `json:"client_state"`
+	CodeChallenge       string             `json:"code_challenge"`
+	CodeChallengeMethod string             `json:"code_challenge_method"`
+	ProviderVerifier    string             `json:"provider_verifier"`
+	CreatedAt           pgtype.Timestamptz `json:"created_at"`
+	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
 }
 
 type OrderItem struct {
-	ID        uuid.UUID       `json:"id"`
-	ReceiptID uuid.UUID       `json:"receipt_id"`
-	Name      string          `json:"name"`
-	Price     sql.NullFloat64 `json:"price"`
-	Quantity  int32           `json:"quantity"`
+	ID           uuid.UUID       `json:"id"`
+	ReceiptID    uuid.UUID       `json:"receipt_id"`
+	Name         string          `json:"name"`
+	Price        sql.NullFloat64 `json:"price"`
+	Quantity     int32           `json:"quantity"`
+	Taxable      bool            `json:"taxable"`
+	ParentItemID *uuid.UUID      `json:"parent_item_id"`
 }
 
 type OtherFee struct {
@@ -50,6 +105,8 @@ type OtherFee struct {
 	ReceiptID uuid.UUID       `json:"receipt_id"`
 	Name      string          `json:"name"`
 	Price     sql.NullFloat64 `json:"price"`
+	Kind      string          `json:"kind"`
+	Taxable   bool            `json:"taxable"`
 }
 
 type Outing struct {
@@ -59,36 +116,85 @@ type Outing struct {
 	CreatedAt pgtype.Timestamptz `json:"created_at"`
 	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
 	UserID    uuid.UUID          `json:"user_id"`
+	Timezone  string             `json:"timezone"`
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+	Date      pgtype.Date        `json:"date"`
+	Location  string             `json:"location"`
 }
 
 type Receipt struct {
-	ID                uuid.UUID       `json:"id"`
-	ReceiptImageID    uuid.UUID       `json:"receipt_image_id"`
-	Restaurant        string          `json:"restaurant"`
-	Address           string          `json:"address"`
-	Opened            time.Time       `json:"opened"`
-	OrderNumber       string          `json:"order_number"`
-	OrderType         string          `json:"order_type"`
-	TableNumber       string          `json:"table_number"`
-	Server            string          `json:"server"`
-	Subtotal          sql.NullFloat64 `json:"subtotal"`
-	SalesTax          sql.NullFloat64 `json:"sales_tax"`
-	Total             sql.NullFloat64 `json:"total"`
-	PaymentMethod     string          `json:"payment_method"`
-	PaymentAmountPaid sql.NullFloat64 `json:"payment_amount_paid"`
-	PaymentTip        sql.NullFloat64 `json:"payment_tip"`
-	Copy              string          `json:"copy"`
-	CreatedAt         time.Time       `json:"created_at"`
+	ID                    uuid.UUID          `json:"id"`
+	ReceiptImageID        uuid.UUID          `json:"receipt_image_id"`
+	Restaurant            string             `json:"restaurant"`
+	Address               string             `json:"address"`
+	Opened                pgtype.Timestamptz `json:"opened"`
+	OrderNumber           string             `json:"order_number"`
+	OrderType             string             `json:"order_type"`
+	TableNumber           string             `json:"table_number"`
+	Server                string             `json:"server"`
+	Subtotal              sql.NullFloat64    `json:"subtotal"`
+	SalesTax              sql.NullFloat64    `json:"sales_tax"`
+	Total                 sql.NullFloat64    `json:"total"`
+	PaymentMethod         string             `json:"payment_method"`
+	PaymentAmountPaid     sql.NullFloat64    `json:"payment_amount_paid"`
+	PaymentTip            sql.NullFloat64    `json:"payment_tip"`
+	Copy                  string             `json:"copy"`
+	CreatedAt             time.Time          `json:"created_at"`
+	PaymentCardLastFour   string             `json:"payment_card_last_four"`
+	TipPercentageOverride sql.NullFloat64    `json:"tip_percentage_override"`
+	OpenedRaw             string             `json:"opened_raw"`
+	PromptVersion         string             `json:"prompt_version"`
+	SchemaVersion         string             `json:"schema_version"`
+	DeletedAt             pgtype.Timestamptz `json:"deleted_at"`
 }
 
 type ReceiptImage struct {
-	ID       uuid.UUID `json:"id"`
-	Bucket   string    `json:"bucket"`
-	Key      string    `json:"key"`
-	RawText  string    `json:"raw_text"`
-	FileName string    `json:"file_name"`
-	Hash     string    `json:"hash"`
-	OutingID uuid.UUID `json:"outing_id"`
+	ID                uuid.UUID          `json:"id"`
+	Bucket            string             `json:"bucket"`
+	Key               string             `json:"key"`
+	RawText           string             `json:"raw_text"`
+	FileName          string             `json:"file_name"`
+	Hash              string             `json:"hash"`
+	OutingID          uuid.UUID          `json:"outing_id"`
+	Phash             pgtype.Int8        `json:"phash"`
+	ThumbnailKey      pgtype.Text        `json:"thumbnail_key"`
+	MediumKey         pgtype.Text        `json:"medium_key"`
+	OriginalDeletedAt pgtype.Timestamptz `json:"original_deleted_at"`
+	RawTextRedacted   bool               `json:"raw_text_redacted"`
+}
+
+type ReceiptDuplicate struct {
+	ID          uuid.UUID          `json:"id"`
+	ReceiptID   uuid.UUID          `json:"receipt_id"`
+	CandidateID uuid.UUID          `json:"candidate_id"`
+	Reasons     []string           `json:"reasons"`
+	Status      string             `json:"status"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt   pgtype.Timestamptz `json:"updated_at"`
+}
+
+type Session struct {
+	ID             uuid.UUID          `json:"id"`
+	UserID         uuid.UUID          `json:"user_id"`
+	RefreshTokenID uuid.UUID          `json:"refresh_token_id"`
+	Platform       string             `json:"platform"`
+	UserAgent      string             `json:"user_agent"`
+	IpAddress      string             `json:"ip_address"`
+	CreatedAt      pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt     pgtype.Timestamptz `json:"last_used_at"`
+	ExpiresAt      pgtype.Timestamptz `json:"expires_at"`
+	RevokedAt      pgtype.Timestamptz `json:"revoked_at"`
+	RevokedReason  pgtype.Text        `json:"revoked_reason"`
+}
+
+type SigningKey struct {
+	Kid         string             `json:"kid"`
+	Algorithm   string             `json:"algorithm"`
+	PrivateKey  []byte             `json:"private_key"`
+	PublicKey   []byte             `json:"public_key"`
+	CreatedAt   pgtype.Timestamptz `json:"created_at"`
+	ActivatesAt pgtype.Timestamptz `json:"activates_at"`
+	RetiresAt   pgtype.Timestamptz `json:"retires_at"`
 }
 
 type Split struct {
@@ -102,11 +208,42 @@ type Split struct {
 }
 
 type User struct {
-	ID            uuid.UUID          `json:"id"`
-	Sub           string             `json:"sub"`
-	Email         string             `json:"email"`
-	Picture       string             `json:"picture"`
-	EmailVerified bool               `json:"email_verified"`
-	CreatedAt     pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt     pgtype.Timestamptz `json:"updated_at"`
+	ID                   uuid.UUID          `json:"id"`
+	Sub                  string             `json:"sub"`
+	Email                string             `json:"email"`
+	Picture              string             `json:"picture"`
+	EmailVerified        bool               `json:"email_verified"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt            pgtype.Timestamptz `json:"updated_at"`
+	Timezone             string             `json:"timezone"`
+	Name                 string             `json:"name"`
+	AvatarKey            string             `json:"avatar_key"`
+	DefaultCurrency      string             `json:"default_currency"`
+	DefaultTipPercentage pgtype.Float8      `json:"default_tip_percentage"`
+	VenmoHandle          string             `json:"venmo_handle"`
+	PaypalHandle         string             `json:"paypal_handle"`
+	Iban                 string             `json:"iban"`
+	DeletedAt            pgtype.Timestamptz `json:"deleted_at"`
+	Locale               string             `json:"locale"`
+}
+
+type UserIdentity struct {
+	ID         uuid.UUID          `json:"id"`
+	UserID     uuid.UUID          `json:"user_id"`
+	Provider   string             `json:"provider"`
+	Subject    string             `json:"subject"`
+	Email      string             `json:"email"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+}
+
+type WebauthnCredential struct {
+	ID         []byte             `json:"id"`
+	UserID     uuid.UUID          `json:"user_id"`
+	PublicKey  []byte             `json:"public_key"`
+	SignCount  int64              `json:"sign_count"`
+	Transports []string           `json:"transports"`
+	Name       string             `json:"name"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
 }
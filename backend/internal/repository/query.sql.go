@@ -14,25 +14,344 @@ import (
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const anonymizeUser = `-- name: AnonymizeUser :exec
+update users
+set sub = 'deleted:' || id::text,
+    email = 'deleted+' || id::text || '@invalid',
+    email_verified = false,
+    name = '',
+    picture = '',
+    avatar_key = '',
+    timezone = null,
+    locale = '',
+    default_tip_percentage = null,
+    venmo_handle = '',
+    paypal_handle = '',
+    iban = '',
+    deleted_at = now(),
+    updated_at = now()
+where id = $1
+`
+
+func (q *Queries) AnonymizeUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, anonymizeUser, id)
+	return err
+}
+
+const anonymizeUserFriends = `-- name: AnonymizeUserFriends :execrows
+update friends
+set user_id = null,
+    name = $2,
+    updated_at = now()
+where user_id = $1
+`
+
+type AnonymizeUserFriendsParams struct {
+	UserID *uuid.UUID `json:"user_id"`
+	Name   string     `json:"name"`
+}
+
+func (q *Queries) AnonymizeUserFriends(ctx context.Context, arg AnonymizeUserFriendsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, anonymizeUserFriends, arg.UserID, arg.Name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const attachOAuthCode = `-- name: AttachOAuthCode :one
+update oauth_states
+set code_hash = $2
+where state_hash = $1
+    and code_hash is null
+    and expires_at > now()
+returning redirect_uri,
+    client_state
+`
+
+type AttachOAuthCodeParams struct {
+	StateHash string `json:"state_hash"`
+	CodeHash  string `json:"code_hash"`
+}
+
+type AttachOAuthCodeRow struct {
+	RedirectUri string `json:"redirect_uri"`
+	ClientState string `json:"client_state"`
+}
+
+func (q *Queries) AttachOAuthCode(ctx context.Context, arg AttachOAuthCodeParams) (AttachOAuthCodeRow, error) {
+	row := q.db.QueryRow(ctx, attachOAuthCode, arg.StateHash, arg.CodeHash)
+	var i AttachOAuthCodeRow
+	err := row.Scan(&i.RedirectUri, &i.ClientState)
+	return i, err
+}
+
+const consumeAuthChallenge = `-- name: ConsumeAuthChallenge :one
+delete from auth_challenges
+where token_hash = $1
+    and kind = $2
+    and expires_at > now()
+returning email,
+    user_id
+`
+
+type ConsumeAuthChallengeParams struct {
+	TokenHash string `json:"token_hash"`
+	Kind      string `json:"kind"`
+}
+
+type ConsumeAuthChallengeRow struct {
+	Email  string     `json:"email"`
+	UserID *uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) ConsumeAuthChallenge(ctx context.Context, arg ConsumeAuthChallengeParams) (ConsumeAuthChallengeRow, error) {
+	row := q.db.QueryRow(ctx, consumeAuthChallenge, arg.TokenHash, arg.Kind)
+	var i ConsumeAuthChallengeRow
+	err := row.Scan(&i.Email, &i.UserID)
+	return i, err
+}
+
+const consumeOAuthCode = `-- name: ConsumeOAuthCode :one
+delete from oauth_states
+where code_hash = $1
+    and expires_at > now()
+returning code_challenge,
+    code_challenge_method,
+    provider_verifier
+`
+
+type ConsumeOAuthCodeRow struct {
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	ProviderVerifier    string `json:"provider_verifier"`
+}
+
+func (q *Queries) ConsumeOAuthCode(ctx context.Context, codeHash string) (ConsumeOAuthCodeRow, error) {
+	row := q.db.QueryRow(ctx, consumeOAuthCode, codeHash)
+	var i ConsumeOAuthCodeRow
+	err := row.Scan(&i.CodeChallenge, &i.CodeChallengeMethod, &i.ProviderVerifier)
+	return i, err
+}
+
+const countOutings = `-- name: CountOutings :one
+select count(*)
+from outings o
+where o.deleted_at is null
+    and (
+        o.user_id = $1
+        or exists (
+            select 1
+            from friends m
+            where m.outing_id = o.id
+                and m.user_id = $1
+        )
+    )
+    and (
+        cardinality($2::text []) = 0
+        or o.status = any($2::text [])
+    )
+    and (
+        $3::date is null
+        or coalesce(o.date, o.created_at::date) >= $3::date
+    )
+    and (
+        $4::date is null
+        or coalesce(o.date, o.created_at::date) <= $4::date
+    )
+`
+
+type CountOutingsParams struct {
+	UserID   uuid.UUID   `json:"user_id"`
+	Statuses []string    `json:"statuses"`
+	DateFrom pgtype.Date `json:"date_from"`
+	DateTo   pgtype.Date `json:"date_to"`
+}
+
+func (q *Queries) CountOutings(ctx context.Context, arg CountOutingsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countOutings,
+		arg.UserID,
+		arg.Statuses,
+		arg.DateFrom,
+		arg.DateTo,
+	)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countReceiptImagesByHash = `-- name: CountReceiptImagesByHash :one
+select count(*)
+from receipt_images
+where hash = $1
+`
+
+func (q *Queries) CountReceiptImagesByHash(ctx context.Context, hash string) (int64, error) {
+	row := q.db.QueryRow(ctx, countReceiptImagesByHash, hash)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countReceiptItems = `-- name: CountReceiptItems :one
+select count(*)
+from order_items
+where receipt_id = $1
+    and parent_item_id is null
+    and id = any($2::uuid [])
+`
+
+type CountReceiptItemsParams struct {
+	ReceiptID uuid.UUID   `json:"receipt_id"`
+	Ids       []uuid.UUID `json:"ids"`
+}
+
+func (q *Queries) CountReceiptItems(ctx context.Context, arg CountReceiptItemsParams) (int64, error) {
+	row := q.db.QueryRow(ctx, countReceiptItems, arg.ReceiptID, arg.Ids)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const countUserLoginMethods = `-- name: CountUserLoginMethods :one
+select (
+        select count(*)
+        from user_identities i
+        where i.user_id = $1
+    ) + (
+        select count(*)
+        from webauthn_credentials w
+        where w.user_id = $1
+    ) as count
+`
+
+func (q *Queries) CountUserLoginMethods(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRow(ctx, countUserLoginMethods, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createAuthChallenge = `-- name: CreateAuthChallenge :exec
+insert into auth_challenges (
+        token_hash,
+        kind,
+        email,
+        user_id,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5)
+`
+
+type CreateAuthChallengeParams struct {
+	TokenHash string             `json:"token_hash"`
+	Kind      string             `json:"kind"`
+	Email     string             `json:"email"`
+	UserID    *uuid.UUID         `json:"user_id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateAuthChallenge(ctx context.Context, arg CreateAuthChallengeParams) error {
+	_, err := q.db.Exec(ctx, createAuthChallenge,
+		arg.TokenHash,
+		arg.Kind,
+		arg.Email,
+		arg.UserID,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
+const createGuestInvite = `-- name: CreateGuestInvite :one
+insert into guest_invites (friend_id, token_hash, created_by, expires_at)
+values ($1, $2, $3, $4)
+returning id
+`
+
+type CreateGuestInviteParams struct {
+	FriendID  uuid.UUID          `json:"friend_id"`
+	TokenHash string             `json:"token_hash"`
+	CreatedBy uuid.UUID          `json:"created_by"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateGuestInvite(ctx context.Context, arg CreateGuestInviteParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, createGuestInvite,
+		arg.FriendID,
+		arg.TokenHash,
+		arg.CreatedBy,
+		arg.ExpiresAt,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const createNewOuting = `-- name: CreateNewOuting :one
-INSERT INTO outings (name, user_id, status)
-VALUES ($1, $2, $3)
+INSERT INTO outings (name, user_id, status, timezone, date, location)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING id
 `
 
 type CreateNewOutingParams struct {
-	Name   string    `json:"name"`
-	UserID uuid.UUID `json:"user_id"`
-	Status string    `json:"status"`
+	Name     string      `json:"name"`
+	UserID   uuid.UUID   `json:"user_id"`
+	Status   string      `json:"status"`
+	Timezone string      `json:"timezone"`
+	Date     pgtype.Date `json:"date"`
+	Location string      `json:"location"`
 }
 
 func (q *Queries) CreateNewOuting(ctx context.Context, arg CreateNewOutingParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, createNewOuting, arg.Name, arg.UserID, arg.Status)
+	row := q.db.QueryRow(ctx, createNewOuting,
+		arg.Name,
+		arg.UserID,
+		arg.Status,
+		arg.Timezone,
+		arg.Date,
+		arg.Location,
+	)
 	var id uuid.UUID
 	err := row.Scan(&id)
 	return id, err
 }
 
+const createOAuthState = `-- name: CreateOAuthState :exec
+insert into oauth_states (
+        state_hash,
+        redirect_uri,
+        client_state,
+        code_challenge,
+        code_challenge_method,
+        provider_verifier,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5, $6, $7)
+`
+
+type CreateOAuthStateParams struct {
+	StateHash           string             `json:"state_hash"`
+	RedirectUri         string             `json:"redirect_uri"`
+	ClientState         string             `json:"client_state"`
+	CodeChallenge       string             `json:"code_challenge"`
+	CodeChallengeMethod string             `json:"code_challenge_method"`
+	ProviderVerifier    string             `json:"provider_verifier"`
+	ExpiresAt           pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateOAuthState(ctx context.Context, arg CreateOAuthStateParams) error {
+	_, err := q.db.Exec(ctx, createOAuthState,
+		arg.StateHash,
+		arg.RedirectUri,
+		arg.ClientState,
+		arg.CodeChallenge,
+		arg.CodeChallengeMethod,
+		arg.ProviderVerifier,
+		arg.ExpiresAt,
+	)
+	return err
+}
+
 const createOrGetFriend = `-- name: CreateOrGetFriend :one
 with existing_friend as (
     select id
@@ -73,6 +392,42 @@ func (q *Queries) CreateOrGetFriend(ctx context.Context, arg CreateOrGetFriendPa
 	return id, err
 }
 
+const createSession = `-- name: CreateSession :one
+insert into sessions (
+        user_id,
+        refresh_token_id,
+        platform,
+        user_agent,
+        ip_address,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5, $6)
+returning id
+`
+
+type CreateSessionParams struct {
+	UserID         uuid.UUID          `json:"user_id"`
+	RefreshTokenID uuid.UUID          `json:"refresh_token_id"`
+	Platform       string             `json:"platform"`
+	UserAgent      string             `json:"user_agent"`
+	IpAddress      string             `json:"ip_address"`
+	ExpiresAt      pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) CreateSession(ctx context.Context, arg CreateSessionParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, createSession,
+		arg.UserID,
+		arg.RefreshTokenID,
+		arg.Platform,
+		arg.UserAgent,
+		arg.IpAddress,
+		arg.ExpiresAt,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
 const createSplit = `-- name: CreateSplit :one
 insert into splits (friend_id, order_item_id, receipt_id, quantity)
 values ($1, $2, $3, $4)
@@ -128,416 +483,2857 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (uuid.UU
 	return id, err
 }
 
-const deleteSplit = `-- name: DeleteSplit :exec
-delete from splits
-where receipt_id = $1
+const createUserIdentity = `-- name: CreateUserIdentity :one
+insert into user_identities (user_id, provider, subject, email)
+values ($1, $2, $3, $4)
+returning id
 `
 
-func (q *Queries) DeleteSplit(ctx context.Context, receiptID uuid.UUID) error {
-	_, err := q.db.Exec(ctx, deleteSplit, receiptID)
-	return err
+type CreateUserIdentityParams struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Provider string    `json:"provider"`
+	Subject  string    `json:"subject"`
+	Email    string    `json:"email"`
 }
 
-const getCachedCloudVisionResponse = `-- name: GetCachedCloudVisionResponse :one
-select response
-from cloud_vision_cache
-where image_hash = $1
-limit 1
+func (q *Queries) CreateUserIdentity(ctx context.Context, arg CreateUserIdentityParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, createUserIdentity,
+		arg.UserID,
+		arg.Provider,
+		arg.Subject,
+		arg.Email,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const createWebauthnCredential = `-- name: CreateWebauthnCredential :exec
+insert into webauthn_credentials (
+        id,
+        user_id,
+        public_key,
+        sign_count,
+        transports,
+        name
+    )
+values ($1, $2, $3, $4, $5, $6)
 `
 
-func (q *Queries) GetCachedCloudVisionResponse(ctx context.Context, imageHash string) ([]string, error) {
-	row := q.db.QueryRow(ctx, getCachedCloudVisionResponse, imageHash)
-	var response []string
-	err := row.Scan(&response)
-	return response, err
+type CreateWebauthnCredentialParams struct {
+	ID         []byte    `json:"id"`
+	UserID     uuid.UUID `json:"user_id"`
+	PublicKey  []byte    `json:"public_key"`
+	SignCount  int64     `json:"sign_count"`
+	Transports []string  `json:"transports"`
+	Name       string    `json:"name"`
 }
 
-const getCachedGenAiResponse = `-- name: GetCachedGenAiResponse :one
-select response
-from genai_cache
-where image_hash = $1
-limit 1
+func (q *Queries) CreateWebauthnCredential(ctx context.Context, arg CreateWebauthnCredentialParams) error {
+	_, err := q.db.Exec(ctx, createWebauthnCredential,
+		arg.ID,
+		arg.UserID,
+		arg.PublicKey,
+		arg.SignCount,
+		arg.Transports,
+		arg.Name,
+	)
+	return err
+}
+
+const deleteCacheEntriesForInput = `-- name: DeleteCacheEntriesForInput :execrows
+delete from extraction_cache
+where input_hash = $1
 `
 
-func (q *Queries) GetCachedGenAiResponse(ctx context.Context, imageHash string) ([]byte, error) {
-	row := q.db.QueryRow(ctx, getCachedGenAiResponse, imageHash)
-	var response []byte
-	err := row.Scan(&response)
-	return response, err
+func (q *Queries) DeleteCacheEntriesForInput(ctx context.Context, inputHash string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteCacheEntriesForInput, inputHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const getFriends = `-- name: GetFriends :many
-select fr.id,
-    fr.name
-from friends fr
-    join outings o on fr.outing_id = o.id
-    join receipt_images ri on o.id = ri.outing_id
-    join receipts r on r.receipt_image_id = ri.id
-where r.id = $1
+const deleteDiscounts = `-- name: DeleteDiscounts :exec
+delete from discounts
+where receipt_id = $1
 `
 
-type GetFriendsRow struct {
-	ID   uuid.UUID `json:"id"`
-	Name string    `json:"name"`
+func (q *Queries) DeleteDiscounts(ctx context.Context, receiptID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteDiscounts, receiptID)
+	return err
 }
 
-func (q *Queries) GetFriends(ctx context.Context, id uuid.UUID) ([]GetFriendsRow, error) {
-	rows, err := q.db.Query(ctx, getFriends, id)
+const deleteExpiredAuthChallenges = `-- name: DeleteExpiredAuthChallenges :execrows
+delete from auth_challenges
+where expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredAuthChallenges(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredAuthChallenges)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetFriendsRow
-	for rows.Next() {
-		var i GetFriendsRow
-		if err := rows.Scan(&i.ID, &i.Name); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return 0, err
 	}
-	return items, nil
+	return result.RowsAffected(), nil
 }
 
-const getFriendsForOuting = `-- name: GetFriendsForOuting :many
-WITH unique_friends_per_receipt AS (
-    SELECT r.id AS receipt_id, COUNT(DISTINCT fr.id) AS friend_count
-    FROM receipts r
-    JOIN order_items it ON r.id = it.receipt_id
-    JOIN splits sp ON it.id = sp.order_item_id
-    JOIN friends fr ON sp.friend_id = fr.id
-    GROUP BY r.id
-)
-SELECT
-    fr.name,
-    (SUM(it.price * sp.quantity))::float AS subtotal,
-    (r.sales_tax / uf.friend_count)::float AS tax_portion,
-    (SUM(it.price * sp.quantity) + (r.sales_tax / uf.friend_count))::float AS total_owed
-FROM receipts r
-JOIN order_items it ON r.id = it.receipt_id
-JOIN splits sp ON it.id = sp.order_item_id
-JOIN friends fr ON sp.friend_id = fr.id
-JOIN receipt_images ri on r.receipt_image_id = ri.id
-JOIN outings ou on ri.outing_id = ou.id
-JOIN unique_friends_per_receipt uf ON r.id = uf.receipt_id
-WHERE ou.id = $1
-GROUP BY fr.id, fr.name, r.sales_tax, r.id, uf.friend_count
+const deleteExpiredCacheEntries = `-- name: DeleteExpiredCacheEntries :execrows
+delete from extraction_cache
+where expires_at is not null
+    and expires_at <= now()
 `
 
-type GetFriendsForOutingRow struct {
-	Name       string  `json:"name"`
-	Subtotal   float64 `json:"subtotal"`
-	TaxPortion float64 `json:"tax_portion"`
-	TotalOwed  float64 `json:"total_owed"`
+func (q *Queries) DeleteExpiredCacheEntries(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredCacheEntries)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-func (q *Queries) GetFriendsForOuting(ctx context.Context, id uuid.UUID) ([]GetFriendsForOutingRow, error) {
-	rows, err := q.db.Query(ctx, getFriendsForOuting, id)
+const deleteExpiredOAuthStates = `-- name: DeleteExpiredOAuthStates :execrows
+delete from oauth_states
+where expires_at <= now()
+`
+
+func (q *Queries) DeleteExpiredOAuthStates(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredOAuthStates)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetFriendsForOutingRow
-	for rows.Next() {
-		var i GetFriendsForOutingRow
-		if err := rows.Scan(
-			&i.Name,
-			&i.Subtotal,
-			&i.TaxPortion,
-			&i.TotalOwed,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+		return 0, err
 	}
-	return items, nil
+	return result.RowsAffected(), nil
 }
 
-const getOutingForReceipt = `-- name: GetOutingForReceipt :one
-select o.id
-from outings o
-    join receipt_images ri on o.id = ri.outing_id
-    join receipts r on ri.id = r.receipt_image_id
-where r.id = $1
+const deleteFriend = `-- name: DeleteFriend :exec
+delete from friends
+where id = $1
 `
 
-func (q *Queries) GetOutingForReceipt(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, getOutingForReceipt, id)
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) DeleteFriend(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteFriend, id)
+	return err
 }
 
-const getOutings = `-- name: GetOutings :many
-SELECT o.id,
-    o.name,
-    o.created_at,
-    o.status,
-    COALESCE(f.friends, '[]') AS friends,
-    COALESCE(r.total_receipts, 0) AS total_receipts
-FROM outings o
-    LEFT JOIN LATERAL (
-        SELECT json_agg(json_build_object('id', fr.id, 'name', fr.name)) AS friends
-        FROM friends fr
-        WHERE fr.outing_id = o.id
-    ) f ON true
-    LEFT JOIN LATERAL (
-        SELECT COUNT(DISTINCT ri.id) AS total_receipts
-        FROM receipt_images ri
-        WHERE ri.outing_id = o.id
-    ) r ON true
+const deleteFriendSplits = `-- name: DeleteFriendSplits :exec
+delete from splits
+where receipt_id = $1
+    and friend_id = $2
 `
 
-type GetOutingsRow struct {
-	ID            uuid.UUID          `json:"id"`
-	Name          string             `json:"name"`
-	CreatedAt     pgtype.Timestamptz `json:"created_at"`
-	Status        string             `json:"status"`
-	Friends       []byte             `json:"friends"`
-	TotalReceipts int64              `json:"total_receipts"`
+type DeleteFriendSplitsParams struct {
+	ReceiptID uuid.UUID `json:"receipt_id"`
+	FriendID  uuid.UUID `json:"friend_id"`
 }
 
-func (q *Queries) GetOutings(ctx context.Context) ([]GetOutingsRow, error) {
-	rows, err := q.db.Query(ctx, getOutings)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetOutingsRow
-	for rows.Next() {
-		var i GetOutingsRow
-		if err := rows.Scan(
-			&i.ID,
-			&i.Name,
-			&i.CreatedAt,
-			&i.Status,
-			&i.Friends,
-			&i.TotalReceipts,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
+func (q *Queries) DeleteFriendSplits(ctx context.Context, arg DeleteFriendSplitsParams) error {
+	_, err := q.db.Exec(ctx, deleteFriendSplits, arg.ReceiptID, arg.FriendID)
+	return err
+}
+
+const deleteOrderItems = `-- name: DeleteOrderItems :exec
+delete from order_items
+where receipt_id = $1
+`
+
+func (q *Queries) DeleteOrderItems(ctx context.Context, receiptID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteOrderItems, receiptID)
+	return err
+}
+
+const deleteOtherFees = `-- name: DeleteOtherFees :exec
+delete from other_fees
+where receipt_id = $1
+`
+
+func (q *Queries) DeleteOtherFees(ctx context.Context, receiptID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteOtherFees, receiptID)
+	return err
+}
+
+const deleteOuting = `-- name: DeleteOuting :exec
+delete from outings
+where id = $1
+`
+
+func (q *Queries) DeleteOuting(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteOuting, id)
+	return err
+}
+
+const deleteReceiptImage = `-- name: DeleteReceiptImage :exec
+delete from receipt_images
+where id = $1
+`
+
+func (q *Queries) DeleteReceiptImage(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteReceiptImage, id)
+	return err
+}
+
+const deleteRetiredSigningKeys = `-- name: DeleteRetiredSigningKeys :execrows
+delete from signing_keys
+where retires_at <= now()
+`
+
+func (q *Queries) DeleteRetiredSigningKeys(ctx context.Context) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteRetiredSigningKeys)
+	if err != nil {
+		return 0, err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
+	return result.RowsAffected(), nil
+}
+
+const deleteSplit = `-- name: DeleteSplit :exec
+delete from splits
+where receipt_id = $1
+`
+
+func (q *Queries) DeleteSplit(ctx context.Context, receiptID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteSplit, receiptID)
+	return err
+}
+
+const deleteUserIdentity = `-- name: DeleteUserIdentity :execrows
+delete from user_identities
+where id = $1
+    and user_id = $2
+`
+
+type DeleteUserIdentityParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteUserIdentity(ctx context.Context, arg DeleteUserIdentityParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteUserIdentity, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
 	}
-	return items, nil
+	return result.RowsAffected(), nil
 }
 
-const getReceipt = `-- name: GetReceipt :one
-SELECT r.id,
-    r.total,
-    r.restaurant,
-    r.address,
-    r.opened,
-    r.order_number,
-    r.order_type,
-    r.payment_tip,
-    r.payment_amount_paid,
-    r.table_number,
-    r.copy,
-    r.server,
-    r.sales_tax,
-    ri.bucket,
-    ri.key,
-    COALESCE(oi.items, '[]') AS items,
-    COALESCE(of.fees, '[]') AS fees,
-    COALESCE(spl.splits, '[]') AS splits
-FROM receipt_images ri
-    JOIN receipts r ON ri.id = r.receipt_image_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(oi.*) AS items
-        FROM order_items oi
-        GROUP BY receipt_id
-    ) oi ON r.id = oi.receipt_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(of.*) AS fees
-        FROM other_fees of
-        GROUP BY receipt_id
-    ) of ON r.id = of.receipt_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(
-                json_build_object(
-                    'id',
-                    sp.id,
-                    'friend_id',
-                    sp.friend_id,
-                    'order_item_id',
-                    sp.order_item_id
-                )
-            ) AS splits
-        FROM splits sp
-        GROUP BY receipt_id
-    ) spl ON r.id = spl.receipt_id
-WHERE r.id = $1
-LIMIT 1
+const deleteUserLogins = `-- name: DeleteUserLogins :exec
+with identities as (
+    delete from user_identities
+    where user_id = $1
+),
+credentials as (
+    delete from webauthn_credentials
+    where user_id = $1
+),
+challenges as (
+    delete from auth_challenges
+    where user_id = $1
+),
+invites as (
+    delete from guest_invites
+    where created_by = $1
+),
+forwarding as (
+    delete from email_forwarding_addresses
+    where user_id = $1
+)
+delete from sessions
+where user_id = $1
 `
 
-type GetReceiptRow struct {
-	ID                uuid.UUID       `json:"id"`
-	Total             sql.NullFloat64 `json:"total"`
-	Restaurant        string          `json:"restaurant"`
-	Address           string          `json:"address"`
-	Opened            time.Time       `json:"opened"`
-	OrderNumber       string          `json:"order_number"`
-	OrderType         string          `json:"order_type"`
-	PaymentTip        sql.NullFloat64 `json:"payment_tip"`
-	PaymentAmountPaid sql.NullFloat64 `json:"payment_amount_paid"`
-	TableNumber       string          `json:"table_number"`
-	Copy              string          `json:"copy"`
-	Server            string          `json:"server"`
-	SalesTax          sql.NullFloat64 `json:"sales_tax"`
-	Bucket            string          `json:"bucket"`
-	Key               string          `json:"key"`
-	Items             []byte          `json:"items"`
-	Fees              []byte          `json:"fees"`
-	Splits            []byte          `json:"splits"`
+func (q *Queries) DeleteUserLogins(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, deleteUserLogins, userID)
+	return err
 }
 
-func (q *Queries) GetReceipt(ctx context.Context, id uuid.UUID) (GetReceiptRow, error) {
-	row := q.db.QueryRow(ctx, getReceipt, id)
-	var i GetReceiptRow
+const deleteWebauthnCredential = `-- name: DeleteWebauthnCredential :execrows
+delete from webauthn_credentials
+where id = $1
+    and user_id = $2
+`
+
+type DeleteWebauthnCredentialParams struct {
+	ID     []byte    `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) DeleteWebauthnCredential(ctx context.Context, arg DeleteWebauthnCredentialParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteWebauthnCredential, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getActiveGuestInvite = `-- name: GetActiveGuestInvite :one
+select gi.friend_id,
+    f.outing_id
+from guest_invites gi
+    join friends f on gi.friend_id = f.id
+    join outings o on f.outing_id = o.id
+where gi.id = $1
+    and gi.revoked_at is null
+    and gi.expires_at > now()
+    and o.deleted_at is null
+`
+
+type GetActiveGuestInviteRow struct {
+	FriendID uuid.UUID `json:"friend_id"`
+	OutingID uuid.UUID `json:"outing_id"`
+}
+
+func (q *Queries) GetActiveGuestInvite(ctx context.Context, id uuid.UUID) (GetActiveGuestInviteRow, error) {
+	row := q.db.QueryRow(ctx, getActiveGuestInvite, id)
+	var i GetActiveGuestInviteRow
+	err := row.Scan(&i.FriendID, &i.OutingID)
+	return i, err
+}
+
+const getCacheEntry = `-- name: GetCacheEntry :one
+select response
+from extraction_cache
+where stage = $1
+    and provider = $2
+    and model = $3
+    and prompt_version = $4
+    and input_hash = $5
+    and (
+        expires_at is null
+        or expires_at > now()
+    )
+limit 1
+`
+
+type GetCacheEntryParams struct {
+	Stage         string `json:"stage"`
+	Provider      string `json:"provider"`
+	Model         string `json:"model"`
+	PromptVersion string `json:"prompt_version"`
+	InputHash     string `json:"input_hash"`
+}
+
+func (q *Queries) GetCacheEntry(ctx context.Context, arg GetCacheEntryParams) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getCacheEntry,
+		arg.Stage,
+		arg.Provider,
+		arg.Model,
+		arg.PromptVersion,
+		arg.InputHash,
+	)
+	var response []byte
+	err := row.Scan(&response)
+	return response, err
+}
+
+const getEmailForwardingAddress = `-- name: GetEmailForwardingAddress :one
+select id, user_id, token, outing_id, created_at, updated_at
+from email_forwarding_addresses
+where user_id = $1
+limit 1
+`
+
+func (q *Queries) GetEmailForwardingAddress(ctx context.Context, userID uuid.UUID) (EmailForwardingAddress, error) {
+	row := q.db.QueryRow(ctx, getEmailForwardingAddress, userID)
+	var i EmailForwardingAddress
 	err := row.Scan(
 		&i.ID,
-		&i.Total,
-		&i.Restaurant,
-		&i.Address,
-		&i.Opened,
-		&i.OrderNumber,
-		&i.OrderType,
-		&i.PaymentTip,
-		&i.PaymentAmountPaid,
-		&i.TableNumber,
-		&i.Copy,
-		&i.Server,
-		&i.SalesTax,
-		&i.Bucket,
-		&i.Key,
-		&i.Items,
-		&i.Fees,
-		&i.Splits,
+		&i.UserID,
+		&i.Token,
+		&i.OutingID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const getReceiptByHash = `-- name: GetReceiptByHash :one
-SELECT ri.id AS receipt_image_id,
-    ri.hash,
-    ri.bucket,
-    ri.key,
-    ri.raw_text,
-    ri.file_name,
-    ri.outing_id,
-    COALESCE(oi.items, '[]') AS items,
-    COALESCE(of.fees, '[]') AS fees
-FROM receipt_images ri
-    JOIN receipts r ON ri.id = r.receipt_image_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(oi.*) AS items
-        FROM order_items oi
-        GROUP BY receipt_id
-    ) oi ON r.id = oi.receipt_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(of.*) AS fees
-        FROM other_fees of
-        GROUP BY receipt_id
-    ) of ON r.id = of.receipt_id
-WHERE ri.hash = $1
-LIMIT 1
+const getEmailForwardingAddressByToken = `-- name: GetEmailForwardingAddressByToken :one
+select id, user_id, token, outing_id, created_at, updated_at
+from email_forwarding_addresses
+where token = $1
+limit 1
 `
 
-type GetReceiptByHashRow struct {
-	ReceiptImageID uuid.UUID `json:"receipt_image_id"`
-	Hash           string    `json:"hash"`
-	Bucket         string    `json:"bucket"`
-	Key            string    `json:"key"`
-	RawText        string    `json:"raw_text"`
-	FileName       string    `json:"file_name"`
-	OutingID       uuid.UUID `json:"outing_id"`
-	Items          []byte    `json:"items"`
-	Fees           []byte    `json:"fees"`
-}
-
-func (q *Queries) GetReceiptByHash(ctx context.Context, hash string) (GetReceiptByHashRow, error) {
-	row := q.db.QueryRow(ctx, getReceiptByHash, hash)
-	var i GetReceiptByHashRow
+func (q *Queries) GetEmailForwardingAddressByToken(ctx context.Context, token string) (EmailForwardingAddress, error) {
+	row := q.db.QueryRow(ctx, getEmailForwardingAddressByToken, token)
+	var i EmailForwardingAddress
 	err := row.Scan(
-		&i.ReceiptImageID,
-		&i.Hash,
-		&i.Bucket,
-		&i.Key,
-		&i.RawText,
-		&i.FileName,
+		&i.ID,
+		&i.UserID,
+		&i.Token,
 		&i.OutingID,
-		&i.Items,
-		&i.Fees,
+		&i.CreatedAt,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const getReceiptImage = `-- name: GetReceiptImage :one
-select ri.bucket,
-    ri.key
-from receipt_images ri
-    join receipts r on ri.id = r.receipt_image_id
+const getExtractionUsage = `-- name: GetExtractionUsage :one
+select coalesce(sum(extractions), 0)::int as extractions
+from extraction_usage
+where user_id = $1
+    and month = date_trunc('month', now() at time zone 'utc')::date
+`
+
+func (q *Queries) GetExtractionUsage(ctx context.Context, userID uuid.UUID) (int32, error) {
+	row := q.db.QueryRow(ctx, getExtractionUsage, userID)
+	var extractions int32
+	err := row.Scan(&extractions)
+	return extractions, err
+}
+
+const getFriend = `-- name: GetFriend :one
+select id,
+    name,
+    user_id,
+    outing_id
+from friends
+where id = $1
+`
+
+type GetFriendRow struct {
+	ID       uuid.UUID  `json:"id"`
+	Name     string     `json:"name"`
+	UserID   *uuid.UUID `json:"user_id"`
+	OutingID uuid.UUID  `json:"outing_id"`
+}
+
+func (q *Queries) GetFriend(ctx context.Context, id uuid.UUID) (GetFriendRow, error) {
+	row := q.db.QueryRow(ctx, getFriend, id)
+	var i GetFriendRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.UserID,
+		&i.OutingID,
+	)
+	return i, err
+}
+
+const getFriends = `-- name: GetFriends :many
+select fr.id,
+    fr.name
+from friends fr
+    join outings o on fr.outing_id = o.id
+    join receipt_images ri on o.id = ri.outing_id
+    join receipts r on r.receipt_image_id = ri.id
 where r.id = $1
-limit 1
+    and (
+        $2::uuid is null
+        or (coalesce(fr.name, ''), fr.id) > (
+            $3::text,
+            $2::uuid
+        )
+    )
+order by coalesce(fr.name, ''),
+    fr.id
+limit $4
 `
 
-type GetReceiptImageRow struct {
-	Bucket string `json:"bucket"`
-	Key    string `json:"key"`
+type GetFriendsParams struct {
+	ReceiptID  uuid.UUID  `json:"receipt_id"`
+	CursorID   *uuid.UUID `json:"cursor_id"`
+	CursorName string     `json:"cursor_name"`
+	PageLimit  int32      `json:"page_limit"`
+}
+
+type GetFriendsRow struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func (q *Queries) GetFriends(ctx context.Context, arg GetFriendsParams) ([]GetFriendsRow, error) {
+	rows, err := q.db.Query(ctx, getFriends,
+		arg.ReceiptID,
+		arg.CursorID,
+		arg.CursorName,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFriendsRow
+	for rows.Next() {
+		var i GetFriendsRow
+		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getFriendsForOuting = `-- name: GetFriendsForOuting :many
+WITH item_totals AS (
+    -- effective unit price of a top-level item: its own price plus modifiers, less item discounts
+    SELECT it.id,
+        it.receipt_id,
+        it.taxable,
+        (
+            it.price * it.quantity + COALESCE(mods.amount, 0) - COALESCE(disc.amount, 0)
+        ) / NULLIF(it.quantity, 0) AS unit_price
+    FROM order_items it
+        LEFT JOIN LATERAL (
+            SELECT SUM(m.price * m.quantity) AS amount
+            FROM order_items m
+            WHERE m.parent_item_id = it.id
+        ) mods ON true
+        LEFT JOIN LATERAL (
+            SELECT SUM(d.amount) AS amount
+            FROM discounts d
+            WHERE d.order_item_id = it.id
+        ) disc ON true
+    WHERE it.parent_item_id IS NULL
+),
+friend_items AS (
+    SELECT sp.friend_id,
+        it.receipt_id,
+        SUM(it.unit_price * sp.quantity) AS subtotal,
+        SUM(
+            CASE
+                WHEN it.taxable THEN it.unit_price * sp.quantity
+                ELSE 0
+            END
+        ) AS taxable_subtotal
+    FROM splits sp
+        JOIN item_totals it ON it.id = sp.order_item_id
+    GROUP BY sp.friend_id,
+        it.receipt_id
+),
+receipt_totals AS (
+    SELECT fi.receipt_id,
+        SUM(fi.subtotal) AS subtotal,
+        SUM(fi.taxable_subtotal) AS taxable_subtotal,
+        COALESCE(MAX(bd.amount), 0) AS discount,
+        COALESCE(MAX(fe.amount), 0) AS fees,
+        COALESCE(MAX(fe.taxable_amount), 0) AS taxable_fees
+    FROM friend_items fi
+        LEFT JOIN LATERAL (
+            SELECT SUM(d.amount) AS amount
+            FROM discounts d
+            WHERE d.receipt_id = fi.receipt_id
+                AND d.order_item_id IS NULL
+        ) bd ON true
+        LEFT JOIN LATERAL (
+            SELECT SUM(o.price) AS amount,
+                SUM(o.price) FILTER (
+                    WHERE o.taxable
+                ) AS taxable_amount
+            FROM other_fees o
+            WHERE o.receipt_id = fi.receipt_id
+        ) fe ON true
+    GROUP BY fi.receipt_id
+)
+SELECT fr.id AS friend_id,
+    fi.receipt_id,
+    fr.name,
+    COALESCE(fi.subtotal, 0)::float AS subtotal,
+    COALESCE(fi.taxable_subtotal, 0)::float AS taxable_subtotal,
+    COALESCE(rt.subtotal, 0)::float AS receipt_subtotal,
+    COALESCE(rt.taxable_subtotal, 0)::float AS receipt_taxable_subtotal,
+    rt.discount::float AS discount,
+    rt.fees::float AS fees,
+    rt.taxable_fees::float AS taxable_fees,
+    COALESCE(r.sales_tax, 0)::float AS sales_tax,
+    COALESCE(
+        r.subtotal * r.tip_percentage_override / 100,
+        r.payment_tip,
+        0
+    )::float AS tip
+FROM friend_items fi
+    JOIN receipt_totals rt ON rt.receipt_id = fi.receipt_id
+    JOIN friends fr ON fi.friend_id = fr.id
+    JOIN receipts r ON fi.receipt_id = r.id
+    JOIN receipt_images ri ON r.receipt_image_id = ri.id
+WHERE ri.outing_id = $1
+    AND r.deleted_at IS NULL
+    AND (
+        $2::uuid IS NULL
+        OR (COALESCE(fr.name, ''), fr.id, fi.receipt_id) > (
+            $3::text,
+            $2::uuid,
+            $4::uuid
+        )
+    )
+ORDER BY COALESCE(fr.name, ''),
+    fr.id,
+    fi.receipt_id
+LIMIT $5
+`
+
+type GetFriendsForOutingParams struct {
+	OutingID        uuid.UUID  `json:"outing_id"`
+	CursorFriendID  *uuid.UUID `json:"cursor_friend_id"`
+	CursorName      string     `json:"cursor_name"`
+	CursorReceiptID *uuid.UUID `json:"cursor_receipt_id"`
+	PageLimit       int32      `json:"page_limit"`
+}
+
+type GetFriendsForOutingRow struct {
+	FriendID               uuid.UUID `json:"friend_id"`
+	ReceiptID              uuid.UUID `json:"receipt_id"`
+	Name                   string    `json:"name"`
+	Subtotal               float64   `json:"subtotal"`
+	TaxableSubtotal        float64   `json:"taxable_subtotal"`
+	ReceiptSubtotal        float64   `json:"receipt_subtotal"`
+	ReceiptTaxableSubtotal float64   `json:"receipt_taxable_subtotal"`
+	Discount               float64   `json:"discount"`
+	Fees                   float64   `json:"fees"`
+	TaxableFees            float64   `json:"taxable_fees"`
+	SalesTax               float64   `json:"sales_tax"`
+	Tip                    float64   `json:"tip"`
+}
+
+func (q *Queries) GetFriendsForOuting(ctx context.Context, arg GetFriendsForOutingParams) ([]GetFriendsForOutingRow, error) {
+	rows, err := q.db.Query(ctx, getFriendsForOuting,
+		arg.OutingID,
+		arg.CursorFriendID,
+		arg.CursorName,
+		arg.CursorReceiptID,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetFriendsForOutingRow
+	for rows.Next() {
+		var i GetFriendsForOutingRow
+		if err := rows.Scan(
+			&i.FriendID,
+			&i.ReceiptID,
+			&i.Name,
+			&i.Subtotal,
+			&i.TaxableSubtotal,
+			&i.ReceiptSubtotal,
+			&i.ReceiptTaxableSubtotal,
+			&i.Discount,
+			&i.Fees,
+			&i.TaxableFees,
+			&i.SalesTax,
+			&i.Tip,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getGuestInviteByToken = `-- name: GetGuestInviteByToken :one
+select gi.id,
+    gi.friend_id,
+    f.outing_id,
+    gi.expires_at
+from guest_invites gi
+    join friends f on gi.friend_id = f.id
+    join outings o on f.outing_id = o.id
+where gi.token_hash = $1
+    and gi.revoked_at is null
+    and gi.expires_at > now()
+    and o.deleted_at is null
+`
+
+type GetGuestInviteByTokenRow struct {
+	ID        uuid.UUID          `json:"id"`
+	FriendID  uuid.UUID          `json:"friend_id"`
+	OutingID  uuid.UUID          `json:"outing_id"`
+	ExpiresAt pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) GetGuestInviteByToken(ctx context.Context, tokenHash string) (GetGuestInviteByTokenRow, error) {
+	row := q.db.QueryRow(ctx, getGuestInviteByToken, tokenHash)
+	var i GetGuestInviteByTokenRow
+	err := row.Scan(
+		&i.ID,
+		&i.FriendID,
+		&i.OutingID,
+		&i.ExpiresAt,
+	)
+	return i, err
+}
+
+const getOuting = `-- name: GetOuting :one
+select id,
+    name,
+    status,
+    created_at,
+    updated_at,
+    user_id,
+    timezone,
+    deleted_at,
+    date,
+    location
+from outings
+where id = $1
+    and deleted_at is null
+`
+
+func (q *Queries) GetOuting(ctx context.Context, id uuid.UUID) (Outing, error) {
+	row := q.db.QueryRow(ctx, getOuting, id)
+	var i Outing
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Status,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Timezone,
+		&i.DeletedAt,
+		&i.Date,
+		&i.Location,
+	)
+	return i, err
+}
+
+const getOutingForReceipt = `-- name: GetOutingForReceipt :one
+select o.id
+from outings o
+    join receipt_images ri on o.id = ri.outing_id
+    join receipts r on ri.id = r.receipt_image_id
+where r.id = $1
+`
+
+func (q *Queries) GetOutingForReceipt(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getOutingForReceipt, id)
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getOutingFriendForUser = `-- name: GetOutingFriendForUser :one
+select id
+from friends
+where outing_id = $1
+    and user_id = $2
+limit 1
+`
+
+type GetOutingFriendForUserParams struct {
+	OutingID uuid.UUID  `json:"outing_id"`
+	UserID   *uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetOutingFriendForUser(ctx context.Context, arg GetOutingFriendForUserParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getOutingFriendForUser, arg.OutingID, arg.UserID)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getOutingOwner = `-- name: GetOutingOwner :one
+select user_id
+from outings
+where id = $1
+`
+
+func (q *Queries) GetOutingOwner(ctx context.Context, id uuid.UUID) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getOutingOwner, id)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const getOutingOwnerLocale = `-- name: GetOutingOwnerLocale :one
+select u.locale
+from outings o
+    join users u on o.user_id = u.id
+where o.id = $1
+`
+
+func (q *Queries) GetOutingOwnerLocale(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getOutingOwnerLocale, id)
+	var locale string
+	err := row.Scan(&locale)
+	return locale, err
+}
+
+const getOutingPayee = `-- name: GetOutingPayee :one
+select u.id,
+    u.name,
+    u.picture,
+    u.venmo_handle,
+    u.paypal_handle,
+    u.iban,
+    u.default_currency
+from outings o
+    join users u on u.id = o.user_id
+where o.id = $1
+    and o.deleted_at is null
+`
+
+type GetOutingPayeeRow struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	Picture         string    `json:"picture"`
+	VenmoHandle     string    `json:"venmo_handle"`
+	PaypalHandle    string    `json:"paypal_handle"`
+	Iban            string    `json:"iban"`
+	DefaultCurrency string    `json:"default_currency"`
+}
+
+func (q *Queries) GetOutingPayee(ctx context.Context, id uuid.UUID) (GetOutingPayeeRow, error) {
+	row := q.db.QueryRow(ctx, getOutingPayee, id)
+	var i GetOutingPayeeRow
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Picture,
+		&i.VenmoHandle,
+		&i.PaypalHandle,
+		&i.Iban,
+		&i.DefaultCurrency,
+	)
+	return i, err
+}
+
+const getOutings = `-- name: GetOutings :many
+SELECT o.id,
+    o.name,
+    o.created_at,
+    o.status,
+    o.date,
+    o.location,
+    COALESCE(f.friends, '[]') AS friends,
+    COALESCE(r.total_receipts, 0) AS total_receipts
+FROM outings o
+    LEFT JOIN LATERAL (
+        SELECT json_agg(json_build_object('id', fr.id, 'name', fr.name)) AS friends
+        FROM friends fr
+        WHERE fr.outing_id = o.id
+    ) f ON true
+    LEFT JOIN LATERAL (
+        SELECT COUNT(DISTINCT ri.id) AS total_receipts
+        FROM receipt_images ri
+            JOIN receipts rc ON rc.receipt_image_id = ri.id
+        WHERE ri.outing_id = o.id
+            AND rc.deleted_at IS NULL
+    ) r ON true
+WHERE o.deleted_at IS NULL
+    AND (
+        o.user_id = $1
+        OR EXISTS (
+            SELECT 1
+            FROM friends m
+            WHERE m.outing_id = o.id
+                AND m.user_id = $1
+        )
+    )
+    AND (
+        cardinality($2::text []) = 0
+        OR o.status = ANY($2::text [])
+    )
+    AND (
+        $3::date IS NULL
+        OR COALESCE(o.date, o.created_at::date) >= $3::date
+    )
+    AND (
+        $4::date IS NULL
+        OR COALESCE(o.date, o.created_at::date) <= $4::date
+    )
+    AND (
+        $5::uuid IS NULL
+        OR (
+            $6::text = 'name'
+            AND NOT $7::bool
+            AND (o.name, o.id) > ($8::text, $5::uuid)
+        )
+        OR (
+            $6::text = 'name'
+            AND $7::bool
+            AND (o.name, o.id) < ($8::text, $5::uuid)
+        )
+        OR (
+            $6::text = 'date'
+            AND NOT $7::bool
+            AND (COALESCE(o.date, 'infinity'::date), o.id) > ($9::date, $5::uuid)
+        )
+        OR (
+            $6::text = 'date'
+            AND $7::bool
+            AND (COALESCE(o.date, '-infinity'::date), o.id) < ($9::date, $5::uuid)
+        )
+        OR (
+            $6::text = 'created_at'
+            AND NOT $7::bool
+            AND (o.created_at, o.id) > ($10::timestamptz, $5::uuid)
+        )
+        OR (
+            $6::text = 'created_at'
+            AND $7::bool
+            AND (o.created_at, o.id) < ($10::timestamptz, $5::uuid)
+        )
+    )
+ORDER BY CASE
+        WHEN $6::text = 'name'
+        AND NOT $7::bool THEN o.name
+    END ASC,
+    CASE
+        WHEN $6::text = 'name'
+        AND $7::bool THEN o.name
+    END DESC,
+    CASE
+        WHEN $6::text = 'date'
+        AND NOT $7::bool THEN COALESCE(o.date, 'infinity'::date)
+    END ASC,
+    CASE
+        WHEN $6::text = 'date'
+        AND $7::bool THEN COALESCE(o.date, '-infinity'::date)
+    END DESC,
+    CASE
+        WHEN $6::text = 'created_at'
+        AND NOT $7::bool THEN o.created_at
+    END ASC,
+    CASE
+        WHEN $6::text = 'created_at'
+        AND $7::bool THEN o.created_at
+    END DESC,
+    CASE
+        WHEN NOT $7::bool THEN o.id
+    END ASC,
+    CASE
+        WHEN $7::bool THEN o.id
+    END DESC
+LIMIT $11
+`
+
+type GetOutingsParams struct {
+	UserID     uuid.UUID          `json:"user_id"`
+	Statuses   []string           `json:"statuses"`
+	DateFrom   pgtype.Date        `json:"date_from"`
+	DateTo     pgtype.Date        `json:"date_to"`
+	CursorID   *uuid.UUID         `json:"cursor_id"`
+	Sort       string             `json:"sort"`
+	Descending bool               `json:"descending"`
+	CursorName string             `json:"cursor_name"`
+	CursorDate pgtype.Date        `json:"cursor_date"`
+	CursorTime pgtype.Timestamptz `json:"cursor_time"`
+	PageLimit  int32              `json:"page_limit"`
+}
+
+type GetOutingsRow struct {
+	ID            uuid.UUID          `json:"id"`
+	Name          string             `json:"name"`
+	CreatedAt     pgtype.Timestamptz `json:"created_at"`
+	Status        string             `json:"status"`
+	Date          pgtype.Date        `json:"date"`
+	Location      string             `json:"location"`
+	Friends       []byte             `json:"friends"`
+	TotalReceipts int64              `json:"total_receipts"`
+}
+
+func (q *Queries) GetOutings(ctx context.Context, arg GetOutingsParams) ([]GetOutingsRow, error) {
+	rows, err := q.db.Query(ctx, getOutings,
+		arg.UserID,
+		arg.Statuses,
+		arg.DateFrom,
+		arg.DateTo,
+		arg.CursorID,
+		arg.Sort,
+		arg.Descending,
+		arg.CursorName,
+		arg.CursorDate,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetOutingsRow
+	for rows.Next() {
+		var i GetOutingsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.CreatedAt,
+			&i.Status,
+			&i.Date,
+			&i.Location,
+			&i.Friends,
+			&i.TotalReceipts,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getOutingTimezone = `-- name: GetOutingTimezone :one
+select coalesce(nullif(o.timezone, ''), nullif(u.timezone, ''), '')::text as timezone
+from outings o
+    join users u on o.user_id = u.id
+where o.id = $1
+`
+
+func (q *Queries) GetOutingTimezone(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getOutingTimezone, id)
+	var timezone string
+	err := row.Scan(&timezone)
+	return timezone, err
+}
+
+const getOwnedReceiptOutingStatus = `-- name: GetOwnedReceiptOutingStatus :one
+select o.status
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.id = $1
+    and o.user_id = $2
+    and o.deleted_at is null
+`
+
+type GetOwnedReceiptOutingStatusParams struct {
+	ReceiptID uuid.UUID `json:"receipt_id"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) GetOwnedReceiptOutingStatus(ctx context.Context, arg GetOwnedReceiptOutingStatusParams) (string, error) {
+	row := q.db.QueryRow(ctx, getOwnedReceiptOutingStatus, arg.ReceiptID, arg.UserID)
+	var status string
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getProfile = `-- name: GetProfile :one
+select id,
+    email,
+    name,
+    picture,
+    avatar_key,
+    coalesce(timezone, '')::text as timezone,
+    locale,
+    default_currency,
+    default_tip_percentage,
+    venmo_handle,
+    paypal_handle,
+    iban,
+    created_at
+from users
+where id = $1
+    and deleted_at is null
+`
+
+type GetProfileRow struct {
+	ID                   uuid.UUID          `json:"id"`
+	Email                string             `json:"email"`
+	Name                 string             `json:"name"`
+	Picture              string             `json:"picture"`
+	AvatarKey            string             `json:"avatar_key"`
+	Timezone             string             `json:"timezone"`
+	Locale               string             `json:"locale"`
+	DefaultCurrency      string             `json:"default_currency"`
+	DefaultTipPercentage pgtype.Float8      `json:"default_tip_percentage"`
+	VenmoHandle          string             `json:"venmo_handle"`
+	PaypalHandle         string             `json:"paypal_handle"`
+	Iban                 string             `json:"iban"`
+	CreatedAt            pgtype.Timestamptz `json:"created_at"`
+}
+
+func (q *Queries) GetProfile(ctx context.Context, id uuid.UUID) (GetProfileRow, error) {
+	row := q.db.QueryRow(ctx, getProfile, id)
+	var i GetProfileRow
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.Name,
+		&i.Picture,
+		&i.AvatarKey,
+		&i.Timezone,
+		&i.Locale,
+		&i.DefaultCurrency,
+		&i.DefaultTipPercentage,
+		&i.VenmoHandle,
+		&i.PaypalHandle,
+		&i.Iban,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getReceipt = `-- name: GetReceipt :one
+SELECT r.id,
+    r.total,
+    r.restaurant,
+    r.address,
+    r.opened,
+    r.opened_raw,
+    r.order_number,
+    r.order_type,
+    r.payment_tip,
+    r.payment_amount_paid,
+    r.payment_method,
+    r.payment_card_last_four,
+    r.tip_percentage_override,
+    r.table_number,
+    r.copy,
+    r.server,
+    r.sales_tax,
+    ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.original_deleted_at,
+    COALESCE(oi.items, '[]') AS items,
+    COALESCE(of.fees, '[]') AS fees,
+    COALESCE(spl.splits, '[]') AS splits,
+    COALESCE(dis.discounts, '[]') AS discounts
+FROM receipt_images ri
+    JOIN receipts r ON ri.id = r.receipt_image_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(oi.*) AS items
+        FROM order_items oi
+        GROUP BY receipt_id
+    ) oi ON r.id = oi.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(of.*) AS fees
+        FROM other_fees of
+        GROUP BY receipt_id
+    ) of ON r.id = of.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(
+                json_build_object(
+                    'id',
+                    sp.id,
+                    'friend_id',
+                    sp.friend_id,
+                    'order_item_id',
+                    sp.order_item_id
+                )
+            ) AS splits
+        FROM splits sp
+        GROUP BY receipt_id
+    ) spl ON r.id = spl.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(d.*) AS discounts
+        FROM discounts d
+        GROUP BY receipt_id
+    ) dis ON r.id = dis.receipt_id
+WHERE r.id = $1
+    AND r.deleted_at IS NULL
+LIMIT 1
+`
+
+type GetReceiptRow struct {
+	ID                    uuid.UUID          `json:"id"`
+	Total                 sql.NullFloat64    `json:"total"`
+	Restaurant            string             `json:"restaurant"`
+	Address               string             `json:"address"`
+	Opened                pgtype.Timestamptz `json:"opened"`
+	OpenedRaw             string             `json:"opened_raw"`
+	OrderNumber           string             `json:"order_number"`
+	OrderType             string             `json:"order_type"`
+	PaymentTip            sql.NullFloat64    `json:"payment_tip"`
+	PaymentAmountPaid     sql.NullFloat64    `json:"payment_amount_paid"`
+	PaymentMethod         string             `json:"payment_method"`
+	PaymentCardLastFour   string             `json:"payment_card_last_four"`
+	TipPercentageOverride sql.NullFloat64    `json:"tip_percentage_override"`
+	TableNumber           string             `json:"table_number"`
+	Copy                  string             `json:"copy"`
+	Server                string             `json:"server"`
+	SalesTax              sql.NullFloat64    `json:"sales_tax"`
+	Bucket                string             `json:"bucket"`
+	Key                   string             `json:"key"`
+	ThumbnailKey          pgtype.Text        `json:"thumbnail_key"`
+	MediumKey             pgtype.Text        `json:"medium_key"`
+	OriginalDeletedAt     pgtype.Timestamptz `json:"original_deleted_at"`
+	Items                 []byte             `json:"items"`
+	Fees                  []byte             `json:"fees"`
+	Splits                []byte             `json:"splits"`
+	Discounts             []byte             `json:"discounts"`
+}
+
+func (q *Queries) GetReceipt(ctx context.Context, id uuid.UUID) (GetReceiptRow, error) {
+	row := q.db.QueryRow(ctx, getReceipt, id)
+	var i GetReceiptRow
+	err := row.Scan(
+		&i.ID,
+		&i.Total,
+		&i.Restaurant,
+		&i.Address,
+		&i.Opened,
+		&i.OpenedRaw,
+		&i.OrderNumber,
+		&i.OrderType,
+		&i.PaymentTip,
+		&i.PaymentAmountPaid,
+		&i.PaymentMethod,
+		&i.PaymentCardLastFour,
+		&i.TipPercentageOverride,
+		&i.TableNumber,
+		&i.Copy,
+		&i.Server,
+		&i.SalesTax,
+		&i.Bucket,
+		&i.Key,
+		&i.ThumbnailKey,
+		&i.MediumKey,
+		&i.OriginalDeletedAt,
+		&i.Items,
+		&i.Fees,
+		&i.Splits,
+		&i.Discounts,
+	)
+	return i, err
+}
+
+const getReceiptByHash = `-- name: GetReceiptByHash :one
+select r.id as receipt_id,
+    ri.id as receipt_image_id
+from receipt_images ri
+    join receipts r on ri.id = r.receipt_image_id
+where ri.hash = $1
+    and ri.outing_id = $2
+    and r.deleted_at is null
+limit 1
+`
+
+type GetReceiptByHashParams struct {
+	Hash     string    `json:"hash"`
+	OutingID uuid.UUID `json:"outing_id"`
+}
+
+type GetReceiptByHashRow struct {
+	ReceiptID      uuid.UUID `json:"receipt_id"`
+	ReceiptImageID uuid.UUID `json:"receipt_image_id"`
+}
+
+func (q *Queries) GetReceiptByHash(ctx context.Context, arg GetReceiptByHashParams) (GetReceiptByHashRow, error) {
+	row := q.db.QueryRow(ctx, getReceiptByHash, arg.Hash, arg.OutingID)
+	var i GetReceiptByHashRow
+	err := row.Scan(&i.ReceiptID, &i.ReceiptImageID)
+	return i, err
+}
+
+const getReceiptForReprocess = `-- name: GetReceiptForReprocess :one
+SELECT r.id,
+    r.restaurant,
+    r.address,
+    r.opened_raw,
+    r.order_number,
+    r.order_type,
+    r.table_number,
+    r.server,
+    r.subtotal,
+    r.sales_tax,
+    r.total,
+    r.payment_method,
+    r.payment_amount_paid,
+    r.payment_tip,
+    r.payment_card_last_four,
+    r.copy,
+    r.prompt_version,
+    r.schema_version,
+    ri.hash,
+    ri.raw_text,
+    ri.outing_id,
+    COALESCE(oi.items, '[]') AS items,
+    COALESCE(of.fees, '[]') AS fees,
+    COALESCE(dis.discounts, '[]') AS discounts,
+    sc.split_count
+FROM receipts r
+    JOIN receipt_images ri ON ri.id = r.receipt_image_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(oi.*) AS items
+        FROM order_items oi
+        GROUP BY receipt_id
+    ) oi ON r.id = oi.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(of.*) AS fees
+        FROM other_fees of
+        GROUP BY receipt_id
+    ) of ON r.id = of.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(d.*) AS discounts
+        FROM discounts d
+        GROUP BY receipt_id
+    ) dis ON r.id = dis.receipt_id
+    LEFT JOIN LATERAL (
+        SELECT COUNT(*) AS split_count
+        FROM splits sp
+        WHERE sp.receipt_id = r.id
+    ) sc ON true
+WHERE r.id = $1
+LIMIT 1
+`
+
+type GetReceiptForReprocessRow struct {
+	ID                  uuid.UUID       `json:"id"`
+	Restaurant          string          `json:"restaurant"`
+	Address             string          `json:"address"`
+	OpenedRaw           string          `json:"opened_raw"`
+	OrderNumber         string          `json:"order_number"`
+	OrderType           string          `json:"order_type"`
+	TableNumber         string          `json:"table_number"`
+	Server              string          `json:"server"`
+	Subtotal            sql.NullFloat64 `json:"subtotal"`
+	SalesTax            sql.NullFloat64 `json:"sales_tax"`
+	Total               sql.NullFloat64 `json:"total"`
+	PaymentMethod       string          `json:"payment_method"`
+	PaymentAmountPaid   sql.NullFloat64 `json:"payment_amount_paid"`
+	PaymentTip          sql.NullFloat64 `json:"payment_tip"`
+	PaymentCardLastFour string          `json:"payment_card_last_four"`
+	Copy                string          `json:"copy"`
+	PromptVersion       string          `json:"prompt_version"`
+	SchemaVersion       string          `json:"schema_version"`
+	Hash                string          `json:"hash"`
+	RawText             string          `json:"raw_text"`
+	OutingID            uuid.UUID       `json:"outing_id"`
+	Items               []byte          `json:"items"`
+	Fees                []byte          `json:"fees"`
+	Discounts           []byte          `json:"discounts"`
+	SplitCount          int64           `json:"split_count"`
+}
+
+func (q *Queries) GetReceiptForReprocess(ctx context.Context, id uuid.UUID) (GetReceiptForReprocessRow, error) {
+	row := q.db.QueryRow(ctx, getReceiptForReprocess, id)
+	var i GetReceiptForReprocessRow
+	err := row.Scan(
+		&i.ID,
+		&i.Restaurant,
+		&i.Address,
+		&i.OpenedRaw,
+		&i.OrderNumber,
+		&i.OrderType,
+		&i.TableNumber,
+		&i.Server,
+		&i.Subtotal,
+		&i.SalesTax,
+		&i.Total,
+		&i.PaymentMethod,
+		&i.PaymentAmountPaid,
+		&i.PaymentTip,
+		&i.PaymentCardLastFour,
+		&i.Copy,
+		&i.PromptVersion,
+		&i.SchemaVersion,
+		&i.Hash,
+		&i.RawText,
+		&i.OutingID,
+		&i.Items,
+		&i.Fees,
+		&i.Discounts,
+		&i.SplitCount,
+	)
+	return i, err
+}
+
+const getReceiptImage = `-- name: GetReceiptImage :one
+select ri.bucket,
+    ri.key
+from receipt_images ri
+    join receipts r on ri.id = r.receipt_image_id
+where r.id = $1
+limit 1
+`
+
+type GetReceiptImageRow struct {
+	Bucket string `json:"bucket"`
+	Key    string `json:"key"`
+}
+
+func (q *Queries) GetReceiptImage(ctx context.Context, id uuid.UUID) (GetReceiptImageRow, error) {
+	row := q.db.QueryRow(ctx, getReceiptImage, id)
+	var i GetReceiptImageRow
+	err := row.Scan(&i.Bucket, &i.Key)
+	return i, err
+}
+
+const getReceiptImageForOuting = `-- name: GetReceiptImageForOuting :one
+select ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.original_deleted_at,
+    ri.hash
+from receipt_images ri
+    join receipts r on ri.id = r.receipt_image_id
+where r.id = $1
+    and ri.outing_id = $2
+    and r.deleted_at is null
+`
+
+type GetReceiptImageForOutingParams struct {
+	ID       uuid.UUID `json:"id"`
+	OutingID uuid.UUID `json:"outing_id"`
+}
+
+type GetReceiptImageForOutingRow struct {
+	Bucket            string             `json:"bucket"`
+	Key               string             `json:"key"`
+	ThumbnailKey      pgtype.Text        `json:"thumbnail_key"`
+	MediumKey         pgtype.Text        `json:"medium_key"`
+	OriginalDeletedAt pgtype.Timestamptz `json:"original_deleted_at"`
+	Hash              string             `json:"hash"`
+}
+
+func (q *Queries) GetReceiptImageForOuting(ctx context.Context, arg GetReceiptImageForOutingParams) (GetReceiptImageForOutingRow, error) {
+	row := q.db.QueryRow(ctx, getReceiptImageForOuting, arg.ID, arg.OutingID)
+	var i GetReceiptImageForOutingRow
+	err := row.Scan(
+		&i.Bucket,
+		&i.Key,
+		&i.ThumbnailKey,
+		&i.MediumKey,
+		&i.OriginalDeletedAt,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const getReceiptImageForUser = `-- name: GetReceiptImageForUser :one
+select ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.original_deleted_at,
+    ri.hash
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.id = $1
+    and r.deleted_at is null
+    and o.deleted_at is null
+    and (
+        o.user_id = $2
+        or exists (
+            select 1
+            from friends f
+            where f.outing_id = o.id
+                and f.user_id = $2
+        )
+    )
+limit 1
+`
+
+type GetReceiptImageForUserParams struct {
+	ReceiptID uuid.UUID `json:"receipt_id"`
+	UserID    uuid.UUID `json:"user_id"`
+}
+
+type GetReceiptImageForUserRow struct {
+	Bucket            string             `json:"bucket"`
+	Key               string             `json:"key"`
+	ThumbnailKey      pgtype.Text        `json:"thumbnail_key"`
+	MediumKey         pgtype.Text        `json:"medium_key"`
+	OriginalDeletedAt pgtype.Timestamptz `json:"original_deleted_at"`
+	Hash              string             `json:"hash"`
+}
+
+func (q *Queries) GetReceiptImageForUser(ctx context.Context, arg GetReceiptImageForUserParams) (GetReceiptImageForUserRow, error) {
+	row := q.db.QueryRow(ctx, getReceiptImageForUser, arg.ReceiptID, arg.UserID)
+	var i GetReceiptImageForUserRow
+	err := row.Scan(
+		&i.Bucket,
+		&i.Key,
+		&i.ThumbnailKey,
+		&i.MediumKey,
+		&i.OriginalDeletedAt,
+		&i.Hash,
+	)
+	return i, err
+}
+
+const getReceiptOutingStatus = `-- name: GetReceiptOutingStatus :one
+select o.status
+from outings o
+    join receipt_images ri on o.id = ri.outing_id
+    join receipts r on ri.id = r.receipt_image_id
+where r.id = $1
+`
+
+func (q *Queries) GetReceiptOutingStatus(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getReceiptOutingStatus, id)
+	var status string
+	err := row.Scan(&status)
+	return status, err
+}
+
+const getReceiptReprocessState = `-- name: GetReceiptReprocessState :one
+select o.status,
+    r.deleted_at is not null as deleted
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.id = $1
+for update of r
+`
+
+type GetReceiptReprocessStateRow struct {
+	Status  string `json:"status"`
+	Deleted bool   `json:"deleted"`
+}
+
+func (q *Queries) GetReceiptReprocessState(ctx context.Context, id uuid.UUID) (GetReceiptReprocessStateRow, error) {
+	row := q.db.QueryRow(ctx, getReceiptReprocessState, id)
+	var i GetReceiptReprocessStateRow
+	err := row.Scan(&i.Status, &i.Deleted)
+	return i, err
+}
+
+const getReceiptsForOuting = `-- name: GetReceiptsForOuting :many
+SELECT r.restaurant,
+    COUNT(oi.id) AS order_count,
+    r.total,
+    r.id,
+    r.created_at
+FROM receipts r
+    JOIN order_items oi ON r.id = oi.receipt_id
+    AND oi.parent_item_id IS NULL
+    JOIN receipt_images ri ON r.receipt_image_id = ri.id
+WHERE ri.outing_id = $1
+    AND r.deleted_at IS NULL
+    AND (
+        $2::date IS NULL
+        OR COALESCE(r.opened, r.created_at)::date >= $2::date
+    )
+    AND (
+        $3::date IS NULL
+        OR COALESCE(r.opened, r.created_at)::date <= $3::date
+    )
+    AND (
+        $4::uuid IS NULL
+        OR (r.created_at, r.id) < (
+            $5::timestamp,
+            $4::uuid
+        )
+    )
+GROUP BY r.id
+ORDER BY r.created_at DESC,
+    r.id DESC
+LIMIT $6
+`
+
+type GetReceiptsForOutingParams struct {
+	OutingID   uuid.UUID        `json:"outing_id"`
+	DateFrom   pgtype.Date      `json:"date_from"`
+	DateTo     pgtype.Date      `json:"date_to"`
+	CursorID   *uuid.UUID       `json:"cursor_id"`
+	CursorTime pgtype.Timestamp `json:"cursor_time"`
+	PageLimit  int32            `json:"page_limit"`
+}
+
+type GetReceiptsForOutingRow struct {
+	Restaurant string          `json:"restaurant"`
+	OrderCount int64           `json:"order_count"`
+	Total      sql.NullFloat64 `json:"total"`
+	ID         uuid.UUID       `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+}
+
+func (q *Queries) GetReceiptsForOuting(ctx context.Context, arg GetReceiptsForOutingParams) ([]GetReceiptsForOutingRow, error) {
+	rows, err := q.db.Query(ctx, getReceiptsForOuting,
+		arg.OutingID,
+		arg.DateFrom,
+		arg.DateTo,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GetReceiptsForOutingRow
+	for rows.Next() {
+		var i GetReceiptsForOutingRow
+		if err := rows.Scan(
+			&i.Restaurant,
+			&i.OrderCount,
+			&i.Total,
+			&i.ID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getUser = `-- name: GetUser :one
+select id,
+    sub,
+    email,
+    picture,
+    name
+from users
+where id = $1
+`
+
+type GetUserRow struct {
+	ID      uuid.UUID `json:"id"`
+	Sub     string    `json:"sub"`
+	Email   string    `json:"email"`
+	Picture string    `json:"picture"`
+	Name    string    `json:"name"`
+}
+
+func (q *Queries) GetUser(ctx context.Context, id uuid.UUID) (GetUserRow, error) {
+	row := q.db.QueryRow(ctx, getUser, id)
+	var i GetUserRow
+	err := row.Scan(
+		&i.ID,
+		&i.Sub,
+		&i.Email,
+		&i.Picture,
+		&i.Name,
+	)
+	return i, err
+}
+
+const getUserAvatar = `-- name: GetUserAvatar :one
+select avatar_key
+from users
+where id = $1
+    and deleted_at is null
+`
+
+func (q *Queries) GetUserAvatar(ctx context.Context, id uuid.UUID) (string, error) {
+	row := q.db.QueryRow(ctx, getUserAvatar, id)
+	var avatar_key string
+	err := row.Scan(&avatar_key)
+	return avatar_key, err
+}
+
+const getUserBySub = `-- name: GetUserBySub :one
+select id,
+    sub,
+    email,
+    picture,
+    created_at,
+    updated_at
+from users
+where sub = $1
+`
+
+type GetUserBySubRow struct {
+	ID        uuid.UUID          `json:"id"`
+	Sub       string             `json:"sub"`
+	Email     string             `json:"email"`
+	Picture   string             `json:"picture"`
+	CreatedAt pgtype.Timestamptz `json:"created_at"`
+	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+}
+
+func (q *Queries) GetUserBySub(ctx context.Context, sub string) (GetUserBySubRow, error) {
+	row := q.db.QueryRow(ctx, getUserBySub, sub)
+	var i GetUserBySubRow
+	err := row.Scan(
+		&i.ID,
+		&i.Sub,
+		&i.Email,
+		&i.Picture,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getUserByVerifiedEmail = `-- name: GetUserByVerifiedEmail :one
+select id
+from users
+where lower(email) = lower($1)
+    and email_verified
+order by created_at
+limit 1
+`
+
+func (q *Queries) GetUserByVerifiedEmail(ctx context.Context, lower string) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getUserByVerifiedEmail, lower)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const getUserIdentity = `-- name: GetUserIdentity :one
+select user_id
+from user_identities
+where provider = $1
+    and subject = $2
+`
+
+type GetUserIdentityParams struct {
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+func (q *Queries) GetUserIdentity(ctx context.Context, arg GetUserIdentityParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, getUserIdentity, arg.Provider, arg.Subject)
+	var user_id uuid.UUID
+	err := row.Scan(&user_id)
+	return user_id, err
+}
+
+const getWebauthnCredential = `-- name: GetWebauthnCredential :one
+select id,
+    user_id,
+    public_key,
+    sign_count
+from webauthn_credentials
+where id = $1
+`
+
+type GetWebauthnCredentialRow struct {
+	ID        []byte    `json:"id"`
+	UserID    uuid.UUID `json:"user_id"`
+	PublicKey []byte    `json:"public_key"`
+	SignCount int64     `json:"sign_count"`
+}
+
+func (q *Queries) GetWebauthnCredential(ctx context.Context, id []byte) (GetWebauthnCredentialRow, error) {
+	row := q.db.QueryRow(ctx, getWebauthnCredential, id)
+	var i GetWebauthnCredentialRow
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.PublicKey,
+		&i.SignCount,
+	)
+	return i, err
+}
+
+const insertDiscount = `-- name: InsertDiscount :exec
+INSERT INTO discounts (receipt_id, order_item_id, name, amount)
+VALUES ($1, $2, $3, $4)
+`
+
+type InsertDiscountParams struct {
+	ReceiptID   uuid.UUID       `json:"receipt_id"`
+	OrderItemID *uuid.UUID      `json:"order_item_id"`
+	Name        string          `json:"name"`
+	Amount      sql.NullFloat64 `json:"amount"`
+}
+
+func (q *Queries) InsertDiscount(ctx context.Context, arg InsertDiscountParams) error {
+	_, err := q.db.Exec(ctx, insertDiscount,
+		arg.ReceiptID,
+		arg.OrderItemID,
+		arg.Name,
+		arg.Amount,
+	)
+	return err
+}
+
+const insertOrderItem = `-- name: InsertOrderItem :one
+INSERT INTO order_items (
+        receipt_id,
+        name,
+        price,
+        quantity,
+        taxable,
+        parent_item_id
+    )
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id
+`
+
+type InsertOrderItemParams struct {
+	ReceiptID    uuid.UUID       `json:"receipt_id"`
+	Name         string          `json:"name"`
+	Price        sql.NullFloat64 `json:"price"`
+	Quantity     int32           `json:"quantity"`
+	Taxable      bool            `json:"taxable"`
+	ParentItemID *uuid.UUID      `json:"parent_item_id"`
+}
+
+func (q *Queries) InsertOrderItem(ctx context.Context, arg InsertOrderItemParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertOrderItem,
+		arg.ReceiptID,
+		arg.Name,
+		arg.Price,
+		arg.Quantity,
+		arg.Taxable,
+		arg.ParentItemID,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertOtherFee = `-- name: InsertOtherFee :exec
+INSERT INTO other_fees (receipt_id, name, price, kind, taxable)
+VALUES ($1, $2, $3, $4, $5)
+`
+
+type InsertOtherFeeParams struct {
+	ReceiptID uuid.UUID       `json:"receipt_id"`
+	Name      string          `json:"name"`
+	Price     sql.NullFloat64 `json:"price"`
+	Kind      string          `json:"kind"`
+	Taxable   bool            `json:"taxable"`
+}
+
+func (q *Queries) InsertOtherFee(ctx context.Context, arg InsertOtherFeeParams) error {
+	_, err := q.db.Exec(ctx, insertOtherFee,
+		arg.ReceiptID,
+		arg.Name,
+		arg.Price,
+		arg.Kind,
+		arg.Taxable,
+	)
+	return err
+}
+
+const insertReceipt = `-- name: InsertReceipt :one
+INSERT INTO receipts (
+        receipt_image_id,
+        restaurant,
+        address,
+        opened,
+        order_number,
+        order_type,
+        table_number,
+        server,
+        subtotal,
+        sales_tax,
+        total,
+        copy,
+        payment_method,
+        payment_amount_paid,
+        payment_tip,
+        payment_card_last_four,
+        opened_raw,
+        prompt_version,
+        schema_version
+    )
+VALUES (
+        $1,
+        $2,
+        $3,
+        $4,
+        $5,
+        $6,
+        $7,
+        $8,
+        $9,
+        $10,
+        $11,
+        $12,
+        $13,
+        $14,
+        $15,
+        $16,
+        $17,
+        $18,
+        $19
+    )
+RETURNING id
+`
+
+type InsertReceiptParams struct {
+	ReceiptImageID      uuid.UUID          `json:"receipt_image_id"`
+	Restaurant          string             `json:"restaurant"`
+	Address             string             `json:"address"`
+	Opened              pgtype.Timestamptz `json:"opened"`
+	OrderNumber         string             `json:"order_number"`
+	OrderType           string             `json:"order_type"`
+	TableNumber         string             `json:"table_number"`
+	Server              string             `json:"server"`
+	Subtotal            sql.NullFloat64    `json:"subtotal"`
+	SalesTax            sql.NullFloat64    `json:"sales_tax"`
+	Total               sql.NullFloat64    `json:"total"`
+	Copy                string             `json:"copy"`
+	PaymentMethod       string             `json:"payment_method"`
+	PaymentAmountPaid   sql.NullFloat64    `json:"payment_amount_paid"`
+	PaymentTip          sql.NullFloat64    `json:"payment_tip"`
+	PaymentCardLastFour string             `json:"payment_card_last_four"`
+	OpenedRaw           string             `json:"opened_raw"`
+	PromptVersion       string             `json:"prompt_version"`
+	SchemaVersion       string             `json:"schema_version"`
+}
+
+func (q *Queries) InsertReceipt(ctx context.Context, arg InsertReceiptParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertReceipt,
+		arg.ReceiptImageID,
+		arg.Restaurant,
+		arg.Address,
+		arg.Opened,
+		arg.OrderNumber,
+		arg.OrderType,
+		arg.TableNumber,
+		arg.Server,
+		arg.Subtotal,
+		arg.SalesTax,
+		arg.Total,
+		arg.Copy,
+		arg.PaymentMethod,
+		arg.PaymentAmountPaid,
+		arg.PaymentTip,
+		arg.PaymentCardLastFour,
+		arg.OpenedRaw,
+		arg.PromptVersion,
+		arg.SchemaVersion,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertReceiptDuplicate = `-- name: InsertReceiptDuplicate :exec
+insert into receipt_duplicates (receipt_id, candidate_id, reasons)
+values ($1, $2, $3) on conflict (receipt_id, candidate_id) do nothing
+`
+
+type InsertReceiptDuplicateParams struct {
+	ReceiptID   uuid.UUID `json:"receipt_id"`
+	CandidateID uuid.UUID `json:"candidate_id"`
+	Reasons     []string  `json:"reasons"`
+}
+
+func (q *Queries) InsertReceiptDuplicate(ctx context.Context, arg InsertReceiptDuplicateParams) error {
+	_, err := q.db.Exec(ctx, insertReceiptDuplicate, arg.ReceiptID, arg.CandidateID, arg.Reasons)
+	return err
+}
+
+const insertReceiptImage = `-- name: InsertReceiptImage :one
+INSERT INTO receipt_images (
+        hash,
+        bucket,
+        key,
+        raw_text,
+        file_name,
+        outing_id,
+        phash,
+        thumbnail_key,
+        medium_key
+    )
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+RETURNING id
+`
+
+type InsertReceiptImageParams struct {
+	Hash         string      `json:"hash"`
+	Bucket       string      `json:"bucket"`
+	Key          string      `json:"key"`
+	RawText      string      `json:"raw_text"`
+	FileName     string      `json:"file_name"`
+	OutingID     uuid.UUID   `json:"outing_id"`
+	Phash        pgtype.Int8 `json:"phash"`
+	ThumbnailKey pgtype.Text `json:"thumbnail_key"`
+	MediumKey    pgtype.Text `json:"medium_key"`
+}
+
+func (q *Queries) InsertReceiptImage(ctx context.Context, arg InsertReceiptImageParams) (uuid.UUID, error) {
+	row := q.db.QueryRow(ctx, insertReceiptImage,
+		arg.Hash,
+		arg.Bucket,
+		arg.Key,
+		arg.RawText,
+		arg.FileName,
+		arg.OutingID,
+		arg.Phash,
+		arg.ThumbnailKey,
+		arg.MediumKey,
+	)
+	var id uuid.UUID
+	err := row.Scan(&id)
+	return id, err
+}
+
+const insertSigningKey = `-- name: InsertSigningKey :exec
+insert into signing_keys (
+        kid,
+        algorithm,
+        private_key,
+        public_key,
+        activates_at,
+        retires_at
+    )
+values ($1, $2, $3, $4, $5, $6)
+`
+
+type InsertSigningKeyParams struct {
+	Kid         string             `json:"kid"`
+	Algorithm   string             `json:"algorithm"`
+	PrivateKey  []byte             `json:"private_key"`
+	PublicKey   []byte             `json:"public_key"`
+	ActivatesAt pgtype.Timestamptz `json:"activates_at"`
+	RetiresAt   pgtype.Timestamptz `json:"retires_at"`
+}
+
+func (q *Queries) InsertSigningKey(ctx context.Context, arg InsertSigningKeyParams) error {
+	_, err := q.db.Exec(ctx, insertSigningKey,
+		arg.Kid,
+		arg.Algorithm,
+		arg.PrivateKey,
+		arg.PublicKey,
+		arg.ActivatesAt,
+		arg.RetiresAt,
+	)
+	return err
+}
+
+const isSessionActive = `-- name: IsSessionActive :one
+select exists (
+        select 1
+        from sessions
+        where id = $1
+            and revoked_at is null
+            and expires_at > now()
+    )
+`
+
+func (q *Queries) IsSessionActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	row := q.db.QueryRow(ctx, isSessionActive, id)
+	var exists bool
+	err := row.Scan(&exists)
+	return exists, err
+}
+
+const listActiveSessions = `-- name: ListActiveSessions :many
+select id,
+    platform,
+    user_agent,
+    ip_address,
+    created_at,
+    last_used_at,
+    expires_at
+from sessions
+where user_id = $1
+    and revoked_at is null
+    and expires_at > now()
+order by last_used_at desc
+`
+
+type ListActiveSessionsRow struct {
+	ID         uuid.UUID          `json:"id"`
+	Platform   string             `json:"platform"`
+	UserAgent  string             `json:"user_agent"`
+	IpAddress  string             `json:"ip_address"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+	ExpiresAt  pgtype.Timestamptz `json:"expires_at"`
+}
+
+func (q *Queries) ListActiveSessions(ctx context.Context, userID uuid.UUID) ([]ListActiveSessionsRow, error) {
+	rows, err := q.db.Query(ctx, listActiveSessions, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListActiveSessionsRow
+	for rows.Next() {
+		var i ListActiveSessionsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Platform,
+			&i.UserAgent,
+			&i.IpAddress,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+			&i.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listExpiredOriginals = `-- name: ListExpiredOriginals :many
+select ri.hash,
+    ri.bucket,
+    ri.key,
+    coalesce(max(ri.medium_key), '')::varchar as medium_key
+from receipt_images ri
+    join receipts r on r.receipt_image_id = ri.id
+where ri.original_deleted_at is null
+group by ri.hash,
+    ri.bucket,
+    ri.key
+having max(r.created_at) < $1
+limit $2
+`
+
+type ListExpiredOriginalsParams struct {
+	CreatedAt pgtype.Timestamp `json:"created_at"`
+	Limit     int32            `json:"limit"`
+}
+
+type ListExpiredOriginalsRow struct {
+	Hash      string `json:"hash"`
+	Bucket    string `json:"bucket"`
+	Key       string `json:"key"`
+	MediumKey string `json:"medium_key"`
+}
+
+func (q *Queries) ListExpiredOriginals(ctx context.Context, arg ListExpiredOriginalsParams) ([]ListExpiredOriginalsRow, error) {
+	rows, err := q.db.Query(ctx, listExpiredOriginals, arg.CreatedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListExpiredOriginalsRow
+	for rows.Next() {
+		var i ListExpiredOriginalsRow
+		if err := rows.Scan(
+			&i.Hash,
+			&i.Bucket,
+			&i.Key,
+			&i.MediumKey,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOutdatedReceipts = `-- name: ListOutdatedReceipts :many
+select r.id,
+    r.prompt_version,
+    r.schema_version
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.deleted_at is null
+    and o.status in ('draft', 'active')
+    and (
+        r.prompt_version <> $1
+        or r.schema_version <> $2
+    )
+order by r.created_at
+limit $3
+`
+
+type ListOutdatedReceiptsParams struct {
+	PromptVersion string `json:"prompt_version"`
+	SchemaVersion string `json:"schema_version"`
+	Limit         int32  `json:"limit"`
+}
+
+type ListOutdatedReceiptsRow struct {
+	ID            uuid.UUID `json:"id"`
+	PromptVersion string    `json:"prompt_version"`
+	SchemaVersion string    `json:"schema_version"`
+}
+
+func (q *Queries) ListOutdatedReceipts(ctx context.Context, arg ListOutdatedReceiptsParams) ([]ListOutdatedReceiptsRow, error) {
+	rows, err := q.db.Query(ctx, listOutdatedReceipts, arg.PromptVersion, arg.SchemaVersion, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOutdatedReceiptsRow
+	for rows.Next() {
+		var i ListOutdatedReceiptsRow
+		if err := rows.Scan(&i.ID, &i.PromptVersion, &i.SchemaVersion); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOutingReceiptFingerprints = `-- name: ListOutingReceiptFingerprints :many
+select r.id,
+    r.restaurant,
+    r.order_number,
+    r.total,
+    r.opened,
+    ri.phash
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+where ri.outing_id = $1
+    and r.deleted_at is null
+`
+
+type ListOutingReceiptFingerprintsRow struct {
+	ID          uuid.UUID          `json:"id"`
+	Restaurant  string             `json:"restaurant"`
+	OrderNumber string             `json:"order_number"`
+	Total       sql.NullFloat64    `json:"total"`
+	Opened      pgtype.Timestamptz `json:"opened"`
+	Phash       pgtype.Int8        `json:"phash"`
+}
+
+func (q *Queries) ListOutingReceiptFingerprints(ctx context.Context, outingID uuid.UUID) ([]ListOutingReceiptFingerprintsRow, error) {
+	rows, err := q.db.Query(ctx, listOutingReceiptFingerprints, outingID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListOutingReceiptFingerprintsRow
+	for rows.Next() {
+		var i ListOutingReceiptFingerprintsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Restaurant,
+			&i.OrderNumber,
+			&i.Total,
+			&i.Opened,
+			&i.Phash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPurgeableOutings = `-- name: ListPurgeableOutings :many
+select id
+from outings
+where deleted_at < $1
+`
+
+func (q *Queries) ListPurgeableOutings(ctx context.Context, deletedAt pgtype.Timestamptz) ([]uuid.UUID, error) {
+	rows, err := q.db.Query(ctx, listPurgeableOutings, deletedAt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPurgeableReceiptImages = `-- name: ListPurgeableReceiptImages :many
+select ri.id,
+    ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.hash
+from receipt_images ri
+    join receipts r on r.receipt_image_id = ri.id
+    join outings o on o.id = ri.outing_id
+where r.deleted_at < $1
+    or o.deleted_at < $1
+limit $2
+`
+
+type ListPurgeableReceiptImagesParams struct {
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+	Limit     int32              `json:"limit"`
+}
+
+type ListPurgeableReceiptImagesRow struct {
+	ID           uuid.UUID   `json:"id"`
+	Bucket       string      `json:"bucket"`
+	Key          string      `json:"key"`
+	ThumbnailKey pgtype.Text `json:"thumbnail_key"`
+	MediumKey    pgtype.Text `json:"medium_key"`
+	Hash         string      `json:"hash"`
+}
+
+func (q *Queries) ListPurgeableReceiptImages(ctx context.Context, arg ListPurgeableReceiptImagesParams) ([]ListPurgeableReceiptImagesRow, error) {
+	rows, err := q.db.Query(ctx, listPurgeableReceiptImages, arg.DeletedAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPurgeableReceiptImagesRow
+	for rows.Next() {
+		var i ListPurgeableReceiptImagesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Bucket,
+			&i.Key,
+			&i.ThumbnailKey,
+			&i.MediumKey,
+			&i.Hash,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listReceiptDuplicates = `-- name: ListReceiptDuplicates :many
+select d.candidate_id,
+    d.reasons,
+    d.status,
+    r.restaurant,
+    r.order_number,
+    r.total,
+    r.opened
+from receipt_duplicates d
+    join receipts r on r.id = d.candidate_id
+where d.receipt_id = $1
+    and d.status = 'pending'
+    and r.deleted_at is null
+order by d.created_at
+`
+
+type ListReceiptDuplicatesRow struct {
+	CandidateID uuid.UUID          `json:"candidate_id"`
+	Reasons     []string           `json:"reasons"`
+	Status      string             `json:"status"`
+	Restaurant  string             `json:"restaurant"`
+	OrderNumber string             `json:"order_number"`
+	Total       sql.NullFloat64    `json:"total"`
+	Opened      pgtype.Timestamptz `json:"opened"`
+}
+
+func (q *Queries) ListReceiptDuplicates(ctx context.Context, receiptID uuid.UUID) ([]ListReceiptDuplicatesRow, error) {
+	rows, err := q.db.Query(ctx, listReceiptDuplicates, receiptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListReceiptDuplicatesRow
+	for rows.Next() {
+		var i ListReceiptDuplicatesRow
+		if err := rows.Scan(
+			&i.CandidateID,
+			&i.Reasons,
+			&i.Status,
+			&i.Restaurant,
+			&i.OrderNumber,
+			&i.Total,
+			&i.Opened,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSigningKeys = `-- name: ListSigningKeys :many
+select kid,
+    algorithm,
+    private_key,
+    public_key,
+    created_at,
+    activates_at,
+    retires_at
+from signing_keys
+where retires_at > now()
+order by activates_at
+`
+
+func (q *Queries) ListSigningKeys(ctx context.Context) ([]SigningKey, error) {
+	rows, err := q.db.Query(ctx, listSigningKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SigningKey
+	for rows.Next() {
+		var i SigningKey
+		if err := rows.Scan(
+			&i.Kid,
+			&i.Algorithm,
+			&i.PrivateKey,
+			&i.PublicKey,
+			&i.CreatedAt,
+			&i.ActivatesAt,
+			&i.RetiresAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUnredactedReceiptImages = `-- name: ListUnredactedReceiptImages :many
+select id,
+    hash,
+    raw_text
+from receipt_images
+where not raw_text_redacted
+limit $1
+`
+
+type ListUnredactedReceiptImagesRow struct {
+	ID      uuid.UUID `json:"id"`
+	Hash    string    `json:"hash"`
+	RawText string    `json:"raw_text"`
+}
+
+func (q *Queries) ListUnredactedReceiptImages(ctx context.Context, limit int32) ([]ListUnredactedReceiptImagesRow, error) {
+	rows, err := q.db.Query(ctx, listUnredactedReceiptImages, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUnredactedReceiptImagesRow
+	for rows.Next() {
+		var i ListUnredactedReceiptImagesRow
+		if err := rows.Scan(&i.ID, &i.Hash, &i.RawText); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUserIdentities = `-- name: ListUserIdentities :many
+select id,
+    provider,
+    email,
+    created_at,
+    last_used_at
+from user_identities
+where user_id = $1
+order by created_at
+`
+
+type ListUserIdentitiesRow struct {
+	ID         uuid.UUID          `json:"id"`
+	Provider   string             `json:"provider"`
+	Email      string             `json:"email"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+}
+
+func (q *Queries) ListUserIdentities(ctx context.Context, userID uuid.UUID) ([]ListUserIdentitiesRow, error) {
+	rows, err := q.db.Query(ctx, listUserIdentities, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListUserIdentitiesRow
+	for rows.Next() {
+		var i ListUserIdentitiesRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Provider,
+			&i.Email,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebauthnCredentials = `-- name: ListWebauthnCredentials :many
+select id,
+    name,
+    transports,
+    created_at,
+    last_used_at
+from webauthn_credentials
+where user_id = $1
+order by created_at
+`
+
+type ListWebauthnCredentialsRow struct {
+	ID         []byte             `json:"id"`
+	Name       string             `json:"name"`
+	Transports []string           `json:"transports"`
+	CreatedAt  pgtype.Timestamptz `json:"created_at"`
+	LastUsedAt pgtype.Timestamptz `json:"last_used_at"`
+}
+
+func (q *Queries) ListWebauthnCredentials(ctx context.Context, userID uuid.UUID) ([]ListWebauthnCredentialsRow, error) {
+	rows, err := q.db.Query(ctx, listWebauthnCredentials, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListWebauthnCredentialsRow
+	for rows.Next() {
+		var i ListWebauthnCredentialsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Transports,
+			&i.CreatedAt,
+			&i.LastUsedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markOriginalDeleted = `-- name: MarkOriginalDeleted :exec
+update receipt_images
+set original_deleted_at = now(),
+    medium_key = null
+where hash = $1
+    and original_deleted_at is null
+`
+
+func (q *Queries) MarkOriginalDeleted(ctx context.Context, hash string) error {
+	_, err := q.db.Exec(ctx, markOriginalDeleted, hash)
+	return err
+}
+
+const moveFriendSplits = `-- name: MoveFriendSplits :exec
+update splits
+set friend_id = $1,
+    updated_at = now()
+where friend_id = $2
+`
+
+type MoveFriendSplitsParams struct {
+	ToFriendID   uuid.UUID `json:"to_friend_id"`
+	FromFriendID uuid.UUID `json:"from_friend_id"`
+}
+
+func (q *Queries) MoveFriendSplits(ctx context.Context, arg MoveFriendSplitsParams) error {
+	_, err := q.db.Exec(ctx, moveFriendSplits, arg.ToFriendID, arg.FromFriendID)
+	return err
+}
+
+const refundExtraction = `-- name: RefundExtraction :exec
+update extraction_usage
+set extractions = extractions - 1,
+    updated_at = now()
+where user_id = $1
+    and month = date_trunc('month', now() at time zone 'utc')::date
+    and extractions > 0
+`
+
+func (q *Queries) RefundExtraction(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.Exec(ctx, refundExtraction, userID)
+	return err
+}
+
+const restoreOuting = `-- name: RestoreOuting :execrows
+update outings
+set deleted_at = null,
+    updated_at = now()
+where id = $1
+    and user_id = $2
+    and deleted_at > $3
+`
+
+type RestoreOutingParams struct {
+	ID        uuid.UUID          `json:"id"`
+	UserID    uuid.UUID          `json:"user_id"`
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+}
+
+func (q *Queries) RestoreOuting(ctx context.Context, arg RestoreOutingParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreOuting, arg.ID, arg.UserID, arg.DeletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const restoreReceipt = `-- name: RestoreReceipt :execrows
+update receipts r
+set deleted_at = null
+from receipt_images ri
+    join outings o on o.id = ri.outing_id
+where r.id = $1
+    and ri.id = r.receipt_image_id
+    and o.user_id = $2
+    and r.deleted_at > $3
+`
+
+type RestoreReceiptParams struct {
+	ID        uuid.UUID          `json:"id"`
+	UserID    uuid.UUID          `json:"user_id"`
+	DeletedAt pgtype.Timestamptz `json:"deleted_at"`
+}
+
+func (q *Queries) RestoreReceipt(ctx context.Context, arg RestoreReceiptParams) (int64, error) {
+	result, err := q.db.Exec(ctx, restoreReceipt, arg.ID, arg.UserID, arg.DeletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeGuestInvites = `-- name: RevokeGuestInvites :execrows
+update guest_invites
+set revoked_at = now()
+where friend_id = $1
+    and revoked_at is null
+`
+
+func (q *Queries) RevokeGuestInvites(ctx context.Context, friendID uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeGuestInvites, friendID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeOtherSessions = `-- name: RevokeOtherSessions :execrows
+update sessions
+set revoked_at = now(),
+    revoked_reason = $3
+where user_id = $1
+    and id <> $2
+    and revoked_at is null
+`
+
+type RevokeOtherSessionsParams struct {
+	UserID        uuid.UUID   `json:"user_id"`
+	ID            uuid.UUID   `json:"id"`
+	RevokedReason pgtype.Text `json:"revoked_reason"`
+}
+
+func (q *Queries) RevokeOtherSessions(ctx context.Context, arg RevokeOtherSessionsParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeOtherSessions, arg.UserID, arg.ID, arg.RevokedReason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeReusedSession = `-- name: RevokeReusedSession :execrows
+update sessions
+set revoked_at = now(),
+    revoked_reason = 'reuse'
+where id = $1
+    and refresh_token_id <> $2
+    and revoked_at is null
+    and expires_at > now()
+`
+
+type RevokeReusedSessionParams struct {
+	ID             uuid.UUID `json:"id"`
+	RefreshTokenID uuid.UUID `json:"refresh_token_id"`
+}
+
+func (q *Queries) RevokeReusedSession(ctx context.Context, arg RevokeReusedSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeReusedSession, arg.ID, arg.RefreshTokenID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeSession = `-- name: RevokeSession :execrows
+update sessions
+set revoked_at = now(),
+    revoked_reason = $3
+where id = $1
+    and user_id = $2
+    and revoked_at is null
+`
+
+type RevokeSessionParams struct {
+	ID            uuid.UUID   `json:"id"`
+	UserID        uuid.UUID   `json:"user_id"`
+	RevokedReason pgtype.Text `json:"revoked_reason"`
+}
+
+func (q *Queries) RevokeSession(ctx context.Context, arg RevokeSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeSession, arg.ID, arg.UserID, arg.RevokedReason)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateSession = `-- name: RotateSession :execrows
+update sessions
+set refresh_token_id = $1,
+    expires_at = $2,
+    last_used_at = now()
+where id = $3
+    and refresh_token_id = $4
+    and revoked_at is null
+    and expires_at > now()
+`
+
+type RotateSessionParams struct {
+	NewRefreshTokenID uuid.UUID          `json:"new_refresh_token_id"`
+	ExpiresAt         pgtype.Timestamptz `json:"expires_at"`
+	ID                uuid.UUID          `json:"id"`
+	RefreshTokenID    uuid.UUID          `json:"refresh_token_id"`
 }
 
-func (q *Queries) GetReceiptImage(ctx context.Context, id uuid.UUID) (GetReceiptImageRow, error) {
-	row := q.db.QueryRow(ctx, getReceiptImage, id)
-	var i GetReceiptImageRow
-	err := row.Scan(&i.Bucket, &i.Key)
-	return i, err
+func (q *Queries) RotateSession(ctx context.Context, arg RotateSessionParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rotateSession,
+		arg.NewRefreshTokenID,
+		arg.ExpiresAt,
+		arg.ID,
+		arg.RefreshTokenID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
 }
 
-const getReceiptsForOuting = `-- name: GetReceiptsForOuting :many
-SELECT r.restaurant,
-    COUNT(oi.id) AS order_count,
+const searchReceipts = `-- name: SearchReceipts :many
+select r.id,
+    r.restaurant,
     r.total,
-    r.id
-FROM receipts r
-    JOIN order_items oi ON r.id = oi.receipt_id
-    JOIN receipt_images ri ON r.receipt_image_id = ri.id
-WHERE ri.outing_id = $1
-GROUP BY r.id
+    r.opened,
+    r.created_at,
+    o.id as outing_id,
+    o.name as outing_name,
+    ts_headline(
+        'english',
+        ri.raw_text,
+        query,
+        'MaxFragments=1, MinWords=3, MaxWords=12'
+    )::text as snippet,
+    coalesce(items.names, '{}')::text [] as matched_items
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+    cross join websearch_to_tsquery('english', $1::text) query
+    left join lateral (
+        select array_agg(
+                oi.name
+                order by oi.name
+            ) as names
+        from order_items oi
+        where oi.receipt_id = r.id
+            and to_tsvector('english', oi.name) @@ query
+    ) items on true
+where r.deleted_at is null
+    and o.deleted_at is null
+    and (
+        o.user_id = $2
+        or exists (
+            select 1
+            from friends f
+            where f.outing_id = o.id
+                and f.user_id = $2
+        )
+    )
+    and (
+        to_tsvector('english', ri.raw_text) @@ query
+        or to_tsvector('english', r.restaurant) @@ query
+        or items.names is not null
+    )
+    and (
+        $3::uuid is null
+        or o.id = $3::uuid
+    )
+    and (
+        cardinality($4::text []) = 0
+        or o.status = any($4::text [])
+    )
+    and (
+        $5::date is null
+        or coalesce(r.opened, r.created_at)::date >= $5::date
+    )
+    and (
+        $6::date is null
+        or coalesce(r.opened, r.created_at)::date <= $6::date
+    )
+    and (
+        $7::uuid is null
+        or (r.created_at, r.id) < (
+            $8::timestamp,
+            $7::uuid
+        )
+    )
+order by r.created_at desc,
+    r.id desc
+limit $9
 `
 
-type GetReceiptsForOutingRow struct {
-	Restaurant string          `json:"restaurant"`
-	OrderCount int64           `json:"order_count"`
-	Total      sql.NullFloat64 `json:"total"`
-	ID         uuid.UUID       `json:"id"`
+type SearchReceiptsParams struct {
+	Query      string           `json:"query"`
+	UserID     uuid.UUID        `json:"user_id"`
+	OutingID   *uuid.UUID       `json:"outing_id"`
+	Statuses   []string         `json:"statuses"`
+	DateFrom   pgtype.Date      `json:"date_from"`
+	DateTo     pgtype.Date      `json:"date_to"`
+	CursorID   *uuid.UUID       `json:"cursor_id"`
+	CursorTime pgtype.Timestamp `json:"cursor_time"`
+	PageLimit  int32            `json:"page_limit"`
+}
+
+type SearchReceiptsRow struct {
+	ID           uuid.UUID          `json:"id"`
+	Restaurant   string             `json:"restaurant"`
+	Total        sql.NullFloat64    `json:"total"`
+	Opened       pgtype.Timestamptz `json:"opened"`
+	CreatedAt    time.Time          `json:"created_at"`
+	OutingID     uuid.UUID          `json:"outing_id"`
+	OutingName   string             `json:"outing_name"`
+	Snippet      string             `json:"snippet"`
+	MatchedItems []string           `json:"matched_items"`
 }
 
-func (q *Queries) GetReceiptsForOuting(ctx context.Context, outingID uuid.UUID) ([]GetReceiptsForOutingRow, error) {
-	rows, err := q.db.Query(ctx, getReceiptsForOuting, outingID)
+func (q *Queries) SearchReceipts(ctx context.Context, arg SearchReceiptsParams) ([]SearchReceiptsRow, error) {
+	rows, err := q.db.Query(ctx, searchReceipts,
+		arg.Query,
+		arg.UserID,
+		arg.OutingID,
+		arg.Statuses,
+		arg.DateFrom,
+		arg.DateTo,
+		arg.CursorID,
+		arg.CursorTime,
+		arg.PageLimit,
+	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []GetReceiptsForOutingRow
+	var items []SearchReceiptsRow
 	for rows.Next() {
-		var i GetReceiptsForOutingRow
+		var i SearchReceiptsRow
 		if err := rows.Scan(
+			&i.ID,
 			&i.Restaurant,
-			&i.OrderCount,
 			&i.Total,
-			&i.ID,
+			&i.Opened,
+			&i.CreatedAt,
+			&i.OutingID,
+			&i.OutingName,
+			&i.Snippet,
+			&i.MatchedItems,
 		); err != nil {
 			return nil, err
 		}
@@ -549,167 +3345,324 @@ func (q *Queries) GetReceiptsForOuting(ctx context.Context, outingID uuid.UUID)
 	return items, nil
 }
 
-const getUserBySub = `-- name: GetUserBySub :one
-select id,
-    sub,
-    email,
-    picture,
-    created_at,
-    updated_at
-from users
-where sub = $1
+const setFriendUser = `-- name: SetFriendUser :exec
+update friends
+set user_id = $2,
+    updated_at = now()
+where id = $1
 `
 
-type GetUserBySubRow struct {
-	ID        uuid.UUID          `json:"id"`
-	Sub       string             `json:"sub"`
-	Email     string             `json:"email"`
-	Picture   string             `json:"picture"`
-	CreatedAt pgtype.Timestamptz `json:"created_at"`
-	UpdatedAt pgtype.Timestamptz `json:"updated_at"`
+type SetFriendUserParams struct {
+	ID     uuid.UUID  `json:"id"`
+	UserID *uuid.UUID `json:"user_id"`
 }
 
-func (q *Queries) GetUserBySub(ctx context.Context, sub string) (GetUserBySubRow, error) {
-	row := q.db.QueryRow(ctx, getUserBySub, sub)
-	var i GetUserBySubRow
-	err := row.Scan(
-		&i.ID,
-		&i.Sub,
-		&i.Email,
-		&i.Picture,
-		&i.CreatedAt,
-		&i.UpdatedAt,
-	)
-	return i, err
+func (q *Queries) SetFriendUser(ctx context.Context, arg SetFriendUserParams) error {
+	_, err := q.db.Exec(ctx, setFriendUser, arg.ID, arg.UserID)
+	return err
 }
 
-const insertCachedCloudVisionResponse = `-- name: InsertCachedCloudVisionResponse :one
-insert into cloud_vision_cache (image_hash, response)
-values ($1, $2)
-returning id
+const setRedactedRawText = `-- name: SetRedactedRawText :exec
+update receipt_images
+set raw_text = $2,
+    raw_text_redacted = true
+where id = $1
 `
 
-type InsertCachedCloudVisionResponseParams struct {
-	ImageHash string   `json:"image_hash"`
-	Response  []string `json:"response"`
+type SetRedactedRawTextParams struct {
+	ID      uuid.UUID `json:"id"`
+	RawText string    `json:"raw_text"`
 }
 
-func (q *Queries) InsertCachedCloudVisionResponse(ctx context.Context, arg InsertCachedCloudVisionResponseParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertCachedCloudVisionResponse, arg.ImageHash, arg.Response)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) SetRedactedRawText(ctx context.Context, arg SetRedactedRawTextParams) error {
+	_, err := q.db.Exec(ctx, setRedactedRawText, arg.ID, arg.RawText)
+	return err
 }
 
-const insertCachedGenAiResponse = `-- name: InsertCachedGenAiResponse :one
-insert into genai_cache (image_hash, response)
-values ($1, $2)
-returning id
+const setUserAvatar = `-- name: SetUserAvatar :exec
+update users
+set avatar_key = $2,
+    picture = $3,
+    updated_at = now()
+where id = $1
 `
 
-type InsertCachedGenAiResponseParams struct {
-	ImageHash string `json:"image_hash"`
-	Response  []byte `json:"response"`
+type SetUserAvatarParams struct {
+	ID        uuid.UUID `json:"id"`
+	AvatarKey string    `json:"avatar_key"`
+	Picture   string    `json:"picture"`
 }
 
-func (q *Queries) InsertCachedGenAiResponse(ctx context.Context, arg InsertCachedGenAiResponseParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertCachedGenAiResponse, arg.ImageHash, arg.Response)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+func (q *Queries) SetUserAvatar(ctx context.Context, arg SetUserAvatarParams) error {
+	_, err := q.db.Exec(ctx, setUserAvatar, arg.ID, arg.AvatarKey, arg.Picture)
+	return err
 }
 
-const insertOrderItem = `-- name: InsertOrderItem :exec
-INSERT INTO order_items (receipt_id, name, price, quantity)
-VALUES ($1, $2, $3, $4)
+const setUserNameIfEmpty = `-- name: SetUserNameIfEmpty :exec
+update users
+set name = $2,
+    updated_at = now()
+where id = $1
+    and name = ''
 `
 
-type InsertOrderItemParams struct {
-	ReceiptID uuid.UUID       `json:"receipt_id"`
-	Name      string          `json:"name"`
-	Price     sql.NullFloat64 `json:"price"`
-	Quantity  int32           `json:"quantity"`
+type SetUserNameIfEmptyParams struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
 }
 
-func (q *Queries) InsertOrderItem(ctx context.Context, arg InsertOrderItemParams) error {
-	_, err := q.db.Exec(ctx, insertOrderItem,
-		arg.ReceiptID,
+func (q *Queries) SetUserNameIfEmpty(ctx context.Context, arg SetUserNameIfEmptyParams) error {
+	_, err := q.db.Exec(ctx, setUserNameIfEmpty, arg.ID, arg.Name)
+	return err
+}
+
+const softDeleteOuting = `-- name: SoftDeleteOuting :one
+update outings
+set deleted_at = now(),
+    updated_at = now()
+where id = $1
+    and user_id = $2
+    and deleted_at is null
+returning deleted_at
+`
+
+type SoftDeleteOutingParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) SoftDeleteOuting(ctx context.Context, arg SoftDeleteOutingParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, softDeleteOuting, arg.ID, arg.UserID)
+	var deleted_at pgtype.Timestamptz
+	err := row.Scan(&deleted_at)
+	return deleted_at, err
+}
+
+const softDeleteReceipt = `-- name: SoftDeleteReceipt :one
+update receipts r
+set deleted_at = now()
+from receipt_images ri
+    join outings o on o.id = ri.outing_id
+where r.id = $1
+    and ri.id = r.receipt_image_id
+    and o.user_id = $2
+    and r.deleted_at is null
+returning r.deleted_at
+`
+
+type SoftDeleteReceiptParams struct {
+	ID     uuid.UUID `json:"id"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+func (q *Queries) SoftDeleteReceipt(ctx context.Context, arg SoftDeleteReceiptParams) (pgtype.Timestamptz, error) {
+	row := q.db.QueryRow(ctx, softDeleteReceipt, arg.ID, arg.UserID)
+	var deleted_at pgtype.Timestamptz
+	err := row.Scan(&deleted_at)
+	return deleted_at, err
+}
+
+const softDeleteUserOutings = `-- name: SoftDeleteUserOutings :execrows
+update outings
+set deleted_at = now(),
+    updated_at = now()
+where user_id = $1
+    and deleted_at is null
+`
+
+func (q *Queries) SoftDeleteUserOutings(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.Exec(ctx, softDeleteUserOutings, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const touchUserIdentity = `-- name: TouchUserIdentity :exec
+update user_identities
+set last_used_at = now(),
+    email = case
+        when $1::text = '' then email
+        else $1::text
+    end
+where provider = $2
+    and subject = $3
+`
+
+type TouchUserIdentityParams struct {
+	Email    string `json:"email"`
+	Provider string `json:"provider"`
+	Subject  string `json:"subject"`
+}
+
+func (q *Queries) TouchUserIdentity(ctx context.Context, arg TouchUserIdentityParams) error {
+	_, err := q.db.Exec(ctx, touchUserIdentity, arg.Email, arg.Provider, arg.Subject)
+	return err
+}
+
+const updateOutingDetails = `-- name: UpdateOutingDetails :exec
+update outings
+set name = $2,
+    date = $3,
+    location = $4,
+    updated_at = now()
+where id = $1
+`
+
+type UpdateOutingDetailsParams struct {
+	ID       uuid.UUID   `json:"id"`
+	Name     string      `json:"name"`
+	Date     pgtype.Date `json:"date"`
+	Location string      `json:"location"`
+}
+
+func (q *Queries) UpdateOutingDetails(ctx context.Context, arg UpdateOutingDetailsParams) error {
+	_, err := q.db.Exec(ctx, updateOutingDetails,
+		arg.ID,
 		arg.Name,
-		arg.Price,
-		arg.Quantity,
+		arg.Date,
+		arg.Location,
 	)
 	return err
 }
 
-const insertOtherFee = `-- name: InsertOtherFee :exec
-INSERT INTO other_fees (receipt_id, name, price)
-VALUES ($1, $2, $3)
+const updateOutingStatus = `-- name: UpdateOutingStatus :execrows
+update outings
+set status = $1,
+    updated_at = now()
+where id = $2
+    and status = $3
 `
 
-type InsertOtherFeeParams struct {
-	ReceiptID uuid.UUID       `json:"receipt_id"`
-	Name      string          `json:"name"`
-	Price     sql.NullFloat64 `json:"price"`
+type UpdateOutingStatusParams struct {
+	Status     string    `json:"status"`
+	ID         uuid.UUID `json:"id"`
+	FromStatus string    `json:"from_status"`
 }
 
-func (q *Queries) InsertOtherFee(ctx context.Context, arg InsertOtherFeeParams) error {
-	_, err := q.db.Exec(ctx, insertOtherFee, arg.ReceiptID, arg.Name, arg.Price)
+func (q *Queries) UpdateOutingStatus(ctx context.Context, arg UpdateOutingStatusParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateOutingStatus, arg.Status, arg.ID, arg.FromStatus)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateProfile = `-- name: UpdateProfile :exec
+update users
+set name = $2,
+    timezone = $3,
+    locale = $4,
+    default_currency = $5,
+    default_tip_percentage = $6,
+    venmo_handle = $7,
+    paypal_handle = $8,
+    iban = $9,
+    updated_at = now()
+where id = $1
+`
+
+type UpdateProfileParams struct {
+	ID                   uuid.UUID     `json:"id"`
+	Name                 string        `json:"name"`
+	Timezone             string        `json:"timezone"`
+	Locale               string        `json:"locale"`
+	DefaultCurrency      string        `json:"default_currency"`
+	DefaultTipPercentage pgtype.Float8 `json:"default_tip_percentage"`
+	VenmoHandle          string        `json:"venmo_handle"`
+	PaypalHandle         string        `json:"paypal_handle"`
+	Iban                 string        `json:"iban"`
+}
+
+func (q *Queries) UpdateProfile(ctx context.Context, arg UpdateProfileParams) error {
+	_, err := q.db.Exec(ctx, updateProfile,
+		arg.ID,
+		arg.Name,
+		arg.Timezone,
+		arg.Locale,
+		arg.DefaultCurrency,
+		arg.DefaultTipPercentage,
+		arg.VenmoHandle,
+		arg.PaypalHandle,
+		arg.Iban,
+	)
 	return err
 }
 
-const insertReceipt = `-- name: InsertReceipt :one
-INSERT INTO receipts (
-        receipt_image_id,
-        restaurant,
-        address,
-        opened,
-        order_number,
-        order_type,
-        table_number,
-        server,
-        subtotal,
-        sales_tax,
-        total,
-        copy
-    )
-VALUES (
-        $1,
-        $2,
-        $3,
-        $4,
-        $5,
-        $6,
-        $7,
-        $8,
-        $9,
-        $10,
-        $11,
-        $12
-    )
-RETURNING id
+const updateReceiptDuplicateStatus = `-- name: UpdateReceiptDuplicateStatus :execrows
+update receipt_duplicates
+set status = $3,
+    updated_at = now()
+where receipt_id = $1
+    and candidate_id = $2
 `
 
-type InsertReceiptParams struct {
-	ReceiptImageID uuid.UUID       `json:"receipt_image_id"`
-	Restaurant     string          `json:"restaurant"`
-	Address        string          `json:"address"`
-	Opened         time.Time       `json:"opened"`
-	OrderNumber    string          `json:"order_number"`
-	OrderType      string          `json:"order_type"`
-	TableNumber    string          `json:"table_number"`
-	Server         string          `json:"server"`
-	Subtotal       sql.NullFloat64 `json:"subtotal"`
-	SalesTax       sql.NullFloat64 `json:"sales_tax"`
-	Total          sql.NullFloat64 `json:"total"`
-	Copy           string          `json:"copy"`
+type UpdateReceiptDuplicateStatusParams struct {
+	ReceiptID   uuid.UUID `json:"receipt_id"`
+	CandidateID uuid.UUID `json:"candidate_id"`
+	Status      string    `json:"status"`
 }
 
-func (q *Queries) InsertReceipt(ctx context.Context, arg InsertReceiptParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertReceipt,
-		arg.ReceiptImageID,
+func (q *Queries) UpdateReceiptDuplicateStatus(ctx context.Context, arg UpdateReceiptDuplicateStatusParams) (int64, error) {
+	result, err := q.db.Exec(ctx, updateReceiptDuplicateStatus, arg.ReceiptID, arg.CandidateID, arg.Status)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const updateReceiptExtraction = `-- name: UpdateReceiptExtraction :exec
+update receipts
+set restaurant = $2,
+    address = $3,
+    opened = $4,
+    opened_raw = $5,
+    order_number = $6,
+    order_type = $7,
+    table_number = $8,
+    server = $9,
+    subtotal = $10,
+    sales_tax = $11,
+    total = $12,
+    copy = $13,
+    payment_method = $14,
+    payment_amount_paid = $15,
+    payment_tip = $16,
+    payment_card_last_four = $17,
+    prompt_version = $18,
+    schema_version = $19
+where id = $1
+`
+
+type UpdateReceiptExtractionParams struct {
+	ID                  uuid.UUID          `json:"id"`
+	Restaurant          string             `json:"restaurant"`
+	Address             string             `json:"address"`
+	Opened              pgtype.Timestamptz `json:"opened"`
+	OpenedRaw           string             `json:"opened_raw"`
+	OrderNumber         string             `json:"order_number"`
+	OrderType           string             `json:"order_type"`
+	TableNumber         string             `json:"table_number"`
+	Server              string             `json:"server"`
+	Subtotal            sql.NullFloat64    `json:"subtotal"`
+	SalesTax            sql.NullFloat64    `json:"sales_tax"`
+	Total               sql.NullFloat64    `json:"total"`
+	Copy                string             `json:"copy"`
+	PaymentMethod       string             `json:"payment_method"`
+	PaymentAmountPaid   sql.NullFloat64    `json:"payment_amount_paid"`
+	PaymentTip          sql.NullFloat64    `json:"payment_tip"`
+	PaymentCardLastFour string             `json:"payment_card_last_four"`
+	PromptVersion       string             `json:"prompt_version"`
+	SchemaVersion       string             `json:"schema_version"`
+}
+
+func (q *Queries) UpdateReceiptExtraction(ctx context.Context, arg UpdateReceiptExtractionParams) error {
+	_, err := q.db.Exec(ctx, updateReceiptExtraction,
+		arg.ID,
 		arg.Restaurant,
 		arg.Address,
 		arg.Opened,
+		arg.OpenedRaw,
 		arg.OrderNumber,
 		arg.OrderType,
 		arg.TableNumber,
@@ -718,44 +3671,159 @@ func (q *Queries) InsertReceipt(ctx context.Context, arg InsertReceiptParams) (u
 		arg.SalesTax,
 		arg.Total,
 		arg.Copy,
+		arg.PaymentMethod,
+		arg.PaymentAmountPaid,
+		arg.PaymentTip,
+		arg.PaymentCardLastFour,
+		arg.PromptVersion,
+		arg.SchemaVersion,
 	)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+	return err
 }
 
-const insertReceiptImage = `-- name: InsertReceiptImage :one
-INSERT INTO receipt_images (
-        hash,
-        bucket,
-        key,
-        raw_text,
-        file_name,
-        outing_id
+const updateReceiptTipPercentage = `-- name: UpdateReceiptTipPercentage :exec
+update receipts
+set tip_percentage_override = $2
+where id = $1
+`
+
+type UpdateReceiptTipPercentageParams struct {
+	ID                    uuid.UUID       `json:"id"`
+	TipPercentageOverride sql.NullFloat64 `json:"tip_percentage_override"`
+}
+
+func (q *Queries) UpdateReceiptTipPercentage(ctx context.Context, arg UpdateReceiptTipPercentageParams) error {
+	_, err := q.db.Exec(ctx, updateReceiptTipPercentage, arg.ID, arg.TipPercentageOverride)
+	return err
+}
+
+const updateUserPicture = `-- name: UpdateUserPicture :exec
+update users
+set picture = $2,
+    updated_at = now()
+where id = $1
+    and avatar_key = ''
+`
+
+type UpdateUserPictureParams struct {
+	ID      uuid.UUID `json:"id"`
+	Picture string    `json:"picture"`
+}
+
+func (q *Queries) UpdateUserPicture(ctx context.Context, arg UpdateUserPictureParams) error {
+	_, err := q.db.Exec(ctx, updateUserPicture, arg.ID, arg.Picture)
+	return err
+}
+
+const updateWebauthnSignCount = `-- name: UpdateWebauthnSignCount :exec
+update webauthn_credentials
+set sign_count = $2,
+    last_used_at = now()
+where id = $1
+`
+
+type UpdateWebauthnSignCountParams struct {
+	ID        []byte `json:"id"`
+	SignCount int64  `json:"sign_count"`
+}
+
+func (q *Queries) UpdateWebauthnSignCount(ctx context.Context, arg UpdateWebauthnSignCountParams) error {
+	_, err := q.db.Exec(ctx, updateWebauthnSignCount, arg.ID, arg.SignCount)
+	return err
+}
+
+const upsertCacheEntry = `-- name: UpsertCacheEntry :exec
+insert into extraction_cache (
+        stage,
+        provider,
+        model,
+        prompt_version,
+        input_hash,
+        response,
+        expires_at
     )
-VALUES ($1, $2, $3, $4, $5, $6)
-RETURNING id
+values ($1, $2, $3, $4, $5, $6, $7) on conflict (stage, provider, model, prompt_version, input_hash) do
+update
+set response = excluded.response,
+    expires_at = excluded.expires_at,
+    updated_at = now()
 `
 
-type InsertReceiptImageParams struct {
-	Hash     string    `json:"hash"`
-	Bucket   string    `json:"bucket"`
-	Key      string    `json:"key"`
-	RawText  string    `json:"raw_text"`
-	FileName string    `json:"file_name"`
-	OutingID uuid.UUID `json:"outing_id"`
+type UpsertCacheEntryParams struct {
+	Stage         string             `json:"stage"`
+	Provider      string             `json:"provider"`
+	Model         string             `json:"model"`
+	PromptVersion string             `json:"prompt_version"`
+	InputHash     string             `json:"input_hash"`
+	Response      []byte             `json:"response"`
+	ExpiresAt     pgtype.Timestamptz `json:"expires_at"`
 }
 
-func (q *Queries) InsertReceiptImage(ctx context.Context, arg InsertReceiptImageParams) (uuid.UUID, error) {
-	row := q.db.QueryRow(ctx, insertReceiptImage,
-		arg.Hash,
-		arg.Bucket,
-		arg.Key,
-		arg.RawText,
-		arg.FileName,
-		arg.OutingID,
+func (q *Queries) UpsertCacheEntry(ctx context.Context, arg UpsertCacheEntryParams) error {
+	_, err := q.db.Exec(ctx, upsertCacheEntry,
+		arg.Stage,
+		arg.Provider,
+		arg.Model,
+		arg.PromptVersion,
+		arg.InputHash,
+		arg.Response,
+		arg.ExpiresAt,
 	)
-	var id uuid.UUID
-	err := row.Scan(&id)
-	return id, err
+	return err
+}
+
+const upsertEmailForwardingAddress = `-- name: UpsertEmailForwardingAddress :one
+insert into email_forwarding_addresses (user_id, token, outing_id)
+values ($1, $2, $3) on conflict (user_id) do
+update
+set outing_id = excluded.outing_id,
+    updated_at = now()
+returning id, user_id, token, outing_id, created_at, updated_at
+`
+
+type UpsertEmailForwardingAddressParams struct {
+	UserID   uuid.UUID  `json:"user_id"`
+	Token    string     `json:"token"`
+	OutingID *uuid.UUID `json:"outing_id"`
+}
+
+func (q *Queries) UpsertEmailForwardingAddress(ctx context.Context, arg UpsertEmailForwardingAddressParams) (EmailForwardingAddress, error) {
+	row := q.db.QueryRow(ctx, upsertEmailForwardingAddress, arg.UserID, arg.Token, arg.OutingID)
+	var i EmailForwardingAddress
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Token,
+		&i.OutingID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const useExtraction = `-- name: UseExtraction :one
+insert into extraction_usage (user_id, month, extractions)
+values (
+        $1,
+        date_trunc('month', now() at time zone 'utc')::date,
+        1
+    ) on conflict (user_id, month) do
+update
+set extractions = extraction_usage.extractions + 1,
+    updated_at = now()
+where $2::int = 0
+    or extraction_usage.extractions < $2::int
+returning extractions
+`
+
+type UseExtractionParams struct {
+	UserID uuid.UUID `json:"user_id"`
+	Quota  int32     `json:"quota"`
+}
+
+func (q *Queries) UseExtraction(ctx context.Context, arg UseExtractionParams) (int32, error) {
+	row := q.db.QueryRow(ctx, useExtraction, arg.UserID, arg.Quota)
+	var extractions int32
+	err := row.Scan(&extractions)
+	return extractions, err
 }
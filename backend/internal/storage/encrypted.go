@@ -0,0 +1,268 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrPresignUnsupported is returned by storages whose objects cannot be
+// handed to clients directly; callers serve them through the API instead.
+var ErrPresignUnsupported = errors.New("presigned urls are not supported")
+
+// encryptedMagic starts every object written by Encrypted.
+var encryptedMagic = []byte("CVENC1")
+
+const (
+	keyIDSize = 8
+	// magic, key id, sealed data key with its nonce, data nonce, tag
+	encryptedOverhead = 6 + keyIDSize + (12 + 32 + 16) + 12 + 16
+)
+
+// Encrypted wraps a Storage with envelope encryption. Every object is sealed
+// with its own random AES-256-GCM data key, and the data key is sealed with
+// the master key and stored in front of the ciphertext, so rotating the
+// master key only means resealing data keys: keep the old key in the list of
+// previous keys, which are still accepted when reading, and run Reseal over
+// the bucket. The ciphertext is bound to its bucket and key. Objects written
+// before encryption was turned on have no header and are returned as stored.
+// List reports stored sizes.
+type Encrypted struct {
+	Storage
+	master cipher.AEAD
+	keyID  []byte
+	// every accepted master key, current and previous, by key id
+	keys map[string]cipher.AEAD
+}
+
+// NewEncrypted seals new objects with masterKey. Objects sealed with one of
+// oldKeys can still be read and resealed.
+func NewEncrypted(storage Storage, masterKey []byte, oldKeys ...[]byte) (*Encrypted, error) {
+	e := &Encrypted{Storage: storage, keys: map[string]cipher.AEAD{}}
+	for i, key := range append([][]byte{masterKey}, oldKeys...) {
+		if len(key) != 32 {
+			return nil, fmt.Errorf("encryption key must be 32 bytes, got %d", len(key))
+		}
+		gcm, err := newGCM(key)
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(key)
+		if i == 0 {
+			e.master, e.keyID = gcm, sum[:keyIDSize]
+		}
+		if _, ok := e.keys[string(sum[:keyIDSize])]; !ok {
+			e.keys[string(sum[:keyIDSize])] = gcm
+		}
+	}
+	return e, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func objectAAD(bucket, key string) []byte {
+	return []byte(bucket + "/" + key)
+}
+
+func (e *Encrypted) seal(bucket, key string, plain []byte) ([]byte, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, encryptedOverhead+len(plain))
+	out = append(out, encryptedMagic...)
+	out = append(out, e.keyID...)
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	out = e.master.Seal(out, nonce, dataKey, e.keyID)
+
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out = append(out, nonce...)
+	return data.Seal(out, nonce, plain, objectAAD(bucket, key)), nil
+}
+
+// header splits a sealed object into its key id, sealed data key (nonce
+// included) and the sealed data. ok is false for objects stored in plaintext.
+func header(bucket, key string, sealed []byte) (keyID, dataKey, data []byte, ok bool, err error) {
+	if !bytes.HasPrefix(sealed, encryptedMagic) {
+		return nil, nil, nil, false, nil
+	}
+	if len(sealed) < encryptedOverhead {
+		return nil, nil, nil, false, fmt.Errorf("encrypted object %s/%s is truncated", bucket, key)
+	}
+
+	rest := sealed[len(encryptedMagic):]
+	return rest[:keyIDSize], rest[keyIDSize : keyIDSize+12+32+16], rest[keyIDSize+12+32+16:], true, nil
+}
+
+// openDataKey unseals a data key with whichever accepted master key sealed it.
+func (e *Encrypted) openDataKey(bucket, key string, keyID, sealedKey []byte) ([]byte, error) {
+	master, ok := e.keys[string(keyID)]
+	if !ok {
+		return nil, fmt.Errorf("object %s/%s was encrypted with an unknown key", bucket, key)
+	}
+	dataKey, err := master.Open(nil, sealedKey[:12], sealedKey[12:], keyID)
+	if err != nil {
+		return nil, fmt.Errorf("unsealing data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+func (e *Encrypted) open(bucket, key string, sealed []byte) ([]byte, error) {
+	keyID, sealedKey, rest, ok, err := header(bucket, key, sealed)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return sealed, nil
+	}
+
+	dataKey, err := e.openDataKey(bucket, key, keyID, sealedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return data.Open(nil, rest[:12], rest[12:], objectAAD(bucket, key))
+}
+
+// reseal rewraps the data key of an object sealed with a previous master key
+// under the current one. The data itself is left as it is. ok is false when
+// the object is plaintext or already uses the current key.
+func (e *Encrypted) reseal(bucket, key string, sealed []byte) (out []byte, ok bool, err error) {
+	keyID, sealedKey, rest, ok, err := header(bucket, key, sealed)
+	if err != nil || !ok || bytes.Equal(keyID, e.keyID) {
+		return nil, false, err
+	}
+
+	dataKey, err := e.openDataKey(bucket, key, keyID, sealedKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	out = make([]byte, 0, len(sealed))
+	out = append(out, encryptedMagic...)
+	out = append(out, e.keyID...)
+
+	nonce := make([]byte, 12)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, false, err
+	}
+	out = append(out, nonce...)
+	out = e.master.Seal(out, nonce, dataKey, e.keyID)
+	return append(out, rest...), true, nil
+}
+
+// Reseal rewraps the data keys of every object in bucket that was sealed with
+// a previous master key, and returns how many objects were rewritten. Once it
+// has run, the previous keys can be dropped.
+func (e *Encrypted) Reseal(ctx context.Context, bucket string) (int, error) {
+	objects, err := e.Storage.List(ctx, bucket, "")
+	if err != nil {
+		return 0, err
+	}
+
+	resealed := 0
+	for _, object := range objects {
+		body, info, err := e.Storage.Get(ctx, bucket, object.Key)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return resealed, err
+		}
+		sealed, err := io.ReadAll(body)
+		body.Close()
+		if err != nil {
+			return resealed, err
+		}
+
+		out, ok, err := e.reseal(bucket, object.Key, sealed)
+		if err != nil {
+			return resealed, err
+		}
+		if !ok {
+			continue
+		}
+		if err := e.Storage.Put(ctx, bucket, object.Key, bytes.NewReader(out), int64(len(out)), info.ContentType); err != nil {
+			return resealed, err
+		}
+		resealed++
+	}
+	return resealed, nil
+}
+
+// Put buffers the object, since GCM seals it in one piece.
+func (e *Encrypted) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	plain, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	sealed, err := e.seal(bucket, key, plain)
+	if err != nil {
+		return err
+	}
+	return e.Storage.Put(ctx, bucket, key, bytes.NewReader(sealed), int64(len(sealed)), contentType)
+}
+
+func (e *Encrypted) Get(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error) {
+	body, info, err := e.Storage.Get(ctx, bucket, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	defer body.Close()
+
+	sealed, err := io.ReadAll(body)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+	plain, err := e.open(bucket, key, sealed)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	info.Size = int64(len(plain))
+	return io.NopCloser(bytes.NewReader(plain)), info, nil
+}
+
+// Stat reports the plaintext size, which means reading the object.
+func (e *Encrypted) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	body, info, err := e.Get(ctx, bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	body.Close()
+	return info, nil
+}
+
+// Presign is unsupported, a presigned URL would hand out ciphertext.
+func (e *Encrypted) Presign(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	return "", ErrPresignUnsupported
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+)
+
+func testKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func newTestEncrypted(t *testing.T, fs *Filesystem, key []byte, oldKeys ...[]byte) *Encrypted {
+	t.Helper()
+	e, err := NewEncrypted(fs, key, oldKeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func readObject(t *testing.T, s Storage, bucket, key string) ([]byte, error) {
+	t.Helper()
+	body, _, err := s.Get(context.Background(), bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+func TestEncryptedKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystem(t.TempDir(), "http://localhost/files", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.EnsureBucket(ctx, "receipts"); err != nil {
+		t.Fatal(err)
+	}
+
+	oldKey, newKey := testKey(1), testKey(2)
+	plain := []byte("receipt image")
+
+	if err := PutBytes(ctx, newTestEncrypted(t, fs, oldKey), "receipts", "a.jpg", plain, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	if err := PutBytes(ctx, fs, "receipts", "plain.jpg", plain, "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := readObject(t, newTestEncrypted(t, fs, newKey), "receipts", "a.jpg"); err == nil {
+		t.Fatal("reading with only the new key succeeded")
+	}
+
+	rotated := newTestEncrypted(t, fs, newKey, oldKey)
+	if got, err := readObject(t, rotated, "receipts", "a.jpg"); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("read with previous key = %q, %v", got, err)
+	}
+
+	n, err := rotated.Reseal(ctx, "receipts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("Reseal rewrote %d objects, want 1", n)
+	}
+	if n, err := rotated.Reseal(ctx, "receipts"); err != nil || n != 0 {
+		t.Errorf("second Reseal = %d, %v, want 0", n, err)
+	}
+
+	for _, key := range []string{"a.jpg", "plain.jpg"} {
+		got, err := readObject(t, newTestEncrypted(t, fs, newKey), "receipts", key)
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("%s after reseal = %q, %v", key, got, err)
+		}
+	}
+}
+
+func TestEncryptedOpenRejects(t *testing.T) {
+	e, err := NewEncrypted(nil, testKey(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := e.seal("receipts", "a.jpg", []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	tests := []struct {
+		name   string
+		bucket string
+		key    string
+		data   []byte
+	}{
+		{"truncated", "receipts", "a.jpg", sealed[:encryptedOverhead-1]},
+		{"tampered", "receipts", "a.jpg", tampered},
+		{"moved", "receipts", "b.jpg", sealed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := e.open(tt.bucket, tt.key, tt.data); err == nil {
+				t.Error("open succeeded")
+			}
+		})
+	}
+}
+
+func TestNewEncryptedKeySize(t *testing.T) {
+	if _, err := NewEncrypted(nil, make([]byte, 16)); err == nil {
+		t.Error("accepted a 16 byte key")
+	}
+	if _, err := NewEncrypted(nil, testKey(1), make([]byte, 31)); err == nil {
+		t.Error("accepted a 31 byte previous key")
+	}
+}
@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilesPath is where the API serves presigned filesystem objects.
+const FilesPath = "/api/v1/files"
+
+const tempPrefix = ".tmp-"
+
+// Filesystem stores objects as files under dir/<bucket>/<key>, for local
+// development and single host installs. Content types are derived from the
+// key's extension. There is no object server, so presigned URLs point at the
+// API's files route and carry an HMAC of the object and expiry instead.
+type Filesystem struct {
+	dir     string
+	baseURL string
+	secret  []byte
+}
+
+func NewFilesystem(dir, baseURL string, secret []byte) (*Filesystem, error) {
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &Filesystem{dir: dir, baseURL: strings.TrimSuffix(baseURL, "/"), secret: secret}, nil
+}
+
+func checkBucket(bucket string) error {
+	if bucket == "" || bucket == "." || bucket == ".." || strings.ContainsAny(bucket, `/\`) {
+		return fmt.Errorf("invalid bucket %q", bucket)
+	}
+	return nil
+}
+
+// objectPath resolves an object to its file, refusing names that would
+// escape the bucket directory.
+func (f *Filesystem) objectPath(bucket, key string) (string, error) {
+	if err := checkBucket(bucket); err != nil {
+		return "", err
+	}
+	if key == "" || path.Clean("/"+key) != "/"+key || strings.Contains(key, `\`) {
+		return "", fmt.Errorf("invalid key %q", key)
+	}
+	return filepath.Join(f.dir, bucket, filepath.FromSlash(key)), nil
+}
+
+func contentType(key string) string {
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+func fileInfo(key string, info fs.FileInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ContentType:  contentType(key),
+		LastModified: info.ModTime(),
+	}
+}
+
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// Put writes to a temporary file first so readers never see a partial object.
+func (f *Filesystem) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	name, err := f.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), os.ModePerm); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(name), tempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
+
+func (f *Filesystem) Get(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error) {
+	name, err := f.objectPath(bucket, key)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, ObjectInfo{}, notFound(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, ObjectInfo{}, err
+	}
+	return file, fileInfo(key, info), nil
+}
+
+func (f *Filesystem) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	name, err := f.objectPath(bucket, key)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return ObjectInfo{}, notFound(err)
+	}
+	return fileInfo(key, info), nil
+}
+
+func (f *Filesystem) Delete(ctx context.Context, bucket, key string) error {
+	name, err := f.objectPath(bucket, key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (f *Filesystem) sign(bucket, key string, expires int64) string {
+	mac := hmac.New(sha256.New, f.secret)
+	fmt.Fprintf(mac, "storage\n%s\n%s\n%d", bucket, key, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (f *Filesystem) Presign(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	if _, err := f.objectPath(bucket, key); err != nil {
+		return "", err
+	}
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {f.sign(bucket, key, expires)},
+	}
+	return fmt.Sprintf("%s/%s/%s?%s", f.baseURL, url.PathEscape(bucket), strings.Join(segments, "/"), query.Encode()), nil
+}
+
+// Verify checks the expiry and signature of a URL built by Presign.
+func (f *Filesystem) Verify(bucket, key, expires, signature string) bool {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > exp {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(f.sign(bucket, key, exp)))
+}
+
+func (f *Filesystem) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	if err := checkBucket(bucket); err != nil {
+		return nil, err
+	}
+	root := filepath.Join(f.dir, bucket)
+
+	var objects []ObjectInfo
+	err := filepath.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return notFound(err)
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), tempPrefix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, fileInfo(key, info))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objects, nil
+}
+
+func (f *Filesystem) EnsureBucket(ctx context.Context, bucket string) error {
+	if err := checkBucket(bucket); err != nil {
+		return err
+	}
+	return os.MkdirAll(filepath.Join(f.dir, bucket), os.ModePerm)
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 stores objects in MinIO or any other S3 compatible service.
+type S3 struct {
+	client *minio.Client
+	region string
+}
+
+type S3Options struct {
+	Endpoint  string
+	AccessKey string
+	SecretKey string
+	Region    string
+	UseSSL    bool
+	// PathStyle addresses buckets as endpoint/bucket rather than
+	// bucket.endpoint, which MinIO and most self-hosted services need.
+	PathStyle bool
+}
+
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Endpoint == "" {
+		return nil, errors.New("storage endpoint is not set")
+	}
+
+	lookup := minio.BucketLookupAuto
+	if opts.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure:       opts.UseSSL,
+		Region:       opts.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{client: client, region: opts.Region}, nil
+}
+
+// s3Error maps missing keys and buckets to ErrNotFound.
+func s3Error(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NoSuchBucket":
+		return ErrNotFound
+	}
+	return err
+}
+
+func toObjectInfo(info minio.ObjectInfo) ObjectInfo {
+	return ObjectInfo{
+		Key:          info.Key,
+		Size:         info.Size,
+		ContentType:  info.ContentType,
+		LastModified: info.LastModified,
+	}
+}
+
+func (s *S3) Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error {
+	_, err := s.client.PutObject(ctx, bucket, key, body, size, minio.PutObjectOptions{ContentType: contentType})
+	return s3Error(err)
+}
+
+func (s *S3) Get(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error) {
+	obj, err := s.client.GetObject(ctx, bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, ObjectInfo{}, s3Error(err)
+	}
+
+	// GetObject is lazy, Stat surfaces a missing object before anything is read
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, ObjectInfo{}, s3Error(err)
+	}
+
+	return obj, toObjectInfo(info), nil
+}
+
+func (s *S3) Stat(ctx context.Context, bucket, key string) (ObjectInfo, error) {
+	info, err := s.client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return ObjectInfo{}, s3Error(err)
+	}
+	return toObjectInfo(info), nil
+}
+
+func (s *S3) Delete(ctx context.Context, bucket, key string) error {
+	return s3Error(s.client.RemoveObject(ctx, bucket, key, minio.RemoveObjectOptions{}))
+}
+
+func (s *S3) Presign(ctx context.Context, bucket, key string, ttl time.Duration) (string, error) {
+	url, err := s.client.PresignedGetObject(ctx, bucket, key, ttl, nil)
+	if err != nil {
+		return "", err
+	}
+	return url.String(), nil
+}
+
+func (s *S3) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	for object := range s.client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, s3Error(object.Err)
+		}
+		objects = append(objects, toObjectInfo(object))
+	}
+	return objects, nil
+}
+
+func (s *S3) EnsureBucket(ctx context.Context, bucket string) error {
+	exists, err := s.client.BucketExists(ctx, bucket)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	err = s.client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{Region: s.region})
+	if err != nil {
+		// another instance may have created it in the meantime
+		if code := minio.ToErrorResponse(err).Code; code == "BucketAlreadyOwnedByYou" || code == "BucketAlreadyExists" {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
@@ -3,147 +3,98 @@ package storage
 import (
 	"bytes"
 	"context"
-	"log"
-	"os"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"time"
 
-	"github.com/minio/minio-go/v7"
 	"github.com/sharithg/civet/internal/config"
 )
 
-type Storage struct {
-	Client *minio.Client
-}
+// ErrNotFound is returned when an object or its bucket does not exist.
+var ErrNotFound = errors.New("object not found")
 
-func NewStorage(config *config.Config) *Storage {
-	client := NewMinio(config)
-	return &Storage{Client: client}
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	LastModified time.Time
 }
 
-func (s *Storage) Upload(ctx context.Context, bucketName string, objectName string, filePath string, contentType string) (*minio.UploadInfo, error) {
-	info, err := s.Client.FPutObject(ctx, bucketName, objectName, filePath, minio.PutObjectOptions{ContentType: contentType})
-	if err != nil {
-		return nil, err
-	}
-
-	return &info, nil
+// Storage holds objects grouped into buckets.
+type Storage interface {
+	Put(ctx context.Context, bucket, key string, body io.Reader, size int64, contentType string) error
+	// Get opens an object for streaming. The caller must close the reader.
+	Get(ctx context.Context, bucket, key string) (io.ReadCloser, ObjectInfo, error)
+	Stat(ctx context.Context, bucket, key string) (ObjectInfo, error)
+	// Delete removes an object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, bucket, key string) error
+	// Presign returns a URL that fetches the object without credentials until ttl passes.
+	Presign(ctx context.Context, bucket, key string, ttl time.Duration) (string, error)
+	List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+	// EnsureBucket creates the bucket if it does not exist yet.
+	EnsureBucket(ctx context.Context, bucket string) error
 }
 
-func (s *Storage) UploadImageBytes(ctx context.Context, bucketName, objectName string, imageBytes []byte, contentType string) (*minio.UploadInfo, error) {
-	exists, err := s.Client.BucketExists(ctx, bucketName)
-	if err != nil {
-		return nil, err
-	}
-	if !exists {
-		err := s.Client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: "us-east-1"})
+// Open builds the storage configured by STORAGE_BACKEND and creates the
+// buckets the app writes to.
+func Open(ctx context.Context, config *config.Config) (Storage, error) {
+	var storage Storage
+	switch config.StorageBackend {
+	case "s3", "minio", "":
+		s3, err := NewS3(S3Options{
+			Endpoint:  config.MinioHost,
+			AccessKey: config.MinioAccessKey,
+			SecretKey: config.MinioSecretKey,
+			Region:    config.StorageRegion,
+			UseSSL:    config.StorageUseSSL,
+			PathStyle: config.StoragePathStyle,
+		})
 		if err != nil {
 			return nil, err
 		}
-	}
-
-	reader := bytes.NewReader(imageBytes)
-	size := int64(len(imageBytes))
-
-	info, err := s.Client.PutObject(ctx, bucketName, objectName, reader, size, minio.PutObjectOptions{
-		ContentType: contentType,
-	})
-	if err != nil {
-		return nil, err
-	}
-
-	return &info, nil
-}
-
-func (s *Storage) GetObjectBytes(ctx context.Context, bucketName string, objectName string, filePath string, contentType string) ([]byte, error) {
-	tempFile, err := os.CreateTemp("", "key-*.pem")
-	if err != nil {
-		return nil, err
-	}
-	defer tempFile.Close()
-
-	err = s.Client.FGetObject(ctx, bucketName, objectName, filePath, minio.GetObjectOptions{})
-	if err != nil {
-		return nil, err
-	}
-
-	data, err := os.ReadFile(tempFile.Name())
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return data, nil
-}
-
-func (s *Storage) DeleteObject(ctx context.Context, bucketName string, objectName string) error {
-	err := s.Client.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
-	if err != nil {
-		return err
-	}
-
-	return nil
-}
-
-func (s *Storage) ListObjects(ctx context.Context, bucketName string) ([]string, error) {
-	var objs []string
-	opts := minio.ListObjectsOptions{}
-
-	objectCh := s.Client.ListObjects(ctx, bucketName, opts)
-
-	for object := range objectCh {
-		if object.Err != nil {
-			return nil, object.Err
+		storage = s3
+	case "filesystem":
+		fs, err := NewFilesystem(config.StorageDir, config.ServerURL+FilesPath, []byte(config.JWTSecret))
+		if err != nil {
+			return nil, err
 		}
-
-		objs = append(objs, object.Key)
-	}
-
-	return objs, nil
-}
-
-func (s *Storage) CreateBucket(ctx context.Context, bucketName string) error {
-
-	err := s.Client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{Region: "us-east-1"})
-	if err != nil {
-		return err
-	}
-
-	log.Printf("Successfully created %s\n", bucketName)
-	return nil
-}
-
-func (s *Storage) SetupBucket(ctx context.Context, bucketName string) error {
-	exists, err := s.Client.BucketExists(ctx, bucketName)
-
-	if err != nil {
-		return err
+		storage = fs
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.StorageBackend)
 	}
 
-	if !exists {
-		if err := s.CreateBucket(ctx, bucketName); err != nil {
-			return err
+	if config.StorageEncryptionKey != "" {
+		key, err := base64.StdEncoding.DecodeString(config.StorageEncryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("decoding storage encryption key: %w", err)
+		}
+		var oldKeys [][]byte
+		for _, encoded := range strings.Split(config.StorageEncryptionOldKeys, ",") {
+			if encoded = strings.TrimSpace(encoded); encoded == "" {
+				continue
+			}
+			oldKey, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return nil, fmt.Errorf("decoding previous storage encryption key: %w", err)
+			}
+			oldKeys = append(oldKeys, oldKey)
+		}
+		if storage, err = NewEncrypted(storage, key, oldKeys...); err != nil {
+			return nil, err
 		}
 	}
 
-	return nil
-}
-
-func (s *Storage) SetupBuckets() error {
-	ctx := context.Background()
-
-	if err := s.SetupBucket(ctx, "node-pem-files"); err != nil {
-		return err
-	}
-
-	if err := s.SetupBucket(ctx, "avatars"); err != nil {
-		return err
+	if err := storage.EnsureBucket(ctx, config.ReceiptsBucket); err != nil {
+		return nil, fmt.Errorf("setting up bucket %s: %w", config.ReceiptsBucket, err)
 	}
 
-	return nil
+	return storage, nil
 }
-func (s *Storage) GetObjectUrl(ctx context.Context, bucketName string, objectName string) (string, error) {
-	url, err := s.Client.PresignedGetObject(ctx, bucketName, objectName, time.Hour*24, nil)
-	if err != nil {
-		return "", err
-	}
-	return url.String(), nil
+
+// PutBytes stores an in-memory object.
+func PutBytes(ctx context.Context, s Storage, bucket, key string, data []byte, contentType string) error {
+	return s.Put(ctx, bucket, key, bytes.NewReader(data), int64(len(data)), contentType)
 }
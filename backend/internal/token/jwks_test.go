@@ -0,0 +1,104 @@
+package token
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// publicKey rebuilds a verifier's view of a JWK.
+func publicKey(t *testing.T, jwk JWK) any {
+	t.Helper()
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil {
+			t.Fatalf("decoding %q: %v", s, err)
+		}
+		return b
+	}
+	switch jwk.Kty {
+	case "RSA":
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(decode(jwk.N)),
+			E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64()),
+		}
+	case "OKP":
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+	t.Fatalf("unexpected kty %q", jwk.Kty)
+	return nil
+}
+
+func TestJWKSVerifiesIssuedTokens(t *testing.T) {
+	tests := []struct {
+		alg, kty, crv string
+	}{
+		{"EdDSA", "OKP", "Ed25519"},
+		{"RS256", "RSA", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			s := rotatedService(t, &keyTable{}, testOptions(tt.alg))
+			set := s.JWKS()
+			if len(set.Keys) != 1 {
+				t.Fatalf("JWKS has %d keys, want 1", len(set.Keys))
+			}
+			jwk := set.Keys[0]
+			if jwk.Kty != tt.kty || jwk.Crv != tt.crv || jwk.Alg != tt.alg || jwk.Use != "sig" {
+				t.Errorf("jwk = %+v", jwk)
+			}
+
+			signed, err := s.Issue(Claims{Sub: "user"}, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tok, err := jwt.ParseWithClaims(signed, &Claims{}, func(tok *jwt.Token) (any, error) {
+				if tok.Header["kid"] != jwk.Kid {
+					t.Errorf("token kid %v, want %s", tok.Header["kid"], jwk.Kid)
+				}
+				return publicKey(t, jwk), nil
+			}, jwt.WithValidMethods([]string{jwk.Alg}))
+			if err != nil || !tok.Valid {
+				t.Errorf("token did not verify against the JWKS: %v", err)
+			}
+		})
+	}
+}
+
+func TestJWKSPublishesScheduledAndRetiringKeys(t *testing.T) {
+	ctx := context.Background()
+	table := &keyTable{}
+	s := newTestService(table, testOptions("EdDSA"))
+	// one key still verifying, one signing and one scheduled
+	for _, at := range []time.Duration{-25*time.Hour - 30*time.Minute, -23*time.Hour - 30*time.Minute, 30 * time.Minute} {
+		if err := s.createKey(ctx, time.Now().Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	set := s.JWKS()
+	if len(set.Keys) != 3 {
+		t.Fatalf("JWKS has %d keys, want 3", len(set.Keys))
+	}
+	for i, jwk := range set.Keys {
+		if jwk.Kid != table.rows[i].Kid {
+			t.Errorf("key %d is %s, want %s", i, jwk.Kid, table.rows[i].Kid)
+		}
+	}
+	signer, err := s.signingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.id != table.rows[1].Kid {
+		t.Errorf("signing with %s, want the active key %s", signer.id, table.rows[1].Kid)
+	}
+}
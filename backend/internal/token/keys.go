@@ -0,0 +1,262 @@
+package token
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+const (
+	// publishLead is how long a new key sits in the JWKS before it signs
+	// anything, so verifiers caching the key set pick it up first.
+	publishLead = time.Hour
+
+	// reloadInterval limits how often an unknown kid triggers a key reload.
+	reloadInterval = time.Minute
+
+	rsaKeyBits = 2048
+)
+
+type key struct {
+	id          string
+	method      jwt.SigningMethod
+	private     crypto.Signer
+	public      crypto.PublicKey
+	activatesAt time.Time
+	retiresAt   time.Time
+}
+
+// canSign reports whether tokens signed now will expire before the key retires.
+func (k *key) canSign(now time.Time, maxTTL time.Duration) bool {
+	return !k.activatesAt.After(now) && k.retiresAt.After(now.Add(maxTTL))
+}
+
+func methodFor(alg string) (jwt.SigningMethod, error) {
+	switch alg {
+	case jwt.SigningMethodRS256.Alg():
+		return jwt.SigningMethodRS256, nil
+	case jwt.SigningMethodEdDSA.Alg():
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("unsupported jwt algorithm %q", alg)
+}
+
+// keyID derives a kid from the public key, so the same key always has the same id.
+func keyID(publicDER []byte) string {
+	sum := sha256.Sum256(publicDER)
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+// sealer encrypts private keys at rest with a key derived from JWT_SECRET.
+func (s *Service) sealer() (cipher.AEAD, error) {
+	sum := sha256.Sum256(append([]byte("civet signing keys\x00"), s.opts.Secret...))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (s *Service) seal(kid string, privateDER []byte) ([]byte, error) {
+	aead, err := s.sealer()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, privateDER, []byte(kid)), nil
+}
+
+func (s *Service) open(kid string, sealed []byte) ([]byte, error) {
+	aead, err := s.sealer()
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("sealed key too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(kid))
+}
+
+func (s *Service) parseKey(row repository.SigningKey) (*key, error) {
+	method, err := methodFor(row.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	privateDER, err := s.open(row.Kid, row.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("opening key %s: %w", row.Kid, err)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(privateDER)
+	if err != nil {
+		return nil, fmt.Errorf("parsing key %s: %w", row.Kid, err)
+	}
+	signer, ok := private.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("key %s cannot sign", row.Kid)
+	}
+
+	return &key{
+		id:          row.Kid,
+		method:      method,
+		private:     signer,
+		public:      signer.Public(),
+		activatesAt: row.ActivatesAt.Time,
+		retiresAt:   row.RetiresAt.Time,
+	}, nil
+}
+
+// createKey generates a key for the configured algorithm and stores it.
+func (s *Service) createKey(ctx context.Context, activatesAt time.Time) error {
+	var private crypto.Signer
+	var err error
+	switch s.opts.Algorithm {
+	case jwt.SigningMethodRS256.Alg():
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	default:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(private.Public())
+	if err != nil {
+		return err
+	}
+
+	kid := keyID(publicDER)
+	sealed, err := s.seal(kid, privateDER)
+	if err != nil {
+		return err
+	}
+
+	// a key signs until its successor activates one rotation later, and its
+	// last tokens must still verify until they expire
+	retiresAt := activatesAt.Add(s.opts.Rotation + s.opts.MaxTokenTTL)
+
+	return s.repo.InsertSigningKey(ctx, repository.InsertSigningKeyParams{
+		Kid:         kid,
+		Algorithm:   s.opts.Algorithm,
+		PrivateKey:  sealed,
+		PublicKey:   publicDER,
+		ActivatesAt: pgtype.Timestamptz{Time: activatesAt, Valid: true},
+		RetiresAt:   pgtype.Timestamptz{Time: retiresAt, Valid: true},
+	})
+}
+
+func (s *Service) reload(ctx context.Context) error {
+	rows, err := s.repo.ListSigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("listing signing keys: %w", err)
+	}
+
+	keys := make([]*key, 0, len(rows))
+	byID := make(map[string]*key, len(rows))
+	for _, row := range rows {
+		k, err := s.parseKey(row)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+		byID[k.id] = k
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.byID = byID
+	s.lastReload = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Service) reloadAllowed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return time.Since(s.lastReload) > reloadInterval
+}
+
+func (s *Service) lookup(kid string) *key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.byID[kid]
+}
+
+// signingKey is the most recently activated key that will outlive the tokens
+// it signs.
+func (s *Service) signingKey() (*key, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		if s.keys[i].canSign(now, s.opts.MaxTokenTTL) {
+			return s.keys[i], nil
+		}
+	}
+	return nil, errors.New("no active signing key")
+}
+
+// Rotate brings the key set up to date: it creates an immediately active key
+// when none can sign (first start, a lapsed rotation or a changed algorithm),
+// schedules the next key ahead of time when the current one is due to be
+// replaced, and drops retired keys.
+func (s *Service) Rotate(ctx context.Context) error {
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	current, err := s.signingKey()
+	if err != nil || current.method.Alg() != s.opts.Algorithm {
+		if err := s.createKey(ctx, now); err != nil {
+			return fmt.Errorf("creating signing key: %w", err)
+		}
+	} else {
+		s.mu.RLock()
+		newest := s.keys[len(s.keys)-1]
+		s.mu.RUnlock()
+
+		// newest only activates in the future when the next key is already scheduled
+		next := newest.activatesAt.Add(s.opts.Rotation)
+		if !newest.activatesAt.After(now) && !next.After(now.Add(publishLead)) {
+			if err := s.createKey(ctx, maxTime(next, now.Add(publishLead))); err != nil {
+				return fmt.Errorf("creating signing key: %w", err)
+			}
+		}
+	}
+
+	if _, err := s.repo.DeleteRetiredSigningKeys(ctx); err != nil {
+		return fmt.Errorf("deleting retired signing keys: %w", err)
+	}
+	return s.reload(ctx)
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,308 @@
+package token
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// keyTable stands in for the signing_keys table, answering the three queries
+// the service runs against it.
+type keyTable struct {
+	mu   sync.Mutex
+	rows []repository.SigningKey
+}
+
+func (k *keyTable) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	switch {
+	case strings.Contains(sql, "insert into signing_keys"):
+		k.rows = append(k.rows, repository.SigningKey{
+			Kid:         args[0].(string),
+			Algorithm:   args[1].(string),
+			PrivateKey:  args[2].([]byte),
+			PublicKey:   args[3].([]byte),
+			CreatedAt:   pgtype.Timestamptz{Time: time.Now(), Valid: true},
+			ActivatesAt: args[4].(pgtype.Timestamptz),
+			RetiresAt:   args[5].(pgtype.Timestamptz),
+		})
+		return pgconn.NewCommandTag("INSERT 0 1"), nil
+	case strings.Contains(sql, "delete from signing_keys"):
+		now := time.Now()
+		n := len(k.rows)
+		k.rows = slices.DeleteFunc(k.rows, func(r repository.SigningKey) bool {
+			return !r.RetiresAt.Time.After(now)
+		})
+		return pgconn.NewCommandTag(fmt.Sprintf("DELETE %d", n-len(k.rows))), nil
+	}
+	return pgconn.CommandTag{}, fmt.Errorf("unexpected exec: %s", sql)
+}
+
+func (k *keyTable) Query(_ context.Context, sql string, _ ...interface{}) (pgx.Rows, error) {
+	if !strings.Contains(sql, "from signing_keys") {
+		return nil, fmt.Errorf("unexpected query: %s", sql)
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	var live []repository.SigningKey
+	for _, r := range k.rows {
+		if r.RetiresAt.Time.After(now) {
+			live = append(live, r)
+		}
+	}
+	slices.SortStableFunc(live, func(a, b repository.SigningKey) int {
+		return a.ActivatesAt.Time.Compare(b.ActivatesAt.Time)
+	})
+	return &keyRows{rows: live, at: -1}, nil
+}
+
+func (k *keyTable) QueryRow(context.Context, string, ...interface{}) pgx.Row {
+	panic("unexpected QueryRow")
+}
+
+func (k *keyTable) len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.rows)
+}
+
+type keyRows struct {
+	pgx.Rows
+	rows []repository.SigningKey
+	at   int
+}
+
+func (r *keyRows) Next() bool {
+	r.at++
+	return r.at < len(r.rows)
+}
+
+func (r *keyRows) Scan(dest ...any) error {
+	row := r.rows[r.at]
+	values := []any{row.Kid, row.Algorithm, row.PrivateKey, row.PublicKey, row.CreatedAt, row.ActivatesAt, row.RetiresAt}
+	for i, d := range dest {
+		reflect.ValueOf(d).Elem().Set(reflect.ValueOf(values[i]))
+	}
+	return nil
+}
+
+func (r *keyRows) Close()     {}
+func (r *keyRows) Err() error { return nil }
+
+func testOptions(alg string) Options {
+	return Options{
+		Algorithm:   alg,
+		Issuer:      "civet",
+		Audience:    "civet-api",
+		Rotation:    24 * time.Hour,
+		MaxTokenTTL: 2 * time.Hour,
+		Secret:      []byte("secret"),
+	}
+}
+
+func newTestService(table *keyTable, opts Options) *Service {
+	return &Service{repo: repository.New(table), opts: opts}
+}
+
+func TestNewServiceOptions(t *testing.T) {
+	ctx := context.Background()
+	if _, err := NewService(ctx, repository.New(&keyTable{}), testOptions("HS256")); err == nil {
+		t.Error("accepted HS256 for new keys")
+	}
+	opts := testOptions("EdDSA")
+	opts.Rotation = publishLead
+	if _, err := NewService(ctx, repository.New(&keyTable{}), opts); err == nil {
+		t.Error("accepted a rotation shorter than twice the publish lead")
+	}
+
+	table := &keyTable{}
+	s, err := NewService(ctx, repository.New(table), testOptions("EdDSA"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if table.len() != 1 {
+		t.Errorf("first start created %d keys, want 1", table.len())
+	}
+	if _, err := s.signingKey(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	rotation := testOptions("EdDSA").Rotation
+
+	tests := []struct {
+		name string
+		// existing keys, by how long ago they activated
+		activated []time.Duration
+		wantKeys  int
+		// whether the oldest key is still the one signing afterwards
+		wantSameSigner bool
+	}{
+		{"current key is not due", []time.Duration{time.Hour}, 1, true},
+		{"next key is scheduled ahead", []time.Duration{rotation - 30*time.Minute}, 2, true},
+		{"lapsed key is replaced now", []time.Duration{rotation + 90*time.Minute}, 2, false},
+		{"retired key is dropped", []time.Duration{rotation + 30*time.Hour}, 1, false},
+		{"scheduled key is not scheduled twice", []time.Duration{rotation - 30*time.Minute, -30 * time.Minute}, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := &keyTable{}
+			s := newTestService(table, testOptions("EdDSA"))
+			for _, ago := range tt.activated {
+				if err := s.createKey(ctx, time.Now().Add(-ago)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			oldest := table.rows[0].Kid
+
+			if err := s.Rotate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if table.len() != tt.wantKeys {
+				t.Errorf("%d keys after Rotate, want %d", table.len(), tt.wantKeys)
+			}
+			signer, err := s.signingKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (signer.id == oldest) != tt.wantSameSigner {
+				t.Errorf("signing with the oldest key = %v, want %v", signer.id == oldest, tt.wantSameSigner)
+			}
+			if len(s.JWKS().Keys) != tt.wantKeys {
+				t.Errorf("JWKS has %d keys, want %d", len(s.JWKS().Keys), tt.wantKeys)
+			}
+
+			// a second pass has nothing left to do
+			if err := s.Rotate(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if table.len() != tt.wantKeys {
+				t.Errorf("%d keys after a second Rotate, want %d", table.len(), tt.wantKeys)
+			}
+		})
+	}
+}
+
+func TestRotateScheduledKeyActivatesAfterLead(t *testing.T) {
+	ctx := context.Background()
+	table := &keyTable{}
+	s := newTestService(table, testOptions("EdDSA"))
+	if err := s.createKey(ctx, time.Now().Add(-23*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	next := table.rows[1]
+	if lead := time.Until(next.ActivatesAt.Time); lead < publishLead-time.Minute || lead > publishLead {
+		t.Errorf("next key activates in %s, want %s", lead, publishLead)
+	}
+	if got := next.RetiresAt.Time.Sub(next.ActivatesAt.Time); got != 26*time.Hour {
+		t.Errorf("next key lives %s, want rotation plus max token ttl", got)
+	}
+}
+
+func TestRotateAlgorithmChange(t *testing.T) {
+	ctx := context.Background()
+	table := &keyTable{}
+	rs := newTestService(table, testOptions("RS256"))
+	if err := rs.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	old, err := rs.Issue(Claims{Sub: "user"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed := newTestService(table, testOptions("EdDSA"))
+	if err := ed.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ed.signingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer.method != jwt.SigningMethodEdDSA {
+		t.Errorf("signing with %s after switching to EdDSA", signer.method.Alg())
+	}
+	if _, err := ed.Verify(old, TypeAccess); err != nil {
+		t.Errorf("token from the RS256 key no longer verifies: %v", err)
+	}
+}
+
+func TestCanSign(t *testing.T) {
+	now := time.Now()
+	ttl := time.Hour
+
+	tests := []struct {
+		name                   string
+		activatesAt, retiresAt time.Time
+		want                   bool
+	}{
+		{"active", now.Add(-time.Hour), now.Add(3 * time.Hour), true},
+		{"activates now", now, now.Add(3 * time.Hour), true},
+		{"scheduled", now.Add(time.Minute), now.Add(3 * time.Hour), false},
+		{"tokens would outlive it", now.Add(-time.Hour), now.Add(30 * time.Minute), false},
+		{"retired", now.Add(-3 * time.Hour), now.Add(-time.Hour), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := &key{activatesAt: tt.activatesAt, retiresAt: tt.retiresAt}
+			if got := k.canSign(now, ttl); got != tt.want {
+				t.Errorf("canSign = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSealedKeys(t *testing.T) {
+	s := newTestService(&keyTable{}, testOptions("EdDSA"))
+	sealed, err := s.seal("kid", []byte("private key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.open("kid", sealed); err != nil || !bytes.Equal(got, []byte("private key")) {
+		t.Fatalf("open = %q, %v", got, err)
+	}
+
+	other := newTestService(&keyTable{}, testOptions("EdDSA"))
+	other.opts.Secret = []byte("other secret")
+
+	tests := []struct {
+		name   string
+		s      *Service
+		kid    string
+		sealed []byte
+	}{
+		{"other kid", s, "other", sealed},
+		{"other secret", other, "kid", sealed},
+		{"truncated", s, "kid", sealed[:4]},
+		{"empty", s, "kid", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.s.open(tt.kid, tt.sealed); err == nil {
+				t.Error("open succeeded")
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// Token types, carried in the "type" claim. Access tokens issued before the
+// claim was set have none.
+const (
+	TypeAccess  = "access"
+	TypeRefresh = "refresh"
+	// TypeGuest tokens act as one friend of one outing, see GuestAuth.
+	TypeGuest = "guest"
+)
+
+// ErrInvalidToken is returned for tokens that are malformed, expired, signed
+// by an unknown key or of the wrong type.
+var ErrInvalidToken = errors.New("invalid token")
+
+type Claims struct {
+	jwt.RegisteredClaims
+	Sub     string `json:"sub"`
+	Name    string `json:"name,omitempty"`
+	Email   string `json:"email,omitempty"`
+	Picture string `json:"picture,omitempty"`
+	Type    string `json:"type,omitempty"`
+	// SessionID ties a token to the sessions row of the device it was issued to.
+	SessionID string `json:"sid,omitempty"`
+	// OutingID and FriendID scope a guest token.
+	OutingID string `json:"oid,omitempty"`
+	FriendID string `json:"fid,omitempty"`
+}
+
+type Options struct {
+	// Algorithm new keys are generated for, RS256 or EdDSA.
+	Algorithm string
+	Issuer    string
+	Audience  string
+	// Rotation is how long each key signs before the next one takes over.
+	Rotation time.Duration
+	// MaxTokenTTL is the longest lifetime of any issued token. Keys stay in
+	// the JWKS this long after they stop signing.
+	MaxTokenTTL time.Duration
+	// Secret seals private keys at rest and, with AcceptLegacy, verifies
+	// HS256 tokens issued before signing keys existed. Those are held to the
+	// same issuer and audience as every other token.
+	Secret       []byte
+	AcceptLegacy bool
+}
+
+// Service issues and verifies Civet's JWTs. Tokens are signed with
+// asymmetric keys kept in the signing_keys table and identified by kid, so
+// other services can verify them against the published JWKS without sharing
+// a secret. Every instance loads the same keys; whichever instance notices a
+// rotation is due creates the next key.
+type Service struct {
+	repo *repository.Queries
+	opts Options
+
+	mu         sync.RWMutex
+	keys       []*key // ordered by activation
+	byID       map[string]*key
+	lastReload time.Time
+}
+
+func NewService(ctx context.Context, repo *repository.Queries, opts Options) (*Service, error) {
+	switch opts.Algorithm {
+	case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg():
+	default:
+		return nil, fmt.Errorf("unsupported jwt algorithm %q", opts.Algorithm)
+	}
+	if opts.Rotation < 2*publishLead {
+		return nil, fmt.Errorf("key rotation must be at least %s", 2*publishLead)
+	}
+
+	s := &Service{repo: repo, opts: opts}
+	if err := s.Rotate(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Open builds the token service from the JWT_ settings.
+func Open(ctx context.Context, config *config.Config, repo *repository.Queries) (*Service, error) {
+	refresh := time.Duration(config.RefreshExpiration) * time.Second
+	access := time.Duration(config.JWTExpirationSeconds) * time.Second
+
+	return NewService(ctx, repo, Options{
+		Algorithm:    config.JWTAlgorithm,
+		Issuer:       config.JWTIssuer,
+		Audience:     config.JWTAudience,
+		Rotation:     time.Duration(config.JWTKeyRotationDays) * 24 * time.Hour,
+		MaxTokenTTL:  max(refresh, access),
+		Secret:       []byte(config.JWTSecret),
+		AcceptLegacy: config.JWTAcceptLegacy,
+	})
+}
+
+// Issue signs claims with the current key. Issuer, audience and the issued
+// and expiry times are filled in.
+func (s *Service) Issue(claims Claims, ttl time.Duration) (string, error) {
+	k, err := s.signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims.Issuer = s.opts.Issuer
+	claims.Audience = jwt.ClaimStrings{s.opts.Audience}
+	claims.IssuedAt = jwt.NewNumericDate(now)
+	claims.ExpiresAt = jwt.NewNumericDate(now.Add(ttl))
+	if claims.Type == "" {
+		claims.Type = TypeAccess
+	}
+
+	t := jwt.NewWithClaims(k.method, claims)
+	t.Header["kid"] = k.id
+	return t.SignedString(k.private)
+}
+
+// Verify checks a token's signature, expiry, issuer, audience and type.
+func (s *Service) Verify(tokenStr, tokenType string) (*Claims, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(tokenStr, &Claims{})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var t *jwt.Token
+	if unverified.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+		if !s.opts.AcceptLegacy {
+			return nil, fmt.Errorf("%w: HS256 tokens are no longer accepted", ErrInvalidToken)
+		}
+		t, err = jwt.ParseWithClaims(tokenStr, &Claims{}, func(*jwt.Token) (any, error) {
+			return s.opts.Secret, nil
+		},
+			jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+			jwt.WithIssuer(s.opts.Issuer),
+			jwt.WithAudience(s.opts.Audience),
+			jwt.WithExpirationRequired(),
+		)
+	} else {
+		t, err = jwt.ParseWithClaims(tokenStr, &Claims{}, s.verificationKey,
+			jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+			jwt.WithIssuer(s.opts.Issuer),
+			jwt.WithAudience(s.opts.Audience),
+			jwt.WithExpirationRequired(),
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims, ok := t.Claims.(*Claims)
+	if !ok || !t.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	actual := claims.Type
+	if actual == "" {
+		actual = TypeAccess
+	}
+	if actual != tokenType {
+		return nil, fmt.Errorf("%w: expected a %s token", ErrInvalidToken, tokenType)
+	}
+	return claims, nil
+}
+
+func (s *Service) verificationKey(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid")
+	}
+
+	k := s.lookup(kid)
+	if k == nil && s.reloadAllowed() {
+		// another instance may have rotated in a key this one hasn't loaded yet
+		if err := s.reload(context.Background()); err != nil {
+			return nil, err
+		}
+		k = s.lookup(kid)
+	}
+	if k == nil {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if k.method.Alg() != t.Method.Alg() {
+		return nil, fmt.Errorf("kid %q is not an %s key", kid, t.Method.Alg())
+	}
+	return k.public, nil
+}
+
+// Start rotates keys and reloads the key set every interval until ctx is done.
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Rotate(ctx); err != nil {
+					log.Printf("[WARN] signing key rotation: %v", err)
+				}
+			}
+		}
+	}()
+}
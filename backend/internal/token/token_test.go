@@ -0,0 +1,211 @@
+package token
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func rotatedService(t *testing.T, table *keyTable, opts Options) *Service {
+	t.Helper()
+	s := newTestService(table, opts)
+	if err := s.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestIssueVerify(t *testing.T) {
+	s := rotatedService(t, &keyTable{}, testOptions("EdDSA"))
+
+	tests := []struct {
+		name      string
+		claims    Claims
+		ttl       time.Duration
+		verifyAs  string
+		wantValid bool
+	}{
+		{"access", Claims{Sub: "user"}, time.Hour, TypeAccess, true},
+		{"refresh", Claims{Sub: "user", Type: TypeRefresh}, time.Hour, TypeRefresh, true},
+		{"guest", Claims{Sub: "user", Type: TypeGuest, OutingID: "o", FriendID: "f"}, time.Hour, TypeGuest, true},
+		{"refresh used as access", Claims{Sub: "user", Type: TypeRefresh}, time.Hour, TypeAccess, false},
+		{"access used as refresh", Claims{Sub: "user"}, time.Hour, TypeRefresh, false},
+		{"expired", Claims{Sub: "user"}, -time.Minute, TypeAccess, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signed, err := s.Issue(tt.claims, tt.ttl)
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims, err := s.Verify(signed, tt.verifyAs)
+			if !tt.wantValid {
+				if !errors.Is(err, ErrInvalidToken) {
+					t.Errorf("Verify err = %v, want ErrInvalidToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if claims.Sub != tt.claims.Sub || claims.OutingID != tt.claims.OutingID || claims.FriendID != tt.claims.FriendID {
+				t.Errorf("claims = %+v, want %+v", claims, tt.claims)
+			}
+			if claims.Issuer != "civet" || len(claims.Audience) != 1 || claims.Audience[0] != "civet-api" {
+				t.Errorf("issuer %q audience %q", claims.Issuer, claims.Audience)
+			}
+		})
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	s := rotatedService(t, &keyTable{}, testOptions("EdDSA"))
+	k, err := s.signingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, stranger, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid := func() Claims {
+		now := time.Now()
+		return Claims{
+			Sub: "user",
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    "civet",
+				Audience:  jwt.ClaimStrings{"civet-api"},
+				ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			},
+		}
+	}
+	sign := func(claims Claims, kid string, private any) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		signed, err := tok.SignedString(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	otherIssuer := valid()
+	otherIssuer.Issuer = "someone-else"
+	otherAudience := valid()
+	otherAudience.Audience = jwt.ClaimStrings{"another-api"}
+	noExpiry := valid()
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"valid control", sign(valid(), k.id, k.private)},
+		{"other issuer", sign(otherIssuer, k.id, k.private)},
+		{"other audience", sign(otherAudience, k.id, k.private)},
+		{"no expiry", sign(noExpiry, k.id, k.private)},
+		{"no kid", sign(valid(), "", k.private)},
+		{"unknown kid", sign(valid(), "unknown", stranger)},
+		{"signed by another key", sign(valid(), k.id, stranger)},
+		{"none algorithm", func() string {
+			signed, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return signed
+		}()},
+		{"garbage", "not.a.token"},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.Verify(tt.token, TypeAccess)
+			if tt.name == "valid control" {
+				if err != nil {
+					t.Fatalf("control token rejected: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyLegacy(t *testing.T) {
+	table := &keyTable{}
+	legacy := func(claims jwt.MapClaims) string {
+		signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	scoped := legacy(jwt.MapClaims{"sub": "user", "iss": "civet", "aud": "civet-api", "exp": exp})
+
+	tests := []struct {
+		name   string
+		accept bool
+		token  string
+		want   bool
+	}{
+		{"rejected by default", false, scoped, false},
+		{"accepted when enabled", true, scoped, true},
+		{"missing issuer and audience", true, legacy(jwt.MapClaims{"sub": "user", "exp": exp}), false},
+		{"other audience", true, legacy(jwt.MapClaims{"sub": "user", "iss": "civet", "aud": "other", "exp": exp}), false},
+		{"no expiry", true, legacy(jwt.MapClaims{"sub": "user", "iss": "civet", "aud": "civet-api"}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOptions("EdDSA")
+			opts.AcceptLegacy = tt.accept
+			s := rotatedService(t, table, opts)
+
+			claims, err := s.Verify(tt.token, TypeAccess)
+			if tt.want {
+				if err != nil || claims.Sub != "user" {
+					t.Errorf("Verify = %+v, %v", claims, err)
+				}
+			} else if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestVerifyReloadsUnknownKid(t *testing.T) {
+	ctx := context.Background()
+	table := &keyTable{}
+	a := rotatedService(t, table, testOptions("EdDSA"))
+	b := rotatedService(t, table, testOptions("EdDSA"))
+
+	// another instance replaces a lapsed key with one b has not loaded
+	table.rows = table.rows[:0]
+	if err := a.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := a.Issue(Claims{Sub: "user"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.Verify(signed, TypeAccess); err == nil {
+		t.Fatal("verified a new kid within the reload interval")
+	}
+	b.mu.Lock()
+	b.lastReload = time.Now().Add(-2 * reloadInterval)
+	b.mu.Unlock()
+	if _, err := b.Verify(signed, TypeAccess); err != nil {
+		t.Errorf("new kid did not verify after a reload: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+var errTruncated = errors.New("cbor: truncated input")
+
+// decodeCBOR reads one CBOR data item from b and returns the bytes after it.
+// It covers what authenticators emit: definite length integers, byte and
+// text strings, arrays, maps, tags and simple values. Integers decode to
+// int64, maps to map[any]any.
+func decodeCBOR(b []byte) (any, []byte, error) {
+	return decodeItem(b, 0)
+}
+
+const maxDepth = 16
+
+func decodeItem(b []byte, depth int) (any, []byte, error) {
+	if depth > maxDepth {
+		return nil, nil, errors.New("cbor: nested too deeply")
+	}
+	if len(b) == 0 {
+		return nil, nil, errTruncated
+	}
+
+	major, info := b[0]>>5, b[0]&0x1f
+	b = b[1:]
+
+	if major == 7 {
+		return decodeSimple(info, b)
+	}
+
+	n, b, err := readArgument(info, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch major {
+	case 0:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return int64(n), b, nil
+	case 1:
+		if n > math.MaxInt64 {
+			return nil, nil, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(n), b, nil
+	case 2, 3:
+		if uint64(len(b)) < n {
+			return nil, nil, errTruncated
+		}
+		if major == 2 {
+			return append([]byte(nil), b[:n]...), b[n:], nil
+		}
+		return string(b[:n]), b[n:], nil
+	case 4:
+		if n > uint64(len(b)) {
+			return nil, nil, errTruncated
+		}
+		items := make([]any, 0, n)
+		for range n {
+			var item any
+			if item, b, err = decodeItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+		return items, b, nil
+	case 5:
+		if n > uint64(len(b)) {
+			return nil, nil, errTruncated
+		}
+		m := make(map[any]any, n)
+		for range n {
+			var k, v any
+			if k, b, err = decodeItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			switch k.(type) {
+			case int64, string:
+			default:
+				return nil, nil, fmt.Errorf("cbor: unsupported map key %T", k)
+			}
+			if v, b, err = decodeItem(b, depth+1); err != nil {
+				return nil, nil, err
+			}
+			m[k] = v
+		}
+		return m, b, nil
+	case 6:
+		// tags carry no meaning for WebAuthn, keep the tagged item
+		return decodeItem(b, depth+1)
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported major type %d", major)
+}
+
+func readArgument(info byte, b []byte) (uint64, []byte, error) {
+	switch {
+	case info < 24:
+		return uint64(info), b, nil
+	case info == 24:
+		if len(b) < 1 {
+			return 0, nil, errTruncated
+		}
+		return uint64(b[0]), b[1:], nil
+	case info == 25:
+		if len(b) < 2 {
+			return 0, nil, errTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(b)), b[2:], nil
+	case info == 26:
+		if len(b) < 4 {
+			return 0, nil, errTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(b)), b[4:], nil
+	case info == 27:
+		if len(b) < 8 {
+			return 0, nil, errTruncated
+		}
+		return binary.BigEndian.Uint64(b), b[8:], nil
+	}
+	return 0, nil, errors.New("cbor: indefinite lengths are not supported")
+}
+
+func decodeSimple(info byte, b []byte) (any, []byte, error) {
+	switch info {
+	case 20:
+		return false, b, nil
+	case 21:
+		return true, b, nil
+	case 22, 23:
+		return nil, b, nil
+	case 25, 26, 27:
+		// floats are skipped over, nothing WebAuthn checks uses them
+		size := map[byte]int{25: 2, 26: 4, 27: 8}[info]
+		if len(b) < size {
+			return nil, nil, errTruncated
+		}
+		return nil, b[size:], nil
+	}
+	return nil, nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+}
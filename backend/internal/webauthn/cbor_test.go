@@ -0,0 +1,201 @@
+package webauthn
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// cborMap keeps map entries in order so encoded test fixtures are stable.
+type cborMap []cborPair
+
+type cborPair struct {
+	k, v any
+}
+
+func cborHead(major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return []byte{major<<5 | byte(n)}
+	case n <= 0xff:
+		return []byte{major<<5 | 24, byte(n)}
+	case n <= 0xffff:
+		return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+	case n <= 0xffffffff:
+		return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+	}
+	return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+}
+
+// encodeCBOR is the inverse of decodeCBOR for the values tests need.
+func encodeCBOR(v any) []byte {
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return cborHead(1, uint64(-1-v))
+		}
+		return cborHead(0, uint64(v))
+	case []byte:
+		return append(cborHead(2, uint64(len(v))), v...)
+	case string:
+		return append(cborHead(3, uint64(len(v))), v...)
+	case []any:
+		b := cborHead(4, uint64(len(v)))
+		for _, item := range v {
+			b = append(b, encodeCBOR(item)...)
+		}
+		return b
+	case cborMap:
+		b := cborHead(5, uint64(len(v)))
+		for _, p := range v {
+			b = append(b, encodeCBOR(p.k)...)
+			b = append(b, encodeCBOR(p.v)...)
+		}
+		return b
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	// examples from RFC 8949 appendix A
+	tests := []struct {
+		in   string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"18 18", int64(24)},
+		{"19 03e8", int64(1000)},
+		{"1a 000f4240", int64(1000000)},
+		{"1b 000000e8d4a51000", int64(1000000000000)},
+		{"1b 7fffffffffffffff", int64(1<<63 - 1)},
+		{"20", int64(-1)},
+		{"38 63", int64(-100)},
+		{"3b 7fffffffffffffff", int64(-1 << 63)},
+		{"40", []byte(nil)},
+		{"44 01020304", []byte{1, 2, 3, 4}},
+		{"60", ""},
+		{"64 49455446", "IETF"},
+		{"80", []any{}},
+		{"83 01 02 03", []any{int64(1), int64(2), int64(3)}},
+		{"82 01 82 02 03", []any{int64(1), []any{int64(2), int64(3)}}},
+		{"a0", map[any]any{}},
+		{"a2 01 02 03 04", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a2 61 61 01 61 62 82 02 03", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f7", nil},
+		{"f9 3c00", nil},
+		{"fb 3ff199999999999a", nil},
+		{"c1 1a 514b67b0", int64(1363896240)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, rest, err := decodeCBOR(mustHex(t, tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("decoded %#v, want %#v", got, tt.want)
+			}
+			if len(rest) != 0 {
+				t.Errorf("%d bytes left over", len(rest))
+			}
+		})
+	}
+}
+
+func TestDecodeCBORRest(t *testing.T) {
+	got, rest, err := decodeCBOR([]byte{0x01, 0x02, 0x03})
+	if err != nil || got != int64(1) || !bytes.Equal(rest, []byte{0x02, 0x03}) {
+		t.Errorf("decodeCBOR = %v, %x, %v", got, rest, err)
+	}
+}
+
+func TestDecodeCBORRoundTrip(t *testing.T) {
+	v := cborMap{
+		{"fmt", "none"},
+		{"attStmt", cborMap{}},
+		{"authData", bytes.Repeat([]byte{0xab}, 300)},
+		{int64(-70000), []any{int64(1 << 40), true, nil}},
+	}
+	got, rest, err := decodeCBOR(encodeCBOR(v))
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("decodeCBOR: %v, %d bytes left", err, len(rest))
+	}
+	want := map[any]any{
+		"fmt":         "none",
+		"attStmt":     map[any]any{},
+		"authData":    bytes.Repeat([]byte{0xab}, 300),
+		int64(-70000): []any{int64(1 << 40), true, nil},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %#v, want %#v", got, want)
+	}
+}
+
+func TestDecodeCBORErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+	}{
+		{"empty", ""},
+		{"truncated argument", "18"},
+		{"truncated uint64", "1b 0000"},
+		{"integer overflow", "1b ffffffffffffffff"},
+		{"negative overflow", "3b 8000000000000000"},
+		{"truncated bytes", "44 010203"},
+		{"truncated text", "64 4945"},
+		{"byte length past input", "5b ffffffffffffffff 00"},
+		{"truncated array", "83 01 02"},
+		{"huge array", "9b ffffffffffffffff"},
+		{"truncated map", "a2 01 02 03"},
+		{"huge map", "ba ffffffff"},
+		{"map missing value", "a1 01"},
+		{"array map key", "a1 80 01"},
+		{"bytes map key", "a1 41 00 01"},
+		{"indefinite bytes", "5f 41 00 ff"},
+		{"indefinite array", "9f 01 ff"},
+		{"indefinite map", "bf 01 02 ff"},
+		{"reserved argument", "1c"},
+		{"tag without item", "c1"},
+		{"unassigned simple value", "e0"},
+		{"break outside indefinite item", "ff"},
+		{"truncated float", "fa 0000"},
+		{"nested too deeply", strings.Repeat("81", maxDepth+1) + "00"},
+		{"tags nested too deeply", strings.Repeat("c1", maxDepth+1) + "00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, _, err := decodeCBOR(mustHex(t, tt.in)); err == nil {
+				t.Errorf("decodeCBOR(%s) = %#v, want an error", tt.in, got)
+			}
+		})
+	}
+
+	if _, _, err := decodeCBOR(mustHex(t, strings.Repeat("81", maxDepth)+"00")); err != nil {
+		t.Errorf("nesting at the limit: %v", err)
+	}
+}
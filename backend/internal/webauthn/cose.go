@@ -0,0 +1,119 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithm identifiers offered to authenticators, in order of preference.
+const (
+	AlgEdDSA int64 = -8
+	AlgES256 int64 = -7
+	AlgRS256 int64 = -257
+)
+
+var SupportedAlgorithms = []int64{AlgEdDSA, AlgES256, AlgRS256}
+
+// COSE key parameters, RFC 9053.
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+	coseN   = -1
+	coseE   = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey reads a COSE_Key as stored for a credential.
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	v, rest, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, errors.New("trailing data after public key")
+	}
+	m, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("public key is not a map")
+	}
+
+	kty, _ := m[int64(coseKty)].(int64)
+	alg, _ := m[int64(coseAlg)].(int64)
+
+	switch alg {
+	case AlgEdDSA:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		if kty != ktyOKP || crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case AlgES256:
+		crv, _ := m[int64(coseCrv)].(int64)
+		x, _ := m[int64(coseX)].([]byte)
+		y, _ := m[int64(coseY)].([]byte)
+		if kty != ktyEC2 || crv != crvP256 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 key")
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("P-256 point is not on the curve")
+		}
+		return &publicKey{alg: alg, key: key}, nil
+
+	case AlgRS256:
+		n, _ := m[int64(coseN)].([]byte)
+		e, _ := m[int64(coseE)].([]byte)
+		if kty != ktyRSA || len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		exp := new(big.Int).SetBytes(e)
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}}, nil
+	}
+	return nil, fmt.Errorf("unsupported algorithm %d", alg)
+}
+
+func (k *publicKey) verify(data, sig []byte) error {
+	switch key := k.key.(type) {
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, data, sig) {
+			return ErrSignature
+		}
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if !ecdsa.VerifyASN1(key, digest[:], sig) {
+			return ErrSignature
+		}
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], sig); err != nil {
+			return ErrSignature
+		}
+	default:
+		return fmt.Errorf("unsupported key type %T", k.key)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+// testSigner is an authenticator's credential key pair.
+type testSigner struct {
+	cose []byte
+	sign func(data []byte) []byte
+}
+
+func newEd25519Signer(t *testing.T) testSigner {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return testSigner{
+		cose: encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgEdDSA}, {-1, crvEd25519}, {-2, []byte(pub)}}),
+		sign: func(data []byte) []byte { return ed25519.Sign(priv, data) },
+	}
+}
+
+func p256Coordinates(key *ecdsa.PublicKey) (x, y []byte) {
+	return key.X.FillBytes(make([]byte, 32)), key.Y.FillBytes(make([]byte, 32))
+}
+
+func newES256Signer(t *testing.T) testSigner {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := p256Coordinates(&priv.PublicKey)
+	return testSigner{
+		cose: encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgES256}, {-1, crvP256}, {-2, x}, {-3, y}}),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := ecdsa.SignASN1(rand.Reader, priv, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+	}
+}
+
+func newRS256Signer(t *testing.T) testSigner {
+	t.Helper()
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := big.NewInt(int64(priv.E)).Bytes()
+	return testSigner{
+		cose: encodeCBOR(cborMap{{1, ktyRSA}, {3, AlgRS256}, {-1, priv.N.Bytes()}, {-2, e}}),
+		sign: func(data []byte) []byte {
+			digest := sha256.Sum256(data)
+			sig, err := rsa.SignPKCS1v15(rand.Reader, priv, crypto.SHA256, digest[:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			return sig
+		},
+	}
+}
+
+func TestPublicKeyVerify(t *testing.T) {
+	tests := []struct {
+		name   string
+		signer testSigner
+		alg    int64
+	}{
+		{"EdDSA", newEd25519Signer(t), AlgEdDSA},
+		{"ES256", newES256Signer(t), AlgES256},
+		{"RS256", newRS256Signer(t), AlgRS256},
+	}
+	data := []byte("authenticator data and client data hash")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := parsePublicKey(tt.signer.cose)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.alg != tt.alg {
+				t.Errorf("alg = %d, want %d", key.alg, tt.alg)
+			}
+
+			sig := tt.signer.sign(data)
+			if err := key.verify(data, sig); err != nil {
+				t.Errorf("valid signature: %v", err)
+			}
+
+			tampered := bytes.Clone(data)
+			tampered[0] ^= 1
+			if err := key.verify(tampered, sig); !errors.Is(err, ErrSignature) {
+				t.Errorf("tampered data: err = %v, want ErrSignature", err)
+			}
+			if err := key.verify(data, sig[:len(sig)-1]); !errors.Is(err, ErrSignature) {
+				t.Errorf("truncated signature: err = %v, want ErrSignature", err)
+			}
+			if err := key.verify(data, nil); !errors.Is(err, ErrSignature) {
+				t.Errorf("empty signature: err = %v, want ErrSignature", err)
+			}
+		})
+	}
+}
+
+func TestParsePublicKeyErrors(t *testing.T) {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ec, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x, y := p256Coordinates(&ec.PublicKey)
+	offCurve := bytes.Clone(y)
+	offCurve[31] ^= 1
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := bytes.Repeat([]byte{0xff}, 256)
+
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"empty", nil},
+		{"truncated", encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgEdDSA}, {-1, crvEd25519}, {-2, []byte(pub)}})[:20]},
+		{"trailing data", append(encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgEdDSA}, {-1, crvEd25519}, {-2, []byte(pub)}}), 0x00)},
+		{"not a map", encodeCBOR([]any{1, AlgEdDSA})},
+		{"missing alg", encodeCBOR(cborMap{{1, ktyOKP}, {-1, crvEd25519}, {-2, []byte(pub)}})},
+		{"unsupported alg", encodeCBOR(cborMap{{1, ktyEC2}, {3, -35}, {-1, 2}, {-2, x}, {-3, y}})},
+		{"alg of the wrong type", encodeCBOR(cborMap{{1, ktyOKP}, {3, "EdDSA"}, {-1, crvEd25519}, {-2, []byte(pub)}})},
+		{"Ed25519 with EC2 kty", encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgEdDSA}, {-1, crvEd25519}, {-2, []byte(pub)}})},
+		{"Ed25519 on another curve", encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgEdDSA}, {-1, 7}, {-2, []byte(pub)}})},
+		{"Ed25519 short x", encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgEdDSA}, {-1, crvEd25519}, {-2, []byte(pub)[:31]}})},
+		{"Ed25519 x as text", encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgEdDSA}, {-1, crvEd25519}, {-2, string(pub)}})},
+		{"P-256 with OKP kty", encodeCBOR(cborMap{{1, ktyOKP}, {3, AlgES256}, {-1, crvP256}, {-2, x}, {-3, y}})},
+		{"P-256 on another curve", encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgES256}, {-1, 2}, {-2, x}, {-3, y}})},
+		{"P-256 missing y", encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgES256}, {-1, crvP256}, {-2, x}})},
+		{"P-256 short x", encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgES256}, {-1, crvP256}, {-2, x[1:]}, {-3, y}})},
+		{"P-256 point off the curve", encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgES256}, {-1, crvP256}, {-2, x}, {-3, offCurve}})},
+		{"RSA with EC2 kty", encodeCBOR(cborMap{{1, ktyEC2}, {3, AlgRS256}, {-1, n}, {-2, []byte{1, 0, 1}}})},
+		{"RSA 1024 bit modulus", encodeCBOR(cborMap{{1, ktyRSA}, {3, AlgRS256}, {-1, small.N.Bytes()}, {-2, []byte{1, 0, 1}}})},
+		{"RSA missing exponent", encodeCBOR(cborMap{{1, ktyRSA}, {3, AlgRS256}, {-1, n}})},
+		{"RSA exponent too long", encodeCBOR(cborMap{{1, ktyRSA}, {3, AlgRS256}, {-1, n}, {-2, []byte{1, 0, 0, 0, 1}}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if key, err := parsePublicKey(tt.raw); err == nil {
+				t.Errorf("parsePublicKey = %+v, want an error", key)
+			}
+		})
+	}
+}
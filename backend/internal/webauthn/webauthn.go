@@ -0,0 +1,207 @@
+// Package webauthn verifies passkey registrations and sign ins. Attestation
+// is not requested, so registrations are trusted as far as the relying party
+// id, origin and challenge; sign ins are checked against the stored public
+// key.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttested     = 0x40
+)
+
+var (
+	ErrSignature = errors.New("webauthn: invalid signature")
+	// ErrCloned is returned when a credential's signature counter went
+	// backwards, which means the private key has been copied.
+	ErrCloned = errors.New("webauthn: signature counter did not increase")
+)
+
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+}
+
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+func (rp *RelyingParty) parseClientData(raw []byte, ceremony string) (clientData, error) {
+	var cd clientData
+	if err := json.Unmarshal(raw, &cd); err != nil {
+		return cd, fmt.Errorf("webauthn: invalid client data: %w", err)
+	}
+	if cd.Type != ceremony {
+		return cd, fmt.Errorf("webauthn: expected %s, got %q", ceremony, cd.Type)
+	}
+	if !slices.Contains(rp.Origins, cd.Origin) {
+		return cd, fmt.Errorf("webauthn: origin %q is not allowed", cd.Origin)
+	}
+	if cd.Challenge == "" {
+		return cd, errors.New("webauthn: missing challenge")
+	}
+	return cd, nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (rp *RelyingParty) parseAuthenticatorData(b []byte) (authenticatorData, error) {
+	var ad authenticatorData
+	if len(b) < 37 {
+		return ad, errors.New("webauthn: authenticator data too short")
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(b[:32], rpIDHash[:]) {
+		return ad, errors.New("webauthn: relying party id mismatch")
+	}
+	ad.flags = b[32]
+	ad.signCount = binary.BigEndian.Uint32(b[33:37])
+	if ad.flags&flagUserPresent == 0 {
+		return ad, errors.New("webauthn: user not present")
+	}
+
+	if ad.flags&flagAttested == 0 {
+		return ad, nil
+	}
+
+	// aaguid(16) | credential id length(2) | credential id | COSE key | extensions
+	rest := b[37:]
+	if len(rest) < 18 {
+		return ad, errors.New("webauthn: attested credential data too short")
+	}
+	idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+	rest = rest[18:]
+	if len(rest) < idLen {
+		return ad, errors.New("webauthn: credential id truncated")
+	}
+	ad.credentialID = rest[:idLen]
+
+	keyStart := rest[idLen:]
+	_, after, err := decodeCBOR(keyStart)
+	if err != nil {
+		return ad, fmt.Errorf("webauthn: invalid credential public key: %w", err)
+	}
+	ad.publicKey = keyStart[:len(keyStart)-len(after)]
+	return ad, nil
+}
+
+// Registration is a new credential created by navigator.credentials.create.
+type Registration struct {
+	Challenge    string
+	CredentialID []byte
+	// PublicKey is the COSE_Key to store for verifying sign ins.
+	PublicKey    []byte
+	SignCount    uint32
+	UserVerified bool
+}
+
+// ParseRegistration checks a registration response. The caller must still
+// check that Challenge is one it issued.
+func (rp *RelyingParty) ParseRegistration(clientDataJSON, attestationObject []byte) (*Registration, error) {
+	cd, err := rp.parseClientData(clientDataJSON, "webauthn.create")
+	if err != nil {
+		return nil, err
+	}
+
+	v, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("webauthn: invalid attestation object: %w", err)
+	}
+	att, ok := v.(map[any]any)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object is not a map")
+	}
+	authData, ok := att["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("webauthn: attestation object has no authData")
+	}
+
+	ad, err := rp.parseAuthenticatorData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if ad.credentialID == nil {
+		return nil, errors.New("webauthn: registration has no credential")
+	}
+	if _, err := parsePublicKey(ad.publicKey); err != nil {
+		return nil, fmt.Errorf("webauthn: %w", err)
+	}
+
+	return &Registration{
+		Challenge:    cd.Challenge,
+		CredentialID: ad.credentialID,
+		PublicKey:    ad.publicKey,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// Assertion is a sign in response from navigator.credentials.get whose
+// signature has not been checked yet.
+type Assertion struct {
+	Challenge    string
+	SignCount    uint32
+	UserVerified bool
+
+	signed    []byte
+	signature []byte
+}
+
+// ParseAssertion checks everything in a sign in response that does not need
+// the credential's public key. The caller must check the challenge, then Verify.
+func (rp *RelyingParty) ParseAssertion(clientDataJSON, authenticatorData, signature []byte) (*Assertion, error) {
+	cd, err := rp.parseClientData(clientDataJSON, "webauthn.get")
+	if err != nil {
+		return nil, err
+	}
+	ad, err := rp.parseAuthenticatorData(authenticatorData)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	return &Assertion{
+		Challenge:    cd.Challenge,
+		SignCount:    ad.signCount,
+		UserVerified: ad.flags&flagUserVerified != 0,
+		signed:       append(append([]byte(nil), authenticatorData...), clientDataHash[:]...),
+		signature:    signature,
+	}, nil
+}
+
+// Verify checks the signature against a stored public key and the signature
+// counter against the last one seen. Authenticators that do not count, like
+// synced passkeys, always report zero.
+func (a *Assertion) Verify(publicKeyCOSE []byte, storedCount uint32) error {
+	key, err := parsePublicKey(publicKeyCOSE)
+	if err != nil {
+		return fmt.Errorf("webauthn: %w", err)
+	}
+	if err := key.verify(a.signed, a.signature); err != nil {
+		return err
+	}
+	if (a.SignCount != 0 || storedCount != 0) && a.SignCount <= storedCount {
+		return ErrCloned
+	}
+	return nil
+}
@@ -0,0 +1,213 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+var testRP = &RelyingParty{ID: "civet.app", Name: "Civet", Origins: []string{"https://civet.app"}}
+
+func clientDataJSON(t *testing.T, typ, challenge, origin string) []byte {
+	t.Helper()
+	b, err := json.Marshal(clientData{Type: typ, Challenge: challenge, Origin: origin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// authData builds authenticator data; credential data is only appended when
+// flags has the attested bit.
+func authData(rpID string, flags byte, count uint32, credentialID, publicKey []byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	b := append(rpIDHash[:], flags)
+	b = binary.BigEndian.AppendUint32(b, count)
+	if flags&flagAttested != 0 {
+		b = append(b, make([]byte, 16)...)
+		b = binary.BigEndian.AppendUint16(b, uint16(len(credentialID)))
+		b = append(b, credentialID...)
+		b = append(b, publicKey...)
+	}
+	return b
+}
+
+func attestationObject(authData []byte) []byte {
+	return encodeCBOR(cborMap{{"fmt", "none"}, {"attStmt", cborMap{}}, {"authData", authData}})
+}
+
+func TestParseRegistration(t *testing.T) {
+	signer := newEd25519Signer(t)
+	credentialID := []byte("credential-1")
+	attested := byte(flagUserPresent | flagUserVerified | flagAttested)
+	valid := authData("civet.app", attested, 0, credentialID, signer.cose)
+	create := clientDataJSON(t, "webauthn.create", "challenge", "https://civet.app")
+
+	reg, err := testRP.ParseRegistration(create, attestationObject(valid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reg.Challenge != "challenge" || !bytes.Equal(reg.CredentialID, credentialID) ||
+		!bytes.Equal(reg.PublicKey, signer.cose) || !reg.UserVerified || reg.SignCount != 0 {
+		t.Errorf("registration = %+v", reg)
+	}
+
+	// extensions follow the public key and must not end up in it
+	withExtensions := append(authData("civet.app", attested|0x80, 7, credentialID, signer.cose), encodeCBOR(cborMap{{"credProtect", 2}})...)
+	reg, err = testRP.ParseRegistration(create, attestationObject(withExtensions))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reg.PublicKey, signer.cose) || reg.SignCount != 7 {
+		t.Errorf("with extensions: public key %x, count %d", reg.PublicKey, reg.SignCount)
+	}
+
+	unsupportedKey := encodeCBOR(cborMap{{1, ktyEC2}, {3, -35}, {-1, 2}, {-2, []byte{1}}, {-3, []byte{2}}})
+	truncatedID := authData("civet.app", attested, 0, credentialID, signer.cose)[:37+18+4]
+
+	tests := []struct {
+		name        string
+		clientData  []byte
+		attestation []byte
+	}{
+		{"get ceremony", clientDataJSON(t, "webauthn.get", "challenge", "https://civet.app"), attestationObject(valid)},
+		{"other origin", clientDataJSON(t, "webauthn.create", "challenge", "https://evil.example"), attestationObject(valid)},
+		{"missing challenge", clientDataJSON(t, "webauthn.create", "", "https://civet.app"), attestationObject(valid)},
+		{"client data not json", []byte("{"), attestationObject(valid)},
+		{"attestation not cbor", create, []byte{0xff}},
+		{"attestation empty", create, nil},
+		{"attestation not a map", create, encodeCBOR([]any{valid})},
+		{"no authData", create, encodeCBOR(cborMap{{"fmt", "none"}})},
+		{"authData not bytes", create, encodeCBOR(cborMap{{"authData", "text"}})},
+		{"authData too short", create, attestationObject(valid[:36])},
+		{"other relying party", create, attestationObject(authData("evil.example", attested, 0, credentialID, signer.cose))},
+		{"user not present", create, attestationObject(authData("civet.app", flagAttested, 0, credentialID, signer.cose))},
+		{"no credential", create, attestationObject(authData("civet.app", flagUserPresent, 0, nil, nil))},
+		{"credential data too short", create, attestationObject(valid[:37+10])},
+		{"credential id truncated", create, attestationObject(truncatedID)},
+		{"public key truncated", create, attestationObject(valid[:len(valid)-1])},
+		{"public key missing", create, attestationObject(authData("civet.app", attested, 0, credentialID, nil))},
+		{"unsupported public key", create, attestationObject(authData("civet.app", attested, 0, credentialID, unsupportedKey))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reg, err := testRP.ParseRegistration(tt.clientData, tt.attestation); err == nil {
+				t.Errorf("ParseRegistration = %+v, want an error", reg)
+			}
+		})
+	}
+}
+
+func TestAssertionVerify(t *testing.T) {
+	signers := map[string]testSigner{
+		"EdDSA": newEd25519Signer(t),
+		"ES256": newES256Signer(t),
+	}
+	get := clientDataJSON(t, "webauthn.get", "challenge", "https://civet.app")
+
+	for name, signer := range signers {
+		t.Run(name, func(t *testing.T) {
+			ad := authData("civet.app", flagUserPresent, 5, nil, nil)
+			clientDataHash := sha256.Sum256(get)
+			sig := signer.sign(append(bytes.Clone(ad), clientDataHash[:]...))
+
+			a, err := testRP.ParseAssertion(get, ad, sig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Challenge != "challenge" || a.SignCount != 5 || a.UserVerified {
+				t.Errorf("assertion = %+v", a)
+			}
+			if err := a.Verify(signer.cose, 4); err != nil {
+				t.Errorf("Verify: %v", err)
+			}
+
+			other := signers["EdDSA"]
+			if name == "EdDSA" {
+				other = newEd25519Signer(t)
+			}
+			if err := a.Verify(other.cose, 4); !errors.Is(err, ErrSignature) {
+				t.Errorf("Verify with another key: err = %v, want ErrSignature", err)
+			}
+
+			// a signature over different client data does not carry over
+			otherHash := sha256.Sum256(clientDataJSON(t, "webauthn.get", "other", "https://civet.app"))
+			replayed, err := testRP.ParseAssertion(get, ad, signer.sign(append(bytes.Clone(ad), otherHash[:]...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := replayed.Verify(signer.cose, 4); !errors.Is(err, ErrSignature) {
+				t.Errorf("Verify over other client data: err = %v, want ErrSignature", err)
+			}
+
+			if err := a.Verify([]byte{0xa0}, 4); err == nil || errors.Is(err, ErrSignature) {
+				t.Errorf("Verify with an invalid stored key: err = %v", err)
+			}
+		})
+	}
+}
+
+func TestAssertionSignCount(t *testing.T) {
+	signer := newEd25519Signer(t)
+	get := clientDataJSON(t, "webauthn.get", "challenge", "https://civet.app")
+	clientDataHash := sha256.Sum256(get)
+
+	tests := []struct {
+		name          string
+		count, stored uint32
+		want          error
+	}{
+		{"increased", 5, 4, nil},
+		{"jumped ahead", 100, 4, nil},
+		{"first use of a counting authenticator", 1, 0, nil},
+		{"synced passkey never counts", 0, 0, nil},
+		{"repeated", 5, 5, ErrCloned},
+		{"went backwards", 3, 5, ErrCloned},
+		{"stopped counting", 0, 5, ErrCloned},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ad := authData("civet.app", flagUserPresent|flagUserVerified, tt.count, nil, nil)
+			a, err := testRP.ParseAssertion(get, ad, signer.sign(append(bytes.Clone(ad), clientDataHash[:]...)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !a.UserVerified {
+				t.Error("UserVerified = false")
+			}
+			if err := a.Verify(signer.cose, tt.stored); !errors.Is(err, tt.want) {
+				t.Errorf("Verify err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseAssertionErrors(t *testing.T) {
+	get := clientDataJSON(t, "webauthn.get", "challenge", "https://civet.app")
+	ad := authData("civet.app", flagUserPresent, 1, nil, nil)
+
+	tests := []struct {
+		name       string
+		clientData []byte
+		authData   []byte
+	}{
+		{"create ceremony", clientDataJSON(t, "webauthn.create", "challenge", "https://civet.app"), ad},
+		{"other origin", clientDataJSON(t, "webauthn.get", "challenge", "http://civet.app"), ad},
+		{"missing challenge", clientDataJSON(t, "webauthn.get", "", "https://civet.app"), ad},
+		{"client data not json", []byte("webauthn.get"), ad},
+		{"empty authenticator data", get, nil},
+		{"authenticator data too short", get, ad[:36]},
+		{"other relying party", get, authData("civet.app.evil.example", flagUserPresent, 1, nil, nil)},
+		{"user not present", get, authData("civet.app", flagUserVerified, 1, nil, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if a, err := testRP.ParseAssertion(tt.clientData, tt.authData, []byte("sig")); err == nil {
+				t.Errorf("ParseAssertion = %+v, want an error", a)
+			}
+		})
+	}
+}
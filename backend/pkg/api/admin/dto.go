@@ -0,0 +1,13 @@
+package admin
+
+import (
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/receipt"
+)
+
+type ReprocessResponse struct {
+	*receipt.ReprocessPlan
+	ReceiptID uuid.UUID `json:"receipt_id"`
+	Applied   bool      `json:"applied"`
+	Error     string    `json:"error,omitempty"`
+}
@@ -0,0 +1,100 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sharithg/civet/internal/cache"
+	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/receipt"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type adminRepository struct {
+	Repo        *repository.Queries
+	Ctx         *context.Context
+	Cache       *cache.Cache
+	Reprocessor *receipt.Reprocessor
+}
+
+func New(repo *repository.Queries, db *pgxpool.Pool, genai genai.OpenAi, cache *cache.Cache, ctx *context.Context) *adminRepository {
+	return &adminRepository{
+		Repo:        repo,
+		Ctx:         ctx,
+		Cache:       cache,
+		Reprocessor: receipt.NewReprocessor(db, repo, genai, cache),
+	}
+}
+
+// CacheStats returns extraction cache hit/miss counts per stage since startup.
+func (r *adminRepository) CacheStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"stages": r.Cache.Stats()})
+}
+
+// ListOutdated returns receipts extracted with an older prompt or schema.
+// Nothing is re-extracted here; use Reprocess to see or apply the diff for a
+// receipt.
+func (r *adminRepository) ListOutdated(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	if err != nil || limit <= 0 || limit > 100 {
+		utils.BadRequest(c, "limit must be between 1 and 100")
+		return
+	}
+
+	outdated, err := r.Reprocessor.Outdated(*r.Ctx, int32(limit))
+	if err != nil {
+		utils.InternalError(c, "error listing receipts", err)
+		return
+	}
+	if outdated == nil {
+		outdated = []repository.ListOutdatedReceiptsRow{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"prompt_version": receipt.PromptVersion,
+		"schema_version": receipt.SchemaVersion(),
+		"receipts":       outdated,
+	})
+}
+
+// Reprocess re-runs extraction for a single receipt. Without ?apply=true it
+// only returns the diff.
+func (r *adminRepository) Reprocess(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	plan, err := r.Reprocessor.Plan(*r.Ctx, receiptId)
+	if err != nil {
+		reprocessError(c, "error re-processing receipt", err)
+		return
+	}
+
+	applied := c.Query("apply") == "true"
+	if applied {
+		if err := r.Reprocessor.Apply(*r.Ctx, plan); err != nil {
+			reprocessError(c, "error saving receipt", err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, ReprocessResponse{ReprocessPlan: plan, ReceiptID: receiptId, Applied: applied})
+}
+
+func reprocessError(c *gin.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, pgx.ErrNoRows), errors.Is(err, receipt.ErrReceiptDeleted):
+		utils.NotFound(c, "receipt not found")
+	case errors.Is(err, receipt.ErrReceiptLocked):
+		utils.Conflict(c, "receipt belongs to a locked or settled outing")
+	default:
+		utils.InternalError(c, msg, err)
+	}
+}
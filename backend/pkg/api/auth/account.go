@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+// deletedFriendName replaces a deleted user's name in outings they were part of.
+const deletedFriendName = "Deleted user"
+
+// DeleteAccount removes the user's personal data. Their own outings are soft
+// deleted and purged like any other. In outings of others they stay on as an
+// anonymous friend so the splits still add up, and every way of signing in,
+// including existing sessions, stops working.
+func (a *authRepository) DeleteAccount(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	avatarKey, err := a.Repo.GetUserAvatar(*a.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+
+	tx, err := a.DB.Begin(*a.Ctx)
+	if err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+	defer tx.Rollback(*a.Ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	outings, err := qtx.SoftDeleteUserOutings(*a.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+	if _, err := qtx.AnonymizeUserFriends(*a.Ctx, repository.AnonymizeUserFriendsParams{
+		UserID: &user.ID,
+		Name:   deletedFriendName,
+	}); err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+	if err := qtx.DeleteUserLogins(*a.Ctx, user.ID); err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+	if err := qtx.AnonymizeUser(*a.Ctx, user.ID); err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+
+	if err := tx.Commit(*a.Ctx); err != nil {
+		utils.InternalError(c, "failed to delete account", err)
+		return
+	}
+
+	if avatarKey != "" {
+		if err := a.Storage.Delete(*a.Ctx, a.Config.ReceiptsBucket, avatarKey); err != nil {
+			utils.Logger(c).Warn("failed to delete avatar", zap.String("key", avatarKey), zap.Error(err))
+		}
+	}
+
+	a.clearCookies(c)
+	c.JSON(http.StatusOK, gin.H{"deleted": true, "outings_deleted": outings})
+}
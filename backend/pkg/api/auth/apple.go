@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+const (
+	appleIssuer  = "https://appleid.apple.com"
+	appleKeysURL = appleIssuer + "/auth/keys"
+
+	// Apple rotates its keys rarely; an unknown kid triggers a refetch anyway
+	appleKeysTTL = 24 * time.Hour
+)
+
+// appleKeys caches Apple's ID token signing keys.
+type appleKeys struct {
+	mu      sync.Mutex
+	keys    map[string]*rsa.PublicKey
+	fetched time.Time
+}
+
+func (k *appleKeys) get(kid string) (*rsa.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	if ok && time.Since(k.fetched) < appleKeysTTL {
+		return key, nil
+	}
+	// refetch for an unknown kid at most once a minute
+	if !ok && time.Since(k.fetched) < time.Minute {
+		return nil, fmt.Errorf("unknown apple key %q", kid)
+	}
+
+	keys, err := fetchAppleKeys()
+	if err != nil {
+		return nil, err
+	}
+	k.keys = keys
+	k.fetched = time.Now()
+
+	if key, ok = keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown apple key %q", kid)
+	}
+	return key, nil
+}
+
+func fetchAppleKeys() (map[string]*rsa.PublicKey, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(appleKeysURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching apple keys: status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	return keys, nil
+}
+
+type appleClaims struct {
+	jwt.RegisteredClaims
+	Email string `json:"email"`
+	// Apple sends these as either booleans or "true"/"false"
+	EmailVerified any    `json:"email_verified"`
+	Nonce         string `json:"nonce"`
+}
+
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// appleIdentity verifies an ID token from Sign in with Apple. The token's
+// audience must be one of APPLE_CLIENT_IDS. When the client passed a nonce to
+// Apple it must send it here too; Apple echoes either the nonce or its
+// SHA-256, depending on the SDK.
+func (a *authRepository) appleIdentity(idToken, nonce string) (identity, error) {
+	if len(a.Config.AppleClientIDs) == 0 {
+		return identity{}, errors.New("sign in with apple is not configured")
+	}
+	if idToken == "" {
+		return identity{}, errors.New("missing id_token")
+	}
+
+	claims := &appleClaims{}
+	_, err := jwt.ParseWithClaims(idToken, claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return a.apple.get(kid)
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithIssuer(appleIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return identity{}, err
+	}
+
+	if !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(a.Config.AppleClientIDs, aud)
+	}) {
+		return identity{}, errors.New("id token was issued for another client")
+	}
+
+	if nonce != "" {
+		sum := sha256.Sum256([]byte(nonce))
+		if claims.Nonce != nonce && claims.Nonce != hex.EncodeToString(sum[:]) {
+			return identity{}, errors.New("nonce mismatch")
+		}
+	}
+
+	if claims.Subject == "" {
+		return identity{}, errors.New("missing sub in ID token")
+	}
+
+	return identity{
+		Provider:      providerApple,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: truthy(claims.EmailVerified),
+	}, nil
+}
+
+// AppleAuthTokenHandler signs in with an ID token from Sign in with Apple.
+// Apple only shares the user's name on the first sign in, so the client
+// passes it along as name.
+func (a *authRepository) AppleAuthTokenHandler(c *gin.Context) {
+	platform := c.DefaultPostForm("platform", "native")
+
+	ident, err := a.appleIdentity(c.PostForm("id_token"), c.PostForm("nonce"))
+	if err != nil {
+		utils.Abort(c, utils.NewError(http.StatusUnauthorized, utils.CodeUnauthorized, "Invalid Apple ID token").WithCause(err))
+		return
+	}
+	ident.Name = c.PostForm("name")
+
+	user, err := a.resolveUser(ident)
+	if err != nil {
+		utils.InternalError(c, "Failed to create user", err)
+		return
+	}
+
+	a.signIn(c, platform, user, ident.Name)
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// Kinds of auth_challenges rows. A secret only works for the kind it was
+// issued for.
+const (
+	challengeMagicLink       = "magic_link"
+	challengeLinkEmail       = "link_email"
+	challengePasskeyRegister = "passkey_register"
+	challengePasskeyLogin    = "passkey_login"
+)
+
+// newSecret returns 32 random bytes, base64url encoded.
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueChallenge stores a single use secret of the given kind, also clearing
+// out expired ones.
+func (a *authRepository) issueChallenge(kind, email string, userID *uuid.UUID, ttl time.Duration) (string, error) {
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+
+	err = a.Repo.CreateAuthChallenge(*a.Ctx, repository.CreateAuthChallengeParams{
+		TokenHash: hashSecret(secret),
+		Kind:      kind,
+		Email:     email,
+		UserID:    userID,
+		ExpiresAt: pgtype.Timestamptz{Time: time.Now().Add(ttl), Valid: true},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := a.Repo.DeleteExpiredAuthChallenges(*a.Ctx); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// consumeChallenge spends a secret. ok is false when it is unknown, expired,
+// of another kind or already used.
+func (a *authRepository) consumeChallenge(kind, secret string) (row repository.ConsumeAuthChallengeRow, ok bool, err error) {
+	row, err = a.Repo.ConsumeAuthChallenge(*a.Ctx, repository.ConsumeAuthChallengeParams{
+		TokenHash: hashSecret(secret),
+		Kind:      kind,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return row, false, nil
+	}
+	if err != nil {
+		return row, false, err
+	}
+	return row, true, nil
+}
@@ -3,8 +3,16 @@ package auth
 import (
 	"net/http"
 	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/pkg/api/utils"
 )
 
+// CSRFHeader must echo the CSRF cookie on state changing requests that are
+// authenticated with cookies.
+const CSRFHeader = "X-CSRF-Token"
+
 func BuildCookie(name, value string, maxAge int, secure bool) *http.Cookie {
 	return &http.Cookie{
 		Name:     name,
@@ -17,6 +25,34 @@ func BuildCookie(name, value string, maxAge int, secure bool) *http.Cookie {
 	}
 }
 
+// SetCSRFCookie issues a new double submit token. The cookie is readable by
+// scripts, and the token is also sent in the CSRFHeader response header for
+// web apps served from another origin than the API.
+func SetCSRFCookie(c *gin.Context, config *config.Config) (string, error) {
+	csrfToken, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	cookie := BuildCookie(config.CSRFCookieName, csrfToken, config.RefreshExpiration, config.CookieSecure)
+	cookie.HttpOnly = false
+	http.SetCookie(c.Writer, cookie)
+	c.Header(CSRFHeader, csrfToken)
+	return csrfToken, nil
+}
+
+// setSessionCookies hands a web client its tokens, along with a fresh CSRF
+// token so one never outlives the session it was issued with. refreshToken is
+// left alone when empty.
+func (a *authRepository) setSessionCookies(c *gin.Context, accessToken, refreshToken string) error {
+	http.SetCookie(c.Writer, BuildCookie(a.Config.CookieName, accessToken, a.Config.JWTExpirationSeconds, a.Config.CookieSecure))
+	if refreshToken == "" {
+		return nil
+	}
+	http.SetCookie(c.Writer, BuildCookie(a.Config.RefreshCookieName, refreshToken, a.Config.RefreshExpiration, a.Config.CookieSecure))
+	_, err := SetCSRFCookie(c, a.Config)
+	return err
+}
+
 func parseCookieHeader(cookieHeader string) map[string]map[string]string {
 	result := map[string]map[string]string{}
 
@@ -42,3 +78,18 @@ func parseCookieHeader(cookieHeader string) map[string]map[string]string {
 
 	return result
 }
+
+// CSRFToken returns the CSRF token for a web client that cannot read the
+// API's cookies, issuing one when the client has none yet.
+func (a *authRepository) CSRFToken(c *gin.Context) {
+	csrfToken, err := c.Cookie(a.Config.CSRFCookieName)
+	if err != nil || csrfToken == "" {
+		csrfToken, err = SetCSRFCookie(c, a.Config)
+		if err != nil {
+			utils.InternalError(c, "failed to issue csrf token", err)
+			return
+		}
+	}
+	c.Header(CSRFHeader, csrfToken)
+	c.JSON(http.StatusOK, gin.H{"csrf_token": csrfToken})
+}
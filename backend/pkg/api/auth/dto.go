@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+type Session struct {
+	ID         uuid.UUID `json:"id"`
+	Platform   string    `json:"platform"`
+	UserAgent  string    `json:"user_agent"`
+	IpAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+func toSessions(rows []repository.ListActiveSessionsRow, current uuid.UUID) []Session {
+	sessions := []Session{}
+	for _, row := range rows {
+		sessions = append(sessions, Session{
+			ID:         row.ID,
+			Platform:   row.Platform,
+			UserAgent:  row.UserAgent,
+			IpAddress:  row.IpAddress,
+			CreatedAt:  row.CreatedAt.Time,
+			LastUsedAt: row.LastUsedAt.Time,
+			ExpiresAt:  row.ExpiresAt.Time,
+			Current:    row.ID == current,
+		})
+	}
+	return sessions
+}
+
+type Identity struct {
+	ID         uuid.UUID `json:"id"`
+	Provider   string    `json:"provider"`
+	Email      string    `json:"email"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+func toIdentities(rows []repository.ListUserIdentitiesRow) []Identity {
+	identities := []Identity{}
+	for _, row := range rows {
+		identities = append(identities, Identity{
+			ID:         row.ID,
+			Provider:   row.Provider,
+			Email:      row.Email,
+			CreatedAt:  row.CreatedAt.Time,
+			LastUsedAt: row.LastUsedAt.Time,
+		})
+	}
+	return identities
+}
+
+type EmailStartInput struct {
+	Email    string `json:"email" form:"email" binding:"required,email"`
+	Platform string `json:"platform" form:"platform"`
+}
+
+type EmailVerifyInput struct {
+	Token    string `json:"token" form:"token" binding:"required"`
+	Platform string `json:"platform" form:"platform"`
+}
+
+type Passkey struct {
+	// ID is the credential id, base64url encoded
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Transports []string   `json:"transports"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func toPasskeys(rows []repository.ListWebauthnCredentialsRow) []Passkey {
+	passkeys := []Passkey{}
+	for _, row := range rows {
+		passkey := Passkey{
+			ID:         encodeBase64URL(row.ID),
+			Name:       row.Name,
+			Transports: row.Transports,
+			CreatedAt:  row.CreatedAt.Time,
+		}
+		if row.LastUsedAt.Valid {
+			passkey.LastUsedAt = &row.LastUsedAt.Time
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys
+}
+
+// WebAuthn options and responses, in the JSON form of the browser's
+// PublicKeyCredential with binary fields base64url encoded.
+
+type PasskeyRP struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type PasskeyUser struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type PasskeyParam struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type PasskeyDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type PasskeyAuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+type PasskeyCreationOptions struct {
+	Challenge              string                        `json:"challenge"`
+	RP                     PasskeyRP                     `json:"rp"`
+	User                   PasskeyUser                   `json:"user"`
+	PubKeyCredParams       []PasskeyParam                `json:"pubKeyCredParams"`
+	Timeout                int64                         `json:"timeout"`
+	Attestation            string                        `json:"attestation"`
+	AuthenticatorSelection PasskeyAuthenticatorSelection `json:"authenticatorSelection"`
+	ExcludeCredentials     []PasskeyDescriptor           `json:"excludeCredentials"`
+}
+
+type PasskeyRequestOptions struct {
+	Challenge        string              `json:"challenge"`
+	RPID             string              `json:"rpId"`
+	Timeout          int64               `json:"timeout"`
+	UserVerification string              `json:"userVerification"`
+	AllowCredentials []PasskeyDescriptor `json:"allowCredentials"`
+}
+
+type PasskeyRegistrationInput struct {
+	ID       string `json:"id" binding:"required"`
+	Name     string `json:"name"`
+	Response struct {
+		ClientDataJSON    string   `json:"clientDataJSON" binding:"required"`
+		AttestationObject string   `json:"attestationObject" binding:"required"`
+		Transports        []string `json:"transports"`
+	} `json:"response"`
+}
+
+type PasskeyLoginInput struct {
+	RawID    string `json:"rawId" binding:"required"`
+	Platform string `json:"platform"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON" binding:"required"`
+		AuthenticatorData string `json:"authenticatorData" binding:"required"`
+		Signature         string `json:"signature" binding:"required"`
+		UserHandle        string `json:"userHandle"`
+	} `json:"response"`
+}
+
+type GuestSessionInput struct {
+	Invite string `json:"invite" form:"invite" binding:"required"`
+}
+
+type GuestSessionResponse struct {
+	AccessToken string    `json:"accessToken"`
+	ExpiresAt   int64     `json:"expiresAt"`
+	OutingID    uuid.UUID `json:"outing_id"`
+	FriendID    uuid.UUID `json:"friend_id"`
+	Name        string    `json:"name"`
+}
+
+type ClaimGuestInput struct {
+	GuestToken string `json:"guest_token" form:"guest_token" binding:"required"`
+}
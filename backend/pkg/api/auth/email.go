@@ -0,0 +1,204 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/mail"
+	"github.com/sharithg/civet/internal/ratelimit"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+const magicLinkTTL = 15 * time.Minute
+
+// Purposes of a magic link, passed back to the client so it knows which
+// endpoint to finish with.
+const (
+	purposeLogin = "login"
+	purposeLink  = "link"
+)
+
+// sendMagicLink mails a link to the server's callback, which hands the
+// secret to the web app or native app.
+func (a *authRepository) sendMagicLink(c *gin.Context, email, secret, purpose, platform string) error {
+	link := a.Config.ServerURL + "/api/v1/auth/email/callback?" + url.Values{
+		"token":    {secret},
+		"purpose":  {purpose},
+		"platform": {platform},
+	}.Encode()
+
+	subject := "Your Civet sign in link"
+	action := "sign in to Civet"
+	if purpose == purposeLink {
+		subject = "Confirm your email for Civet"
+		action = "add this email to your Civet account"
+	}
+
+	return a.Mailer.Send(c.Request.Context(), mail.Message{
+		To:      email,
+		Subject: subject,
+		Text: fmt.Sprintf("Open the link below to %s. It expires in %d minutes and can only be used once.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			action, int(magicLinkTTL.Minutes()), link),
+	})
+}
+
+// allowEmail takes a token from the address's bucket, so that rotating IPs
+// can't flood one inbox with links. Like the RateLimit middleware, it lets the
+// request through when the limiter is down.
+func (a *authRepository) allowEmail(c *gin.Context, email string) bool {
+	key := "email:address:" + email
+	result, err := a.Limiter.Allow(*a.Ctx, key, ratelimit.PerHour(a.Config.EmailRatePerHour, a.Config.EmailRateBurst))
+	if err != nil {
+		utils.Logger(c).Warn("rate limiter unavailable", zap.String("key", key), zap.Error(err))
+		return true
+	}
+	if !result.Allowed {
+		utils.RateLimited(c, result.RetryAfter)
+		return false
+	}
+	return true
+}
+
+// StartEmailLogin sends a sign in link. It responds the same whether or not
+// the address has an account.
+func (a *authRepository) StartEmailLogin(c *gin.Context) {
+	var body EmailStartInput
+	if !utils.Bind(c, &body) {
+		return
+	}
+	email := normalizeEmail(body.Email)
+	if !a.allowEmail(c, email) {
+		return
+	}
+
+	secret, err := a.issueChallenge(challengeMagicLink, email, nil, magicLinkTTL)
+	if err != nil {
+		utils.InternalError(c, "failed to send sign in link", err)
+		return
+	}
+
+	if err := a.sendMagicLink(c, email, secret, purposeLogin, body.Platform); err != nil {
+		utils.InternalError(c, "failed to send sign in link", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true})
+}
+
+// EmailCallback is where magic links land. It forwards the secret to the
+// client the same way GoogleCallbackHandler forwards an OAuth code.
+func (a *authRepository) EmailCallback(c *gin.Context) {
+	redirect := a.Config.AppScheme
+	if c.Query("platform") == "web" {
+		redirect = a.Config.WebRedirect
+	}
+	redirect += "?" + url.Values{
+		"email_token": {c.Query("token")},
+		"purpose":     {c.DefaultQuery("purpose", purposeLogin)},
+	}.Encode()
+
+	c.Redirect(http.StatusFound, redirect)
+}
+
+// VerifyEmailLogin exchanges a magic link secret for a session.
+func (a *authRepository) VerifyEmailLogin(c *gin.Context) {
+	var body EmailVerifyInput
+	if !utils.Bind(c, &body) {
+		return
+	}
+
+	row, ok, err := a.consumeChallenge(challengeMagicLink, body.Token)
+	if err != nil {
+		utils.InternalError(c, "failed to verify sign in link", err)
+		return
+	}
+	if !ok {
+		utils.Unauthorized(c, "Sign in link is invalid or expired")
+		return
+	}
+
+	user, err := a.resolveUser(identity{
+		Provider:      providerEmail,
+		Subject:       row.Email,
+		Email:         row.Email,
+		EmailVerified: true,
+	})
+	if err != nil {
+		utils.InternalError(c, "Failed to create user", err)
+		return
+	}
+
+	platform := body.Platform
+	if platform == "" {
+		platform = "native"
+	}
+	a.signIn(c, platform, user, "")
+}
+
+// StartEmailLink sends a confirmation link for adding an email identity to
+// the signed in user.
+func (a *authRepository) StartEmailLink(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body EmailStartInput
+	if !utils.Bind(c, &body) {
+		return
+	}
+	email := normalizeEmail(body.Email)
+	if !a.allowEmail(c, email) {
+		return
+	}
+
+	secret, err := a.issueChallenge(challengeLinkEmail, email, &user.ID, magicLinkTTL)
+	if err != nil {
+		utils.InternalError(c, "failed to send confirmation link", err)
+		return
+	}
+
+	if err := a.sendMagicLink(c, email, secret, purposeLink, body.Platform); err != nil {
+		utils.InternalError(c, "failed to send confirmation link", err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"success": true})
+}
+
+// VerifyEmailLink finishes StartEmailLink. It must be called by the same user
+// that requested the link.
+func (a *authRepository) VerifyEmailLink(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body EmailVerifyInput
+	if !utils.Bind(c, &body) {
+		return
+	}
+
+	row, ok, err := a.consumeChallenge(challengeLinkEmail, body.Token)
+	if err != nil {
+		utils.InternalError(c, "failed to verify confirmation link", err)
+		return
+	}
+	if !ok || row.UserID == nil || *row.UserID != user.ID {
+		utils.Unauthorized(c, "Confirmation link is invalid or expired")
+		return
+	}
+
+	a.respondLinked(c, user.ID, identity{
+		Provider:      providerEmail,
+		Subject:       row.Email,
+		Email:         row.Email,
+		EmailVerified: true,
+	})
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/ratelimit"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+func TestAllowEmail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	a := &authRepository{
+		Ctx:     &ctx,
+		Config:  &config.Config{EmailRateBurst: 2, EmailRatePerHour: 1},
+		Limiter: ratelimit.NewMemory(),
+	}
+
+	allow := func(email string) (bool, *gin.Context) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		return a.allowEmail(c, email), c
+	}
+
+	for i := range 2 {
+		if ok, _ := allow("a@example.com"); !ok {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+
+	ok, c := allow("a@example.com")
+	if ok {
+		t.Fatal("request over the burst was allowed")
+	}
+	if err := utils.AsError(c.Errors.Last()); err.Status != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want %d", err.Status, http.StatusTooManyRequests)
+	}
+	if c.Writer.Header().Get("Retry-After") == "" {
+		t.Error("no Retry-After header")
+	}
+
+	if ok, _ := allow("b@example.com"); !ok {
+		t.Error("another address was limited")
+	}
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/token"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+// GuestInviteRedirect is where share links and QR codes land. It forwards the
+// invite to the web app, which exchanges it with GuestSession.
+func (a *authRepository) GuestInviteRedirect(c *gin.Context) {
+	c.Redirect(http.StatusFound, a.Config.WebRedirect+"?"+url.Values{
+		"guest_invite": {c.Param("invite")},
+	}.Encode())
+}
+
+// GuestSession exchanges an invite for a guest token. The token lasts until
+// the invite expires, capped at the refresh token lifetime, and stops working
+// as soon as the invite is revoked.
+func (a *authRepository) GuestSession(c *gin.Context) {
+	var body GuestSessionInput
+	if !utils.Bind(c, &body) {
+		return
+	}
+
+	invite, err := a.Repo.GetGuestInviteByToken(*a.Ctx, hashSecret(body.Invite))
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.Unauthorized(c, "Invite is invalid or expired")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to join outing", err)
+		return
+	}
+
+	friend, err := a.Repo.GetFriend(*a.Ctx, invite.FriendID)
+	if err != nil {
+		utils.InternalError(c, "failed to join outing", err)
+		return
+	}
+
+	ttl := min(time.Until(invite.ExpiresAt.Time), time.Duration(a.Config.RefreshExpiration)*time.Second)
+	claims := token.Claims{
+		Sub:      friend.ID.String(),
+		Name:     friend.Name,
+		Type:     token.TypeGuest,
+		OutingID: invite.OutingID.String(),
+		FriendID: friend.ID.String(),
+	}
+	claims.ID = invite.ID.String()
+
+	accessToken, err := a.Tokens.Issue(claims, ttl)
+	if err != nil {
+		utils.InternalError(c, "failed to join outing", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, GuestSessionResponse{
+		AccessToken: accessToken,
+		ExpiresAt:   time.Now().Add(ttl).Unix(),
+		OutingID:    invite.OutingID,
+		FriendID:    friend.ID,
+		Name:        friend.Name,
+	})
+}
+
+// ClaimGuest upgrades a guest to the signed in account: the guest's friend row
+// becomes the user's, so their claims carry over. If the user was already a
+// friend in the outing, the guest's claims move onto that row instead.
+func (a *authRepository) ClaimGuest(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body ClaimGuestInput
+	if !utils.Bind(c, &body) {
+		return
+	}
+
+	claims, err := a.Tokens.Verify(body.GuestToken, token.TypeGuest)
+	if err != nil {
+		utils.Unauthorized(c, "Invalid or expired guest token")
+		return
+	}
+	inviteID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		utils.Unauthorized(c, "Invalid or expired guest token")
+		return
+	}
+
+	tx, err := a.DB.Begin(*a.Ctx)
+	if err != nil {
+		utils.InternalError(c, "failed to claim guest", err)
+		return
+	}
+	defer tx.Rollback(*a.Ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	invite, err := qtx.GetActiveGuestInvite(*a.Ctx, inviteID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.Unauthorized(c, "Invite is invalid or expired")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to claim guest", err)
+		return
+	}
+
+	friend, err := qtx.GetFriend(*a.Ctx, invite.FriendID)
+	if err != nil {
+		utils.InternalError(c, "failed to claim guest", err)
+		return
+	}
+	if friend.UserID != nil && *friend.UserID != user.ID {
+		utils.Conflict(c, "This guest already belongs to another account")
+		return
+	}
+
+	friendID := friend.ID
+	existing, err := qtx.GetOutingFriendForUser(*a.Ctx, repository.GetOutingFriendForUserParams{
+		OutingID: invite.OutingID,
+		UserID:   &user.ID,
+	})
+	switch {
+	case err == nil && existing != friend.ID:
+		friendID = existing
+		err = qtx.MoveFriendSplits(*a.Ctx, repository.MoveFriendSplitsParams{
+			ToFriendID:   existing,
+			FromFriendID: friend.ID,
+		})
+		if err == nil {
+			err = qtx.DeleteFriend(*a.Ctx, friend.ID)
+		}
+	case err == nil:
+	case errors.Is(err, pgx.ErrNoRows):
+		err = qtx.SetFriendUser(*a.Ctx, repository.SetFriendUserParams{ID: friend.ID, UserID: &user.ID})
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to claim guest", err)
+		return
+	}
+
+	// the account replaces the share link
+	if _, err := qtx.RevokeGuestInvites(*a.Ctx, friend.ID); err != nil {
+		utils.InternalError(c, "failed to claim guest", err)
+		return
+	}
+
+	if err := tx.Commit(*a.Ctx); err != nil {
+		utils.InternalError(c, "failed to claim guest", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"friend_id": friendID, "outing_id": invite.OutingID})
+}
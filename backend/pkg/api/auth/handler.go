@@ -3,33 +3,45 @@ package auth
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/sharithg/civet/internal/config"
 	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/mail"
+	"github.com/sharithg/civet/internal/ratelimit"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/internal/token"
+	"github.com/sharithg/civet/internal/webauthn"
+	"github.com/sharithg/civet/pkg/api/utils"
 )
 
 type authRepository struct {
 	DB      *pgxpool.Pool
 	Ctx     *context.Context
-	Storage *storage.Storage
+	Storage storage.Storage
 	Genai   genai.OpenAi
 	Config  *config.Config
 	Repo    *repository.Queries
+	Tokens  *token.Service
+	Mailer  mail.Sender
+	Limiter ratelimit.Limiter
+	RP      *webauthn.RelyingParty
+
+	apple *appleKeys
 }
 
-func New(db *pgxpool.Pool, repo *repository.Queries, storage *storage.Storage, genai genai.OpenAi, config *config.Config, ctx *context.Context) *authRepository {
+func New(db *pgxpool.Pool, repo *repository.Queries, storage storage.Storage, genai genai.OpenAi, config *config.Config, tokens *token.Service, mailer mail.Sender, limiter ratelimit.Limiter, ctx *context.Context) *authRepository {
 	return &authRepository{
 		DB:      db,
 		Ctx:     ctx,
@@ -37,6 +49,15 @@ func New(db *pgxpool.Pool, repo *repository.Queries, storage *storage.Storage, g
 		Genai:   genai,
 		Config:  config,
 		Repo:    repo,
+		Tokens:  tokens,
+		Mailer:  mailer,
+		Limiter: limiter,
+		RP: &webauthn.RelyingParty{
+			ID:      config.WebAuthnRPID,
+			Name:    config.WebAuthnRPName,
+			Origins: config.WebAuthnOrigins,
+		},
+		apple: &appleKeys{},
 	}
 }
 
@@ -60,26 +81,41 @@ func (a *authRepository) RefreshTokenHandler(c *gin.Context) {
 		}
 	}
 
-	// 3. Fallback: Authorization header
+	// An access token is never enough: refreshing always spends and rotates
+	// a refresh token, so a stolen access token can't be kept alive
 	if refreshToken == "" {
-		authHeader := c.GetHeader("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			accessToken := strings.TrimPrefix(authHeader, "Bearer ")
-			a.handleAccessTokenFallback(c, accessToken, platform)
-			return
-		}
+		utils.Unauthorized(c, "Missing refresh token")
+		return
 	}
 
-	// No valid token found
-	if refreshToken == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Missing refresh token"})
+	// Decode & validate refresh token
+	claims, err := a.Tokens.Verify(refreshToken, token.TypeRefresh)
+	if err != nil {
+		utils.Unauthorized(c, "Invalid or expired refresh token")
 		return
 	}
 
-	// Decode & validate refresh token
-	claims, err := DecodeToken(refreshToken, a.Config.JWTSecret)
-	if err != nil || claims.Type != "refresh" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+	// Refresh tokens issued before sessions existed can't be revoked, so
+	// they are no longer accepted and the client has to sign in again
+	sessionID, err := uuid.Parse(claims.SessionID)
+	if err != nil {
+		utils.Unauthorized(c, "Session expired, please sign in again")
+		return
+	}
+	tokenID, err := uuid.Parse(claims.ID)
+	if err != nil {
+		utils.Unauthorized(c, "Invalid or expired refresh token")
+		return
+	}
+
+	// Rotate: the presented token is spent whether or not this succeeds
+	newTokenID, ok, err := a.rotateSession(c, sessionID, tokenID)
+	if err != nil {
+		utils.InternalError(c, "Failed to refresh session", err)
+		return
+	}
+	if !ok {
+		utils.Unauthorized(c, "Refresh token revoked or already used")
 		return
 	}
 
@@ -92,15 +128,17 @@ func (a *authRepository) RefreshTokenHandler(c *gin.Context) {
 		"picture": claims.Picture,
 	}
 
-	accessToken, newRefreshToken, issuedAt, err := GenerateTokens(sub, time.Duration(a.Config.JWTExpirationSeconds), a.Config.JWTSecret, time.Duration(a.Config.RefreshExpiration), userInfo)
+	accessToken, newRefreshToken, issuedAt, err := a.generateTokens(sub, sessionID, newTokenID, userInfo)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate tokens"})
+		utils.InternalServerError(c, "Failed to generate tokens")
 		return
 	}
 
 	if platform == "web" {
-		c.SetCookie(a.Config.CookieName, accessToken, a.Config.JWTExpirationSeconds, "/", "", false, true)
-		c.SetCookie(a.Config.RefreshCookieName, newRefreshToken, a.Config.RefreshExpiration, "/", "", false, true)
+		if err := a.setSessionCookies(c, accessToken, newRefreshToken); err != nil {
+			utils.InternalError(c, "Failed to generate tokens", err)
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{
 			"success":   true,
 			"issuedAt":  issuedAt,
@@ -119,7 +157,7 @@ func (a *authRepository) RefreshTokenHandler(c *gin.Context) {
 func (a *authRepository) SessionHandler(c *gin.Context) {
 	cookieHeader := c.GetHeader("Cookie")
 	if cookieHeader == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		utils.Unauthorized(c, "Not authenticated")
 		return
 	}
 
@@ -127,15 +165,13 @@ func (a *authRepository) SessionHandler(c *gin.Context) {
 
 	tokenData, ok := cookies[a.Config.CookieName]
 	if !ok || tokenData["value"] == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		utils.Unauthorized(c, "Not authenticated")
 		return
 	}
 
-	token := tokenData["value"]
-
-	claims, err := DecodeToken(token, a.Config.JWTSecret)
+	claims, err := a.Tokens.Verify(tokenData["value"], token.TypeAccess)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		utils.Unauthorized(c, "Invalid token")
 		return
 	}
 
@@ -165,67 +201,23 @@ func (a *authRepository) SessionHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, response)
 }
 
-func (a *authRepository) GoogleLoginHandler(c *gin.Context) {
-	redirectURI := c.Query("redirect_uri")
-	clientID := c.Query("client_id")
-	scope := c.DefaultQuery("scope", "identity")
-	state := c.Query("state")
-
-	if redirectURI == "" || clientID != "google" || state == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
-		return
-	}
-
-	platform := "web"
-	if redirectURI != a.Config.WebRedirect {
-		platform = "mobile"
-	}
-
-	googleURL := "https://accounts.google.com/o/oauth2/auth?" + url.Values{
-		"client_id":     {a.Config.ClientID},
-		"redirect_uri":  {a.Config.ServerURL + "/auth/callback"},
-		"response_type": {"code"},
-		"scope":         {scope},
-		"state":         {platform + "|" + state},
-		"prompt":        {"select_account"},
-	}.Encode()
-
-	c.Redirect(http.StatusFound, googleURL)
-}
-
 func (a *authRepository) AuthGoogleHandler(c *gin.Context) {
 	code := c.Query("code")
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing code"})
+		utils.BadRequest(c, "Missing code")
 		return
 	}
 
 	// Step 1: Exchange code for access token
-	tokenURL := "https://accounts.google.com/o/oauth2/token"
-	data := url.Values{
-		"code":          {code},
-		"client_id":     {a.Config.ClientID},
-		"client_secret": {a.Config.ClientSecret},
-		"redirect_uri":  {a.Config.RedirectURI},
-		"grant_type":    {"authorization_code"},
-	}
-
-	resp, err := http.PostForm(tokenURL, data)
-	if err != nil || resp.StatusCode >= 400 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to get access token"})
-		return
-	}
-	defer resp.Body.Close()
-
-	var tokenData map[string]any
-	if err := json.NewDecoder(resp.Body).Decode(&tokenData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse token response"})
+	tokenData, err := a.googleExchange(code, c.Query("code_verifier"))
+	if err != nil {
+		utils.Abort(c, utils.NewError(http.StatusBadRequest, utils.CodeBadRequest, "Failed to get access token").WithCause(err))
 		return
 	}
 
 	accessToken, ok := tokenData["access_token"].(string)
 	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing access token"})
+		utils.BadRequest(c, "Missing access token")
 		return
 	}
 
@@ -236,14 +228,14 @@ func (a *authRepository) AuthGoogleHandler(c *gin.Context) {
 	client := &http.Client{}
 	userResp, err := client.Do(req)
 	if err != nil || userResp.StatusCode >= 400 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to fetch user info"})
+		utils.BadRequest(c, "Failed to fetch user info")
 		return
 	}
 	defer userResp.Body.Close()
 
 	var userInfo map[string]any
 	if err := json.NewDecoder(userResp.Body).Decode(&userInfo); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse user info"})
+		utils.InternalServerError(c, "Failed to parse user info")
 		return
 	}
 
@@ -252,212 +244,204 @@ func (a *authRepository) AuthGoogleHandler(c *gin.Context) {
 
 func (a *authRepository) GoogleAuthTokenHandler(c *gin.Context) {
 	code := c.PostForm("code")
-	fmt.Println("CODE: ", code)
 	platform := c.DefaultPostForm("platform", "native")
 
 	if code == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing authorization code"})
+		utils.BadRequest(c, "Missing authorization code")
 		return
 	}
 
-	// Exchange code for token
+	ident, err := a.googleIdentity(code, c.PostForm("code_verifier"))
+	if err != nil {
+		utils.Abort(c, utils.NewError(http.StatusBadRequest, utils.CodeBadRequest, "Failed to exchange authorization code").WithCause(err))
+		return
+	}
+
+	user, err := a.resolveUser(ident)
+	if err != nil {
+		utils.InternalError(c, "Failed to create user", err)
+		return
+	}
+
+	a.signIn(c, platform, user, ident.Name)
+}
+
+// googleExchange trades an authorization code from our callback for Google's
+// tokens, once the client has proven it started the flow.
+func (a *authRepository) googleExchange(code, codeVerifier string) (map[string]any, error) {
+	if code == "" {
+		return nil, errors.New("missing authorization code")
+	}
+
+	providerVerifier, err := a.consumeOAuthCode(code, codeVerifier)
+	if err != nil {
+		return nil, err
+	}
+
 	data := url.Values{
 		"code":          {code},
 		"client_id":     {a.Config.ClientID},
 		"client_secret": {a.Config.ClientSecret},
 		"redirect_uri":  {a.Config.RedirectURI},
 		"grant_type":    {"authorization_code"},
+		"code_verifier": {providerVerifier},
 	}
 
 	resp, err := http.PostForm("https://oauth2.googleapis.com/token", data)
-	if err != nil || resp.StatusCode >= 400 {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		fmt.Println("OAuth error response:", string(bodyBytes))
-
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "OAuth validation error",
-			"message": "Failed to exchange authorization code",
-		})
-		return
+	if err != nil {
+		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("token exchange failed: %s", bodyBytes)
+	}
 
 	var tokenData map[string]any
 	if err := json.NewDecoder(resp.Body).Decode(&tokenData); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode token response"})
-		return
+		return nil, fmt.Errorf("decode token response: %w", err)
 	}
-
 	if errMsg, exists := tokenData["error"]; exists {
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":             errMsg,
-			"error_description": tokenData["error_description"],
-			"message":           "OAuth validation error - please ensure the app complies with Google's OAuth 2.0 policy",
-		})
-		return
+		return nil, fmt.Errorf("%v: %v", errMsg, tokenData["error_description"])
+	}
+	return tokenData, nil
+}
+
+// googleIdentity exchanges an authorization code and verifies the ID token
+// Google returns with it.
+func (a *authRepository) googleIdentity(code, codeVerifier string) (identity, error) {
+	tokenData, err := a.googleExchange(code, codeVerifier)
+	if err != nil {
+		return identity{}, err
 	}
 
 	idToken, ok := tokenData["id_token"].(string)
 	if !ok {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing required id_token"})
-		return
-	}
-
-	claims, err := verifyIdToken(idToken, a.Config.ClientID)
-
-	sub := claims.Claims["sub"].(string)
-	email := claims.Claims["email"].(string)
-	picture := claims.Claims["picture"].(string)
-	emailVerified := claims.Claims["email_verified"].(bool)
-
-	if err != nil || sub == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or missing sub in ID token"})
-		return
+		return identity{}, errors.New("missing id_token")
 	}
 
-	userInfo := map[string]string{
-		"sub":           sub,
-		"email":         email,
-		"picture":       picture,
-		"emailVerified": strconv.FormatBool(emailVerified),
+	payload, err := verifyIdToken(idToken, a.Config.ClientID)
+	if err != nil {
+		return identity{}, err
 	}
 
-	accessToken, refreshToken, issuedAt, err := GenerateTokens(sub, time.Duration(a.Config.JWTExpirationSeconds), a.Config.JWTSecret, time.Duration(a.Config.RefreshExpiration), userInfo)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate internal tokens"})
-		return
+	sub, _ := payload.Claims["sub"].(string)
+	if sub == "" {
+		return identity{}, errors.New("missing sub in ID token")
 	}
+	email, _ := payload.Claims["email"].(string)
+	picture, _ := payload.Claims["picture"].(string)
+	name, _ := payload.Claims["name"].(string)
+	emailVerified, _ := payload.Claims["email_verified"].(bool)
 
-	_, err = a.Repo.CreateUser(*a.Ctx, repository.CreateUserParams{
-		Sub:           sub,
+	return identity{
+		Provider:      providerGoogle,
+		Subject:       sub,
 		Email:         email,
-		Picture:       picture,
 		EmailVerified: emailVerified,
-	})
-
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
-		return
-	}
-
-	if platform == "web" {
-		// Set cookies
-		c.SetCookie(a.Config.CookieName, accessToken, a.Config.JWTExpirationSeconds, "/", "", false, true)
-		c.SetCookie(a.Config.RefreshCookieName, refreshToken, a.Config.RefreshExpiration, "/", "", false, true)
-		c.JSON(http.StatusOK, gin.H{
-			"success":   true,
-			"issuedAt":  issuedAt,
-			"expiresAt": int(issuedAt) + a.Config.JWTExpirationSeconds,
-		})
-		return
-	}
-
-	// Native (mobile) response
-	c.JSON(http.StatusOK, gin.H{
-		"accessToken":  accessToken,
-		"refreshToken": refreshToken,
-	})
+		Name:          name,
+		Picture:       picture,
+	}, nil
 }
 
+// LoginGoogleHandler starts the Google sign in flow. The client's state and
+// PKCE challenge are kept server side and Google only sees a state of our
+// own, so the callback can tell which attempt it belongs to and where to send
+// the client back to.
 func (a *authRepository) LoginGoogleHandler(c *gin.Context) {
 	internalClient := c.Query("client_id")
 	redirectURI := c.Query("redirect_uri")
 	requestedScope := c.DefaultQuery("scope", "identity")
 	stateParam := c.Query("state")
+	challenge := c.Query("code_challenge")
+	method := c.Query("code_challenge_method")
 
 	if a.Config.ClientID == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": "Missing GOOGLE_CLIENT_ID environment variable",
-		})
+		utils.InternalServerError(c, "Missing GOOGLE_CLIENT_ID environment variable")
 		return
 	}
 
-	var platform string
-	switch {
-	case strings.HasPrefix(redirectURI, "exp://"):
-		platform = "mobile"
-	case redirectURI == a.Config.WebRedirect:
-		platform = "web"
-	default:
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid redirect_uri"})
+	if !a.redirectAllowed(redirectURI) {
+		utils.BadRequest(c, "Invalid redirect_uri")
 		return
 	}
 
 	if internalClient != "google" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client"})
+		utils.BadRequest(c, "Invalid client")
 		return
 	}
 
 	if stateParam == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid state"})
+		utils.BadRequest(c, "Invalid state")
 		return
 	}
 
-	// Construct state for round-trip
-	state := fmt.Sprintf("%s|%s", platform, stateParam)
+	if method != pkceS256 {
+		utils.BadRequest(c, "code_challenge_method must be S256")
+		return
+	}
+	if !pkceValue.MatchString(challenge) {
+		utils.BadRequest(c, "Invalid code_challenge")
+		return
+	}
+
+	state, providerChallenge, err := a.startOAuthState(c, redirectURI, stateParam, challenge, method)
+	if err != nil {
+		utils.InternalError(c, "Failed to start sign in", err)
+		return
+	}
 
 	query := url.Values{
-		"client_id":     {a.Config.ClientID},
-		"redirect_uri":  {a.Config.ServerURL + "/api/v1/auth/callback"},
-		"response_type": {"code"},
-		"scope":         {requestedScope},
-		"state":         {state},
-		"prompt":        {"select_account"},
+		"client_id":             {a.Config.ClientID},
+		"redirect_uri":          {a.Config.ServerURL + "/api/v1/auth/callback"},
+		"response_type":         {"code"},
+		"scope":                 {requestedScope},
+		"state":                 {state},
+		"code_challenge":        {providerChallenge},
+		"code_challenge_method": {pkceS256},
+		"prompt":                {"select_account"},
 	}.Encode()
 
 	googleURL := fmt.Sprintf("https://accounts.google.com/o/oauth2/auth?%s", query)
 	c.Redirect(http.StatusFound, googleURL)
 }
 
+// GoogleCallbackHandler receives the code from Google and hands it to the
+// client at the redirect URI it started with.
 func (a *authRepository) GoogleCallbackHandler(c *gin.Context) {
 	state := c.Query("state")
 	code := c.Query("code")
 
-	platform := "web"
-	originalState := ""
-	if split := strings.SplitN(state, "|", 2); len(split) == 2 {
-		platform, originalState = split[0], split[1]
+	if state == "" || (code == "" && c.Query("error") == "") {
+		utils.BadRequest(c, "Invalid callback")
+		return
 	}
 
-	var redirect string
-	if platform == "web" {
-		redirect = a.Config.WebRedirect
-	} else {
-		redirect = a.Config.AppScheme
+	// a denied or failed sign in still uses up the state
+	attached := code
+	if attached == "" {
+		attached, _ = newSecret()
 	}
-	redirect += "?code=" + url.QueryEscape(code) + "&state=" + url.QueryEscape(originalState)
-
-	c.Redirect(http.StatusFound, redirect)
-}
-
-func (a *authRepository) handleAccessTokenFallback(c *gin.Context, accessToken string, platform string) {
-	claims, err := DecodeToken(accessToken, a.Config.JWTSecret)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+	flow, err := a.attachOAuthCode(state, attached)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.BadRequest(c, "Invalid or expired state")
 		return
 	}
-
-	issuedAt := time.Now().Unix()
-	claims.RegisteredClaims.IssuedAt = jwt.NewNumericDate(time.Unix(issuedAt, 0))
-	claims.RegisteredClaims.ExpiresAt = jwt.NewNumericDate(time.Unix(int64(int(issuedAt)+a.Config.JWTExpirationSeconds), 0))
-
-	newAccessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(a.Config.JWTSecret))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reissue access token"})
+		utils.InternalError(c, "Failed to complete sign in", err)
 		return
 	}
 
-	if platform == "web" {
-		c.SetCookie(a.Config.CookieName, newAccessToken, a.Config.JWTExpirationSeconds, "/", "", false, true)
-		c.JSON(http.StatusOK, gin.H{
-			"success": true,
-			"warning": "Access token used as fallback",
-		})
-		return
+	query := url.Values{"state": {flow.ClientState}}
+	if code != "" {
+		query.Set("code", code)
+	} else {
+		query.Set("error", c.Query("error"))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"accessToken": newAccessToken,
-		"warning":     "Access token fallback",
-	})
+	separator := "?"
+	if strings.Contains(flow.RedirectUri, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, flow.RedirectUri+separator+query.Encode())
 }
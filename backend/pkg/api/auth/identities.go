@@ -0,0 +1,297 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+// Login providers a user_identities row can belong to.
+const (
+	providerGoogle = "google"
+	providerApple  = "apple"
+	providerEmail  = "email"
+)
+
+var errIdentityInUse = errors.New("identity belongs to another user")
+
+// identity is an account at a login provider, as vouched for by that provider.
+type identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Picture       string
+}
+
+// resolveUser finds the user an identity signs in as. An unknown identity is
+// linked to the user with the same verified email, so signing in with Apple
+// after Google lands in the same account, and otherwise gets a new user.
+func (a *authRepository) resolveUser(ident identity) (repository.GetUserRow, error) {
+	tx, err := a.DB.Begin(*a.Ctx)
+	if err != nil {
+		return repository.GetUserRow{}, err
+	}
+	defer tx.Rollback(*a.Ctx)
+	qtx := a.Repo.WithTx(tx)
+
+	userID, err := qtx.GetUserIdentity(*a.Ctx, repository.GetUserIdentityParams{
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+	})
+	switch {
+	case err == nil:
+		err = qtx.TouchUserIdentity(*a.Ctx, repository.TouchUserIdentityParams{
+			Email:    ident.Email,
+			Provider: ident.Provider,
+			Subject:  ident.Subject,
+		})
+		if err != nil {
+			return repository.GetUserRow{}, fmt.Errorf("touch identity: %w", err)
+		}
+		if ident.Picture != "" {
+			err = qtx.UpdateUserPicture(*a.Ctx, repository.UpdateUserPictureParams{ID: userID, Picture: ident.Picture})
+			if err != nil {
+				return repository.GetUserRow{}, fmt.Errorf("update picture: %w", err)
+			}
+		}
+
+	case errors.Is(err, pgx.ErrNoRows):
+		userID = uuid.Nil
+		if ident.EmailVerified && ident.Email != "" {
+			userID, err = qtx.GetUserByVerifiedEmail(*a.Ctx, ident.Email)
+			if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+				return repository.GetUserRow{}, fmt.Errorf("find user by email: %w", err)
+			}
+		}
+		if userID == uuid.Nil {
+			// an unverified address could be anyone's, so it is kept on the
+			// identity but not the user
+			email := ""
+			if ident.EmailVerified {
+				email = ident.Email
+			}
+			// users.sub is the subject of Civet's tokens, not the provider's
+			userID, err = qtx.CreateUser(*a.Ctx, repository.CreateUserParams{
+				Sub:           uuid.NewString(),
+				Email:         email,
+				Picture:       ident.Picture,
+				EmailVerified: ident.EmailVerified,
+			})
+			if err != nil {
+				return repository.GetUserRow{}, fmt.Errorf("create user: %w", err)
+			}
+		}
+		_, err = qtx.CreateUserIdentity(*a.Ctx, repository.CreateUserIdentityParams{
+			UserID:   userID,
+			Provider: ident.Provider,
+			Subject:  ident.Subject,
+			Email:    ident.Email,
+		})
+		if err != nil {
+			return repository.GetUserRow{}, fmt.Errorf("create identity: %w", err)
+		}
+
+	default:
+		return repository.GetUserRow{}, fmt.Errorf("get identity: %w", err)
+	}
+
+	// a name the user picked themselves is never replaced by the provider's
+	if ident.Name != "" {
+		err = qtx.SetUserNameIfEmpty(*a.Ctx, repository.SetUserNameIfEmptyParams{ID: userID, Name: ident.Name})
+		if err != nil {
+			return repository.GetUserRow{}, fmt.Errorf("set name: %w", err)
+		}
+	}
+
+	user, err := qtx.GetUser(*a.Ctx, userID)
+	if err != nil {
+		return repository.GetUserRow{}, fmt.Errorf("get user: %w", err)
+	}
+	return user, tx.Commit(*a.Ctx)
+}
+
+// linkIdentity adds an identity to a signed in user. Linking one that
+// already signs in as someone else fails with errIdentityInUse.
+func (a *authRepository) linkIdentity(userID uuid.UUID, ident identity) error {
+	owner, err := a.Repo.GetUserIdentity(*a.Ctx, repository.GetUserIdentityParams{
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+	})
+	if err == nil {
+		if owner != userID {
+			return errIdentityInUse
+		}
+		return nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	_, err = a.Repo.CreateUserIdentity(*a.Ctx, repository.CreateUserIdentityParams{
+		UserID:   userID,
+		Provider: ident.Provider,
+		Subject:  ident.Subject,
+		Email:    ident.Email,
+	})
+	return err
+}
+
+// signIn starts a session for user and responds with its tokens, as cookies
+// for the web and in the body for native clients.
+func (a *authRepository) signIn(c *gin.Context, platform string, user repository.GetUserRow, name string) {
+	if user.Name != "" {
+		name = user.Name
+	}
+	userInfo := map[string]string{
+		"sub":     user.Sub,
+		"name":    name,
+		"email":   user.Email,
+		"picture": user.Picture,
+	}
+
+	sessionPlatform := platform
+	if sessionPlatform != "web" {
+		sessionPlatform = "native"
+	}
+	accessToken, refreshToken, issuedAt, err := a.startSession(c, user.ID, user.Sub, sessionPlatform, userInfo)
+	if err != nil {
+		utils.InternalError(c, "Failed to generate internal tokens", err)
+		return
+	}
+
+	if platform == "web" {
+		if err := a.setSessionCookies(c, accessToken, refreshToken); err != nil {
+			utils.InternalError(c, "Failed to generate tokens", err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"issuedAt":  issuedAt,
+			"expiresAt": int(issuedAt) + a.Config.JWTExpirationSeconds,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"accessToken":  accessToken,
+		"refreshToken": refreshToken,
+	})
+}
+
+func (a *authRepository) ListIdentities(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	rows, err := a.Repo.ListUserIdentities(*a.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to list identities", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toIdentities(rows))
+}
+
+// LinkIdentity connects a Google or Apple account to the signed in user, with
+// the same credentials the provider's sign in endpoint takes.
+func (a *authRepository) LinkIdentity(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var ident identity
+	switch provider := c.Param("provider"); provider {
+	case providerGoogle:
+		ident, err = a.googleIdentity(c.PostForm("code"), c.PostForm("code_verifier"))
+	case providerApple:
+		ident, err = a.appleIdentity(c.PostForm("id_token"), c.PostForm("nonce"))
+	default:
+		utils.BadRequest(c, "provider must be google or apple")
+		return
+	}
+	if err != nil {
+		utils.Abort(c, utils.NewError(http.StatusUnauthorized, utils.CodeUnauthorized, "Invalid credentials").WithCause(err))
+		return
+	}
+
+	a.respondLinked(c, user.ID, ident)
+}
+
+func (a *authRepository) respondLinked(c *gin.Context, userID uuid.UUID, ident identity) {
+	err := a.linkIdentity(userID, ident)
+	if errors.Is(err, errIdentityInUse) {
+		utils.Conflict(c, "This account is already linked to another user")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to link identity", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"provider": ident.Provider, "email": ident.Email})
+}
+
+// UnlinkIdentity removes a login provider from the user. The last way to sign
+// in, counting passkeys, cannot be removed.
+func (a *authRepository) UnlinkIdentity(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	identityID, ok := utils.ParamUUID(c, "identity_id")
+	if !ok {
+		return
+	}
+
+	if !a.canRemoveLoginMethod(c, user.ID) {
+		return
+	}
+
+	n, err := a.Repo.DeleteUserIdentity(*a.Ctx, repository.DeleteUserIdentityParams{
+		ID:     identityID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to unlink identity", err)
+		return
+	}
+	if n == 0 {
+		utils.NotFound(c, "identity not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": identityID})
+}
+
+// canRemoveLoginMethod writes a 409 when the user has only one way left to sign in.
+func (a *authRepository) canRemoveLoginMethod(c *gin.Context, userID uuid.UUID) bool {
+	count, err := a.Repo.CountUserLoginMethods(*a.Ctx, userID)
+	if err != nil {
+		utils.InternalError(c, "failed to check login methods", err)
+		return false
+	}
+	if count <= 1 {
+		utils.Conflict(c, "Cannot remove the last way to sign in")
+		return false
+	}
+	return true
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+// newTestAuth connects to the database in TEST_DATABASE_URL, migrated to the
+// latest schema. The tests only add rows with random subjects and emails, so
+// any scratch database will do.
+func newTestAuth(t *testing.T) *authRepository {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	m, err := migrate.New("file://../../../db/migrations", url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatal(err)
+	}
+	m.Close()
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	return &authRepository{DB: pool, Repo: repository.New(pool), Ctx: &ctx}
+}
+
+func TestResolveUserNewAccounts(t *testing.T) {
+	a := newTestAuth(t)
+	email := uuid.NewString() + "@example.com"
+
+	owner, err := a.resolveUser(identity{Provider: providerGoogle, Subject: uuid.NewString(), Email: email, EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		ident identity
+	}{
+		{"unverified copy of a taken email", identity{Provider: providerApple, Subject: uuid.NewString(), Email: email}},
+		{"no email", identity{Provider: providerApple, Subject: uuid.NewString()}},
+		{"another account with no email", identity{Provider: providerApple, Subject: uuid.NewString()}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user, err := a.resolveUser(tt.ident)
+			if err != nil {
+				t.Fatalf("resolveUser: %v", err)
+			}
+			if user.ID == owner.ID {
+				t.Error("signed in as the owner of the email")
+			}
+		})
+	}
+}
+
+func TestResolveUserLinksVerifiedEmail(t *testing.T) {
+	a := newTestAuth(t)
+	email := uuid.NewString() + "@example.com"
+
+	google, err := a.resolveUser(identity{Provider: providerGoogle, Subject: uuid.NewString(), Email: email, EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	apple, err := a.resolveUser(identity{Provider: providerApple, Subject: uuid.NewString(), Email: email, EmailVerified: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apple.ID != google.ID {
+		t.Error("a verified email did not link to the existing user")
+	}
+}
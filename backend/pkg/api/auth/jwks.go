@@ -0,0 +1,15 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWKS publishes the public signing keys so other services can verify
+// Civet's tokens. The set already holds the next key an hour before it signs
+// anything, so a few minutes of caching is safe.
+func (a *authRepository) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, a.Tokens.JWKS())
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+// oauthStateTTL bounds the whole round trip through Google, from the login
+// redirect to the client exchanging its code.
+const oauthStateTTL = 10 * time.Minute
+
+// pkceS256 is the only PKCE method accepted; a plain challenge is the
+// verifier itself and protects nothing once the authorize URL leaks.
+const pkceS256 = "S256"
+
+var (
+	errUnknownCode     = errors.New("unknown or expired authorization code")
+	errInvalidVerifier = errors.New("code_verifier does not match code_challenge")
+
+	// RFC 7636 section 4.1, also the format of an S256 challenge
+	pkceValue = regexp.MustCompile(`^[A-Za-z0-9._~-]{43,128}$`)
+)
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// redirectAllowed reports whether uri is one of the configured OAuth
+// redirect URIs. Only exact matches count.
+func (a *authRepository) redirectAllowed(uri string) bool {
+	for _, allowed := range a.Config.OAuthRedirectURIs {
+		if uri == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// startOAuthState records a sign in attempt and returns the state to send to
+// Google along with the PKCE challenge for our own leg of the flow. The
+// client's challenge must be answered when it exchanges the code it gets
+// back.
+func (a *authRepository) startOAuthState(c *gin.Context, redirectURI, clientState, challenge, method string) (state, providerChallenge string, err error) {
+	state, err = newSecret()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := newSecret()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = a.Repo.CreateOAuthState(*a.Ctx, repository.CreateOAuthStateParams{
+		StateHash:           hashSecret(state),
+		RedirectUri:         redirectURI,
+		ClientState:         clientState,
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: method,
+		ProviderVerifier:    verifier,
+		ExpiresAt:           pgtype.Timestamptz{Time: time.Now().Add(oauthStateTTL), Valid: true},
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("store oauth state: %w", err)
+	}
+
+	if _, err := a.Repo.DeleteExpiredOAuthStates(*a.Ctx); err != nil {
+		utils.Logger(c).Warn("failed to delete expired oauth states", zap.Error(err))
+	}
+	return state, pkceChallenge(verifier), nil
+}
+
+// attachOAuthCode ties the code Google returned to the state it came back
+// with. A state can only be used once.
+func (a *authRepository) attachOAuthCode(state, code string) (repository.AttachOAuthCodeRow, error) {
+	return a.Repo.AttachOAuthCode(*a.Ctx, repository.AttachOAuthCodeParams{
+		StateHash: hashSecret(state),
+		CodeHash:  hashSecret(code),
+	})
+}
+
+// consumeOAuthCode checks the client's code_verifier and returns the verifier
+// Google expects for the code.
+func (a *authRepository) consumeOAuthCode(code, codeVerifier string) (string, error) {
+	row, err := a.Repo.ConsumeOAuthCode(*a.Ctx, hashSecret(code))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", errUnknownCode
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if row.CodeChallenge == "" || row.CodeChallengeMethod != pkceS256 || codeVerifier == "" ||
+		subtle.ConstantTimeCompare([]byte(pkceChallenge(codeVerifier)), []byte(row.CodeChallenge)) != 1 {
+		return "", errInvalidVerifier
+	}
+	return row.ProviderVerifier, nil
+}
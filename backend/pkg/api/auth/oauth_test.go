@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+func TestLoginGoogleRequiresS256(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	a := &authRepository{Config: &config.Config{
+		ClientID:          "client",
+		OAuthRedirectURIs: []string{"civet://"},
+	}}
+	challenge := pkceChallenge("verifier")
+
+	tests := []struct {
+		name   string
+		params url.Values
+	}{
+		{"no challenge", url.Values{}},
+		{"plain", url.Values{"code_challenge": {challenge}, "code_challenge_method": {"plain"}}},
+		{"no method", url.Values{"code_challenge": {challenge}}},
+		{"malformed challenge", url.Values{"code_challenge": {"short"}, "code_challenge_method": {pkceS256}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.params.Set("client_id", "google")
+			tt.params.Set("redirect_uri", "civet://")
+			tt.params.Set("state", "state")
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/auth/login/google?"+tt.params.Encode(), nil)
+			a.LoginGoogleHandler(c)
+
+			if len(c.Errors) == 0 {
+				t.Fatal("request was not rejected")
+			}
+			if err := utils.AsError(c.Errors.Last()); err.Status != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", err.Status, http.StatusBadRequest)
+			}
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/webauthn"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+const passkeyTimeout = 5 * time.Minute
+
+// decodeBase64URL accepts the unpadded base64url WebAuthn uses, and padded
+// input from clients that add it.
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// StartPasskeyRegistration returns the options for navigator.credentials.create
+// to add a passkey to the signed in user.
+func (a *authRepository) StartPasskeyRegistration(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	existing, err := a.Repo.ListWebauthnCredentials(*a.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to start passkey registration", err)
+		return
+	}
+
+	challenge, err := a.issueChallenge(challengePasskeyRegister, "", &user.ID, passkeyTimeout)
+	if err != nil {
+		utils.InternalError(c, "failed to start passkey registration", err)
+		return
+	}
+
+	options := PasskeyCreationOptions{
+		Challenge: challenge,
+		RP:        PasskeyRP{ID: a.RP.ID, Name: a.RP.Name},
+		User: PasskeyUser{
+			ID:          encodeBase64URL(user.ID[:]),
+			Name:        user.Email,
+			DisplayName: user.Email,
+		},
+		Timeout:     passkeyTimeout.Milliseconds(),
+		Attestation: "none",
+		AuthenticatorSelection: PasskeyAuthenticatorSelection{
+			ResidentKey:      "required",
+			UserVerification: "preferred",
+		},
+		ExcludeCredentials: []PasskeyDescriptor{},
+	}
+	for _, alg := range webauthn.SupportedAlgorithms {
+		options.PubKeyCredParams = append(options.PubKeyCredParams, PasskeyParam{Type: "public-key", Alg: alg})
+	}
+	for _, cred := range existing {
+		options.ExcludeCredentials = append(options.ExcludeCredentials, PasskeyDescriptor{
+			Type:       "public-key",
+			ID:         encodeBase64URL(cred.ID),
+			Transports: cred.Transports,
+		})
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// FinishPasskeyRegistration stores the credential created from
+// StartPasskeyRegistration's options.
+func (a *authRepository) FinishPasskeyRegistration(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body PasskeyRegistrationInput
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+	clientData, err1 := decodeBase64URL(body.Response.ClientDataJSON)
+	attestation, err2 := decodeBase64URL(body.Response.AttestationObject)
+	if err1 != nil || err2 != nil {
+		utils.BadRequest(c, "invalid passkey registration")
+		return
+	}
+
+	reg, err := a.RP.ParseRegistration(clientData, attestation)
+	if err != nil {
+		utils.Abort(c, utils.NewError(http.StatusBadRequest, utils.CodeBadRequest, "invalid passkey registration").WithCause(err))
+		return
+	}
+
+	row, ok, err := a.consumeChallenge(challengePasskeyRegister, reg.Challenge)
+	if err != nil {
+		utils.InternalError(c, "failed to register passkey", err)
+		return
+	}
+	if !ok || row.UserID == nil || *row.UserID != user.ID {
+		utils.Unauthorized(c, "Passkey challenge is invalid or expired")
+		return
+	}
+
+	transports := body.Response.Transports
+	if transports == nil {
+		transports = []string{}
+	}
+	err = a.Repo.CreateWebauthnCredential(*a.Ctx, repository.CreateWebauthnCredentialParams{
+		ID:         reg.CredentialID,
+		UserID:     user.ID,
+		PublicKey:  reg.PublicKey,
+		SignCount:  int64(reg.SignCount),
+		Transports: transports,
+		Name:       body.Name,
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to register passkey", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": encodeBase64URL(reg.CredentialID)})
+}
+
+// StartPasskeyLogin returns the options for navigator.credentials.get. No
+// credentials are listed, the authenticator offers its discoverable passkeys.
+func (a *authRepository) StartPasskeyLogin(c *gin.Context) {
+	challenge, err := a.issueChallenge(challengePasskeyLogin, "", nil, passkeyTimeout)
+	if err != nil {
+		utils.InternalError(c, "failed to start passkey sign in", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PasskeyRequestOptions{
+		Challenge:        challenge,
+		RPID:             a.RP.ID,
+		Timeout:          passkeyTimeout.Milliseconds(),
+		UserVerification: "preferred",
+		AllowCredentials: []PasskeyDescriptor{},
+	})
+}
+
+// FinishPasskeyLogin verifies a passkey assertion and starts a session for
+// the credential's owner.
+func (a *authRepository) FinishPasskeyLogin(c *gin.Context) {
+	var body PasskeyLoginInput
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+	credentialID, err1 := decodeBase64URL(body.RawID)
+	clientData, err2 := decodeBase64URL(body.Response.ClientDataJSON)
+	authData, err3 := decodeBase64URL(body.Response.AuthenticatorData)
+	signature, err4 := decodeBase64URL(body.Response.Signature)
+	userHandle, err5 := decodeBase64URL(body.Response.UserHandle)
+	if err := errors.Join(err1, err2, err3, err4, err5); err != nil {
+		utils.BadRequest(c, "invalid passkey sign in")
+		return
+	}
+
+	assertion, err := a.RP.ParseAssertion(clientData, authData, signature)
+	if err != nil {
+		utils.Abort(c, utils.NewError(http.StatusUnauthorized, utils.CodeUnauthorized, "Invalid passkey").WithCause(err))
+		return
+	}
+
+	if _, ok, err := a.consumeChallenge(challengePasskeyLogin, assertion.Challenge); err != nil {
+		utils.InternalError(c, "failed to sign in with passkey", err)
+		return
+	} else if !ok {
+		utils.Unauthorized(c, "Passkey challenge is invalid or expired")
+		return
+	}
+
+	cred, err := a.Repo.GetWebauthnCredential(*a.Ctx, credentialID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.Unauthorized(c, "Unknown passkey")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to sign in with passkey", err)
+		return
+	}
+	if len(userHandle) > 0 && string(userHandle) != string(cred.UserID[:]) {
+		utils.Unauthorized(c, "Invalid passkey")
+		return
+	}
+
+	if err := assertion.Verify(cred.PublicKey, uint32(cred.SignCount)); err != nil {
+		if errors.Is(err, webauthn.ErrCloned) {
+			utils.Logger(c).Warn("passkey may be cloned",
+				zap.String("credential_id", encodeBase64URL(cred.ID)),
+				zap.Stringer("user_id", cred.UserID))
+		}
+		utils.Unauthorized(c, "Invalid passkey")
+		return
+	}
+
+	err = a.Repo.UpdateWebauthnSignCount(*a.Ctx, repository.UpdateWebauthnSignCountParams{
+		ID:        cred.ID,
+		SignCount: int64(assertion.SignCount),
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to sign in with passkey", err)
+		return
+	}
+
+	user, err := a.Repo.GetUser(*a.Ctx, cred.UserID)
+	if err != nil {
+		utils.InternalError(c, "failed to sign in with passkey", err)
+		return
+	}
+
+	platform := body.Platform
+	if platform == "" {
+		platform = "native"
+	}
+	a.signIn(c, platform, user, "")
+}
+
+func (a *authRepository) ListPasskeys(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	rows, err := a.Repo.ListWebauthnCredentials(*a.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to list passkeys", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toPasskeys(rows))
+}
+
+// DeletePasskey removes one of the user's passkeys, unless it is their last
+// way to sign in.
+func (a *authRepository) DeletePasskey(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	credentialID, err := decodeBase64URL(c.Param("credential_id"))
+	if err != nil {
+		utils.BadRequest(c, "invalid passkey id")
+		return
+	}
+
+	if !a.canRemoveLoginMethod(c, user.ID) {
+		return
+	}
+
+	n, err := a.Repo.DeleteWebauthnCredential(*a.Ctx, repository.DeleteWebauthnCredentialParams{
+		ID:     credentialID,
+		UserID: user.ID,
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to delete passkey", err)
+		return
+	}
+	if n == 0 {
+		utils.NotFound(c, "passkey not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": c.Param("credential_id")})
+}
@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+// Reasons a session was revoked. Replayed refresh tokens are revoked as
+// "reuse" by RevokeReusedSession.
+const (
+	revokedLogout = "logout"
+	revokedByUser = "revoked"
+)
+
+func (a *authRepository) refreshExpiresAt() pgtype.Timestamptz {
+	return pgtype.Timestamptz{
+		Time:  time.Now().Add(time.Duration(a.Config.RefreshExpiration) * time.Second),
+		Valid: true,
+	}
+}
+
+// startSession records a newly signed in device and issues its first token pair.
+func (a *authRepository) startSession(c *gin.Context, userID uuid.UUID, sub, platform string, userInfo map[string]string) (accessToken, refreshToken string, issuedAt int64, err error) {
+	tokenID := uuid.New()
+	sessionID, err := a.Repo.CreateSession(*a.Ctx, repository.CreateSessionParams{
+		UserID:         userID,
+		RefreshTokenID: tokenID,
+		Platform:       platform,
+		UserAgent:      c.Request.UserAgent(),
+		IpAddress:      c.ClientIP(),
+		ExpiresAt:      a.refreshExpiresAt(),
+	})
+	if err != nil {
+		return "", "", 0, fmt.Errorf("create session: %w", err)
+	}
+
+	return a.generateTokens(sub, sessionID, tokenID, userInfo)
+}
+
+// rotateSession swaps the session's refresh token for a new one. ok is false
+// when the presented token is not the current one. A token that was already
+// rotated out means it has been replayed, by an attacker or by the owner
+// after the attacker refreshed first, so the whole session is revoked.
+func (a *authRepository) rotateSession(c *gin.Context, sessionID, tokenID uuid.UUID) (newTokenID uuid.UUID, ok bool, err error) {
+	newTokenID = uuid.New()
+	n, err := a.Repo.RotateSession(*a.Ctx, repository.RotateSessionParams{
+		NewRefreshTokenID: newTokenID,
+		ExpiresAt:         a.refreshExpiresAt(),
+		ID:                sessionID,
+		RefreshTokenID:    tokenID,
+	})
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	if n > 0 {
+		return newTokenID, true, nil
+	}
+
+	revoked, err := a.Repo.RevokeReusedSession(*a.Ctx, repository.RevokeReusedSessionParams{
+		ID:             sessionID,
+		RefreshTokenID: tokenID,
+	})
+	if err != nil {
+		return uuid.Nil, false, err
+	}
+	if revoked > 0 {
+		utils.Logger(c).Warn("refresh token reuse detected, revoked session", zap.Stringer("session_id", sessionID))
+	}
+	return uuid.Nil, false, nil
+}
+
+func (a *authRepository) clearCookies(c *gin.Context) {
+	for _, name := range []string{a.Config.CookieName, a.Config.RefreshCookieName, a.Config.CSRFCookieName} {
+		http.SetCookie(c.Writer, BuildCookie(name, "", -1, a.Config.CookieSecure))
+	}
+}
+
+// Logout revokes the session the request was made with, so its refresh token
+// stops working and its access token is rejected.
+func (a *authRepository) Logout(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	if sessionID, ok := GetSessionID(c); ok {
+		_, err := a.Repo.RevokeSession(*a.Ctx, repository.RevokeSessionParams{
+			ID:            sessionID,
+			UserID:        user.ID,
+			RevokedReason: pgtype.Text{String: revokedLogout, Valid: true},
+		})
+		if err != nil {
+			utils.InternalError(c, "failed to log out", err)
+			return
+		}
+	}
+
+	a.clearCookies(c)
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func (a *authRepository) ListSessions(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	rows, err := a.Repo.ListActiveSessions(*a.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to list sessions", err)
+		return
+	}
+
+	current, _ := GetSessionID(c)
+	c.JSON(http.StatusOK, toSessions(rows, current))
+}
+
+// RevokeSession signs out one of the user's devices.
+func (a *authRepository) RevokeSession(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	sessionID, ok := utils.ParamUUID(c, "session_id")
+	if !ok {
+		return
+	}
+
+	n, err := a.Repo.RevokeSession(*a.Ctx, repository.RevokeSessionParams{
+		ID:            sessionID,
+		UserID:        user.ID,
+		RevokedReason: pgtype.Text{String: revokedByUser, Valid: true},
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to revoke session", err)
+		return
+	}
+	if n == 0 {
+		utils.NotFound(c, "session not found")
+		return
+	}
+
+	if current, ok := GetSessionID(c); ok && current == sessionID {
+		a.clearCookies(c)
+	}
+	c.JSON(http.StatusOK, gin.H{"id": sessionID})
+}
+
+// RevokeOtherSessions signs out every device except the one making the request.
+func (a *authRepository) RevokeOtherSessions(c *gin.Context) {
+	user, err := GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	current, _ := GetSessionID(c)
+	n, err := a.Repo.RevokeOtherSessions(*a.Ctx, repository.RevokeOtherSessionsParams{
+		UserID:        user.ID,
+		ID:            current,
+		RevokedReason: pgtype.Text{String: revokedByUser, Valid: true},
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to revoke sessions", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
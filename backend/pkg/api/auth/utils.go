@@ -4,6 +4,7 @@ import (
 	"errors"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/sharithg/civet/internal/repository"
 )
 
@@ -20,3 +21,32 @@ func GetUser(c *gin.Context) (repository.GetUserBySubRow, error) {
 
 	return user, nil
 }
+
+// GetSessionID returns the session of the access token the request was made
+// with. Tokens issued before sessions existed have none.
+func GetSessionID(c *gin.Context) (uuid.UUID, bool) {
+	id, ok := c.Get("sessionID")
+	if !ok {
+		return uuid.Nil, false
+	}
+	sessionID, ok := id.(uuid.UUID)
+	return sessionID, ok
+}
+
+// Guest is who a guest token acts as: one friend of one outing, through the
+// invite it was exchanged for.
+type Guest struct {
+	InviteID uuid.UUID
+	FriendID uuid.UUID
+	OutingID uuid.UUID
+}
+
+// GetGuest returns the guest set by GuestAuth.
+func GetGuest(c *gin.Context) (Guest, bool) {
+	raw, ok := c.Get("guest")
+	if !ok {
+		return Guest{}, false
+	}
+	guest, ok := raw.(Guest)
+	return guest, ok
+}
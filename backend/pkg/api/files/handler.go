@@ -0,0 +1,47 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type filesRepository struct {
+	Storage *storage.Filesystem
+	Ctx     *context.Context
+}
+
+func New(storage *storage.Filesystem, ctx *context.Context) *filesRepository {
+	return &filesRepository{Storage: storage, Ctx: ctx}
+}
+
+// Serve streams an object from filesystem storage. It stands in for the
+// object server of the S3 backend, so like a presigned S3 URL it needs no
+// session, only the expiry and signature that Presign put in the query.
+func (f *filesRepository) Serve(c *gin.Context) {
+	bucket := c.Param("bucket")
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	if !f.Storage.Verify(bucket, key, c.Query("expires"), c.Query("signature")) {
+		utils.Forbidden(c, "invalid or expired signature")
+		return
+	}
+
+	body, info, err := f.Storage.Get(*f.Ctx, bucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.NotFound(c, "object not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to read object", err)
+		return
+	}
+	defer body.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, body, nil)
+}
@@ -4,5 +4,6 @@ type FriendsResponse struct {
 	Name       string `json:"name"`
 	Subtotal   int64  `json:"subtotal"`
 	TaxPortion int32  `json:"tax_portion"`
+	FeePortion int32  `json:"fee_portion"`
 	TotalOwed  int32  `json:"total_owed"`
 }
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/receipt"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/pkg/api/utils"
 )
@@ -41,20 +43,102 @@ func toOutingReceiptsResponse(receipts []repository.GetReceiptsForOutingRow) []G
 	return rec
 }
 
+type DeleteOutingResponse struct {
+	ID           uuid.UUID `json:"id"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	RestoreUntil time.Time `json:"restore_until"`
+}
+
 type Friend struct {
 	ID   uuid.UUID `json:"id"`
 	Name string    `json:"name"`
 }
 
+// FriendShare is what a friend owes for one receipt of the outing.
+type FriendShare struct {
+	FriendID   uuid.UUID `json:"friend_id"`
+	ReceiptID  uuid.UUID `json:"receipt_id"`
+	Name       string    `json:"name"`
+	Subtotal   float64   `json:"subtotal"`
+	TaxPortion float64   `json:"tax_portion"`
+	FeePortion float64   `json:"fee_portion"`
+	TipPortion float64   `json:"tip_portion"`
+	TotalOwed  float64   `json:"total_owed"`
+}
+
+func toFriendShares(rows []repository.GetFriendsForOutingRow) []FriendShare {
+	shares := make([]FriendShare, 0, len(rows))
+	for _, row := range rows {
+		bill := receipt.Bill{
+			Subtotal:        row.ReceiptSubtotal,
+			TaxableSubtotal: row.ReceiptTaxableSubtotal,
+			Discount:        row.Discount,
+			Fees:            row.Fees,
+			TaxableFees:     row.TaxableFees,
+			Tax:             row.SalesTax,
+			Tip:             row.Tip,
+		}
+		share := bill.Share(receipt.Claim{
+			Subtotal:        row.Subtotal,
+			TaxableSubtotal: row.TaxableSubtotal,
+		})
+		shares = append(shares, FriendShare{
+			FriendID:   row.FriendID,
+			ReceiptID:  row.ReceiptID,
+			Name:       row.Name,
+			Subtotal:   share.Subtotal,
+			TaxPortion: share.Tax,
+			FeePortion: share.Fees,
+			TipPortion: share.Tip,
+			TotalOwed:  share.Total,
+		})
+	}
+	return shares
+}
+
 type Outing struct {
 	ID            uuid.UUID `json:"id"`
 	Name          string    `json:"name"`
 	CreatedAt     time.Time `json:"created_at"`
 	Status        string    `json:"status"`
+	Date          *string   `json:"date"`
+	Location      string    `json:"location"`
 	Friends       []Friend  `json:"friends"`
 	TotalReceipts int64     `json:"total_receipts"`
 }
 
+type OutingDetails struct {
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Status    string    `json:"status"`
+	Date      *string   `json:"date"`
+	Location  string    `json:"location"`
+	Timezone  string    `json:"timezone"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func formatDate(d pgtype.Date) *string {
+	if !d.Valid {
+		return nil
+	}
+	s := d.Time.Format(time.DateOnly)
+	return &s
+}
+
+func toOutingDetails(outing repository.Outing) OutingDetails {
+	return OutingDetails{
+		ID:        outing.ID,
+		Name:      outing.Name,
+		Status:    outing.Status,
+		Date:      formatDate(outing.Date),
+		Location:  outing.Location,
+		Timezone:  outing.Timezone,
+		CreatedAt: outing.CreatedAt.Time,
+		UpdatedAt: outing.UpdatedAt.Time,
+	}
+}
+
 func toOutingsResponse(outings []repository.GetOutingsRow) ([]Outing, error) {
 	var outingsResp []Outing
 
@@ -70,6 +154,8 @@ func toOutingsResponse(outings []repository.GetOutingsRow) ([]Outing, error) {
 			Name:          outing.Name,
 			CreatedAt:     outing.CreatedAt.Time,
 			Status:        outing.Status,
+			Date:          formatDate(outing.Date),
+			Location:      outing.Location,
 			TotalReceipts: outing.TotalReceipts,
 			Friends:       friends,
 		})
@@ -2,27 +2,77 @@ package outing
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/outingstatus"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/pkg/api/auth"
 	"github.com/sharithg/civet/pkg/api/utils"
 )
 
 type Repository struct {
-	Repo *repository.Queries
-	Ctx  *context.Context
+	Repo   *repository.Queries
+	Ctx    *context.Context
+	Config *config.Config
 }
 
-func New(repo *repository.Queries, ctx *context.Context) *Repository {
-	return &Repository{Repo: repo, Ctx: ctx}
+func New(repo *repository.Queries, ctx *context.Context, config *config.Config) *Repository {
+	return &Repository{Repo: repo, Ctx: ctx, Config: config}
 }
 
 type CreateOutingRequest struct {
-	Name string `json:"name" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Timezone string `json:"timezone"`
+	Status   string `json:"status"`
+	Date     string `json:"date"`
+	Location string `json:"location"`
+}
+
+type UpdateOutingRequest struct {
+	Name     *string `json:"name"`
+	Date     *string `json:"date"`
+	Location *string `json:"location"`
+}
+
+type UpdateStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// outingsCursor is the sort key of the last outing on a page. Sort and Order
+// are kept so a cursor cannot be replayed against a different ordering.
+type outingsCursor struct {
+	Sort      string      `json:"s"`
+	Order     string      `json:"o"`
+	ID        uuid.UUID   `json:"id"`
+	Name      string      `json:"n,omitempty"`
+	Date      pgtype.Date `json:"d"`
+	CreatedAt time.Time   `json:"t"`
+}
+
+type receiptsCursor struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"t"`
+}
+
+type friendsCursor struct {
+	Name      string    `json:"n"`
+	FriendID  uuid.UUID `json:"f"`
+	ReceiptID uuid.UUID `json:"r"`
 }
 
 func (r *Repository) CreateOuting(c *gin.Context) {
@@ -30,37 +80,165 @@ func (r *Repository) CreateOuting(c *gin.Context) {
 	user, err := auth.GetUser(c)
 
 	if err != nil {
-		fmt.Println("err: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "getting user"})
+		utils.BadRequest(c, "getting user")
 		return
 	}
 
 	var body CreateOutingRequest
-	if err := c.ShouldBindJSON(&body); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	if body.Timezone != "" {
+		if _, err := time.LoadLocation(body.Timezone); err != nil {
+			utils.BadRequest(c, "Invalid timezone")
+			return
+		}
+	}
+
+	status := body.Status
+	if status == "" {
+		status = outingstatus.Active
+	}
+	if status != outingstatus.Draft && status != outingstatus.Active {
+		utils.BadRequest(c, "New outings must be draft or active")
+		return
+	}
+
+	date, err := utils.ParseDate(body.Date)
+	if err != nil {
+		utils.BadRequest(c, "Invalid date, expected YYYY-MM-DD")
 		return
 	}
 
 	id, err := r.Repo.CreateNewOuting(*r.Ctx, repository.CreateNewOutingParams{
-		Name:   body.Name,
-		UserID: user.ID,
-		Status: "active",
+		Name:     body.Name,
+		UserID:   user.ID,
+		Status:   status,
+		Timezone: body.Timezone,
+		Date:     date,
+		Location: body.Location,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create outing"})
+		utils.InternalServerError(c, "Failed to create outing")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"id": id})
 }
 
+// GetOutings lists the outings the user created or was added to as a friend,
+// optionally filtered by a comma separated status list and a from/to date
+// range, sorted by created_at, name or date. Pages are
+// fetched with the cursor from the X-Next-Cursor header; the total number of
+// matching outings is returned in X-Total-Count.
 func (r *Repository) GetOutings(c *gin.Context) {
-	outings, err := r.Repo.GetOutings(*r.Ctx)
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var statuses []string
+	if raw := c.Query("status"); raw != "" {
+		for _, status := range strings.Split(raw, ",") {
+			status = strings.TrimSpace(status)
+			if !outingstatus.Valid(status) {
+				utils.BadRequest(c, fmt.Sprintf("invalid status %q", status))
+				return
+			}
+			statuses = append(statuses, status)
+		}
+	}
+	if statuses == nil {
+		statuses = []string{}
+	}
+
+	sort := c.DefaultQuery("sort", "created_at")
+	if sort != "created_at" && sort != "name" && sort != "date" {
+		utils.BadRequest(c, "sort must be created_at, name or date")
+		return
+	}
+
+	order := c.DefaultQuery("order", "desc")
+	if order != "asc" && order != "desc" {
+		utils.BadRequest(c, "order must be asc or desc")
+		return
+	}
+
+	limit, ok := utils.PageLimit(c, defaultPageLimit, maxPageLimit)
+	if !ok {
+		return
+	}
+
+	from, to, ok := utils.DateRange(c)
+	if !ok {
+		return
+	}
+
+	params := repository.GetOutingsParams{
+		UserID:     user.ID,
+		Statuses:   statuses,
+		DateFrom:   from,
+		DateTo:     to,
+		Sort:       sort,
+		Descending: order == "desc",
+		PageLimit:  limit + 1,
+	}
+
+	var cursor outingsCursor
+	if !utils.ReadCursor(c, &cursor) {
+		return
+	}
+	if cursor.ID != uuid.Nil {
+		if cursor.Sort != sort || cursor.Order != order {
+			utils.BadRequest(c, "cursor does not match sort and order")
+			return
+		}
+		params.CursorID = &cursor.ID
+		params.CursorName = cursor.Name
+		params.CursorDate = cursor.Date
+		params.CursorTime = pgtype.Timestamptz{Time: cursor.CreatedAt, Valid: true}
+	}
+
+	outings, err := r.Repo.GetOutings(*r.Ctx, params)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to fetch outings")
+		return
+	}
+
+	total, err := r.Repo.CountOutings(*r.Ctx, repository.CountOutingsParams{
+		UserID:   user.ID,
+		Statuses: statuses,
+		DateFrom: from,
+		DateTo:   to,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch outings"})
+		utils.InternalServerError(c, "Failed to fetch outings")
 		return
 	}
 
+	if len(outings) > int(limit) {
+		outings = outings[:limit]
+		last := outings[len(outings)-1]
+		next := outingsCursor{
+			Sort:      sort,
+			Order:     order,
+			ID:        last.ID,
+			Name:      last.Name,
+			Date:      last.Date,
+			CreatedAt: last.CreatedAt.Time,
+		}
+		// outings without a date sort last, matching the coalesce in the query
+		if !next.Date.Valid {
+			next.Date = pgtype.Date{InfinityModifier: pgtype.Infinity, Valid: true}
+			if order == "desc" {
+				next.Date.InfinityModifier = pgtype.NegativeInfinity
+			}
+		}
+		c.Header(utils.NextCursorHeader, utils.EncodeCursor(next))
+	}
+
 	outingsResp, err := toOutingsResponse(outings)
 
 	if err != nil {
@@ -68,37 +246,328 @@ func (r *Repository) GetOutings(c *gin.Context) {
 		return
 	}
 
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
 	c.JSON(http.StatusOK, outingsResp)
 }
 
-func (r *Repository) GetReceipts(c *gin.Context) {
-	outingIDStr := c.Param("outing_id")
-	outingID, err := uuid.Parse(outingIDStr)
+// ownedOuting loads an outing the current user created, writing the error
+// response and returning false if there is none.
+func (r *Repository) ownedOuting(c *gin.Context) (repository.Outing, bool) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return repository.Outing{}, false
+	}
+
+	outingID, ok := utils.ParamUUID(c, "outing_id")
+	if !ok {
+		return repository.Outing{}, false
+	}
+
+	outing, err := r.Repo.GetOuting(*r.Ctx, outingID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && outing.UserID != user.ID) {
+		utils.NotFound(c, "outing not found")
+		return repository.Outing{}, false
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outing ID"})
+		utils.InternalError(c, "Failed to fetch outing", err)
+		return repository.Outing{}, false
+	}
+
+	return outing, true
+}
+
+// outingMember resolves :outing_id for its owner, one of its friends with an
+// account, or a guest invited to it, writing a 404 for anyone else.
+func (r *Repository) outingMember(c *gin.Context) (uuid.UUID, bool) {
+	outingID, ok := utils.ParamUUID(c, "outing_id")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	if guest, ok := auth.GetGuest(c); ok {
+		if guest.OutingID != outingID {
+			utils.NotFound(c, "outing not found")
+			return uuid.Nil, false
+		}
+		return outingID, true
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return uuid.Nil, false
+	}
+
+	outing, err := r.Repo.GetOuting(*r.Ctx, outingID)
+	if err == nil && outing.UserID == user.ID {
+		return outingID, true
+	}
+	if err == nil {
+		_, err = r.Repo.GetOutingFriendForUser(*r.Ctx, repository.GetOutingFriendForUserParams{
+			OutingID: outingID,
+			UserID:   &user.ID,
+		})
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "outing not found")
+		return uuid.Nil, false
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to fetch outing", err)
+		return uuid.Nil, false
+	}
+	return outingID, true
+}
+
+func (r *Repository) UpdateOuting(c *gin.Context) {
+	outing, ok := r.ownedOuting(c)
+	if !ok {
 		return
 	}
 
-	receipts, err := r.Repo.GetReceiptsForOuting(*r.Ctx, outingID)
+	var body UpdateOutingRequest
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	if outing.Status == outingstatus.Archived {
+		utils.Conflict(c, "archived outings must be reopened before editing")
+		return
+	}
+
+	params := repository.UpdateOutingDetailsParams{
+		ID:       outing.ID,
+		Name:     outing.Name,
+		Date:     outing.Date,
+		Location: outing.Location,
+	}
+	if body.Name != nil {
+		if strings.TrimSpace(*body.Name) == "" {
+			utils.BadRequest(c, "name must not be empty")
+			return
+		}
+		params.Name = *body.Name
+	}
+	if body.Date != nil {
+		date, err := utils.ParseDate(*body.Date)
+		if err != nil {
+			utils.BadRequest(c, "Invalid date, expected YYYY-MM-DD")
+			return
+		}
+		params.Date = date
+	}
+	if body.Location != nil {
+		params.Location = *body.Location
+	}
+
+	if err := r.Repo.UpdateOutingDetails(*r.Ctx, params); err != nil {
+		utils.InternalError(c, "Failed to update outing", err)
+		return
+	}
+
+	outing.Name, outing.Date, outing.Location = params.Name, params.Date, params.Location
+	c.JSON(http.StatusOK, toOutingDetails(outing))
+}
+
+// UpdateStatus moves an outing through its lifecycle. Only the transitions in
+// the status state machine are allowed; anything else is a 409.
+func (r *Repository) UpdateStatus(c *gin.Context) {
+	outing, ok := r.ownedOuting(c)
+	if !ok {
+		return
+	}
+
+	var body UpdateStatusRequest
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	if !outingstatus.Valid(body.Status) {
+		utils.BadRequest(c, fmt.Sprintf("invalid status %q", body.Status))
+		return
+	}
+	if !outingstatus.CanTransition(outing.Status, body.Status) {
+		utils.Conflict(c, fmt.Sprintf("cannot move outing from %s to %s", outing.Status, body.Status))
+		return
+	}
+
+	n, err := r.Repo.UpdateOutingStatus(*r.Ctx, repository.UpdateOutingStatusParams{
+		Status:     body.Status,
+		ID:         outing.ID,
+		FromStatus: outing.Status,
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipts"})
+		utils.InternalError(c, "Failed to update outing status", err)
+		return
+	}
+	if n == 0 {
+		utils.Conflict(c, "outing status changed, try again")
 		return
 	}
+
+	outing.Status = body.Status
+	c.JSON(http.StatusOK, toOutingDetails(outing))
+}
+
+// GetReceipts lists an outing's receipts, newest first, optionally limited to
+// a from/to date range on when the receipt was opened.
+func (r *Repository) GetReceipts(c *gin.Context) {
+	outingID, ok := r.outingMember(c)
+	if !ok {
+		return
+	}
+
+	limit, ok := utils.PageLimit(c, defaultPageLimit, maxPageLimit)
+	if !ok {
+		return
+	}
+
+	from, to, ok := utils.DateRange(c)
+	if !ok {
+		return
+	}
+
+	params := repository.GetReceiptsForOutingParams{
+		OutingID:  outingID,
+		DateFrom:  from,
+		DateTo:    to,
+		PageLimit: limit + 1,
+	}
+
+	var cursor receiptsCursor
+	if !utils.ReadCursor(c, &cursor) {
+		return
+	}
+	if cursor.ID != uuid.Nil {
+		params.CursorID = &cursor.ID
+		params.CursorTime = pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true}
+	}
+
+	receipts, err := r.Repo.GetReceiptsForOuting(*r.Ctx, params)
+	if err != nil {
+		utils.InternalServerError(c, "Failed to fetch receipts")
+		return
+	}
+
+	if len(receipts) > int(limit) {
+		receipts = receipts[:limit]
+		last := receipts[len(receipts)-1]
+		c.Header(utils.NextCursorHeader, utils.EncodeCursor(receiptsCursor{ID: last.ID, CreatedAt: last.CreatedAt}))
+	}
+
 	c.JSON(http.StatusOK, toOutingReceiptsResponse(receipts))
 }
 
+// GetFriends lists what each friend owes per receipt, ordered by friend name.
 func (r *Repository) GetFriends(c *gin.Context) {
-	outingId := c.Param("outing_id")
-	outingIdUuid, err := uuid.Parse(outingId)
+	outingIdUuid, ok := r.outingMember(c)
+	if !ok {
+		return
+	}
+
+	limit, ok := utils.PageLimit(c, maxPageLimit, maxPageLimit)
+	if !ok {
+		return
+	}
+
+	params := repository.GetFriendsForOutingParams{
+		OutingID:  outingIdUuid,
+		PageLimit: limit + 1,
+	}
+
+	var cursor friendsCursor
+	if !utils.ReadCursor(c, &cursor) {
+		return
+	}
+	if cursor.FriendID != uuid.Nil {
+		params.CursorName = cursor.Name
+		params.CursorFriendID = &cursor.FriendID
+		params.CursorReceiptID = &cursor.ReceiptID
+	}
+
+	friends, err := r.Repo.GetFriendsForOuting(*r.Ctx, params)
+	if err != nil {
+		utils.InternalError(c, "Failed to get friends", err)
+		return
+	}
+
+	if len(friends) > int(limit) {
+		friends = friends[:limit]
+		last := friends[len(friends)-1]
+		c.Header(utils.NextCursorHeader, utils.EncodeCursor(friendsCursor{
+			Name:      last.Name,
+			FriendID:  last.FriendID,
+			ReceiptID: last.ReceiptID,
+		}))
+	}
+
+	c.JSON(http.StatusOK, toFriendShares(friends))
+}
+
+func (r *Repository) restoreWindow() time.Duration {
+	return time.Duration(r.Config.RestoreWindowHours) * time.Hour
+}
+
+// DeleteOuting soft deletes an outing and, with it, every receipt in it. The
+// outing can be restored until the restore window passes and it is purged.
+func (r *Repository) DeleteOuting(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	outingID, ok := utils.ParamUUID(c, "outing_id")
+	if !ok {
+		return
+	}
+
+	deletedAt, err := r.Repo.SoftDeleteOuting(*r.Ctx, repository.SoftDeleteOutingParams{
+		ID:     outingID,
+		UserID: user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "outing not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outing ID"})
+		utils.InternalError(c, "Failed to delete outing", err)
 		return
 	}
-	friends, err := r.Repo.GetFriendsForOuting(*r.Ctx, outingIdUuid)
+
+	c.JSON(http.StatusOK, DeleteOutingResponse{
+		ID:           outingID,
+		DeletedAt:    deletedAt.Time,
+		RestoreUntil: deletedAt.Time.Add(r.restoreWindow()),
+	})
+}
+
+func (r *Repository) RestoreOuting(c *gin.Context) {
+	user, err := auth.GetUser(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	outingID, ok := utils.ParamUUID(c, "outing_id")
+	if !ok {
+		return
+	}
+
+	n, err := r.Repo.RestoreOuting(*r.Ctx, repository.RestoreOutingParams{
+		ID:        outingID,
+		UserID:    user.ID,
+		DeletedAt: pgtype.Timestamptz{Time: time.Now().Add(-r.restoreWindow()), Valid: true},
+	})
+	if err != nil {
+		utils.InternalError(c, "Failed to restore outing", err)
+		return
+	}
+	if n == 0 {
+		utils.NotFound(c, "no deleted outing to restore")
 		return
 	}
 
-	c.JSON(http.StatusOK, friends)
+	c.JSON(http.StatusOK, gin.H{"id": outingID})
 }
@@ -0,0 +1,110 @@
+package outing
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type GuestInviteResponse struct {
+	Invite    string    `json:"invite"`
+	URL       string    `json:"url"`
+	FriendID  uuid.UUID `json:"friend_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// outingFriend resolves :friend_id to one of the outing's friends.
+func (r *Repository) outingFriend(c *gin.Context, outing repository.Outing) (repository.GetFriendRow, bool) {
+	friendID, ok := utils.ParamUUID(c, "friend_id")
+	if !ok {
+		return repository.GetFriendRow{}, false
+	}
+
+	friend, err := r.Repo.GetFriend(*r.Ctx, friendID)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && friend.OutingID != outing.ID) {
+		utils.NotFound(c, "friend not found")
+		return repository.GetFriendRow{}, false
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to fetch friend", err)
+		return repository.GetFriendRow{}, false
+	}
+	return friend, true
+}
+
+// CreateInvite makes a share link that lets someone without an account act as
+// one of the outing's friends. Only the hash of the link's secret is stored, so
+// the link is only ever shown in this response.
+func (r *Repository) CreateInvite(c *gin.Context) {
+	outing, ok := r.ownedOuting(c)
+	if !ok {
+		return
+	}
+	friend, ok := r.outingFriend(c, outing)
+	if !ok {
+		return
+	}
+	if friend.UserID != nil {
+		utils.Conflict(c, "friend already has an account")
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		utils.InternalError(c, "failed to create invite", err)
+		return
+	}
+	secret := base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(secret))
+
+	expiresAt := time.Now().Add(time.Duration(r.Config.GuestInviteTTLHours) * time.Hour)
+	_, err := r.Repo.CreateGuestInvite(*r.Ctx, repository.CreateGuestInviteParams{
+		FriendID:  friend.ID,
+		TokenHash: hex.EncodeToString(sum[:]),
+		CreatedBy: outing.UserID,
+		ExpiresAt: pgtype.Timestamptz{Time: expiresAt, Valid: true},
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to create invite", err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, GuestInviteResponse{
+		Invite:    secret,
+		URL:       r.Config.ServerURL + "/api/v1/guest/invite/" + secret,
+		FriendID:  friend.ID,
+		ExpiresAt: expiresAt,
+	})
+}
+
+// RevokeInvites disables every share link for the friend, including tokens
+// guests already exchanged them for.
+func (r *Repository) RevokeInvites(c *gin.Context) {
+	outing, ok := r.ownedOuting(c)
+	if !ok {
+		return
+	}
+	friend, ok := r.outingFriend(c, outing)
+	if !ok {
+		return
+	}
+
+	n, err := r.Repo.RevokeGuestInvites(*r.Ctx, friend.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to revoke invites", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revoked": n})
+}
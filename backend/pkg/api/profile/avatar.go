@@ -0,0 +1,170 @@
+package profile
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/receipt"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+const avatarSize = 512
+
+func (p *profileRepository) avatarURL(userID uuid.UUID, hash string) string {
+	return fmt.Sprintf("%s/api/v1/users/%s/avatar?v=%s", p.Config.ServerURL, userID, hash[:12])
+}
+
+// UploadAvatar replaces the user's picture with an uploaded image, shrunk to
+// avatarSize and re-encoded so no metadata from the photo is kept.
+func (p *profileRepository) UploadAvatar(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	part, err := utils.FormFile(c, "avatar")
+	if utils.TooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		utils.BadRequest(c, "no file uploaded")
+		return
+	}
+	defer part.Close()
+
+	upload, err := receipt.ReadImageUpload(part, part.FileName(), c.Request.ContentLength, p.Config.MaxUploadBytes, p.Config.MaxImagePixels)
+	if utils.TooLarge(c, err) {
+		return
+	}
+	if errors.Is(err, receipt.ErrImageTooLarge) {
+		utils.ImageTooLarge(c, p.Config.MaxImagePixels)
+		return
+	}
+	if errors.Is(err, receipt.ErrNotImage) {
+		utils.BadRequest(c, "avatar must be a JPEG, PNG or GIF image")
+		return
+	}
+	if err != nil {
+		utils.BadRequest(c, "reading file data")
+		return
+	}
+	defer upload.Close()
+
+	data, err := upload.Bytes()
+	if err != nil {
+		utils.InternalError(c, "failed to read avatar", err)
+		return
+	}
+
+	avatar, err := receipt.Shrink(data, avatarSize)
+	if err != nil {
+		utils.BadRequest(c, "avatar must be a JPEG, PNG or GIF image")
+		return
+	}
+
+	sum := sha256.Sum256(avatar)
+	hash := hex.EncodeToString(sum[:])
+	key := fmt.Sprintf("avatars/%s/%s.jpg", user.ID, hash)
+	if err := storage.PutBytes(*p.Ctx, p.Storage, p.Config.ReceiptsBucket, key, avatar, "image/jpeg"); err != nil {
+		utils.InternalError(c, "failed to upload avatar", err)
+		return
+	}
+
+	previous, err := p.Repo.GetUserAvatar(*p.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to upload avatar", err)
+		return
+	}
+
+	picture := p.avatarURL(user.ID, hash)
+	err = p.Repo.SetUserAvatar(*p.Ctx, repository.SetUserAvatarParams{
+		ID:        user.ID,
+		AvatarKey: key,
+		Picture:   picture,
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to upload avatar", err)
+		return
+	}
+
+	p.deleteAvatar(c, previous, key)
+	c.JSON(http.StatusOK, gin.H{"picture": picture})
+}
+
+// DeleteAvatar removes an uploaded avatar. The picture from the login
+// provider comes back on the next sign in.
+func (p *profileRepository) DeleteAvatar(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	previous, err := p.Repo.GetUserAvatar(*p.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to delete avatar", err)
+		return
+	}
+
+	err = p.Repo.SetUserAvatar(*p.Ctx, repository.SetUserAvatarParams{ID: user.ID})
+	if err != nil {
+		utils.InternalError(c, "failed to delete avatar", err)
+		return
+	}
+
+	p.deleteAvatar(c, previous, "")
+	c.JSON(http.StatusOK, gin.H{"picture": ""})
+}
+
+func (p *profileRepository) deleteAvatar(c *gin.Context, key, current string) {
+	if key == "" || key == current {
+		return
+	}
+	if err := p.Storage.Delete(*p.Ctx, p.Config.ReceiptsBucket, key); err != nil {
+		utils.Logger(c).Warn("failed to delete avatar", zap.String("key", key), zap.Error(err))
+	}
+}
+
+// GetAvatar serves a user's uploaded avatar. The URL changes with the image,
+// so it can be cached for good.
+func (p *profileRepository) GetAvatar(c *gin.Context) {
+	userID, ok := utils.ParamUUID(c, "user_id")
+	if !ok {
+		return
+	}
+
+	key, err := p.Repo.GetUserAvatar(*p.Ctx, userID)
+	if (err == nil && key == "") || errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "avatar not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to get avatar", err)
+		return
+	}
+
+	obj, info, err := p.Storage.Get(*p.Ctx, p.Config.ReceiptsBucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.NotFound(c, "avatar not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to read avatar", err)
+		return
+	}
+	defer obj.Close()
+
+	c.Header("Cache-Control", "private, max-age=31536000, immutable")
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, obj, nil)
+}
@@ -0,0 +1,91 @@
+package profile
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/repository"
+)
+
+type Profile struct {
+	ID                   uuid.UUID `json:"id"`
+	Email                string    `json:"email"`
+	Name                 string    `json:"name"`
+	Picture              string    `json:"picture"`
+	Timezone             string    `json:"timezone"`
+	Locale               string    `json:"locale"`
+	DefaultCurrency      string    `json:"default_currency"`
+	DefaultTipPercentage *float64  `json:"default_tip_percentage"`
+	Venmo                string    `json:"venmo"`
+	PayPal               string    `json:"paypal"`
+	IBAN                 string    `json:"iban"`
+	CreatedAt            time.Time `json:"created_at"`
+	Usage                Usage     `json:"usage"`
+}
+
+// Usage is how much of this month's extraction quota is used up. A quota of
+// 0 is unlimited.
+type Usage struct {
+	Extractions int32     `json:"extractions"`
+	Quota       int       `json:"quota"`
+	ResetsAt    time.Time `json:"resets_at"`
+}
+
+func toProfile(row repository.GetProfileRow, usage Usage) Profile {
+	var tip *float64
+	if row.DefaultTipPercentage.Valid {
+		tip = &row.DefaultTipPercentage.Float64
+	}
+	return Profile{
+		ID:                   row.ID,
+		Email:                row.Email,
+		Name:                 row.Name,
+		Picture:              row.Picture,
+		Timezone:             row.Timezone,
+		Locale:               row.Locale,
+		DefaultCurrency:      row.DefaultCurrency,
+		DefaultTipPercentage: tip,
+		Venmo:                row.VenmoHandle,
+		PayPal:               row.PaypalHandle,
+		IBAN:                 row.Iban,
+		CreatedAt:            row.CreatedAt.Time,
+		Usage:                usage,
+	}
+}
+
+// UpdateProfileRequest changes the fields that are present. An empty string
+// clears a payment handle, and clear_default_tip removes the default tip.
+type UpdateProfileRequest struct {
+	Name                 *string  `json:"name"`
+	Timezone             *string  `json:"timezone"`
+	Locale               *string  `json:"locale"`
+	DefaultCurrency      *string  `json:"default_currency"`
+	DefaultTipPercentage *float64 `json:"default_tip_percentage"`
+	ClearDefaultTip      bool     `json:"clear_default_tip"`
+	Venmo                *string  `json:"venmo"`
+	PayPal               *string  `json:"paypal"`
+	IBAN                 *string  `json:"iban"`
+}
+
+// Payee is who the friends of an outing pay back and how.
+type Payee struct {
+	UserID   uuid.UUID `json:"user_id"`
+	Name     string    `json:"name"`
+	Picture  string    `json:"picture"`
+	Currency string    `json:"currency"`
+	Venmo    string    `json:"venmo"`
+	PayPal   string    `json:"paypal"`
+	IBAN     string    `json:"iban"`
+}
+
+func toPayee(row repository.GetOutingPayeeRow) Payee {
+	return Payee{
+		UserID:   row.ID,
+		Name:     row.Name,
+		Picture:  row.Picture,
+		Currency: row.DefaultCurrency,
+		Venmo:    row.VenmoHandle,
+		PayPal:   row.PaypalHandle,
+		IBAN:     row.Iban,
+	}
+}
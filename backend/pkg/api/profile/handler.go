@@ -0,0 +1,267 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type profileRepository struct {
+	Repo    *repository.Queries
+	Storage storage.Storage
+	Ctx     *context.Context
+	Config  *config.Config
+}
+
+func New(repo *repository.Queries, storage storage.Storage, config *config.Config, ctx *context.Context) *profileRepository {
+	return &profileRepository{
+		Repo:    repo,
+		Storage: storage,
+		Ctx:     ctx,
+		Config:  config,
+	}
+}
+
+var (
+	currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+	venmoHandle  = regexp.MustCompile(`^[A-Za-z0-9_-]{5,30}$`)
+	paypalHandle = regexp.MustCompile(`^[A-Za-z0-9]{1,20}$`)
+	ibanFormat   = regexp.MustCompile(`^[A-Z]{2}[0-9]{2}[A-Z0-9]{11,30}$`)
+	// a BCP 47 tag, loosely: a language then script, region or variant subtags
+	localeTag = regexp.MustCompile(`^[A-Za-z]{2,3}([-_][A-Za-z0-9]{1,8}){0,3}$`)
+)
+
+// validIBAN checks the ISO 13616 check digits: moving the first four
+// characters to the end and reading letters as 10-35 must leave 1 mod 97.
+func validIBAN(iban string) bool {
+	if !ibanFormat.MatchString(iban) {
+		return false
+	}
+	var digits strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&digits, "%d", r-'A'+10)
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	return ok && n.Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+func (p *profileRepository) GetProfile(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	profile, err := p.Repo.GetProfile(*p.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to get profile", err)
+		return
+	}
+
+	usage, err := p.usage(user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to get profile", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toProfile(profile, usage))
+}
+
+func (p *profileRepository) usage(userID uuid.UUID) (Usage, error) {
+	extractions, err := p.Repo.GetExtractionUsage(*p.Ctx, userID)
+	if err != nil {
+		return Usage{}, err
+	}
+	return Usage{
+		Extractions: extractions,
+		Quota:       p.Config.ExtractionQuotaMonthly,
+		ResetsAt:    utils.QuotaResetsAt(time.Now()),
+	}, nil
+}
+
+func (p *profileRepository) UpdateProfile(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body UpdateProfileRequest
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	profile, err := p.Repo.GetProfile(*p.Ctx, user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to get profile", err)
+		return
+	}
+
+	if body.Name != nil {
+		name := strings.TrimSpace(*body.Name)
+		if name == "" || len(name) > 255 {
+			utils.BadRequest(c, "name must be between 1 and 255 characters")
+			return
+		}
+		profile.Name = name
+	}
+	if body.Timezone != nil {
+		if _, err := time.LoadLocation(*body.Timezone); err != nil || *body.Timezone == "" {
+			utils.BadRequest(c, "invalid timezone")
+			return
+		}
+		profile.Timezone = *body.Timezone
+	}
+	if body.Locale != nil {
+		locale := strings.TrimSpace(*body.Locale)
+		if locale != "" && !localeTag.MatchString(locale) {
+			utils.BadRequest(c, "locale must be a language tag such as en-CA")
+			return
+		}
+		profile.Locale = locale
+	}
+	if body.DefaultCurrency != nil {
+		currency := strings.ToUpper(*body.DefaultCurrency)
+		if !currencyCode.MatchString(currency) {
+			utils.BadRequest(c, "default_currency must be an ISO 4217 code")
+			return
+		}
+		profile.DefaultCurrency = currency
+	}
+	if body.ClearDefaultTip {
+		profile.DefaultTipPercentage = pgtype.Float8{}
+	} else if body.DefaultTipPercentage != nil {
+		if *body.DefaultTipPercentage < 0 || *body.DefaultTipPercentage > 100 {
+			utils.BadRequest(c, "default_tip_percentage must be between 0 and 100")
+			return
+		}
+		profile.DefaultTipPercentage = pgtype.Float8{Float64: *body.DefaultTipPercentage, Valid: true}
+	}
+	if body.Venmo != nil {
+		venmo := strings.TrimPrefix(strings.TrimSpace(*body.Venmo), "@")
+		if venmo != "" && !venmoHandle.MatchString(venmo) {
+			utils.BadRequest(c, "invalid venmo username")
+			return
+		}
+		profile.VenmoHandle = venmo
+	}
+	if body.PayPal != nil {
+		paypal := strings.TrimSpace(*body.PayPal)
+		if paypal != "" && !paypalHandle.MatchString(paypal) {
+			utils.BadRequest(c, "invalid paypal.me username")
+			return
+		}
+		profile.PaypalHandle = paypal
+	}
+	if body.IBAN != nil {
+		iban := strings.ToUpper(strings.Join(strings.Fields(*body.IBAN), ""))
+		if iban != "" && !validIBAN(iban) {
+			utils.BadRequest(c, "invalid IBAN")
+			return
+		}
+		profile.Iban = iban
+	}
+
+	err = p.Repo.UpdateProfile(*p.Ctx, repository.UpdateProfileParams{
+		ID:                   user.ID,
+		Name:                 profile.Name,
+		Timezone:             profile.Timezone,
+		Locale:               profile.Locale,
+		DefaultCurrency:      profile.DefaultCurrency,
+		DefaultTipPercentage: profile.DefaultTipPercentage,
+		VenmoHandle:          profile.VenmoHandle,
+		PaypalHandle:         profile.PaypalHandle,
+		Iban:                 profile.Iban,
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to update profile", err)
+		return
+	}
+
+	usage, err := p.usage(user.ID)
+	if err != nil {
+		utils.InternalError(c, "failed to get profile", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toProfile(profile, usage))
+}
+
+// GetPayee shows the outing's owner, who paid the bill, and the payment
+// handles friends can use to pay them back.
+func (p *profileRepository) GetPayee(c *gin.Context) {
+	outingID, ok := p.outingMember(c)
+	if !ok {
+		return
+	}
+
+	payee, err := p.Repo.GetOutingPayee(*p.Ctx, outingID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "outing not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to get payee", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, toPayee(payee))
+}
+
+// outingMember resolves :outing_id for its owner, one of its friends with an
+// account, or a guest invited to it.
+func (p *profileRepository) outingMember(c *gin.Context) (uuid.UUID, bool) {
+	outingID, ok := utils.ParamUUID(c, "outing_id")
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	if guest, ok := auth.GetGuest(c); ok {
+		return guest.OutingID, guest.OutingID == outingID
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return uuid.Nil, false
+	}
+
+	outing, err := p.Repo.GetOuting(*p.Ctx, outingID)
+	if err == nil && outing.UserID == user.ID {
+		return outingID, true
+	}
+	if err == nil {
+		_, err = p.Repo.GetOutingFriendForUser(*p.Ctx, repository.GetOutingFriendForUserParams{
+			OutingID: outingID,
+			UserID:   &user.ID,
+		})
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "outing not found")
+		return uuid.Nil, false
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to get outing", err)
+		return uuid.Nil, false
+	}
+	return outingID, true
+}
@@ -0,0 +1,132 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/outingstatus"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type DeleteResponse struct {
+	ID           uuid.UUID `json:"id"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	RestoreUntil time.Time `json:"restore_until"`
+}
+
+func (r *receiptRepository) restoreWindow() time.Duration {
+	return time.Duration(r.Config.RestoreWindowHours) * time.Hour
+}
+
+// ownReceipt checks that the caller owns the receipt's outing and returns the
+// outing's status.
+func (r *receiptRepository) ownReceipt(c *gin.Context, userId, receiptId uuid.UUID) (string, bool) {
+	status, err := r.Repo.GetOwnedReceiptOutingStatus(*r.Ctx, repository.GetOwnedReceiptOutingStatusParams{
+		ReceiptID: receiptId,
+		UserID:    userId,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "receipt not found")
+		return "", false
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to check outing status", err)
+		return "", false
+	}
+	return status, true
+}
+
+// ownReceiptEditable is ownReceipt for changes, which are refused once the
+// outing is locked or settled, since removing a receipt changes what everyone
+// owes.
+func (r *receiptRepository) ownReceiptEditable(c *gin.Context, userId, receiptId uuid.UUID) bool {
+	status, ok := r.ownReceipt(c, userId, receiptId)
+	if !ok {
+		return false
+	}
+	if !outingstatus.SplitsEditable(status) {
+		utils.Conflict(c, fmt.Sprintf("outing is %s, receipts can no longer change", status))
+		return false
+	}
+	return true
+}
+
+// DeleteReceipt soft deletes a receipt. It disappears from the outing straight
+// away and is purged, along with its items, splits and image, once the restore
+// window has passed.
+func (r *receiptRepository) DeleteReceipt(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	if !r.ownReceiptEditable(c, user.ID, receiptId) {
+		return
+	}
+
+	deletedAt, err := r.Repo.SoftDeleteReceipt(*r.Ctx, repository.SoftDeleteReceiptParams{
+		ID:     receiptId,
+		UserID: user.ID,
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "receipt not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to delete receipt", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, DeleteResponse{
+		ID:           receiptId,
+		DeletedAt:    deletedAt.Time,
+		RestoreUntil: deletedAt.Time.Add(r.restoreWindow()),
+	})
+}
+
+func (r *receiptRepository) RestoreReceipt(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	if !r.ownReceiptEditable(c, user.ID, receiptId) {
+		return
+	}
+
+	n, err := r.Repo.RestoreReceipt(*r.Ctx, repository.RestoreReceiptParams{
+		ID:        receiptId,
+		UserID:    user.ID,
+		DeletedAt: pgtype.Timestamptz{Time: time.Now().Add(-r.restoreWindow()), Valid: true},
+	})
+	if err != nil {
+		utils.InternalError(c, "Failed to restore receipt", err)
+		return
+	}
+	if n == 0 {
+		utils.NotFound(c, "no deleted receipt to restore")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": receiptId})
+}
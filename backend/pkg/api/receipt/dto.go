@@ -2,7 +2,6 @@ package receipt
 
 import (
 	"encoding/json"
-	"fmt"
 	"log"
 	"time"
 
@@ -12,11 +11,13 @@ import (
 )
 
 type OrderItem struct {
-	ID        string   `json:"id"`
-	ReceiptID string   `json:"receipt_id"`
-	Name      string   `json:"name"`
-	Price     *float64 `json:"price"`
-	Quantity  int32    `json:"quantity"`
+	ID           string   `json:"id"`
+	ReceiptID    string   `json:"receipt_id"`
+	Name         string   `json:"name"`
+	Price        *float64 `json:"price"`
+	Quantity     int32    `json:"quantity"`
+	Taxable      bool     `json:"taxable"`
+	ParentItemID *string  `json:"parent_item_id"`
 }
 
 type OtherFee struct {
@@ -24,6 +25,16 @@ type OtherFee struct {
 	ReceiptID string   `json:"receipt_id"`
 	Name      string   `json:"name"`
 	Price     *float64 `json:"price"`
+	Kind      string   `json:"kind"`
+	Taxable   bool     `json:"taxable"`
+}
+
+type Discount struct {
+	ID          string   `json:"id"`
+	ReceiptID   string   `json:"receipt_id"`
+	OrderItemID *string  `json:"order_item_id"`
+	Name        string   `json:"name"`
+	Amount      *float64 `json:"amount"`
 }
 
 type Split struct {
@@ -38,21 +49,28 @@ type ReceiptResponse struct {
 	Restaurant        string      `json:"restaurant"`
 	Address           string      `json:"address"`
 	Opened            time.Time   `json:"opened"`
+	OpenedRaw         string      `json:"opened_raw"`
 	OrderNumber       string      `json:"order_number"`
 	OrderType         string      `json:"order_type"`
 	PaymentTip        *float64    `json:"payment_tip"`
 	PaymentAmountPaid *float64    `json:"payment_amount_paid"`
+	PaymentMethod     string      `json:"payment_method"`
+	CardLastFour      string      `json:"card_last_four"`
+	TipPercentage     *float64    `json:"tip_percentage"`
 	TableNumber       string      `json:"table_number"`
 	Copy              string      `json:"copy"`
 	Server            string      `json:"server"`
 	SalesTax          *float64    `json:"sales_tax"`
 	Items             []OrderItem `json:"items"`
 	ImageUrl          string      `json:"image_url"`
+	MediumUrl         string      `json:"medium_url"`
+	ThumbnailUrl      string      `json:"thumbnail_url"`
 	Fees              []OtherFee  `json:"fees"`
 	Splits            []Split     `json:"splits"`
+	Discounts         []Discount  `json:"discounts"`
 }
 
-func toReceiptResponse(dbRow repository.GetReceiptRow, imageUrl string) ReceiptResponse {
+func toReceiptResponse(dbRow repository.GetReceiptRow, urls ImageUrls) ReceiptResponse {
 	var items []OrderItem
 	if err := json.Unmarshal(dbRow.Items, &items); err != nil {
 		log.Printf("error decoding items JSON: %v", err)
@@ -71,16 +89,26 @@ func toReceiptResponse(dbRow repository.GetReceiptRow, imageUrl string) ReceiptR
 		fees = []OtherFee{}
 	}
 
+	var discounts []Discount
+	if err := json.Unmarshal(dbRow.Discounts, &discounts); err != nil {
+		log.Printf("error decoding discounts JSON: %v", err)
+		discounts = []Discount{}
+	}
+
 	return ReceiptResponse{
 		ID:                dbRow.ID.String(),
 		Total:             utils.NullFloat64ToPtr(dbRow.Total),
 		Restaurant:        dbRow.Restaurant,
 		Address:           dbRow.Address,
-		Opened:            dbRow.Opened,
+		Opened:            dbRow.Opened.Time,
+		OpenedRaw:         dbRow.OpenedRaw,
 		OrderNumber:       dbRow.OrderNumber,
 		OrderType:         dbRow.OrderType,
 		PaymentTip:        utils.NullFloat64ToPtr(dbRow.PaymentTip),
 		PaymentAmountPaid: utils.NullFloat64ToPtr(dbRow.PaymentAmountPaid),
+		PaymentMethod:     dbRow.PaymentMethod,
+		CardLastFour:      dbRow.PaymentCardLastFour,
+		TipPercentage:     utils.NullFloat64ToPtr(dbRow.TipPercentageOverride),
 		TableNumber:       dbRow.TableNumber,
 		Copy:              dbRow.Copy,
 		Server:            dbRow.Server,
@@ -88,7 +116,10 @@ func toReceiptResponse(dbRow repository.GetReceiptRow, imageUrl string) ReceiptR
 		Items:             items,
 		Fees:              fees,
 		Splits:            splits,
-		ImageUrl:          imageUrl,
+		Discounts:         discounts,
+		ImageUrl:          urls.Original,
+		MediumUrl:         urls.Medium,
+		ThumbnailUrl:      urls.Thumbnail,
 	}
 }
 
@@ -127,6 +158,12 @@ func toCreateFriend(friend CreateFriendInput, outingId uuid.UUID) (repository.Cr
 	}, nil
 }
 
+// UpdateTipInput overrides the recorded tip with a percentage of the subtotal.
+// A null tip_percentage clears the override and falls back to the receipt's tip.
+type UpdateTipInput struct {
+	TipPercentage *float64 `json:"tip_percentage"`
+}
+
 type CreateSplitItem struct {
 	FriendId string `json:"friend_id"`
 	ItemId   string `json:"item_id"`
@@ -138,7 +175,6 @@ type CreateSplitInput struct {
 }
 
 func toCreateSplit(split CreateSplitInput) (*[]repository.CreateSplitParams, *uuid.UUID, error) {
-	fmt.Printf("SLIT: %v\n", split)
 	receiptUuid, err := uuid.Parse(split.ReceiptId)
 	if err != nil {
 		return nil, nil, err
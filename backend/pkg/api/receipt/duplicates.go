@@ -0,0 +1,229 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/receipt"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type DuplicateCandidate struct {
+	ReceiptID   uuid.UUID  `json:"receipt_id"`
+	Restaurant  string     `json:"restaurant"`
+	OrderNumber string     `json:"order_number"`
+	Total       *float64   `json:"total"`
+	Opened      *time.Time `json:"opened"`
+	Reasons     []string   `json:"reasons"`
+}
+
+type ResolveDuplicateInput struct {
+	Action string `json:"action" binding:"required,oneof=dismiss merge"`
+}
+
+func fingerprintFromRow(row repository.ListOutingReceiptFingerprintsRow) receipt.Fingerprint {
+	f := receipt.Fingerprint{
+		Restaurant:  row.Restaurant,
+		OrderNumber: row.OrderNumber,
+		Total:       row.Total.Float64,
+	}
+	if row.Opened.Valid {
+		f.Opened = row.Opened.Time
+	}
+	return f
+}
+
+// saveExtract runs extraction for a new file, saves the receipt and records
+// any receipts already in the outing that look like the same transaction.
+func (r *receiptRepository) saveExtract(c *gin.Context, extract *receipt.Extract, outingId uuid.UUID) (uuid.UUID, []DuplicateCandidate, error) {
+	extract.Location = r.outingLocation(outingId)
+	extract.DateOrder = r.outingDateOrder(c, outingId)
+	extract.Bucket = r.Config.ReceiptsBucket
+
+	var phash pgtype.Int8
+	if hash, ok := receipt.PerceptualHash(extract.ImageBytes); ok {
+		phash = pgtype.Int8{Int64: int64(hash), Valid: true}
+	}
+
+	model, text, bucket, key, err := extract.Run(*r.Ctx)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("running model: %w", err)
+	}
+
+	existing, err := r.Repo.ListOutingReceiptFingerprints(*r.Ctx, outingId)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("listing outing receipts: %w", err)
+	}
+
+	fingerprint := model.Fingerprint()
+	var candidates []DuplicateCandidate
+	for _, row := range existing {
+		var reasons []string
+		if phash.Valid && row.Phash.Valid &&
+			receipt.HammingDistance(uint64(phash.Int64), uint64(row.Phash.Int64)) <= receipt.PerceptualHashThreshold {
+			reasons = append(reasons, receipt.DuplicateImage)
+		}
+		reasons = append(reasons, fingerprint.DuplicateReasons(fingerprintFromRow(row))...)
+		if len(reasons) == 0 {
+			continue
+		}
+
+		candidate := DuplicateCandidate{
+			ReceiptID:   row.ID,
+			Restaurant:  row.Restaurant,
+			OrderNumber: row.OrderNumber,
+			Reasons:     reasons,
+		}
+		if row.Total.Valid {
+			candidate.Total = &row.Total.Float64
+		}
+		if row.Opened.Valid {
+			candidate.Opened = &row.Opened.Time
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	receiptId, err := r.SaveReceipt(r.Repo, extract.ImageHash, bucket, key, extract.Variants, text, extract.FileName, outingId, phash, model)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("saving receipt: %w", err)
+	}
+
+	for _, candidate := range candidates {
+		err := r.Repo.InsertReceiptDuplicate(*r.Ctx, repository.InsertReceiptDuplicateParams{
+			ReceiptID:   receiptId,
+			CandidateID: candidate.ReceiptID,
+			Reasons:     candidate.Reasons,
+		})
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("saving duplicate: %w", err)
+		}
+	}
+
+	return receiptId, candidates, nil
+}
+
+func (r *receiptRepository) GetDuplicates(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	if _, ok := r.ownReceipt(c, user.ID, receiptId); !ok {
+		return
+	}
+
+	rows, err := r.Repo.ListReceiptDuplicates(*r.Ctx, receiptId)
+	if err != nil {
+		utils.InternalError(c, "Failed to list duplicates", err)
+		return
+	}
+
+	candidates := []DuplicateCandidate{}
+	for _, row := range rows {
+		candidate := DuplicateCandidate{
+			ReceiptID:   row.CandidateID,
+			Restaurant:  row.Restaurant,
+			OrderNumber: row.OrderNumber,
+			Reasons:     row.Reasons,
+		}
+		if row.Total.Valid {
+			candidate.Total = &row.Total.Float64
+		}
+		if row.Opened.Valid {
+			candidate.Opened = &row.Opened.Time
+		}
+		candidates = append(candidates, candidate)
+	}
+
+	c.JSON(http.StatusOK, candidates)
+}
+
+// ResolveDuplicate either dismisses a flagged candidate, keeping both
+// receipts, or merges by soft deleting this receipt in favour of the candidate.
+func (r *receiptRepository) ResolveDuplicate(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+	candidateId, ok := utils.ParamUUID(c, "candidate_id")
+	if !ok {
+		return
+	}
+
+	var body ResolveDuplicateInput
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	// dismissing only clears the flag, merging deletes a receipt
+	status := "dismissed"
+	if body.Action == "merge" {
+		status = "merged"
+		if !r.ownReceiptEditable(c, user.ID, receiptId) {
+			return
+		}
+	} else if _, ok := r.ownReceipt(c, user.ID, receiptId); !ok {
+		return
+	}
+
+	tx, err := r.Db.BeginTx(*r.Ctx, pgx.TxOptions{})
+	if err != nil {
+		utils.InternalError(c, "Failed to resolve duplicate", err)
+		return
+	}
+	defer tx.Rollback(*r.Ctx)
+	qtx := r.Repo.WithTx(tx)
+
+	n, err := qtx.UpdateReceiptDuplicateStatus(*r.Ctx, repository.UpdateReceiptDuplicateStatusParams{
+		ReceiptID:   receiptId,
+		CandidateID: candidateId,
+		Status:      status,
+	})
+	if err != nil {
+		utils.InternalError(c, "Failed to resolve duplicate", err)
+		return
+	}
+	if n == 0 {
+		utils.NotFound(c, "duplicate not found")
+		return
+	}
+
+	if body.Action == "merge" {
+		// the merged receipt goes through the normal soft delete so it can be
+		// restored until it is purged
+		if _, err := qtx.SoftDeleteReceipt(*r.Ctx, repository.SoftDeleteReceiptParams{
+			ID:     receiptId,
+			UserID: user.ID,
+		}); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			utils.InternalError(c, "Failed to merge receipts", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(*r.Ctx); err != nil {
+		utils.InternalError(c, "Failed to resolve duplicate", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipt_id": candidateId, "status": status})
+}
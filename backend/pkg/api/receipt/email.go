@@ -0,0 +1,349 @@
+package receipt
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/receipt"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+var errNoReceiptContent = errors.New("no receipt content found in email")
+
+type EmailResult struct {
+	FileName   string               `json:"file_name"`
+	Hash       string               `json:"hash"`
+	Existing   bool                 `json:"existing"`
+	ReceiptID  *uuid.UUID           `json:"receipt_id"`
+	Duplicates []DuplicateCandidate `json:"duplicates,omitempty"`
+}
+
+type ForwardingAddressResponse struct {
+	Address  string     `json:"address"`
+	OutingID *uuid.UUID `json:"outing_id"`
+}
+
+type SetForwardingOutingInput struct {
+	OutingID *string `json:"outing_id"`
+}
+
+func newForwardingToken() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)), nil
+}
+
+func (r *receiptRepository) forwardingAddress(token string) string {
+	return fmt.Sprintf("%s@%s", token, r.Config.InboundEmailDomain)
+}
+
+// tokenFromRecipients finds the forwarding token among the addresses a message was sent to.
+func (r *receiptRepository) tokenFromRecipients(recipients []string) string {
+	domain := "@" + strings.ToLower(r.Config.InboundEmailDomain)
+	for _, addr := range recipients {
+		addr = strings.ToLower(addr)
+		if strings.HasSuffix(addr, domain) {
+			return strings.TrimSuffix(addr, domain)
+		}
+	}
+	return ""
+}
+
+// ingestEmail creates receipts from a raw RFC 822 message. Image attachments are run
+// through OCR; when there are none the message body itself is treated as the receipt.
+// Each new receipt the model is called for counts against the user's quota;
+// once it runs out the receipts created so far are returned with
+// errQuotaExceeded.
+func (r *receiptRepository) ingestEmail(c *gin.Context, raw []byte, fname string, outingId, userId uuid.UUID) ([]EmailResult, error) {
+	email, err := receipt.ParseEmail(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var extracts []*receipt.Extract
+
+	for _, image := range email.ImageAttachments() {
+		extract, err := receipt.NewExtract(*r.Ctx, r.Storage, r.Genai, r.Repo, r.Cache, image.Data, image.FileName, r.Config.CloudVisionCredentials)
+		if err != nil {
+			return nil, fmt.Errorf("starting extraction: %w", err)
+		}
+		extracts = append(extracts, extract)
+	}
+
+	if len(extracts) == 0 {
+		body := email.Body()
+		if strings.TrimSpace(body) == "" {
+			return nil, errNoReceiptContent
+		}
+		if email.Subject != "" {
+			body = email.Subject + "\n" + body
+		}
+		extracts = append(extracts, receipt.NewTextExtract(r.Storage, r.Genai, r.Repo, r.Cache, raw, fname, "message/rfc822", body))
+	}
+
+	var results []EmailResult
+	for _, extract := range extracts {
+		existing, err := r.existingReceipt(extract.ImageHash, outingId)
+		if err != nil {
+			return nil, fmt.Errorf("getting existing receipt: %w", err)
+		}
+
+		result := EmailResult{FileName: extract.FileName, Hash: extract.ImageHash, Existing: existing != nil, ReceiptID: existing}
+		if existing != nil {
+			results = append(results, result)
+			continue
+		}
+
+		if err := r.useExtraction(userId); err != nil {
+			return results, err
+		}
+		receiptId, duplicates, err := r.saveExtract(c, extract, outingId)
+		if err != nil || !extract.ModelCalled {
+			r.refundExtraction(c, userId)
+		}
+		if err != nil {
+			return nil, err
+		}
+		result.ReceiptID = &receiptId
+		result.Duplicates = duplicates
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func (r *receiptRepository) readEmailFile(c *gin.Context) ([]byte, string, error) {
+	part, err := utils.FormFile(c, "email")
+	if err != nil {
+		return nil, "", err
+	}
+	defer part.Close()
+
+	data, err := receipt.ReadLimited(part, r.Config.MaxEmailBytes, c.Request.ContentLength)
+	if err != nil {
+		return nil, "", err
+	}
+
+	name := part.FileName()
+	if !strings.HasSuffix(strings.ToLower(name), ".eml") {
+		name += ".eml"
+	}
+
+	return data, name, nil
+}
+
+// ownsOuting writes a 404 and returns false unless the outing exists and
+// belongs to the user.
+func (r *receiptRepository) ownsOuting(c *gin.Context, userId, outingId uuid.UUID) bool {
+	owner, err := r.Repo.GetOutingOwner(*r.Ctx, outingId)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && owner != userId) {
+		utils.NotFound(c, "outing not found")
+		return false
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to fetch outing", err)
+		return false
+	}
+	return true
+}
+
+func (r *receiptRepository) ProcessEmail(c *gin.Context) {
+	outingId, ok := utils.HeaderUUID(c, "outingid")
+	if !ok {
+		return
+	}
+
+	data, name, err := r.readEmailFile(c)
+	if utils.TooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		utils.BadRequest(c, "No email uploaded")
+		return
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	if !r.ownsOuting(c, user.ID, outingId) {
+		return
+	}
+
+	results, err := r.ingestEmail(c, data, name, outingId, user.ID)
+	if errors.Is(err, errQuotaExceeded) {
+		r.quotaExceeded(c, gin.H{"receipts": results})
+		return
+	}
+	if errors.Is(err, errNoReceiptContent) {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to process email", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipts": results})
+}
+
+func (r *receiptRepository) GetForwardingAddress(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	address, err := r.Repo.GetEmailForwardingAddress(*r.Ctx, user.ID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		token, err := newForwardingToken()
+		if err != nil {
+			utils.InternalServerError(c, "failed to create forwarding address")
+			return
+		}
+		address, err = r.Repo.UpsertEmailForwardingAddress(*r.Ctx, repository.UpsertEmailForwardingAddressParams{
+			UserID: user.ID,
+			Token:  token,
+		})
+		if err != nil {
+			utils.InternalServerError(c, "failed to create forwarding address")
+			return
+		}
+	} else if err != nil {
+		utils.InternalServerError(c, "failed to fetch forwarding address")
+		return
+	}
+
+	c.JSON(http.StatusOK, ForwardingAddressResponse{
+		Address:  r.forwardingAddress(address.Token),
+		OutingID: address.OutingID,
+	})
+}
+
+func (r *receiptRepository) SetForwardingOuting(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body SetForwardingOutingInput
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	var outingId *uuid.UUID
+	if body.OutingID != nil {
+		id, err := uuid.Parse(*body.OutingID)
+		if err != nil {
+			utils.BadRequest(c, "invalid outing id")
+			return
+		}
+		if !r.ownsOuting(c, user.ID, id) {
+			return
+		}
+		outingId = &id
+	}
+
+	token, err := newForwardingToken()
+	if err != nil {
+		utils.InternalServerError(c, "failed to update forwarding address")
+		return
+	}
+
+	// The token is only used on first insert; existing addresses keep theirs.
+	address, err := r.Repo.UpsertEmailForwardingAddress(*r.Ctx, repository.UpsertEmailForwardingAddressParams{
+		UserID:   user.ID,
+		Token:    token,
+		OutingID: outingId,
+	})
+	if err != nil {
+		utils.InternalServerError(c, "failed to update forwarding address")
+		return
+	}
+
+	c.JSON(http.StatusOK, ForwardingAddressResponse{
+		Address:  r.forwardingAddress(address.Token),
+		OutingID: address.OutingID,
+	})
+}
+
+// InboundEmail receives raw messages from the mail provider's inbound webhook.
+// Requests must carry the shared secret configured in INBOUND_EMAIL_SECRET.
+func (r *receiptRepository) InboundEmail(c *gin.Context) {
+	secret := r.Config.InboundEmailSecret
+	if secret == "" || subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Inbound-Secret")), []byte(secret)) != 1 {
+		utils.Unauthorized(c, "invalid inbound secret")
+		return
+	}
+
+	data, err := receipt.ReadLimited(c.Request.Body, r.Config.MaxEmailBytes, c.Request.ContentLength)
+	if utils.TooLarge(c, err) {
+		return
+	}
+	if err != nil {
+		utils.BadRequest(c, "reading email")
+		return
+	}
+
+	email, err := receipt.ParseEmail(data)
+	if err != nil {
+		utils.BadRequest(c, "invalid email")
+		return
+	}
+
+	token := r.tokenFromRecipients(email.To)
+	if token == "" {
+		utils.NotFound(c, "unknown forwarding address")
+		return
+	}
+
+	address, err := r.Repo.GetEmailForwardingAddressByToken(*r.Ctx, token)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "unknown forwarding address")
+		return
+	}
+	if err != nil {
+		utils.InternalServerError(c, "failed to fetch forwarding address")
+		return
+	}
+
+	if address.OutingID == nil {
+		utils.Unprocessable(c, "no outing selected for forwarding address")
+		return
+	}
+	// addresses pointed at an outing before ownership was checked stay harmless
+	if !r.ownsOuting(c, address.UserID, *address.OutingID) {
+		return
+	}
+
+	results, err := r.ingestEmail(c, data, "forwarded.eml", *address.OutingID, address.UserID)
+	if errors.Is(err, errQuotaExceeded) {
+		r.quotaExceeded(c, gin.H{"receipts": results})
+		return
+	}
+	if errors.Is(err, errNoReceiptContent) {
+		utils.BadRequest(c, err.Error())
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to process email", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipts": results})
+}
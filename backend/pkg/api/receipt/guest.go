@@ -0,0 +1,119 @@
+package receipt
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type ClaimItem struct {
+	ItemId   string `json:"item_id"`
+	Quantity int32  `json:"quantity"`
+}
+
+type ClaimItemsInput struct {
+	Items []ClaimItem `json:"items"`
+}
+
+// ClaimItems replaces the guest's claims on a receipt with the items in the
+// body. A guest can only ever split items to the friend they were invited as.
+func (r *receiptRepository) ClaimItems(c *gin.Context) {
+	guest, ok := auth.GetGuest(c)
+	if !ok {
+		utils.Unauthorized(c, "guest token required")
+		return
+	}
+
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	var body ClaimItemsInput
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	seen := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	var splits []repository.CreateSplitParams
+	for _, item := range body.Items {
+		itemId, err := uuid.Parse(item.ItemId)
+		if err != nil {
+			utils.BadRequest(c, "invalid item id")
+			return
+		}
+		if item.Quantity < 0 {
+			utils.BadRequest(c, "quantity cannot be negative")
+			return
+		}
+		if seen[itemId] {
+			utils.BadRequest(c, "duplicate item id")
+			return
+		}
+		seen[itemId] = true
+		ids = append(ids, itemId)
+
+		if item.Quantity > 0 {
+			splits = append(splits, repository.CreateSplitParams{
+				FriendID:    guest.FriendID,
+				OrderItemID: itemId,
+				ReceiptID:   receiptId,
+				Quantity:    item.Quantity,
+			})
+		}
+	}
+
+	if r.splitsLocked(c, receiptId) {
+		return
+	}
+
+	if len(ids) > 0 {
+		n, err := r.Repo.CountReceiptItems(*r.Ctx, repository.CountReceiptItemsParams{
+			ReceiptID: receiptId,
+			Ids:       ids,
+		})
+		if err != nil {
+			utils.InternalError(c, "failed to claim items", err)
+			return
+		}
+		if n != int64(len(ids)) {
+			utils.BadRequest(c, "items must belong to the receipt")
+			return
+		}
+	}
+
+	tx, err := r.Db.BeginTx(*r.Ctx, pgx.TxOptions{})
+	if err != nil {
+		utils.InternalError(c, "failed to claim items", err)
+		return
+	}
+	defer tx.Rollback(*r.Ctx)
+	qtx := r.Repo.WithTx(tx)
+
+	if err := qtx.DeleteFriendSplits(*r.Ctx, repository.DeleteFriendSplitsParams{
+		ReceiptID: receiptId,
+		FriendID:  guest.FriendID,
+	}); err != nil {
+		utils.InternalError(c, "failed to claim items", err)
+		return
+	}
+	for _, split := range splits {
+		if _, err := qtx.CreateSplit(*r.Ctx, split); err != nil {
+			utils.InternalError(c, "failed to claim items", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(*r.Ctx); err != nil {
+		utils.InternalError(c, "failed to claim items", err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"receipt_id": receiptId, "friend_id": guest.FriendID, "claimed": len(splits)})
+}
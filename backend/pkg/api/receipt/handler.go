@@ -3,47 +3,39 @@ package receipt
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"strings"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sharithg/civet/internal/cache"
 	"github.com/sharithg/civet/internal/config"
 	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/outingstatus"
 	"github.com/sharithg/civet/internal/receipt"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/pkg/api/auth"
 	"github.com/sharithg/civet/pkg/api/utils"
 )
 
-type ReceiptWithDetails struct {
-	ImageID  uuid.UUID              `json:"image_id"`
-	Hash     string                 `json:"hash"`
-	Bucket   string                 `json:"bucket"`
-	Key      string                 `json:"key"`
-	RawText  string                 `json:"raw_text"`
-	FileName string                 `json:"file_name"`
-	OutingID uuid.UUID              `json:"outing_id,omitempty"`
-	Items    []repository.OrderItem `json:"items"`
-	Fees     []repository.OtherFee  `json:"fees"`
-}
-
 type receiptRepository struct {
 	Repo    *repository.Queries
 	Ctx     *context.Context
-	Storage *storage.Storage
+	Storage storage.Storage
 	Genai   genai.OpenAi
 	Db      *pgxpool.Pool
 	Config  *config.Config
+	Cache   *cache.Cache
 }
 
-func New(repo *repository.Queries, db *pgxpool.Pool, storage *storage.Storage, genai genai.OpenAi, ctx *context.Context, config *config.Config) *receiptRepository {
+func New(repo *repository.Queries, db *pgxpool.Pool, storage storage.Storage, genai genai.OpenAi, cache *cache.Cache, ctx *context.Context, config *config.Config) *receiptRepository {
 	return &receiptRepository{
 		Repo:    repo,
 		Ctx:     ctx,
@@ -51,13 +43,14 @@ func New(repo *repository.Queries, db *pgxpool.Pool, storage *storage.Storage, g
 		Genai:   genai,
 		Db:      db,
 		Config:  config,
+		Cache:   cache,
 	}
 }
 
-func (r *receiptRepository) SaveReceipt(repo *repository.Queries, hash, bucket, key, text, name string, outingId uuid.UUID, receipt receipt.ParsedReceipt) error {
+func (r *receiptRepository) SaveReceipt(repo *repository.Queries, hash, bucket, key string, variants receipt.ImageVariants, text, name string, outingId uuid.UUID, phash pgtype.Int8, parsed receipt.ParsedReceipt) (uuid.UUID, error) {
 	tx, err := r.Db.BeginTx(*r.Ctx, pgx.TxOptions{})
 	if err != nil {
-		return fmt.Errorf("begin transaction: %w", err)
+		return uuid.Nil, fmt.Errorf("begin transaction: %w", err)
 	}
 	defer tx.Rollback(*r.Ctx)
 
@@ -71,215 +64,265 @@ func (r *receiptRepository) SaveReceipt(repo *repository.Queries, hash, bucket,
 		RawText:  text,
 		FileName: name,
 		OutingID: outingId,
+		Phash:    phash,
+
+		ThumbnailKey: nullKey(variants.ThumbnailKey),
+		MediumKey:    nullKey(variants.MediumKey),
 	})
 	if err != nil {
-		return fmt.Errorf("insert into receipt_images: %w", err)
+		return uuid.Nil, fmt.Errorf("insert into receipt_images: %w", err)
 	}
 
 	// 2. Insert into receipts
 	receiptId, err := qtx.InsertReceipt(*r.Ctx, repository.InsertReceiptParams{
 		ReceiptImageID: imageId,
-		Restaurant:     receipt.Restaurant,
-		Address:        receipt.Address,
-		Opened:         receipt.Opened,
-		OrderNumber:    receipt.OrderNumber,
-		OrderType:      receipt.OrderType,
-		TableNumber:    receipt.Table,
-		Server:         receipt.Server,
+		Restaurant:     parsed.Restaurant,
+		Address:        parsed.Address,
+		Opened: pgtype.Timestamptz{
+			Time:  parsed.Opened,
+			Valid: !parsed.Opened.IsZero(),
+		},
+		OpenedRaw:   parsed.Receipt.Opened,
+		OrderNumber: parsed.OrderNumber,
+		OrderType:   parsed.OrderType,
+		TableNumber: parsed.Table,
+		Server:      parsed.Server,
 		Subtotal: sql.NullFloat64{
-			Float64: receipt.Subtotal,
+			Float64: parsed.Subtotal,
 			Valid:   true,
 		},
 		SalesTax: sql.NullFloat64{
-			Float64: receipt.SalesTax,
+			Float64: parsed.SalesTax,
 			Valid:   true,
 		},
 		Total: sql.NullFloat64{
-			Float64: receipt.Total,
+			Float64: parsed.Total,
 			Valid:   true,
 		},
-		Copy: receipt.Copy,
+		Copy:          parsed.Copy,
+		PaymentMethod: parsed.Payment.Method,
+		PaymentAmountPaid: sql.NullFloat64{
+			Float64: parsed.Payment.AmountPaid,
+			Valid:   parsed.Payment.AmountPaid != 0,
+		},
+		PaymentTip: sql.NullFloat64{
+			Float64: parsed.Payment.Tip,
+			Valid:   true,
+		},
+		PaymentCardLastFour: parsed.Payment.CardLastFour,
+		PromptVersion:       receipt.PromptVersion,
+		SchemaVersion:       receipt.SchemaVersion(),
 	})
 	if err != nil {
-		return fmt.Errorf("insert into receipts: %w", err)
-	}
-
-	// 3. Insert order_items
-	for _, item := range receipt.Items {
-		err = qtx.InsertOrderItem(*r.Ctx, repository.InsertOrderItemParams{
-			ReceiptID: receiptId,
-			Name:      item.Name,
-			Price: sql.NullFloat64{
-				Float64: item.Price,
-				Valid:   true,
-			},
-			Quantity: int32(item.Quantity),
-		})
-		if err != nil {
-			return fmt.Errorf("insert into order_items: %w", err)
-		}
+		return uuid.Nil, fmt.Errorf("insert into receipts: %w", err)
 	}
 
-	fmt.Printf("receipt.OtherFees: %#v\n", receipt.OtherFees)
-
-	// 4. Insert other_fees
-	for _, fee := range receipt.OtherFees {
-		err = qtx.InsertOtherFee(*r.Ctx, repository.InsertOtherFeeParams{
-			ReceiptID: receiptId,
-			Name:      fee.Name,
-			Price: sql.NullFloat64{
-				Float64: fee.Price,
-				Valid:   true,
-			},
-		})
-		if err != nil {
-			return fmt.Errorf("insert into other_fees: %w", err)
-		}
+	// 3. Insert order_items, other_fees and discounts
+	if err := receipt.SaveLineItems(*r.Ctx, qtx, receiptId, parsed); err != nil {
+		return uuid.Nil, err
 	}
 
-	// 5. Commit transaction
+	// 4. Commit transaction
 	if err := tx.Commit(*r.Ctx); err != nil {
-		return fmt.Errorf("commit transaction: %w", err)
+		return uuid.Nil, fmt.Errorf("commit transaction: %w", err)
 	}
 
-	return nil
+	return receiptId, nil
 }
 
-func (r *receiptRepository) GetReceiptByHash(hash string) (*ReceiptWithDetails, error) {
-	row, err := r.Repo.GetReceiptByHash(*r.Ctx, hash)
+// outingLocation returns the timezone receipts in an outing are read in: the
+// outing's own timezone, else its owner's, else UTC.
+func (r *receiptRepository) outingLocation(outingId uuid.UUID) *time.Location {
+	name, err := r.Repo.GetOutingTimezone(*r.Ctx, outingId)
+	if err != nil {
+		return time.UTC
+	}
+	return receipt.LoadLocation(name)
+}
+
+// outingDateOrder returns how the outing's owner reads numeric dates: from
+// their profile's locale, else the locale the request was made in.
+func (r *receiptRepository) outingDateOrder(c *gin.Context, outingId uuid.UUID) receipt.DateOrder {
+	locale, err := r.Repo.GetOutingOwnerLocale(*r.Ctx, outingId)
+	if err == nil && locale != "" {
+		return receipt.LocaleDateOrder(locale)
+	}
+	return receipt.LocaleDateOrder(c.GetHeader("Accept-Language"))
+}
+
+// existingReceipt returns the receipt already created in the outing from the
+// exact same file, if any.
+func (r *receiptRepository) existingReceipt(hash string, outingId uuid.UUID) (*uuid.UUID, error) {
+	row, err := r.Repo.GetReceiptByHash(*r.Ctx, repository.GetReceiptByHashParams{
+		Hash:     hash,
+		OutingID: outingId,
+	})
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 		return nil, fmt.Errorf("query: %w", err)
 	}
-
-	var items []repository.OrderItem
-	var fees []repository.OtherFee
-
-	if err := json.Unmarshal([]byte(row.Items), &items); err != nil {
-		return nil, fmt.Errorf("unmarshal items: %w", err)
-	}
-	if err := json.Unmarshal([]byte(row.Fees), &fees); err != nil {
-		return nil, fmt.Errorf("unmarshal fees: %w", err)
-	}
-
-	return &ReceiptWithDetails{
-		ImageID:  row.ReceiptImageID,
-		Hash:     row.Hash,
-		Bucket:   row.Bucket,
-		Key:      row.Key,
-		RawText:  row.RawText,
-		FileName: row.FileName,
-		OutingID: row.OutingID,
-		Items:    items,
-		Fees:     fees,
-	}, nil
+	return &row.ReceiptID, nil
 }
 
 func (r *receiptRepository) ProcessReceipt(c *gin.Context) {
 
-	outingId := uuid.MustParse(c.GetHeader("outingid"))
-
-	fileHeader, err := c.FormFile("photo.0")
+	outingId, ok := utils.HeaderUUID(c, "outingid")
+	if !ok {
+		return
+	}
 
+	part, err := utils.FormFile(c, "photo.0")
+	if utils.TooLarge(c, err) {
+		return
+	}
 	if err != nil {
-		fmt.Println("Error: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		utils.BadRequest(c, "No file uploaded")
 		return
 	}
+	defer part.Close()
 
-	if !strings.HasPrefix(fileHeader.Header.Get("Content-Type"), "image/") {
-		fmt.Println("Error on file type: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Only image files are allowed"})
+	upload, err := receipt.ReadImageUpload(part, part.FileName(), c.Request.ContentLength, r.Config.MaxUploadBytes, r.Config.MaxImagePixels)
+	if utils.TooLarge(c, err) {
+		return
+	}
+	if errors.Is(err, receipt.ErrImageTooLarge) {
+		utils.ImageTooLarge(c, r.Config.MaxImagePixels)
+		return
+	}
+	if errors.Is(err, receipt.ErrNotImage) {
+		utils.BadRequest(c, "Only image files are allowed")
 		return
 	}
-
-	file, err := fileHeader.Open()
 	if err != nil {
-		fmt.Println("Error on opening file: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "opening file"})
+		utils.BadRequest(c, "reading file data")
 		return
 	}
-	defer file.Close()
+	defer upload.Close()
 
-	data, err := io.ReadAll(file)
+	user, err := auth.GetUser(c)
 	if err != nil {
-		fmt.Println("Error on reading file data: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "reading file data"})
+		utils.BadRequest(c, "getting user")
 		return
 	}
 
-	fileInfo, err := receipt.NewExtract(*r.Ctx, *r.Storage, r.Genai, r.Repo, data, fileHeader.Filename, r.Config.CloudVisionCredentials)
+	fileInfo, err := receipt.NewUploadExtract(*r.Ctx, r.Storage, r.Genai, r.Repo, r.Cache, upload, r.Config.CloudVisionCredentials)
 
 	if err != nil {
-		fmt.Println("Error on starting extraction: ", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "starting extraction"})
+		utils.InternalError(c, "starting extraction", err)
 		return
 	}
 
-	existing, err := r.GetReceiptByHash(fileInfo.ImageHash)
+	existing, err := r.existingReceipt(fileInfo.ImageHash, outingId)
 
 	if err != nil {
-		fmt.Println("Error on getting existing receipt image: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get existing receipt image"})
+		utils.InternalError(c, "Failed to get existing receipt image", err)
 		return
 	}
 
 	if existing != nil {
-		c.JSON(http.StatusOK, gin.H{"hash": fileInfo.ImageHash, "existing": true})
+		c.JSON(http.StatusOK, gin.H{"hash": fileInfo.ImageHash, "existing": true, "receipt_id": existing})
 		return
 	}
 
-	model, text, bucket, key, err := fileInfo.Run(*r.Ctx)
-
+	// the extraction is reserved up front so concurrent uploads cannot go
+	// over the quota, and handed back unless the model ended up being called
+	err = r.useExtraction(user.ID)
+	if errors.Is(err, errQuotaExceeded) {
+		r.quotaExceeded(c, nil)
+		return
+	}
 	if err != nil {
-		fmt.Println("Error on running model: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload receipt image"})
+		utils.InternalError(c, "Failed to process receipt image", err)
 		return
 	}
 
-	if err = r.SaveReceipt(r.Repo, fileInfo.ImageHash, bucket, key, text, fileHeader.Filename, outingId, model); err != nil {
-		fmt.Println("Error on saving receipt: ", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save receipt image"})
+	receiptId, duplicates, err := r.saveExtract(c, fileInfo, outingId)
+	if err != nil || !fileInfo.ModelCalled {
+		r.refundExtraction(c, user.ID)
+	}
+	if err != nil {
+		utils.InternalError(c, "Failed to process receipt image", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"hash": fileInfo.ImageHash, "existing": false})
+	c.JSON(http.StatusOK, gin.H{
+		"hash":       fileInfo.ImageHash,
+		"existing":   false,
+		"receipt_id": receiptId,
+		"duplicates": duplicates,
+	})
 }
 
 func (r *receiptRepository) GetReceipt(c *gin.Context) {
-	receiptId, err := uuid.Parse(c.Param("id"))
-
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid receipt id"})
+	receiptId, ok := utils.ParamUUID(c, "id")
+	if !ok {
 		return
 	}
 
 	receipt, err := r.Repo.GetReceipt(*r.Ctx, receiptId)
-
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "receipt not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "fetching receipt"})
+		utils.InternalError(c, "fetching receipt", err)
 		return
 	}
 
-	url, err := r.Storage.GetObjectUrl(*r.Ctx, receipt.Bucket, receipt.Key)
+	urls, err := r.imageUrls(c, receiptId, storedImage{
+		Bucket:          receipt.Bucket,
+		Key:             receipt.Key,
+		Thumbnail:       receipt.ThumbnailKey,
+		Medium:          receipt.MediumKey,
+		OriginalDeleted: receipt.OriginalDeletedAt.Valid,
+	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "getting object url"})
+		utils.InternalError(c, "getting object url", err)
 		return
 	}
 
-	c.JSON(http.StatusOK, toReceiptResponse(receipt, url))
+	c.JSON(http.StatusOK, toReceiptResponse(receipt, urls))
+}
+
+// splitsLocked writes an error response and returns true when the receipt's
+// outing no longer allows its splits to change.
+func (r *receiptRepository) splitsLocked(c *gin.Context, receiptId uuid.UUID) bool {
+	status, err := r.Repo.GetReceiptOutingStatus(*r.Ctx, receiptId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "receipt not found")
+		return true
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to check outing status", err)
+		return true
+	}
+	if !outingstatus.SplitsEditable(status) {
+		utils.Conflict(c, fmt.Sprintf("outing is %s, splits can no longer change", status))
+		return true
+	}
+	return false
 }
 
 func (r *receiptRepository) SaveSplit(c *gin.Context) {
 
 	var body SplitInput
-	if err := c.ShouldBindJSON(&body); err != nil {
-		utils.BadRequest(c, "invalid request")
+	if !utils.BindJSON(c, &body) {
 		return
 	}
 
+	receiptId, err := uuid.Parse(body.ReceiptId)
+	if err != nil {
+		utils.BadRequest(c, "invalid receipt id")
+		return
+	}
+	if r.splitsLocked(c, receiptId) {
+		return
+	}
+
+	var ids []uuid.UUID
+	splits := make([]repository.CreateSplitParams, 0, len(body.Items))
 	for _, item := range body.Items {
 		itemUuid, err := uuid.Parse(item.ItemId)
 		if err != nil {
@@ -291,38 +334,91 @@ func (r *receiptRepository) SaveSplit(c *gin.Context) {
 			utils.BadRequest(c, "invalid friend id")
 			return
 		}
-		r.Repo.CreateSplit(*r.Ctx, repository.CreateSplitParams{
+		if !slices.Contains(ids, itemUuid) {
+			ids = append(ids, itemUuid)
+		}
+		splits = append(splits, repository.CreateSplitParams{
 			FriendID:    friendUuid,
 			OrderItemID: itemUuid,
+			ReceiptID:   receiptId,
 			Quantity:    item.Quantity,
 		})
 	}
+
+	// modifiers are priced into the item they belong to and cannot be claimed
+	// on their own, or they would be left out of every total
+	n, err := r.Repo.CountReceiptItems(*r.Ctx, repository.CountReceiptItemsParams{
+		ReceiptID: receiptId,
+		Ids:       ids,
+	})
+	if err != nil {
+		utils.InternalError(c, "failed to save splits", err)
+		return
+	}
+	if n != int64(len(ids)) {
+		utils.BadRequest(c, "items must be top level items of the receipt")
+		return
+	}
+
+	for _, split := range splits {
+		if _, err := r.Repo.CreateSplit(*r.Ctx, split); err != nil {
+			utils.InternalError(c, "failed to save splits", err)
+			return
+		}
+	}
+}
+
+const maxFriendsPage = 100
+
+type friendsCursor struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"n"`
 }
 
 func (r *receiptRepository) GetFriends(c *gin.Context) {
-	receiptIdStr := c.Param("receipt_id")
-	receiptId, err := uuid.Parse(receiptIdStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outing ID"})
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	limit, ok := utils.PageLimit(c, maxFriendsPage, maxFriendsPage)
+	if !ok {
 		return
 	}
 
-	friends, err := r.Repo.GetFriends(*r.Ctx, receiptId)
+	params := repository.GetFriendsParams{
+		ReceiptID: receiptId,
+		PageLimit: limit + 1,
+	}
+
+	var cursor friendsCursor
+	if !utils.ReadCursor(c, &cursor) {
+		return
+	}
+	if cursor.ID != uuid.Nil {
+		params.CursorID = &cursor.ID
+		params.CursorName = cursor.Name
+	}
+
+	friends, err := r.Repo.GetFriends(*r.Ctx, params)
 	if err != nil {
-		fmt.Println("ERR: ", err)
-		utils.InternalServerError(c, "failed to fetch friends")
+		utils.InternalError(c, "failed to fetch friends", err)
 		return
 	}
 
+	if len(friends) > int(limit) {
+		friends = friends[:limit]
+		last := friends[len(friends)-1]
+		c.Header(utils.NextCursorHeader, utils.EncodeCursor(friendsCursor{ID: last.ID, Name: last.Name}))
+	}
+
 	c.JSON(http.StatusOK, friends)
 }
 
 func (r *receiptRepository) CreateFriend(c *gin.Context) {
 
 	var body CreateFriendInput
-	if err := c.ShouldBindJSON(&body); err != nil {
-		fmt.Println("ERR: ", err)
-		utils.BadRequest(c, "invalid request")
+	if !utils.BindJSON(c, &body) {
 		return
 	}
 
@@ -340,15 +436,13 @@ func (r *receiptRepository) CreateFriend(c *gin.Context) {
 
 	createFriend, err := toCreateFriend(body, outing)
 	if err != nil {
-		fmt.Println("ERR: ", err)
 		utils.BadRequest(c, "invalid request")
 		return
 	}
 
 	friendId, err := r.Repo.CreateOrGetFriend(*r.Ctx, createFriend)
 	if err != nil {
-		fmt.Println("ERR: ", err)
-		utils.InternalServerError(c, "failed to create friend")
+		utils.InternalError(c, "failed to create friend", err)
 		return
 	}
 
@@ -358,9 +452,7 @@ func (r *receiptRepository) CreateFriend(c *gin.Context) {
 func (r *receiptRepository) CreateSplit(c *gin.Context) {
 
 	var body CreateSplitInput
-	if err := c.ShouldBindJSON(&body); err != nil {
-		fmt.Println("ERR b: ", err)
-		utils.BadRequest(c, "invalid request")
+	if !utils.BindJSON(c, &body) {
 		return
 	}
 
@@ -370,6 +462,10 @@ func (r *receiptRepository) CreateSplit(c *gin.Context) {
 		return
 	}
 
+	if r.splitsLocked(c, *receiptId) {
+		return
+	}
+
 	if err = r.Repo.DeleteSplit(*r.Ctx, *receiptId); err != nil {
 		utils.BadRequest(c, "error deleting split")
 		return
@@ -385,3 +481,46 @@ func (r *receiptRepository) CreateSplit(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{})
 }
+
+func (r *receiptRepository) UpdateTip(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	var body UpdateTipInput
+	if !utils.BindJSON(c, &body) {
+		return
+	}
+
+	// the tip changes what everyone owes, so only the owner may set it
+	if !r.ownReceiptEditable(c, user.ID, receiptId) {
+		return
+	}
+
+	override := sql.NullFloat64{}
+	if body.TipPercentage != nil {
+		if *body.TipPercentage < 0 || *body.TipPercentage > 100 {
+			utils.BadRequest(c, "tip_percentage must be between 0 and 100")
+			return
+		}
+		override = sql.NullFloat64{Float64: *body.TipPercentage, Valid: true}
+	}
+
+	err = r.Repo.UpdateReceiptTipPercentage(*r.Ctx, repository.UpdateReceiptTipPercentageParams{
+		ID:                    receiptId,
+		TipPercentageOverride: override,
+	})
+	if err != nil {
+		utils.InternalServerError(c, "failed to update tip")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tip_percentage": body.TipPercentage})
+}
@@ -0,0 +1,220 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/receipt"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+// Proxied images are content addressed, but access is per user, so they may
+// only be cached by the client.
+const imageCacheControl = "private, max-age=86400"
+
+type ImageUrls struct {
+	Original  string
+	Medium    string
+	Thumbnail string
+}
+
+func nullKey(key string) pgtype.Text {
+	return pgtype.Text{String: key, Valid: key != ""}
+}
+
+// storedImage is the part of a receipt image row needed to serve it.
+type storedImage struct {
+	Bucket          string
+	Key             string
+	Thumbnail       pgtype.Text
+	Medium          pgtype.Text
+	OriginalDeleted bool
+}
+
+// variantKey picks the object key for a variant, falling back to the closest
+// size that is stored: images uploaded before variants existed or too small
+// to need one only have the original, and the retention policy removes the
+// original and medium copies. ok is false for an unknown variant and key is
+// empty when nothing is left to serve.
+func (img storedImage) variantKey(variant string) (key string, ok bool) {
+	original := pgtype.Text{String: img.Key, Valid: !img.OriginalDeleted}
+
+	var candidates []pgtype.Text
+	switch variant {
+	case receipt.VariantOriginal:
+		candidates = []pgtype.Text{original, img.Medium, img.Thumbnail}
+	case receipt.VariantMedium:
+		candidates = []pgtype.Text{img.Medium, original, img.Thumbnail}
+	case receipt.VariantThumbnail:
+		candidates = []pgtype.Text{img.Thumbnail, img.Medium, original}
+	default:
+		return "", false
+	}
+
+	for _, candidate := range candidates {
+		if candidate.Valid {
+			return candidate.String, true
+		}
+	}
+	return "", true
+}
+
+// proxyUrl points at GetImage. Guests are sent to the copy of the route that
+// accepts their token.
+func (r *receiptRepository) proxyUrl(receiptId uuid.UUID, variant string, guest bool) string {
+	prefix := "/api/v1"
+	if guest {
+		prefix = "/api/v1/guest"
+	}
+	return fmt.Sprintf("%s%s/receipt/%s/image?variant=%s", r.Config.ServerURL, prefix, receiptId, variant)
+}
+
+// imageUrls presigns every variant of an image. Variants get the longer TTL
+// since they are what lists and detail screens hold on to. When the storage
+// cannot presign, as with encrypted images, the URLs point at GetImage.
+func (r *receiptRepository) imageUrls(c *gin.Context, receiptId uuid.UUID, img storedImage) (ImageUrls, error) {
+	_, guest := auth.GetGuest(c)
+	originalTTL := time.Duration(r.Config.ImageURLTTLSeconds) * time.Second
+	variantTTL := time.Duration(r.Config.ImageVariantURLTTLSeconds) * time.Second
+
+	presigned := map[string]string{}
+	url := func(variant string) (string, error) {
+		key, _ := img.variantKey(variant)
+		if key == "" {
+			return "", nil
+		}
+		if url, ok := presigned[key]; ok {
+			return url, nil
+		}
+
+		ttl := variantTTL
+		if key == img.Key {
+			ttl = originalTTL
+		}
+		url, err := r.Storage.Presign(*r.Ctx, img.Bucket, key, ttl)
+		if errors.Is(err, storage.ErrPresignUnsupported) {
+			return r.proxyUrl(receiptId, variant, guest), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		presigned[key] = url
+		return url, nil
+	}
+
+	var urls ImageUrls
+	var err error
+	if urls.Original, err = url(receipt.VariantOriginal); err != nil {
+		return ImageUrls{}, err
+	}
+	if urls.Medium, err = url(receipt.VariantMedium); err != nil {
+		return ImageUrls{}, err
+	}
+	if urls.Thumbnail, err = url(receipt.VariantThumbnail); err != nil {
+		return ImageUrls{}, err
+	}
+	return urls, nil
+}
+
+// GetImage streams a receipt image through the API, for clients that cannot
+// or should not reach the object store directly. ?variant= is thumbnail,
+// medium (the default) or original. Only the outing's owner, its friends and
+// guests invited to it can fetch an image.
+func (r *receiptRepository) GetImage(c *gin.Context) {
+	receiptId, ok := utils.ParamUUID(c, "receipt_id")
+	if !ok {
+		return
+	}
+
+	stored, err := r.imageFor(c, receiptId)
+	if errors.Is(err, pgx.ErrNoRows) {
+		utils.NotFound(c, "receipt not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to get receipt image", err)
+		return
+	}
+
+	variant := c.DefaultQuery("variant", receipt.VariantMedium)
+	key, ok := stored.variantKey(variant)
+	if !ok {
+		utils.BadRequest(c, "variant must be thumbnail, medium or original")
+		return
+	}
+	if key == "" {
+		utils.Gone(c, "image is no longer stored")
+		return
+	}
+
+	// keys are content addressed, so the key itself identifies the bytes
+	etag := fmt.Sprintf("%q", key)
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", imageCacheControl)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	obj, info, err := r.Storage.Get(*r.Ctx, stored.Bucket, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		utils.NotFound(c, "image not found")
+		return
+	}
+	if err != nil {
+		utils.InternalError(c, "failed to read receipt image", err)
+		return
+	}
+	defer obj.Close()
+
+	c.DataFromReader(http.StatusOK, info.Size, info.ContentType, obj, nil)
+}
+
+// imageFor looks up a receipt's image for whoever is asking: a guest can see
+// any receipt in their outing, a user only receipts in outings they are part of.
+func (r *receiptRepository) imageFor(c *gin.Context, receiptId uuid.UUID) (storedImage, error) {
+	if guest, ok := auth.GetGuest(c); ok {
+		image, err := r.Repo.GetReceiptImageForOuting(*r.Ctx, repository.GetReceiptImageForOutingParams{
+			ID:       receiptId,
+			OutingID: guest.OutingID,
+		})
+		if err != nil {
+			return storedImage{}, err
+		}
+		return storedImage{
+			Bucket:          image.Bucket,
+			Key:             image.Key,
+			Thumbnail:       image.ThumbnailKey,
+			Medium:          image.MediumKey,
+			OriginalDeleted: image.OriginalDeletedAt.Valid,
+		}, nil
+	}
+
+	user, err := auth.GetUser(c)
+	if err != nil {
+		return storedImage{}, err
+	}
+	image, err := r.Repo.GetReceiptImageForUser(*r.Ctx, repository.GetReceiptImageForUserParams{
+		ReceiptID: receiptId,
+		UserID:    user.ID,
+	})
+	if err != nil {
+		return storedImage{}, err
+	}
+	return storedImage{
+		Bucket:          image.Bucket,
+		Key:             image.Key,
+		Thumbnail:       image.ThumbnailKey,
+		Medium:          image.MediumKey,
+		OriginalDeleted: image.OriginalDeletedAt.Valid,
+	}, nil
+}
@@ -0,0 +1,52 @@
+package receipt
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+var errQuotaExceeded = errors.New("monthly extraction quota exceeded")
+
+// useExtraction counts an extraction against the user's monthly quota, or
+// returns errQuotaExceeded when there is none left.
+func (r *receiptRepository) useExtraction(userId uuid.UUID) error {
+	_, err := r.Repo.UseExtraction(*r.Ctx, repository.UseExtractionParams{
+		UserID: userId,
+		Quota:  int32(r.Config.ExtractionQuotaMonthly),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errQuotaExceeded
+	}
+	return err
+}
+
+// refundExtraction gives back an extraction that failed or was answered from
+// the cache without calling the model.
+func (r *receiptRepository) refundExtraction(c *gin.Context, userId uuid.UUID) {
+	if err := r.Repo.RefundExtraction(*r.Ctx, userId); err != nil {
+		utils.Logger(c).Error("failed to refund extraction", zap.Stringer("user_id", userId), zap.Error(err))
+	}
+}
+
+func (r *receiptRepository) quotaExceeded(c *gin.Context, extra gin.H) {
+	resetsAt := utils.QuotaResetsAt(time.Now())
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(resetsAt).Seconds())))
+
+	meta := gin.H{
+		"quota":     r.Config.ExtractionQuotaMonthly,
+		"resets_at": resetsAt,
+	}
+	for k, v := range extra {
+		meta[k] = v
+	}
+	utils.Abort(c, utils.NewError(http.StatusTooManyRequests, utils.CodeQuotaExceeded, errQuotaExceeded.Error()).WithMeta(meta))
+}
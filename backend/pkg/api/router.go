@@ -5,13 +5,21 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/sharithg/civet/internal/cache"
 	"github.com/sharithg/civet/internal/config"
 	"github.com/sharithg/civet/internal/genai"
+	"github.com/sharithg/civet/internal/mail"
+	"github.com/sharithg/civet/internal/ratelimit"
 	"github.com/sharithg/civet/internal/repository"
 	"github.com/sharithg/civet/internal/storage"
+	"github.com/sharithg/civet/internal/token"
+	"github.com/sharithg/civet/pkg/api/admin"
 	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/files"
 	"github.com/sharithg/civet/pkg/api/outing"
+	"github.com/sharithg/civet/pkg/api/profile"
 	"github.com/sharithg/civet/pkg/api/receipt"
+	"github.com/sharithg/civet/pkg/api/search"
 	"github.com/sharithg/civet/pkg/middleware"
 	"go.uber.org/zap"
 )
@@ -20,20 +28,51 @@ type AppContext struct {
 	Logger  *zap.Logger
 	Repo    *repository.Queries
 	DB      *pgxpool.Pool
-	Storage *storage.Storage
+	Storage storage.Storage
+	Tokens  *token.Service
+	Mailer  mail.Sender
 	OpenAI  genai.OpenAi
+	Cache   *cache.Cache
+	Limiter ratelimit.Limiter
 	Context *context.Context
 	Config  *config.Config
 }
 
 func NewRouter(appCtx *AppContext) *gin.Engine {
 
-	authRepository := auth.New(appCtx.DB, appCtx.Repo, appCtx.Storage, appCtx.OpenAI, appCtx.Config, appCtx.Context)
-	outingsRepository := outing.New(appCtx.Repo, appCtx.Context)
-	receiptRepository := receipt.New(appCtx.Repo, appCtx.DB, appCtx.Storage, appCtx.OpenAI, appCtx.Context, appCtx.Config)
-	r := gin.Default()
+	authRepository := auth.New(appCtx.DB, appCtx.Repo, appCtx.Storage, appCtx.OpenAI, appCtx.Config, appCtx.Tokens, appCtx.Mailer, appCtx.Limiter, appCtx.Context)
+	outingsRepository := outing.New(appCtx.Repo, appCtx.Context, appCtx.Config)
+	receiptRepository := receipt.New(appCtx.Repo, appCtx.DB, appCtx.Storage, appCtx.OpenAI, appCtx.Cache, appCtx.Context, appCtx.Config)
+	profileRepository := profile.New(appCtx.Repo, appCtx.Storage, appCtx.Config, appCtx.Context)
+	searchRepository := search.New(appCtx.Repo, appCtx.Context)
+	adminRepository := admin.New(appCtx.Repo, appCtx.DB, appCtx.OpenAI, appCtx.Cache, appCtx.Context)
+	r := gin.New()
+	r.Use(gin.Logger(), middleware.Recovery(), middleware.Errors(appCtx.Logger))
 
-	r.Use(middleware.Cors())
+	// OCR and the model are paid per call
+	extractionLimit := middleware.RateLimit(appCtx.Context, appCtx.Limiter, "extraction",
+		ratelimit.PerHour(appCtx.Config.ExtractionRatePerHour, appCtx.Config.ExtractionRateBurst),
+		ratelimit.PerHour(appCtx.Config.ExtractionIPRatePerHour, appCtx.Config.ExtractionRateBurst))
+
+	// every sign in link is an email sent on the server's behalf; the
+	// handlers also limit each address
+	emailLimit := middleware.RateLimit(appCtx.Context, appCtx.Limiter, "email",
+		ratelimit.PerHour(appCtx.Config.EmailIPRatePerHour, appCtx.Config.EmailRateBurst),
+		ratelimit.PerHour(appCtx.Config.EmailIPRatePerHour, appCtx.Config.EmailRateBurst))
+
+	// uploads are streamed, so only small forms are ever parsed into memory
+	r.MaxMultipartMemory = appCtx.Config.MaxRequestBytes
+
+	r.Use(middleware.Cors(appCtx.Config))
+	r.Use(middleware.BodyLimit(appCtx.Config.MaxRequestBytes, map[string]int64{
+		"/api/v1/inbound/email":  appCtx.Config.MaxEmailBytes,
+		"/api/v1/receipt/email":  appCtx.Config.MaxEmailBytes,
+		"/api/v1/receipt/upload": appCtx.Config.MaxUploadBytes,
+		"/api/v1/me/avatar":      appCtx.Config.MaxUploadBytes,
+	}))
+	if appCtx.Config.CSRFEnabled {
+		r.Use(middleware.CSRF(appCtx.Config))
+	}
 
 	// Auth routes
 	authRoutes := r.Group("/api/v1/auth")
@@ -44,18 +83,79 @@ func NewRouter(appCtx *AppContext) *gin.Engine {
 		authRoutes.POST("/token", authRepository.GoogleAuthTokenHandler)
 		authRoutes.POST("/refresh", authRepository.RefreshTokenHandler)
 		authRoutes.GET("/session", authRepository.SessionHandler)
+		authRoutes.GET("/csrf", authRepository.CSRFToken)
+		authRoutes.POST("/apple", authRepository.AppleAuthTokenHandler)
+		authRoutes.POST("/email/start", emailLimit, authRepository.StartEmailLogin)
+		authRoutes.GET("/email/callback", authRepository.EmailCallback)
+		authRoutes.POST("/email/verify", authRepository.VerifyEmailLogin)
+		authRoutes.POST("/passkeys/login/start", authRepository.StartPasskeyLogin)
+		authRoutes.POST("/passkeys/login/finish", authRepository.FinishPasskeyLogin)
+	}
+
+	r.GET("/.well-known/jwks.json", authRepository.JWKS)
+
+	// Inbound email webhook, authenticated with a shared secret
+	r.POST("/api/v1/inbound/email", receiptRepository.InboundEmail)
+
+	// Presigned objects when storage is on the local filesystem
+	if fs, ok := appCtx.Storage.(*storage.Filesystem); ok {
+		filesRepository := files.New(fs, appCtx.Context)
+		r.GET(storage.FilesPath+"/:bucket/*key", filesRepository.Serve)
+	}
+
+	// Guest share links, exchanged for a token scoped to one outing
+	r.GET("/api/v1/guest/invite/:invite", authRepository.GuestInviteRedirect)
+	r.POST("/api/v1/guest/session", authRepository.GuestSession)
+
+	guests := r.Group("/api/v1/guest")
+	guests.Use(middleware.GuestAuth(appCtx.Context, appCtx.Repo, appCtx.Tokens))
+	{
+		guests.GET("/outing/:outing_id/receipts", outingsRepository.GetReceipts)
+		guests.GET("/outing/:outing_id/friends", outingsRepository.GetFriends)
+		guests.GET("/outing/:outing_id/payee", profileRepository.GetPayee)
+		guests.GET("/receipt/item/:id", receiptRepository.GetReceipt)
+		guests.GET("/receipt/:receipt_id/friends", receiptRepository.GetFriends)
+		guests.GET("/receipt/:receipt_id/image", receiptRepository.GetImage)
+		guests.PUT("/receipt/:receipt_id/claims", receiptRepository.ClaimItems)
 	}
 
 	v1 := r.Group("/api/v1")
-	v1.Use(middleware.CheckAuth(appCtx.Context, appCtx.Repo, appCtx.Config))
+	v1.Use(middleware.CheckAuth(appCtx.Context, appCtx.Repo, appCtx.Config, appCtx.Tokens))
+
+	sessions := v1.Group("/auth")
+	{
+		sessions.POST("/logout", authRepository.Logout)
+		sessions.GET("/sessions", authRepository.ListSessions)
+		sessions.DELETE("/sessions", authRepository.RevokeOtherSessions)
+		sessions.DELETE("/sessions/:session_id", authRepository.RevokeSession)
+		sessions.GET("/identities", authRepository.ListIdentities)
+		sessions.POST("/identities/email", emailLimit, authRepository.StartEmailLink)
+		sessions.POST("/identities/email/verify", authRepository.VerifyEmailLink)
+		sessions.POST("/identities/:provider", authRepository.LinkIdentity)
+		sessions.DELETE("/identities/:identity_id", authRepository.UnlinkIdentity)
+		sessions.GET("/passkeys", authRepository.ListPasskeys)
+		sessions.POST("/passkeys/register/start", authRepository.StartPasskeyRegistration)
+		sessions.POST("/passkeys/register/finish", authRepository.FinishPasskeyRegistration)
+		sessions.DELETE("/passkeys/:credential_id", authRepository.DeletePasskey)
+		sessions.POST("/guest/claim", authRepository.ClaimGuest)
+	}
 
 	{
 		receipts := v1.Group("/receipt")
 		{
-			receipts.POST("/upload", receiptRepository.ProcessReceipt)
+			receipts.POST("/upload", extractionLimit, receiptRepository.ProcessReceipt)
+			receipts.POST("/email", extractionLimit, receiptRepository.ProcessEmail)
+			receipts.GET("/email/address", receiptRepository.GetForwardingAddress)
+			receipts.PUT("/email/address", receiptRepository.SetForwardingOuting)
 			receipts.GET("/item/:id", receiptRepository.GetReceipt)
 			receipts.POST("/split", receiptRepository.SaveSplit)
 			receipts.GET("/:receipt_id/friends", receiptRepository.GetFriends)
+			receipts.GET("/:receipt_id/image", receiptRepository.GetImage)
+			receipts.PATCH("/:receipt_id/tip", receiptRepository.UpdateTip)
+			receipts.DELETE("/:receipt_id", receiptRepository.DeleteReceipt)
+			receipts.POST("/:receipt_id/restore", receiptRepository.RestoreReceipt)
+			receipts.GET("/:receipt_id/duplicates", receiptRepository.GetDuplicates)
+			receipts.POST("/:receipt_id/duplicates/:candidate_id", receiptRepository.ResolveDuplicate)
 			receipts.POST("/friends", receiptRepository.CreateFriend)
 			receipts.POST("/friends/split", receiptRepository.CreateSplit)
 		}
@@ -66,6 +166,33 @@ func NewRouter(appCtx *AppContext) *gin.Engine {
 			outings.GET("", outingsRepository.GetOutings)
 			outings.GET("/:outing_id/receipts", outingsRepository.GetReceipts)
 			outings.GET("/:outing_id/friends", outingsRepository.GetFriends)
+			outings.PATCH("/:outing_id", outingsRepository.UpdateOuting)
+			outings.PATCH("/:outing_id/status", outingsRepository.UpdateStatus)
+			outings.DELETE("/:outing_id", outingsRepository.DeleteOuting)
+			outings.POST("/:outing_id/restore", outingsRepository.RestoreOuting)
+			outings.GET("/:outing_id/payee", profileRepository.GetPayee)
+			outings.POST("/:outing_id/friends/:friend_id/invite", outingsRepository.CreateInvite)
+			outings.DELETE("/:outing_id/friends/:friend_id/invite", outingsRepository.RevokeInvites)
+		}
+
+		me := v1.Group("/me")
+		{
+			me.GET("", profileRepository.GetProfile)
+			me.PATCH("", profileRepository.UpdateProfile)
+			me.DELETE("", authRepository.DeleteAccount)
+			me.POST("/avatar", profileRepository.UploadAvatar)
+			me.DELETE("/avatar", profileRepository.DeleteAvatar)
+		}
+		v1.GET("/users/:user_id/avatar", profileRepository.GetAvatar)
+
+		v1.GET("/search", searchRepository.Search)
+
+		admins := v1.Group("/admin")
+		admins.Use(middleware.RequireAdmin(appCtx.Config))
+		{
+			admins.GET("/reprocess", adminRepository.ListOutdated)
+			admins.POST("/reprocess/:receipt_id", adminRepository.Reprocess)
+			admins.GET("/cache", adminRepository.CacheStats)
 		}
 
 	}
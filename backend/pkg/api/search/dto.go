@@ -0,0 +1,42 @@
+package search
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+type SearchResult struct {
+	ReceiptID    uuid.UUID  `json:"receipt_id"`
+	Restaurant   string     `json:"restaurant"`
+	Total        *float64   `json:"total"`
+	Opened       *time.Time `json:"opened"`
+	OutingID     uuid.UUID  `json:"outing_id"`
+	OutingName   string     `json:"outing_name"`
+	Snippet      string     `json:"snippet"`
+	MatchedItems []string   `json:"matched_items"`
+}
+
+func toSearchResults(rows []repository.SearchReceiptsRow) []SearchResult {
+	results := []SearchResult{}
+
+	for _, row := range rows {
+		result := SearchResult{
+			ReceiptID:    row.ID,
+			Restaurant:   row.Restaurant,
+			Total:        utils.NullFloat64ToPtr(row.Total),
+			OutingID:     row.OutingID,
+			OutingName:   row.OutingName,
+			Snippet:      row.Snippet,
+			MatchedItems: row.MatchedItems,
+		}
+		if row.Opened.Valid {
+			result.Opened = &row.Opened.Time
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
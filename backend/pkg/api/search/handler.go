@@ -0,0 +1,114 @@
+package search
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/sharithg/civet/internal/outingstatus"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type searchRepository struct {
+	Repo *repository.Queries
+	Ctx  *context.Context
+}
+
+func New(repo *repository.Queries, ctx *context.Context) *searchRepository {
+	return &searchRepository{Repo: repo, Ctx: ctx}
+}
+
+type searchCursor struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"t"`
+}
+
+// Search finds receipts in the user's outings whose restaurant, item names or
+// OCR text match q. q uses web search syntax: quoted phrases, "or" and a
+// leading "-" to exclude a word. Results are newest first and can be narrowed
+// by outing_id, outing status and a from/to date range.
+func (r *searchRepository) Search(c *gin.Context) {
+	user, err := auth.GetUser(c)
+	if err != nil {
+		utils.BadRequest(c, "getting user")
+		return
+	}
+
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		utils.BadRequest(c, "q is required")
+		return
+	}
+
+	params := repository.SearchReceiptsParams{
+		Query:    query,
+		UserID:   user.ID,
+		Statuses: []string{},
+	}
+
+	if raw := c.Query("outing_id"); raw != "" {
+		outingID, err := uuid.Parse(raw)
+		if err != nil {
+			utils.BadRequest(c, "invalid outing id")
+			return
+		}
+		params.OutingID = &outingID
+	}
+
+	if raw := c.Query("status"); raw != "" {
+		for _, status := range strings.Split(raw, ",") {
+			status = strings.TrimSpace(status)
+			if !outingstatus.Valid(status) {
+				utils.BadRequest(c, fmt.Sprintf("invalid status %q", status))
+				return
+			}
+			params.Statuses = append(params.Statuses, status)
+		}
+	}
+
+	var ok bool
+	if params.DateFrom, params.DateTo, ok = utils.DateRange(c); !ok {
+		return
+	}
+
+	limit, ok := utils.PageLimit(c, defaultPageLimit, maxPageLimit)
+	if !ok {
+		return
+	}
+	params.PageLimit = limit + 1
+
+	var cursor searchCursor
+	if !utils.ReadCursor(c, &cursor) {
+		return
+	}
+	if cursor.ID != uuid.Nil {
+		params.CursorID = &cursor.ID
+		params.CursorTime = pgtype.Timestamp{Time: cursor.CreatedAt, Valid: true}
+	}
+
+	rows, err := r.Repo.SearchReceipts(*r.Ctx, params)
+	if err != nil {
+		utils.InternalError(c, "failed to search receipts", err)
+		return
+	}
+
+	if len(rows) > int(limit) {
+		rows = rows[:limit]
+		last := rows[len(rows)-1]
+		c.Header(utils.NextCursorHeader, utils.EncodeCursor(searchCursor{ID: last.ID, CreatedAt: last.CreatedAt}))
+	}
+
+	c.JSON(http.StatusOK, toSearchResults(rows))
+}
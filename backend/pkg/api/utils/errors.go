@@ -0,0 +1,161 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code tells clients what kind of error they got without them having to
+// match on messages.
+type Code string
+
+const (
+	CodeBadRequest      Code = "bad_request"
+	CodeValidation      Code = "validation_failed"
+	CodeUnauthorized    Code = "unauthorized"
+	CodeForbidden       Code = "forbidden"
+	CodeNotFound        Code = "not_found"
+	CodeConflict        Code = "conflict"
+	CodeGone            Code = "gone"
+	CodeUnprocessable   Code = "unprocessable"
+	CodeTooLarge        Code = "payload_too_large"
+	CodeRateLimited     Code = "rate_limited"
+	CodeQuotaExceeded   Code = "quota_exceeded"
+	CodeInternal        Code = "internal"
+	CodeUpstreamFailure Code = "upstream_failure"
+)
+
+// FieldError is what is wrong with one field of a request.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error response. Handlers abort with one and the Errors
+// middleware writes it, so every error has the same shape:
+//
+//	{"error": "<message>", "code": "<code>", "fields": [...]}
+//
+// with any Meta merged in. Err is the underlying cause; it is logged for
+// server errors but never sent to the client.
+type Error struct {
+	Status  int
+	Code    Code
+	Message string
+	Fields  []FieldError
+	Meta    gin.H
+	Err     error
+}
+
+func NewError(status int, code Code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// WithCause records what caused the error, for the logs.
+func (e *Error) WithCause(err error) *Error {
+	e.Err = err
+	return e
+}
+
+// WithMeta adds fields to the response body alongside the error.
+func (e *Error) WithMeta(meta gin.H) *Error {
+	e.Meta = meta
+	return e
+}
+
+// Body is the JSON the error is sent as.
+func (e *Error) Body() gin.H {
+	body := gin.H{}
+	for k, v := range e.Meta {
+		body[k] = v
+	}
+	body["error"] = e.Message
+	body["code"] = e.Code
+	if len(e.Fields) > 0 {
+		body["fields"] = e.Fields
+	}
+	return body
+}
+
+// AsError is the response for any error. Errors that are not an *Error are
+// server errors whose details stay out of the response.
+func AsError(err error) *Error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return tooLargeError(maxBytesErr.Limit)
+	}
+	return NewError(http.StatusInternalServerError, CodeInternal, "internal server error").WithCause(err)
+}
+
+// Abort stops the request with err, which the Errors middleware responds with.
+func Abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
+
+func BadRequest(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusBadRequest, CodeBadRequest, s))
+}
+
+func Unauthorized(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusUnauthorized, CodeUnauthorized, s))
+}
+
+func Forbidden(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusForbidden, CodeForbidden, s))
+}
+
+func NotFound(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusNotFound, CodeNotFound, s))
+}
+
+func Conflict(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusConflict, CodeConflict, s))
+}
+
+func Gone(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusGone, CodeGone, s))
+}
+
+func Unprocessable(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusUnprocessableEntity, CodeUnprocessable, s))
+}
+
+// RateLimited tells the client to back off for retryAfter.
+func RateLimited(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	Abort(c, NewError(http.StatusTooManyRequests, CodeRateLimited, "rate limit exceeded, try again later").
+		WithMeta(gin.H{"retry_after": seconds}))
+}
+
+func InternalServerError(c *gin.Context, s string) {
+	Abort(c, NewError(http.StatusInternalServerError, CodeInternal, s))
+}
+
+// InternalError is InternalServerError for a failure with a cause worth
+// logging.
+func InternalError(c *gin.Context, s string, err error) {
+	Abort(c, NewError(http.StatusInternalServerError, CodeInternal, s).WithCause(err))
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const loggerKey = "logger"
+
+// SetLogger makes logger available to the rest of the request through Logger.
+func SetLogger(c *gin.Context, logger *zap.Logger) {
+	c.Set(loggerKey, logger)
+}
+
+// Logger returns the request's logger, already tagged with its method and
+// route. Outside a request that went through the Errors middleware it
+// discards everything.
+func Logger(c *gin.Context) *zap.Logger {
+	if logger, ok := c.Get(loggerKey); ok {
+		return logger.(*zap.Logger)
+	}
+	return zap.NewNop()
+}
@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// NextCursorHeader carries the cursor for the next page of a list response.
+// It is absent on the last page.
+const NextCursorHeader = "X-Next-Cursor"
+
+// EncodeCursor packs the sort key of the last row on a page into an opaque
+// string that clients pass back as ?cursor= for the next page.
+func EncodeCursor(v any) string {
+	raw, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func DecodeCursor(s string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+// ReadCursor decodes the cursor query parameter into v. It returns false,
+// having written a 400, when the cursor is malformed; a missing cursor leaves
+// v untouched.
+func ReadCursor(c *gin.Context, v any) bool {
+	cursor := c.Query("cursor")
+	if cursor == "" {
+		return true
+	}
+	if err := DecodeCursor(cursor, v); err != nil {
+		Abort(c, ValidationError(FieldError{Field: "cursor", Message: "is invalid"}))
+		return false
+	}
+	return true
+}
+
+// PageLimit reads the limit query parameter, writing a 400 when it is out of range.
+func PageLimit(c *gin.Context, fallback, max int) (int32, bool) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(fallback)))
+	if err != nil || limit < 1 || limit > max {
+		Abort(c, ValidationError(FieldError{Field: "limit", Message: fmt.Sprintf("must be between 1 and %d", max)}))
+		return 0, false
+	}
+	return int32(limit), true
+}
+
+// ParseDate reads a calendar date in YYYY-MM-DD form. An empty string is a null date.
+func ParseDate(s string) (pgtype.Date, error) {
+	if s == "" {
+		return pgtype.Date{}, nil
+	}
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return pgtype.Date{}, err
+	}
+	return pgtype.Date{Time: t, Valid: true}, nil
+}
+
+// DateRange reads the inclusive from and to query parameters.
+func DateRange(c *gin.Context) (from, to pgtype.Date, ok bool) {
+	from, err := ParseDate(c.Query("from"))
+	if err != nil {
+		Abort(c, ValidationError(FieldError{Field: "from", Message: "must be a date in YYYY-MM-DD form"}))
+		return from, to, false
+	}
+	to, err = ParseDate(c.Query("to"))
+	if err != nil {
+		Abort(c, ValidationError(FieldError{Field: "to", Message: "must be a date in YYYY-MM-DD form"}))
+		return from, to, false
+	}
+	return from, to, true
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func tooLargeError(limit int64) *Error {
+	size := fmt.Sprintf("%d bytes", limit)
+	if limit >= 1<<20 {
+		size = fmt.Sprintf("%.1f MB", float64(limit)/(1<<20))
+	}
+	return NewError(http.StatusRequestEntityTooLarge, CodeTooLarge, "request body must be at most "+size).
+		WithMeta(gin.H{"limit": limit})
+}
+
+// PayloadTooLarge is the response for any request or upload over its limit.
+func PayloadTooLarge(c *gin.Context, limit int64) {
+	Abort(c, tooLargeError(limit))
+}
+
+// TooLarge responds with a 413 and reports true when err came from reading
+// past a size limit.
+func TooLarge(c *gin.Context, err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return false
+	}
+	PayloadTooLarge(c, maxBytesErr.Limit)
+	return true
+}
+
+// FormFile streams the named file from a multipart request body instead of
+// buffering the whole form the way gin's FormFile does. The part must be read
+// before the request body is used for anything else.
+func FormFile(c *gin.Context, name string) (*multipart.Part, error) {
+	reader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, http.ErrMissingFile
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == name && part.FileName() != "" {
+			return part, nil
+		}
+		part.Close()
+	}
+}
+
+// ImageTooLarge is the response for an image over its pixel limit.
+func ImageTooLarge(c *gin.Context, maxPixels int) {
+	message := fmt.Sprintf("image must be at most %d megapixels", max(maxPixels/1_000_000, 1))
+	Abort(c, NewError(http.StatusRequestEntityTooLarge, CodeTooLarge, message).
+		WithMeta(gin.H{"max_pixels": maxPixels}))
+}
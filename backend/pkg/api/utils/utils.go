@@ -2,9 +2,7 @@ package utils
 
 import (
 	"database/sql"
-	"net/http"
-
-	"github.com/gin-gonic/gin"
+	"time"
 )
 
 func NullFloat64ToPtr(n sql.NullFloat64) *float64 {
@@ -14,12 +12,8 @@ func NullFloat64ToPtr(n sql.NullFloat64) *float64 {
 	return nil
 }
 
-func BadRequest(c *gin.Context, s string) {
-	c.JSON(http.StatusBadRequest, gin.H{"error": s})
-	return
-}
-
-func InternalServerError(c *gin.Context, s string) {
-	c.JSON(http.StatusInternalServerError, gin.H{"error": s})
-	return
+// QuotaResetsAt is when monthly quotas, counted in UTC months, start over.
+func QuotaResetsAt(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
 }
@@ -0,0 +1,155 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+)
+
+func init() {
+	// validation errors name fields the way clients send them
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// ValidationError is a 400 listing the fields of a request that are wrong. The
+// message names the first so clients that only show "error" stay useful.
+func ValidationError(fields ...FieldError) *Error {
+	message := "invalid request"
+	if len(fields) > 0 {
+		message = fields[0].Field + " " + fields[0].Message
+	}
+	apiErr := NewError(http.StatusBadRequest, CodeValidation, message)
+	apiErr.Fields = fields
+	return apiErr
+}
+
+// BindJSON decodes and validates a JSON body into obj, responding with the
+// fields at fault when that fails.
+func BindJSON(c *gin.Context, obj any) bool {
+	return bindWith(c, obj, binding.JSON)
+}
+
+// Bind is BindJSON for bodies of whatever type the request declares.
+func Bind(c *gin.Context, obj any) bool {
+	return bindWith(c, obj, binding.Default(c.Request.Method, c.ContentType()))
+}
+
+func bindWith(c *gin.Context, obj any, b binding.Binding) bool {
+	err := c.ShouldBindWith(obj, b)
+	if err == nil {
+		return true
+	}
+	if TooLarge(c, err) {
+		return false
+	}
+	Abort(c, bindingError(err))
+	return false
+}
+
+func bindingError(err error) *Error {
+	var validationErrs validator.ValidationErrors
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &validationErrs):
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			// the namespace starts with the name of the request type
+			_, field, _ := strings.Cut(fe.Namespace(), ".")
+			fields = append(fields, FieldError{Field: field, Message: validationMessage(fe)})
+		}
+		return ValidationError(fields...)
+	case errors.As(err, &typeErr):
+		return ValidationError(FieldError{Field: typeErr.Field, Message: "must be " + typeName(typeErr.Type)})
+	case errors.As(err, &syntaxErr), errors.Is(err, io.ErrUnexpectedEOF):
+		return NewError(http.StatusBadRequest, CodeValidation, "request body is not valid JSON")
+	case errors.Is(err, io.EOF):
+		return NewError(http.StatusBadRequest, CodeValidation, "request body is required")
+	}
+	return NewError(http.StatusBadRequest, CodeValidation, "invalid request")
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email"
+	case "uuid", "uuid4":
+		return "must be a valid id"
+	case "oneof":
+		return "must be one of " + strings.Join(strings.Fields(fe.Param()), ", ")
+	case "min", "gte":
+		return "must be at least " + fe.Param()
+	case "max", "lte":
+		return "must be at most " + fe.Param()
+	case "gt":
+		return "must be more than " + fe.Param()
+	case "lt":
+		return "must be less than " + fe.Param()
+	}
+	return fmt.Sprintf("failed the %s check", fe.Tag())
+}
+
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "a list"
+	}
+	return "an object"
+}
+
+// ParamUUID parses the id in a path parameter, responding with a validation
+// error when it is not one.
+func ParamUUID(c *gin.Context, name string) (uuid.UUID, bool) {
+	return parseUUID(c, name, c.Param(name))
+}
+
+// HeaderUUID is ParamUUID for an id sent in a request header.
+func HeaderUUID(c *gin.Context, name string) (uuid.UUID, bool) {
+	return parseUUID(c, name, c.GetHeader(name))
+}
+
+func parseUUID(c *gin.Context, field, value string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(value)
+	if err != nil {
+		message := "must be a valid id"
+		if value == "" {
+			message = "is required"
+		}
+		Abort(c, ValidationError(FieldError{Field: field, Message: message}))
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+// RequireAdmin allows the request through only if the user set by CheckAuth
+// has an email listed in ADMIN_EMAILS.
+func RequireAdmin(config *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRaw, _ := c.Get("currentUser")
+		user, ok := userRaw.(repository.GetUserBySubRow)
+		if !ok {
+			utils.Unauthorized(c, "User not found")
+			return
+		}
+
+		for _, email := range config.AdminEmails {
+			if strings.EqualFold(email, user.Email) {
+				c.Next()
+				return
+			}
+		}
+
+		utils.Forbidden(c, "Admin access required")
+	}
+}
@@ -2,18 +2,17 @@ package middleware
 
 import (
 	"context"
-	"fmt"
-	"net/http"
 	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 	"github.com/sharithg/civet/internal/config"
 	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/token"
+	"github.com/sharithg/civet/pkg/api/utils"
 )
 
-func CheckAuth(ctx *context.Context, r *repository.Queries, config *config.Config) gin.HandlerFunc {
+func CheckAuth(ctx *context.Context, r *repository.Queries, config *config.Config, tokens *token.Service) gin.HandlerFunc {
 	return func(c *gin.Context) {
 
 		var tokenString string
@@ -25,8 +24,7 @@ func CheckAuth(ctx *context.Context, r *repository.Queries, config *config.Confi
 			// Get token from cookie
 			cookie, err := c.Cookie(config.CookieName)
 			if err != nil {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "auth_token cookie missing"})
-				c.Abort()
+				utils.Unauthorized(c, "auth_token cookie missing")
 				return
 			}
 			tokenString = cookie
@@ -34,52 +32,42 @@ func CheckAuth(ctx *context.Context, r *repository.Queries, config *config.Confi
 			// Get token from Authorization header
 			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is missing"})
-				c.Abort()
+				utils.Unauthorized(c, "Authorization header is missing")
 				return
 			}
 
 			authToken := strings.Split(authHeader, " ")
 			if len(authToken) != 2 || authToken[0] != "Bearer" {
-				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
-				c.Abort()
+				utils.Unauthorized(c, "Invalid token format")
 				return
 			}
 			tokenString = authToken[1]
 		}
-		// Parse JWT
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(config.JWTSecret), nil
-		})
-		if err != nil || !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
-			c.Abort()
-			return
-		}
-
-		// Extract claims
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
-			c.Abort()
+		claims, err := tokens.Verify(tokenString, token.TypeAccess)
+		if err != nil {
+			utils.Unauthorized(c, "Invalid or expired token")
 			return
 		}
 
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
-			c.Abort()
-			return
+		// tokens issued before sessions existed carry no sid and simply
+		// expire; the others stop working as soon as their session is revoked
+		if claims.SessionID != "" {
+			sessionID, err := uuid.Parse(claims.SessionID)
+			if err != nil {
+				utils.Unauthorized(c, "Invalid token claims")
+				return
+			}
+			active, err := r.IsSessionActive(*ctx, sessionID)
+			if err != nil || !active {
+				utils.Unauthorized(c, "Session revoked")
+				return
+			}
+			c.Set("sessionID", sessionID)
 		}
 
-		sub := claims["sub"].(string)
-
-		user, err := r.GetUserBySub(*ctx, sub)
+		user, err := r.GetUserBySub(*ctx, claims.Sub)
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
-			c.Abort()
+			utils.Unauthorized(c, "User not found")
 			return
 		}
 
@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+// BodyLimit caps the size of request bodies at defaultLimit bytes, or at the
+// limit routes gives the matched route's full path. Requests that declare a larger
+// Content-Length are refused up front, and reading past the limit fails with
+// an *http.MaxBytesError.
+func BodyLimit(defaultLimit int64, routes map[string]int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := routes[c.FullPath()]
+		if !ok {
+			limit = defaultLimit
+		}
+		if c.Request.ContentLength > limit {
+			utils.PayloadTooLarge(c, limit)
+			return
+		}
+
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		c.Next()
+	}
+}
@@ -5,23 +5,16 @@ import (
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/config"
 )
 
-func Cors() gin.HandlerFunc {
+func Cors(config *config.Config) gin.HandlerFunc {
 	return cors.New(cors.Config{
-		AllowOrigins: []string{
-			"http://127.0.0.1",
-			"http://127.0.0.1:8001",
-			"http://localhost",
-			"http://localhost:8001",
-			"http://localhost:8081"},
-		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders: []string{"Authorization", "Content-Type", "X-CSRF-Token", "platform", "outingid"},
-		//ExposeHeaders:    []string{"Content-Length"},
+		AllowOriginFunc:  config.OriginAllowed,
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Authorization", "Content-Type", "X-CSRF-Token", "platform", "outingid"},
+		ExposeHeaders:    []string{"X-Next-Cursor", "X-Total-Count", "X-CSRF-Token"},
 		AllowCredentials: true,
-		//AllowOriginFunc: func(origin string) bool {
-		//	return origin == "https://github.com"
-		//},
-		MaxAge: 12 * time.Hour,
+		MaxAge:           12 * time.Hour,
 	})
 }
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/config"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"go.uber.org/zap"
+)
+
+func newCSRFRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{
+		CookieName:        "access_token",
+		RefreshCookieName: "refresh_token",
+		CSRFCookieName:    "csrf_token",
+		AllowedOrigins:    []string{"https://app.example.com"},
+		RefreshExpiration: 3600,
+	}
+	r := gin.New()
+	r.Use(Errors(zap.NewNop()), CSRF(cfg))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+	r.GET("/", ok)
+	r.POST("/", ok)
+	return r
+}
+
+func TestCSRF(t *testing.T) {
+	r := newCSRFRouter()
+
+	session := &http.Cookie{Name: "access_token", Value: "jwt"}
+	refresh := &http.Cookie{Name: "refresh_token", Value: "refresh"}
+	csrf := &http.Cookie{Name: "csrf_token", Value: "token"}
+	const allowed = "https://app.example.com"
+
+	tests := []struct {
+		name    string
+		method  string
+		cookies []*http.Cookie
+		headers map[string]string
+		want    int
+	}{
+		{"get without session", http.MethodGet, nil, nil, http.StatusNoContent},
+		{"get with session", http.MethodGet, []*http.Cookie{session, csrf}, nil, http.StatusNoContent},
+		{"bearer client", http.MethodPost, nil, nil, http.StatusNoContent},
+		{"no session from allowed origin", http.MethodPost, nil, map[string]string{"Origin": allowed}, http.StatusNoContent},
+		{"no session from other origin", http.MethodPost, nil, map[string]string{"Origin": "https://evil.example"}, http.StatusForbidden},
+		{"matching token", http.MethodPost, []*http.Cookie{session, csrf},
+			map[string]string{"Origin": allowed, auth.CSRFHeader: "token"}, http.StatusNoContent},
+		{"refresh cookie only", http.MethodPost, []*http.Cookie{refresh, csrf},
+			map[string]string{"Origin": allowed, auth.CSRFHeader: "token"}, http.StatusNoContent},
+		{"origin from referer", http.MethodPost, []*http.Cookie{session, csrf},
+			map[string]string{"Referer": allowed + "/outings/1", auth.CSRFHeader: "token"}, http.StatusNoContent},
+		{"other origin with token", http.MethodPost, []*http.Cookie{session, csrf},
+			map[string]string{"Origin": "https://evil.example", auth.CSRFHeader: "token"}, http.StatusForbidden},
+		{"missing origin", http.MethodPost, []*http.Cookie{session, csrf},
+			map[string]string{auth.CSRFHeader: "token"}, http.StatusForbidden},
+		{"missing header", http.MethodPost, []*http.Cookie{session, csrf},
+			map[string]string{"Origin": allowed}, http.StatusForbidden},
+		{"wrong token", http.MethodPost, []*http.Cookie{session, csrf},
+			map[string]string{"Origin": allowed, auth.CSRFHeader: "other"}, http.StatusForbidden},
+		{"missing cookie", http.MethodPost, []*http.Cookie{session},
+			map[string]string{"Origin": allowed, auth.CSRFHeader: "token"}, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+		})
+	}
+}
+
+func TestCSRFIssuesMissingCookie(t *testing.T) {
+	r := newCSRFRouter()
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		want    bool
+	}{
+		{"session without token", []*http.Cookie{{Name: "access_token", Value: "jwt"}}, true},
+		{"session with token", []*http.Cookie{{Name: "access_token", Value: "jwt"}, {Name: "csrf_token", Value: "token"}}, false},
+		{"no session", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			var issued *http.Cookie
+			for _, cookie := range w.Result().Cookies() {
+				if cookie.Name == "csrf_token" {
+					issued = cookie
+				}
+			}
+			if (issued != nil) != tt.want {
+				t.Fatalf("issued csrf cookie = %v, want %v", issued != nil, tt.want)
+			}
+			if issued == nil {
+				return
+			}
+			if issued.HttpOnly || issued.Value == "" {
+				t.Errorf("csrf cookie = %+v, want a non empty cookie readable by scripts", issued)
+			}
+			if got := w.Header().Get(auth.CSRFHeader); got != issued.Value {
+				t.Errorf("%s header = %q, want the cookie value", auth.CSRFHeader, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+// Errors responds with the error a handler or middleware aborted with, in
+// the shape of utils.Error. Server errors are logged, as are client errors
+// with a cause. It must run before the middleware whose errors it handles,
+// and hands the request's logger to them through utils.Logger.
+func Errors(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		logger := logger.With(
+			zap.String("method", c.Request.Method),
+			zap.String("route", c.FullPath()),
+		)
+		utils.SetLogger(c, logger)
+
+		c.Next()
+
+		last := c.Errors.Last()
+		if last == nil {
+			return
+		}
+		apiErr := utils.AsError(last.Err)
+		fields := []zap.Field{
+			zap.Int("status", apiErr.Status),
+			zap.Error(apiErr.Err),
+		}
+		switch {
+		case apiErr.Status >= http.StatusInternalServerError:
+			logger.Error(apiErr.Message, fields...)
+		case apiErr.Err != nil:
+			logger.Info(apiErr.Message, fields...)
+		}
+		if c.Writer.Written() {
+			return
+		}
+		c.JSON(apiErr.Status, apiErr.Body())
+	}
+}
+
+// Recovery turns a panic into a 500 with the usual error body. gin logs the
+// panic and its stack.
+func Recovery() gin.HandlerFunc {
+	return gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		apiErr := utils.NewError(http.StatusInternalServerError, utils.CodeInternal, "internal server error")
+		c.AbortWithStatusJSON(apiErr.Status, apiErr.Body())
+	})
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sharithg/civet/internal/repository"
+	"github.com/sharithg/civet/internal/token"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+)
+
+// GuestAuth is CheckAuth for guest tokens. The invite behind the token must
+// still be active, and routes with an :outing_id, :receipt_id or :id
+// (receipt) parameter only match the guest's own outing.
+func GuestAuth(ctx *context.Context, r *repository.Queries, tokens *token.Service) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || tokenString == "" {
+			utils.Unauthorized(c, "Authorization header is missing")
+			return
+		}
+
+		claims, err := tokens.Verify(tokenString, token.TypeGuest)
+		if err != nil {
+			utils.Unauthorized(c, "Invalid or expired token")
+			return
+		}
+
+		inviteID, err := uuid.Parse(claims.ID)
+		if err != nil {
+			utils.Unauthorized(c, "Invalid token claims")
+			return
+		}
+		invite, err := r.GetActiveGuestInvite(*ctx, inviteID)
+		if err != nil {
+			utils.Unauthorized(c, "Invite revoked or expired")
+			return
+		}
+
+		if !guestOwnsParams(ctx, r, c, invite.OutingID) {
+			utils.NotFound(c, "not found")
+			return
+		}
+
+		c.Set("guest", auth.Guest{
+			InviteID: inviteID,
+			FriendID: invite.FriendID,
+			OutingID: invite.OutingID,
+		})
+
+		c.Next()
+	}
+}
+
+func guestOwnsParams(ctx *context.Context, r *repository.Queries, c *gin.Context, outingID uuid.UUID) bool {
+	if param := c.Param("outing_id"); param != "" {
+		id, err := uuid.Parse(param)
+		if err != nil || id != outingID {
+			return false
+		}
+	}
+
+	for _, key := range []string{"receipt_id", "id"} {
+		param := c.Param(key)
+		if param == "" {
+			continue
+		}
+		receiptID, err := uuid.Parse(param)
+		if err != nil {
+			return false
+		}
+		receiptOuting, err := r.GetOutingForReceipt(*ctx, receiptID)
+		if err != nil || receiptOuting != outingID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sharithg/civet/internal/ratelimit"
+	"github.com/sharithg/civet/pkg/api/auth"
+	"github.com/sharithg/civet/pkg/api/utils"
+	"go.uber.org/zap"
+)
+
+// RateLimit gives every user and every client IP its own bucket for the
+// routes it guards, named by name. A limiter outage lets requests through
+// rather than taking the routes down with it.
+func RateLimit(ctx *context.Context, limiter ratelimit.Limiter, name string, perUser, perIP ratelimit.Rate) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := map[string]ratelimit.Rate{
+			fmt.Sprintf("%s:ip:%s", name, c.ClientIP()): perIP,
+		}
+		if user, err := auth.GetUser(c); err == nil {
+			keys[fmt.Sprintf("%s:user:%s", name, user.ID)] = perUser
+		}
+
+		remaining := math.MaxInt
+		for key, rate := range keys {
+			result, err := limiter.Allow(*ctx, key, rate)
+			if err != nil {
+				utils.Logger(c).Warn("rate limiter unavailable", zap.String("key", key), zap.Error(err))
+				continue
+			}
+			if !result.Allowed {
+				utils.RateLimited(c, result.RetryAfter)
+				return
+			}
+			remaining = min(remaining, result.Remaining)
+		}
+
+		if remaining != math.MaxInt {
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		}
+		c.Next()
+	}
+}
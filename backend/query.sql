@@ -1,24 +1,47 @@
 -- name: CreateNewOuting :one
-INSERT INTO outings (name, user_id, status)
-VALUES ($1, $2, $3)
+INSERT INTO outings (name, user_id, status, timezone, date, location)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING id;
 
 -- name: GetReceiptsForOuting :many
 SELECT r.restaurant,
     COUNT(oi.id) AS order_count,
     r.total,
-    r.id
+    r.id,
+    r.created_at
 FROM receipts r
     JOIN order_items oi ON r.id = oi.receipt_id
+    AND oi.parent_item_id IS NULL
     JOIN receipt_images ri ON r.receipt_image_id = ri.id
-WHERE ri.outing_id = $1
-GROUP BY r.id;
+WHERE ri.outing_id = sqlc.arg(outing_id)
+    AND r.deleted_at IS NULL
+    AND (
+        sqlc.narg(date_from)::date IS NULL
+        OR COALESCE(r.opened, r.created_at)::date >= sqlc.narg(date_from)::date
+    )
+    AND (
+        sqlc.narg(date_to)::date IS NULL
+        OR COALESCE(r.opened, r.created_at)::date <= sqlc.narg(date_to)::date
+    )
+    AND (
+        sqlc.narg(cursor_id)::uuid IS NULL
+        OR (r.created_at, r.id) < (
+            sqlc.narg(cursor_time)::timestamp,
+            sqlc.narg(cursor_id)::uuid
+        )
+    )
+GROUP BY r.id
+ORDER BY r.created_at DESC,
+    r.id DESC
+LIMIT sqlc.arg(page_limit);
 
 -- name: GetOutings :many
 SELECT o.id,
     o.name,
     o.created_at,
     o.status,
+    o.date,
+    o.location,
     COALESCE(f.friends, '[]') AS friends,
     COALESCE(r.total_receipts, 0) AS total_receipts
 FROM outings o
@@ -30,8 +53,96 @@ FROM outings o
     LEFT JOIN LATERAL (
         SELECT COUNT(DISTINCT ri.id) AS total_receipts
         FROM receipt_images ri
+            JOIN receipts rc ON rc.receipt_image_id = ri.id
         WHERE ri.outing_id = o.id
-    ) r ON true;
+            AND rc.deleted_at IS NULL
+    ) r ON true
+WHERE o.deleted_at IS NULL
+    AND (
+        o.user_id = sqlc.arg(user_id)
+        OR EXISTS (
+            SELECT 1
+            FROM friends m
+            WHERE m.outing_id = o.id
+                AND m.user_id = sqlc.arg(user_id)
+        )
+    )
+    AND (
+        cardinality(sqlc.arg(statuses)::text []) = 0
+        OR o.status = ANY(sqlc.arg(statuses)::text [])
+    )
+    AND (
+        sqlc.narg(date_from)::date IS NULL
+        OR COALESCE(o.date, o.created_at::date) >= sqlc.narg(date_from)::date
+    )
+    AND (
+        sqlc.narg(date_to)::date IS NULL
+        OR COALESCE(o.date, o.created_at::date) <= sqlc.narg(date_to)::date
+    )
+    AND (
+        sqlc.narg(cursor_id)::uuid IS NULL
+        OR (
+            sqlc.arg(sort)::text = 'name'
+            AND NOT sqlc.arg(descending)::bool
+            AND (o.name, o.id) > (sqlc.arg(cursor_name)::text, sqlc.narg(cursor_id)::uuid)
+        )
+        OR (
+            sqlc.arg(sort)::text = 'name'
+            AND sqlc.arg(descending)::bool
+            AND (o.name, o.id) < (sqlc.arg(cursor_name)::text, sqlc.narg(cursor_id)::uuid)
+        )
+        OR (
+            sqlc.arg(sort)::text = 'date'
+            AND NOT sqlc.arg(descending)::bool
+            AND (COALESCE(o.date, 'infinity'::date), o.id) > (sqlc.narg(cursor_date)::date, sqlc.narg(cursor_id)::uuid)
+        )
+        OR (
+            sqlc.arg(sort)::text = 'date'
+            AND sqlc.arg(descending)::bool
+            AND (COALESCE(o.date, '-infinity'::date), o.id) < (sqlc.narg(cursor_date)::date, sqlc.narg(cursor_id)::uuid)
+        )
+        OR (
+            sqlc.arg(sort)::text = 'created_at'
+            AND NOT sqlc.arg(descending)::bool
+            AND (o.created_at, o.id) > (sqlc.narg(cursor_time)::timestamptz, sqlc.narg(cursor_id)::uuid)
+        )
+        OR (
+            sqlc.arg(sort)::text = 'created_at'
+            AND sqlc.arg(descending)::bool
+            AND (o.created_at, o.id) < (sqlc.narg(cursor_time)::timestamptz, sqlc.narg(cursor_id)::uuid)
+        )
+    )
+ORDER BY CASE
+        WHEN sqlc.arg(sort)::text = 'name'
+        AND NOT sqlc.arg(descending)::bool THEN o.name
+    END ASC,
+    CASE
+        WHEN sqlc.arg(sort)::text = 'name'
+        AND sqlc.arg(descending)::bool THEN o.name
+    END DESC,
+    CASE
+        WHEN sqlc.arg(sort)::text = 'date'
+        AND NOT sqlc.arg(descending)::bool THEN COALESCE(o.date, 'infinity'::date)
+    END ASC,
+    CASE
+        WHEN sqlc.arg(sort)::text = 'date'
+        AND sqlc.arg(descending)::bool THEN COALESCE(o.date, '-infinity'::date)
+    END DESC,
+    CASE
+        WHEN sqlc.arg(sort)::text = 'created_at'
+        AND NOT sqlc.arg(descending)::bool THEN o.created_at
+    END ASC,
+    CASE
+        WHEN sqlc.arg(sort)::text = 'created_at'
+        AND sqlc.arg(descending)::bool THEN o.created_at
+    END DESC,
+    CASE
+        WHEN NOT sqlc.arg(descending)::bool THEN o.id
+    END ASC,
+    CASE
+        WHEN sqlc.arg(descending)::bool THEN o.id
+    END DESC
+LIMIT sqlc.arg(page_limit);
 
 ;
 
@@ -42,9 +153,12 @@ INSERT INTO receipt_images (
         key,
         raw_text,
         file_name,
-        outing_id
+        outing_id,
+        phash,
+        thumbnail_key,
+        medium_key
     )
-VALUES ($1, $2, $3, $4, $5, $6)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 RETURNING id;
 
 -- name: InsertReceipt :one
@@ -60,7 +174,14 @@ INSERT INTO receipts (
         subtotal,
         sales_tax,
         total,
-        copy
+        copy,
+        payment_method,
+        payment_amount_paid,
+        payment_tip,
+        payment_card_last_four,
+        opened_raw,
+        prompt_version,
+        schema_version
     )
 VALUES (
         $1,
@@ -74,44 +195,46 @@ VALUES (
         $9,
         $10,
         $11,
-        $12
+        $12,
+        $13,
+        $14,
+        $15,
+        $16,
+        $17,
+        $18,
+        $19
     )
 RETURNING id;
 
--- name: InsertOrderItem :exec
-INSERT INTO order_items (receipt_id, name, price, quantity)
+-- name: InsertOrderItem :one
+INSERT INTO order_items (
+        receipt_id,
+        name,
+        price,
+        quantity,
+        taxable,
+        parent_item_id
+    )
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id;
+
+-- name: InsertDiscount :exec
+INSERT INTO discounts (receipt_id, order_item_id, name, amount)
 VALUES ($1, $2, $3, $4);
 
 -- name: InsertOtherFee :exec
-INSERT INTO other_fees (receipt_id, name, price)
-VALUES ($1, $2, $3);
+INSERT INTO other_fees (receipt_id, name, price, kind, taxable)
+VALUES ($1, $2, $3, $4, $5);
 
 -- name: GetReceiptByHash :one
-SELECT ri.id AS receipt_image_id,
-    ri.hash,
-    ri.bucket,
-    ri.key,
-    ri.raw_text,
-    ri.file_name,
-    ri.outing_id,
-    COALESCE(oi.items, '[]') AS items,
-    COALESCE(of.fees, '[]') AS fees
-FROM receipt_images ri
-    JOIN receipts r ON ri.id = r.receipt_image_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(oi.*) AS items
-        FROM order_items oi
-        GROUP BY receipt_id
-    ) oi ON r.id = oi.receipt_id
-    LEFT JOIN (
-        SELECT receipt_id,
-            json_agg(of.*) AS fees
-        FROM other_fees of
-        GROUP BY receipt_id
-    ) of ON r.id = of.receipt_id
-WHERE ri.hash = $1
-LIMIT 1;
+select r.id as receipt_id,
+    ri.id as receipt_image_id
+from receipt_images ri
+    join receipts r on ri.id = r.receipt_image_id
+where ri.hash = $1
+    and ri.outing_id = $2
+    and r.deleted_at is null
+limit 1;
 
 -- name: CreateUser :one
 INSERT INTO users (sub, email, picture, email_verified)
@@ -139,19 +262,27 @@ SELECT r.id,
     r.restaurant,
     r.address,
     r.opened,
+    r.opened_raw,
     r.order_number,
     r.order_type,
     r.payment_tip,
     r.payment_amount_paid,
+    r.payment_method,
+    r.payment_card_last_four,
+    r.tip_percentage_override,
     r.table_number,
     r.copy,
     r.server,
     r.sales_tax,
     ri.bucket,
     ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.original_deleted_at,
     COALESCE(oi.items, '[]') AS items,
     COALESCE(of.fees, '[]') AS fees,
-    COALESCE(spl.splits, '[]') AS splits
+    COALESCE(spl.splits, '[]') AS splits,
+    COALESCE(dis.discounts, '[]') AS discounts
 FROM receipt_images ri
     JOIN receipts r ON ri.id = r.receipt_image_id
     LEFT JOIN (
@@ -181,7 +312,14 @@ FROM receipt_images ri
         FROM splits sp
         GROUP BY receipt_id
     ) spl ON r.id = spl.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(d.*) AS discounts
+        FROM discounts d
+        GROUP BY receipt_id
+    ) dis ON r.id = dis.receipt_id
 WHERE r.id = $1
+    AND r.deleted_at IS NULL
 LIMIT 1;
 
 -- name: CreateOrGetFriend :one
@@ -226,7 +364,17 @@ from friends fr
     join outings o on fr.outing_id = o.id
     join receipt_images ri on o.id = ri.outing_id
     join receipts r on r.receipt_image_id = ri.id
-where r.id = $1;
+where r.id = sqlc.arg(receipt_id)
+    and (
+        sqlc.narg(cursor_id)::uuid is null
+        or (coalesce(fr.name, ''), fr.id) > (
+            sqlc.arg(cursor_name)::text,
+            sqlc.narg(cursor_id)::uuid
+        )
+    )
+order by coalesce(fr.name, ''),
+    fr.id
+limit sqlc.arg(page_limit);
 
 -- name: GetOutingForReceipt :one
 select o.id
@@ -235,6 +383,30 @@ from outings o
     join receipts r on ri.id = r.receipt_image_id
 where r.id = $1;
 
+-- name: GetOutingOwner :one
+select user_id
+from outings
+where id = $1;
+
+-- name: CountReceiptItems :one
+select count(*)
+from order_items
+where receipt_id = $1
+    and parent_item_id is null
+    and id = any(sqlc.arg(ids)::uuid []);
+
+-- name: GetOutingTimezone :one
+select coalesce(nullif(o.timezone, ''), nullif(u.timezone, ''), '')::text as timezone
+from outings o
+    join users u on o.user_id = u.id
+where o.id = $1;
+
+-- name: GetOutingOwnerLocale :one
+select u.locale
+from outings o
+    join users u on o.user_id = u.id
+where o.id = $1;
+
 -- name: GetReceiptImage :one
 select ri.bucket,
     ri.key
@@ -243,49 +415,1083 @@ from receipt_images ri
 where r.id = $1
 limit 1;
 
--- name: GetCachedCloudVisionResponse :one
+-- name: GetCacheEntry :one
 select response
-from cloud_vision_cache
-where image_hash = $1
+from extraction_cache
+where stage = $1
+    and provider = $2
+    and model = $3
+    and prompt_version = $4
+    and input_hash = $5
+    and (
+        expires_at is null
+        or expires_at > now()
+    )
 limit 1;
 
--- name: GetCachedGenAiResponse :one
-select response
-from genai_cache
-where image_hash = $1
+-- name: UpsertCacheEntry :exec
+insert into extraction_cache (
+        stage,
+        provider,
+        model,
+        prompt_version,
+        input_hash,
+        response,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5, $6, $7) on conflict (stage, provider, model, prompt_version, input_hash) do
+update
+set response = excluded.response,
+    expires_at = excluded.expires_at,
+    updated_at = now();
+
+-- name: DeleteExpiredCacheEntries :execrows
+delete from extraction_cache
+where expires_at is not null
+    and expires_at <= now();
+
+
+-- name: GetFriendsForOuting :many
+WITH item_totals AS (
+    -- effective unit price of a top-level item: its own price plus modifiers, less item discounts
+    SELECT it.id,
+        it.receipt_id,
+        it.taxable,
+        (
+            it.price * it.quantity + COALESCE(mods.amount, 0) - COALESCE(disc.amount, 0)
+        ) / NULLIF(it.quantity, 0) AS unit_price
+    FROM order_items it
+        LEFT JOIN LATERAL (
+            SELECT SUM(m.price * m.quantity) AS amount
+            FROM order_items m
+            WHERE m.parent_item_id = it.id
+        ) mods ON true
+        LEFT JOIN LATERAL (
+            SELECT SUM(d.amount) AS amount
+            FROM discounts d
+            WHERE d.order_item_id = it.id
+        ) disc ON true
+    WHERE it.parent_item_id IS NULL
+),
+friend_items AS (
+    SELECT sp.friend_id,
+        it.receipt_id,
+        SUM(it.unit_price * sp.quantity) AS subtotal,
+        SUM(
+            CASE
+                WHEN it.taxable THEN it.unit_price * sp.quantity
+                ELSE 0
+            END
+        ) AS taxable_subtotal
+    FROM splits sp
+        JOIN item_totals it ON it.id = sp.order_item_id
+    GROUP BY sp.friend_id,
+        it.receipt_id
+),
+receipt_totals AS (
+    SELECT fi.receipt_id,
+        SUM(fi.subtotal) AS subtotal,
+        SUM(fi.taxable_subtotal) AS taxable_subtotal,
+        COALESCE(MAX(bd.amount), 0) AS discount,
+        COALESCE(MAX(fe.amount), 0) AS fees,
+        COALESCE(MAX(fe.taxable_amount), 0) AS taxable_fees
+    FROM friend_items fi
+        LEFT JOIN LATERAL (
+            SELECT SUM(d.amount) AS amount
+            FROM discounts d
+            WHERE d.receipt_id = fi.receipt_id
+                AND d.order_item_id IS NULL
+        ) bd ON true
+        LEFT JOIN LATERAL (
+            SELECT SUM(o.price) AS amount,
+                SUM(o.price) FILTER (
+                    WHERE o.taxable
+                ) AS taxable_amount
+            FROM other_fees o
+            WHERE o.receipt_id = fi.receipt_id
+        ) fe ON true
+    GROUP BY fi.receipt_id
+)
+-- the friend's share of the bill is worked out by receipt.Bill.Share
+SELECT fr.id AS friend_id,
+    fi.receipt_id,
+    fr.name,
+    COALESCE(fi.subtotal, 0)::float AS subtotal,
+    COALESCE(fi.taxable_subtotal, 0)::float AS taxable_subtotal,
+    COALESCE(rt.subtotal, 0)::float AS receipt_subtotal,
+    COALESCE(rt.taxable_subtotal, 0)::float AS receipt_taxable_subtotal,
+    rt.discount::float AS discount,
+    rt.fees::float AS fees,
+    rt.taxable_fees::float AS taxable_fees,
+    COALESCE(r.sales_tax, 0)::float AS sales_tax,
+    COALESCE(
+        r.subtotal * r.tip_percentage_override / 100,
+        r.payment_tip,
+        0
+    )::float AS tip
+FROM friend_items fi
+    JOIN receipt_totals rt ON rt.receipt_id = fi.receipt_id
+    JOIN friends fr ON fi.friend_id = fr.id
+    JOIN receipts r ON fi.receipt_id = r.id
+    JOIN receipt_images ri ON r.receipt_image_id = ri.id
+WHERE ri.outing_id = sqlc.arg(outing_id)
+    AND r.deleted_at IS NULL
+    AND (
+        sqlc.narg(cursor_friend_id)::uuid IS NULL
+        OR (COALESCE(fr.name, ''), fr.id, fi.receipt_id) > (
+            sqlc.arg(cursor_name)::text,
+            sqlc.narg(cursor_friend_id)::uuid,
+            sqlc.narg(cursor_receipt_id)::uuid
+        )
+    )
+ORDER BY COALESCE(fr.name, ''),
+    fr.id,
+    fi.receipt_id
+LIMIT sqlc.arg(page_limit);
+
+-- name: UpdateReceiptTipPercentage :exec
+update receipts
+set tip_percentage_override = $2
+where id = $1;
+
+-- name: GetEmailForwardingAddress :one
+select *
+from email_forwarding_addresses
+where user_id = $1
+limit 1;
+
+-- name: GetEmailForwardingAddressByToken :one
+select *
+from email_forwarding_addresses
+where token = $1
+limit 1;
+
+-- name: UpsertEmailForwardingAddress :one
+insert into email_forwarding_addresses (user_id, token, outing_id)
+values ($1, $2, $3) on conflict (user_id) do
+update
+set outing_id = excluded.outing_id,
+    updated_at = now()
+returning *;
+
+-- name: DeleteDiscounts :exec
+delete from discounts
+where receipt_id = $1;
+
+-- name: DeleteOrderItems :exec
+delete from order_items
+where receipt_id = $1;
+
+-- name: DeleteOtherFees :exec
+delete from other_fees
+where receipt_id = $1;
+
+-- name: GetReceiptForReprocess :one
+SELECT r.id,
+    r.restaurant,
+    r.address,
+    r.opened_raw,
+    r.order_number,
+    r.order_type,
+    r.table_number,
+    r.server,
+    r.subtotal,
+    r.sales_tax,
+    r.total,
+    r.payment_method,
+    r.payment_amount_paid,
+    r.payment_tip,
+    r.payment_card_last_four,
+    r.copy,
+    r.prompt_version,
+    r.schema_version,
+    ri.hash,
+    ri.raw_text,
+    ri.outing_id,
+    COALESCE(oi.items, '[]') AS items,
+    COALESCE(of.fees, '[]') AS fees,
+    COALESCE(dis.discounts, '[]') AS discounts,
+    sc.split_count
+FROM receipts r
+    JOIN receipt_images ri ON ri.id = r.receipt_image_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(oi.*) AS items
+        FROM order_items oi
+        GROUP BY receipt_id
+    ) oi ON r.id = oi.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(of.*) AS fees
+        FROM other_fees of
+        GROUP BY receipt_id
+    ) of ON r.id = of.receipt_id
+    LEFT JOIN (
+        SELECT receipt_id,
+            json_agg(d.*) AS discounts
+        FROM discounts d
+        GROUP BY receipt_id
+    ) dis ON r.id = dis.receipt_id
+    LEFT JOIN LATERAL (
+        SELECT COUNT(*) AS split_count
+        FROM splits sp
+        WHERE sp.receipt_id = r.id
+    ) sc ON true
+WHERE r.id = $1
+LIMIT 1;
+
+-- name: ListOutdatedReceipts :many
+select r.id,
+    r.prompt_version,
+    r.schema_version
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.deleted_at is null
+    and o.status in ('draft', 'active')
+    and (
+        r.prompt_version <> $1
+        or r.schema_version <> $2
+    )
+order by r.created_at
+limit $3;
+
+-- name: UpdateReceiptExtraction :exec
+update receipts
+set restaurant = $2,
+    address = $3,
+    opened = $4,
+    opened_raw = $5,
+    order_number = $6,
+    order_type = $7,
+    table_number = $8,
+    server = $9,
+    subtotal = $10,
+    sales_tax = $11,
+    total = $12,
+    copy = $13,
+    payment_method = $14,
+    payment_amount_paid = $15,
+    payment_tip = $16,
+    payment_card_last_four = $17,
+    prompt_version = $18,
+    schema_version = $19
+where id = $1;
+
+-- name: ListOutingReceiptFingerprints :many
+select r.id,
+    r.restaurant,
+    r.order_number,
+    r.total,
+    r.opened,
+    ri.phash
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+where ri.outing_id = $1
+    and r.deleted_at is null;
+
+-- name: InsertReceiptDuplicate :exec
+insert into receipt_duplicates (receipt_id, candidate_id, reasons)
+values ($1, $2, $3) on conflict (receipt_id, candidate_id) do nothing;
+
+-- name: ListReceiptDuplicates :many
+select d.candidate_id,
+    d.reasons,
+    d.status,
+    r.restaurant,
+    r.order_number,
+    r.total,
+    r.opened
+from receipt_duplicates d
+    join receipts r on r.id = d.candidate_id
+where d.receipt_id = $1
+    and d.status = 'pending'
+    and r.deleted_at is null
+order by d.created_at;
+
+-- name: UpdateReceiptDuplicateStatus :execrows
+update receipt_duplicates
+set status = $3,
+    updated_at = now()
+where receipt_id = $1
+    and candidate_id = $2;
+
+-- name: GetOwnedReceiptOutingStatus :one
+select o.status
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.id = sqlc.arg(receipt_id)
+    and o.user_id = sqlc.arg(user_id)
+    and o.deleted_at is null;
+
+-- name: SoftDeleteReceipt :one
+update receipts r
+set deleted_at = now()
+from receipt_images ri
+    join outings o on o.id = ri.outing_id
+where r.id = sqlc.arg(id)
+    and ri.id = r.receipt_image_id
+    and o.user_id = sqlc.arg(user_id)
+    and r.deleted_at is null
+returning r.deleted_at;
+
+-- name: RestoreReceipt :execrows
+update receipts r
+set deleted_at = null
+from receipt_images ri
+    join outings o on o.id = ri.outing_id
+where r.id = sqlc.arg(id)
+    and ri.id = r.receipt_image_id
+    and o.user_id = sqlc.arg(user_id)
+    and r.deleted_at > sqlc.arg(deleted_at);
+
+-- name: SoftDeleteOuting :one
+update outings
+set deleted_at = now(),
+    updated_at = now()
+where id = $1
+    and user_id = $2
+    and deleted_at is null
+returning deleted_at;
+
+-- name: RestoreOuting :execrows
+update outings
+set deleted_at = null,
+    updated_at = now()
+where id = $1
+    and user_id = $2
+    and deleted_at > $3;
+
+-- name: ListPurgeableReceiptImages :many
+select ri.id,
+    ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.hash
+from receipt_images ri
+    join receipts r on r.receipt_image_id = ri.id
+    join outings o on o.id = ri.outing_id
+where r.deleted_at < $1
+    or o.deleted_at < $1
+limit $2;
+
+-- name: DeleteReceiptImage :exec
+delete from receipt_images
+where id = $1;
+
+-- name: ListPurgeableOutings :many
+select id
+from outings
+where deleted_at < $1;
+
+-- name: DeleteOuting :exec
+delete from outings
+where id = $1;
+
+-- name: CountReceiptImagesByHash :one
+select count(*)
+from receipt_images
+where hash = $1;
+
+-- name: DeleteCacheEntriesForInput :execrows
+delete from extraction_cache
+where input_hash = $1;
+
+-- name: CountOutings :one
+select count(*)
+from outings o
+where o.deleted_at is null
+    and (
+        o.user_id = sqlc.arg(user_id)
+        or exists (
+            select 1
+            from friends m
+            where m.outing_id = o.id
+                and m.user_id = sqlc.arg(user_id)
+        )
+    )
+    and (
+        cardinality(sqlc.arg(statuses)::text []) = 0
+        or o.status = any(sqlc.arg(statuses)::text [])
+    )
+    and (
+        sqlc.narg(date_from)::date is null
+        or coalesce(o.date, o.created_at::date) >= sqlc.narg(date_from)::date
+    )
+    and (
+        sqlc.narg(date_to)::date is null
+        or coalesce(o.date, o.created_at::date) <= sqlc.narg(date_to)::date
+    );
+
+-- name: GetOuting :one
+select id,
+    name,
+    status,
+    created_at,
+    updated_at,
+    user_id,
+    timezone,
+    deleted_at,
+    date,
+    location
+from outings
+where id = $1
+    and deleted_at is null;
+
+-- name: UpdateOutingDetails :exec
+update outings
+set name = $2,
+    date = $3,
+    location = $4,
+    updated_at = now()
+where id = $1;
+
+-- name: UpdateOutingStatus :execrows
+update outings
+set status = sqlc.arg(status),
+    updated_at = now()
+where id = sqlc.arg(id)
+    and status = sqlc.arg(from_status);
+
+-- name: GetReceiptOutingStatus :one
+select o.status
+from outings o
+    join receipt_images ri on o.id = ri.outing_id
+    join receipts r on ri.id = r.receipt_image_id
+where r.id = $1;
+
+-- name: GetReceiptReprocessState :one
+select o.status,
+    r.deleted_at is not null as deleted
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.id = $1
+for update of r;
+
+-- name: SearchReceipts :many
+select r.id,
+    r.restaurant,
+    r.total,
+    r.opened,
+    r.created_at,
+    o.id as outing_id,
+    o.name as outing_name,
+    ts_headline(
+        'english',
+        ri.raw_text,
+        query,
+        'MaxFragments=1, MinWords=3, MaxWords=12'
+    )::text as snippet,
+    coalesce(items.names, '{}')::text [] as matched_items
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+    cross join websearch_to_tsquery('english', sqlc.arg(query)::text) query
+    left join lateral (
+        select array_agg(
+                oi.name
+                order by oi.name
+            ) as names
+        from order_items oi
+        where oi.receipt_id = r.id
+            and to_tsvector('english', oi.name) @@ query
+    ) items on true
+where r.deleted_at is null
+    and o.deleted_at is null
+    and (
+        o.user_id = sqlc.arg(user_id)
+        or exists (
+            select 1
+            from friends f
+            where f.outing_id = o.id
+                and f.user_id = sqlc.arg(user_id)
+        )
+    )
+    and (
+        to_tsvector('english', ri.raw_text) @@ query
+        or to_tsvector('english', r.restaurant) @@ query
+        or items.names is not null
+    )
+    and (
+        sqlc.narg(outing_id)::uuid is null
+        or o.id = sqlc.narg(outing_id)::uuid
+    )
+    and (
+        cardinality(sqlc.arg(statuses)::text []) = 0
+        or o.status = any(sqlc.arg(statuses)::text [])
+    )
+    and (
+        sqlc.narg(date_from)::date is null
+        or coalesce(r.opened, r.created_at)::date >= sqlc.narg(date_from)::date
+    )
+    and (
+        sqlc.narg(date_to)::date is null
+        or coalesce(r.opened, r.created_at)::date <= sqlc.narg(date_to)::date
+    )
+    and (
+        sqlc.narg(cursor_id)::uuid is null
+        or (r.created_at, r.id) < (
+            sqlc.narg(cursor_time)::timestamp,
+            sqlc.narg(cursor_id)::uuid
+        )
+    )
+order by r.created_at desc,
+    r.id desc
+limit sqlc.arg(page_limit);
+
+-- name: GetReceiptImageForUser :one
+select ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.original_deleted_at,
+    ri.hash
+from receipts r
+    join receipt_images ri on ri.id = r.receipt_image_id
+    join outings o on o.id = ri.outing_id
+where r.id = sqlc.arg(receipt_id)
+    and r.deleted_at is null
+    and o.deleted_at is null
+    and (
+        o.user_id = sqlc.arg(user_id)
+        or exists (
+            select 1
+            from friends f
+            where f.outing_id = o.id
+                and f.user_id = sqlc.arg(user_id)
+        )
+    )
+limit 1;
+
+-- name: ListExpiredOriginals :many
+select ri.hash,
+    ri.bucket,
+    ri.key,
+    coalesce(max(ri.medium_key), '')::varchar as medium_key
+from receipt_images ri
+    join receipts r on r.receipt_image_id = ri.id
+where ri.original_deleted_at is null
+group by ri.hash,
+    ri.bucket,
+    ri.key
+having max(r.created_at) < $1
+limit $2;
+
+-- name: MarkOriginalDeleted :exec
+update receipt_images
+set original_deleted_at = now(),
+    medium_key = null
+where hash = $1
+    and original_deleted_at is null;
+
+-- name: ListUnredactedReceiptImages :many
+select id,
+    hash,
+    raw_text
+from receipt_images
+where not raw_text_redacted
+limit $1;
+
+-- name: SetRedactedRawText :exec
+update receipt_images
+set raw_text = $2,
+    raw_text_redacted = true
+where id = $1;
+
+-- name: CreateSession :one
+insert into sessions (
+        user_id,
+        refresh_token_id,
+        platform,
+        user_agent,
+        ip_address,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5, $6)
+returning id;
+
+-- name: RotateSession :execrows
+update sessions
+set refresh_token_id = sqlc.arg(new_refresh_token_id),
+    expires_at = sqlc.arg(expires_at),
+    last_used_at = now()
+where id = sqlc.arg(id)
+    and refresh_token_id = sqlc.arg(refresh_token_id)
+    and revoked_at is null
+    and expires_at > now();
+
+-- name: RevokeReusedSession :execrows
+update sessions
+set revoked_at = now(),
+    revoked_reason = 'reuse'
+where id = $1
+    and refresh_token_id <> $2
+    and revoked_at is null
+    and expires_at > now();
+
+-- name: RevokeSession :execrows
+update sessions
+set revoked_at = now(),
+    revoked_reason = $3
+where id = $1
+    and user_id = $2
+    and revoked_at is null;
+
+-- name: RevokeOtherSessions :execrows
+update sessions
+set revoked_at = now(),
+    revoked_reason = $3
+where user_id = $1
+    and id <> $2
+    and revoked_at is null;
+
+-- name: ListActiveSessions :many
+select id,
+    platform,
+    user_agent,
+    ip_address,
+    created_at,
+    last_used_at,
+    expires_at
+from sessions
+where user_id = $1
+    and revoked_at is null
+    and expires_at > now()
+order by last_used_at desc;
+
+-- name: IsSessionActive :one
+select exists (
+        select 1
+        from sessions
+        where id = $1
+            and revoked_at is null
+            and expires_at > now()
+    );
+
+-- name: ListSigningKeys :many
+select kid,
+    algorithm,
+    private_key,
+    public_key,
+    created_at,
+    activates_at,
+    retires_at
+from signing_keys
+where retires_at > now()
+order by activates_at;
+
+-- name: InsertSigningKey :exec
+insert into signing_keys (
+        kid,
+        algorithm,
+        private_key,
+        public_key,
+        activates_at,
+        retires_at
+    )
+values ($1, $2, $3, $4, $5, $6);
+
+-- name: DeleteRetiredSigningKeys :execrows
+delete from signing_keys
+where retires_at <= now();
+
+-- name: GetUser :one
+select id,
+    sub,
+    email,
+    picture,
+    name
+from users
+where id = $1;
+
+-- name: GetUserByVerifiedEmail :one
+select id
+from users
+where lower(email) = lower($1)
+    and email_verified
+order by created_at
 limit 1;
 
--- name: InsertCachedCloudVisionResponse :one
-insert into cloud_vision_cache (image_hash, response)
-values ($1, $2)
+-- name: UpdateUserPicture :exec
+update users
+set picture = $2,
+    updated_at = now()
+where id = $1
+    and avatar_key = '';
+
+-- name: GetUserIdentity :one
+select user_id
+from user_identities
+where provider = $1
+    and subject = $2;
+
+-- name: CreateUserIdentity :one
+insert into user_identities (user_id, provider, subject, email)
+values ($1, $2, $3, $4)
 returning id;
 
--- name: InsertCachedGenAiResponse :one
-insert into genai_cache (image_hash, response)
-values ($1, $2)
+-- name: TouchUserIdentity :exec
+update user_identities
+set last_used_at = now(),
+    email = case
+        when sqlc.arg(email)::text = '' then email
+        else sqlc.arg(email)::text
+    end
+where provider = sqlc.arg(provider)
+    and subject = sqlc.arg(subject);
+
+-- name: ListUserIdentities :many
+select id,
+    provider,
+    email,
+    created_at,
+    last_used_at
+from user_identities
+where user_id = $1
+order by created_at;
+
+-- name: DeleteUserIdentity :execrows
+delete from user_identities
+where id = $1
+    and user_id = $2;
+
+-- name: CountUserLoginMethods :one
+select (
+        select count(*)
+        from user_identities i
+        where i.user_id = $1
+    ) + (
+        select count(*)
+        from webauthn_credentials w
+        where w.user_id = $1
+    ) as count;
+
+-- name: CreateAuthChallenge :exec
+insert into auth_challenges (
+        token_hash,
+        kind,
+        email,
+        user_id,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5);
+
+-- name: ConsumeAuthChallenge :one
+delete from auth_challenges
+where token_hash = $1
+    and kind = $2
+    and expires_at > now()
+returning email,
+    user_id;
+
+-- name: DeleteExpiredAuthChallenges :execrows
+delete from auth_challenges
+where expires_at <= now();
+
+-- name: CreateWebauthnCredential :exec
+insert into webauthn_credentials (
+        id,
+        user_id,
+        public_key,
+        sign_count,
+        transports,
+        name
+    )
+values ($1, $2, $3, $4, $5, $6);
+
+-- name: GetWebauthnCredential :one
+select id,
+    user_id,
+    public_key,
+    sign_count
+from webauthn_credentials
+where id = $1;
+
+-- name: UpdateWebauthnSignCount :exec
+update webauthn_credentials
+set sign_count = $2,
+    last_used_at = now()
+where id = $1;
+
+-- name: ListWebauthnCredentials :many
+select id,
+    name,
+    transports,
+    created_at,
+    last_used_at
+from webauthn_credentials
+where user_id = $1
+order by created_at;
+
+-- name: DeleteWebauthnCredential :execrows
+delete from webauthn_credentials
+where id = $1
+    and user_id = $2;
+
+-- name: CreateGuestInvite :one
+insert into guest_invites (friend_id, token_hash, created_by, expires_at)
+values ($1, $2, $3, $4)
 returning id;
 
+-- name: GetGuestInviteByToken :one
+select gi.id,
+    gi.friend_id,
+    f.outing_id,
+    gi.expires_at
+from guest_invites gi
+    join friends f on gi.friend_id = f.id
+    join outings o on f.outing_id = o.id
+where gi.token_hash = $1
+    and gi.revoked_at is null
+    and gi.expires_at > now()
+    and o.deleted_at is null;
 
--- name: GetFriendsForOuting :many
-WITH unique_friends_per_receipt AS (
-    SELECT r.id AS receipt_id, COUNT(DISTINCT fr.id) AS friend_count
-    FROM receipts r
-    JOIN order_items it ON r.id = it.receipt_id
-    JOIN splits sp ON it.id = sp.order_item_id
-    JOIN friends fr ON sp.friend_id = fr.id
-    GROUP BY r.id
+-- name: GetActiveGuestInvite :one
+select gi.friend_id,
+    f.outing_id
+from guest_invites gi
+    join friends f on gi.friend_id = f.id
+    join outings o on f.outing_id = o.id
+where gi.id = $1
+    and gi.revoked_at is null
+    and gi.expires_at > now()
+    and o.deleted_at is null;
+
+-- name: RevokeGuestInvites :execrows
+update guest_invites
+set revoked_at = now()
+where friend_id = $1
+    and revoked_at is null;
+
+-- name: GetFriend :one
+select id,
+    name,
+    user_id,
+    outing_id
+from friends
+where id = $1;
+
+-- name: GetOutingFriendForUser :one
+select id
+from friends
+where outing_id = $1
+    and user_id = $2
+limit 1;
+
+-- name: SetFriendUser :exec
+update friends
+set user_id = $2,
+    updated_at = now()
+where id = $1;
+
+-- name: MoveFriendSplits :exec
+update splits
+set friend_id = sqlc.arg(to_friend_id),
+    updated_at = now()
+where friend_id = sqlc.arg(from_friend_id);
+
+-- name: DeleteFriend :exec
+delete from friends
+where id = $1;
+
+-- name: DeleteFriendSplits :exec
+delete from splits
+where receipt_id = $1
+    and friend_id = $2;
+
+-- name: GetReceiptImageForOuting :one
+select ri.bucket,
+    ri.key,
+    ri.thumbnail_key,
+    ri.medium_key,
+    ri.original_deleted_at,
+    ri.hash
+from receipt_images ri
+    join receipts r on ri.id = r.receipt_image_id
+where r.id = $1
+    and ri.outing_id = $2
+    and r.deleted_at is null;
+
+-- name: CreateOAuthState :exec
+insert into oauth_states (
+        state_hash,
+        redirect_uri,
+        client_state,
+        code_challenge,
+        code_challenge_method,
+        provider_verifier,
+        expires_at
+    )
+values ($1, $2, $3, $4, $5, $6, $7);
+
+-- name: AttachOAuthCode :one
+update oauth_states
+set code_hash = $2
+where state_hash = $1
+    and code_hash is null
+    and expires_at > now()
+returning redirect_uri,
+    client_state;
+
+-- name: ConsumeOAuthCode :one
+delete from oauth_states
+where code_hash = $1
+    and expires_at > now()
+returning code_challenge,
+    code_challenge_method,
+    provider_verifier;
+
+-- name: DeleteExpiredOAuthStates :execrows
+delete from oauth_states
+where expires_at <= now();
+
+-- name: SetUserNameIfEmpty :exec
+update users
+set name = $2,
+    updated_at = now()
+where id = $1
+    and name = '';
+
+-- name: GetProfile :one
+select id,
+    email,
+    name,
+    picture,
+    avatar_key,
+    coalesce(timezone, '')::text as timezone,
+    locale,
+    default_currency,
+    default_tip_percentage,
+    venmo_handle,
+    paypal_handle,
+    iban,
+    created_at
+from users
+where id = $1
+    and deleted_at is null;
+
+-- name: UpdateProfile :exec
+update users
+set name = $2,
+    timezone = $3,
+    locale = $4,
+    default_currency = $5,
+    default_tip_percentage = $6,
+    venmo_handle = $7,
+    paypal_handle = $8,
+    iban = $9,
+    updated_at = now()
+where id = $1;
+
+-- name: SetUserAvatar :exec
+update users
+set avatar_key = $2,
+    picture = $3,
+    updated_at = now()
+where id = $1;
+
+-- name: GetUserAvatar :one
+select avatar_key
+from users
+where id = $1
+    and deleted_at is null;
+
+-- name: GetOutingPayee :one
+select u.id,
+    u.name,
+    u.picture,
+    u.venmo_handle,
+    u.paypal_handle,
+    u.iban,
+    u.default_currency
+from outings o
+    join users u on u.id = o.user_id
+where o.id = $1
+    and o.deleted_at is null;
+
+-- name: SoftDeleteUserOutings :execrows
+update outings
+set deleted_at = now(),
+    updated_at = now()
+where user_id = $1
+    and deleted_at is null;
+
+-- name: AnonymizeUserFriends :execrows
+update friends
+set user_id = null,
+    name = $2,
+    updated_at = now()
+where user_id = $1;
+
+-- name: DeleteUserLogins :exec
+with identities as (
+    delete from user_identities
+    where user_id = $1
+),
+credentials as (
+    delete from webauthn_credentials
+    where user_id = $1
+),
+challenges as (
+    delete from auth_challenges
+    where user_id = $1
+),
+invites as (
+    delete from guest_invites
+    where created_by = $1
+),
+forwarding as (
+    delete from email_forwarding_addresses
+    where user_id = $1
 )
-SELECT
-    fr.name,
-    (SUM(it.price * sp.quantity))::float AS subtotal,
-    (r.sales_tax / uf.friend_count)::float AS tax_portion,
-    (SUM(it.price * sp.quantity) + (r.sales_tax / uf.friend_count))::float AS total_owed
-FROM receipts r
-JOIN order_items it ON r.id = it.receipt_id
-JOIN splits sp ON it.id = sp.order_item_id
-JOIN friends fr ON sp.friend_id = fr.id
-JOIN receipt_images ri on r.receipt_image_id = ri.id
-JOIN outings ou on ri.outing_id = ou.id
-JOIN unique_friends_per_receipt uf ON r.id = uf.receipt_id
-WHERE ou.id = $1
-GROUP BY fr.id, fr.name, r.sales_tax, r.id, uf.friend_count;
\ No newline at end of file
+delete from sessions
+where user_id = $1;
+
+-- name: AnonymizeUser :exec
+update users
+set sub = 'deleted:' || id::text,
+    email = 'deleted+' || id::text || '@invalid',
+    email_verified = false,
+    name = '',
+    picture = '',
+    avatar_key = '',
+    timezone = null,
+    locale = '',
+    default_tip_percentage = null,
+    venmo_handle = '',
+    paypal_handle = '',
+    iban = '',
+    deleted_at = now(),
+    updated_at = now()
+where id = $1;
+
+-- name: UseExtraction :one
+insert into extraction_usage (user_id, month, extractions)
+values (
+        sqlc.arg(user_id),
+        date_trunc('month', now() at time zone 'utc')::date,
+        1
+    ) on conflict (user_id, month) do
+update
+set extractions = extraction_usage.extractions + 1,
+    updated_at = now()
+where sqlc.arg(quota)::int = 0
+    or extraction_usage.extractions < sqlc.arg(quota)::int
+returning extractions;
+
+-- name: RefundExtraction :exec
+update extraction_usage
+set extractions = extractions - 1,
+    updated_at = now()
+where user_id = $1
+    and month = date_trunc('month', now() at time zone 'utc')::date
+    and extractions > 0;
+
+-- name: GetExtractionUsage :one
+select coalesce(sum(extractions), 0)::int as extractions
+from extraction_usage
+where user_id = $1
+    and month = date_trunc('month', now() at time zone 'utc')::date;